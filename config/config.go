@@ -1,10 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"github.com/spf13/viper"
 	"golang.org/x/xerrors"
 	"log"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -18,6 +20,162 @@ type GrafanaQueryConfig struct {
 	Mock               int    `mapstructure:"mock"`
 	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
 	Token              string `mapstructure:"token"`
+	// 请求未携带用户 token 时的处理方式：none 不携带 token，由 DCE 拒绝；service 使用上面配置的服务账号 token
+	TokenFallback string `mapstructure:"tokenFallback"`
+}
+
+const (
+	TokenFallbackNone    = "none"
+	TokenFallbackService = "service"
+)
+
+// 认证方式
+const (
+	AuthModeDCE  = "dce"  // 调用 DCE 当前用户接口校验 token
+	AuthModeJWT  = "jwt"  // 使用配置的密钥校验 JWT
+	AuthModeNone = "none" // 不校验，仅用于本地开发，所有请求视为管理员
+)
+
+type AuthConfig struct {
+	Mode string `mapstructure:"mode"`
+	// jwt 模式，jwtSecret 用于 HS256，jwtPublicKeyFile 为 RS256 公钥 PEM 文件
+	JWTSecret        string `mapstructure:"jwtSecret"`
+	JWTPublicKeyFile string `mapstructure:"jwtPublicKeyFile"`
+	Issuer           string `mapstructure:"issuer"`
+	Audience         string `mapstructure:"audience"`
+	RoleClaim        string `mapstructure:"roleClaim"`     // 角色声明，默认 roles
+	UsernameClaim    string `mapstructure:"usernameClaim"` // 用户名声明，默认 preferred_username，缺失时取 sub
+	// dce 模式
+	CurrentUserPath string        `mapstructure:"currentUserPath"`
+	CacheTTL        time.Duration `mapstructure:"cacheTTL"` // token 校验结果缓存时间
+	// 用户名到角色的映射，未配置的已认证用户为 viewer
+	Admins          []string `mapstructure:"admins"`
+	LedgerOperators []string `mapstructure:"ledgerOperators"`
+	LedgerApprovers []string `mapstructure:"ledgerApprovers"`
+	// 部门数据隔离：用户所属部门来自 jwt 的 deptClaim 声明及 departments 配置，管理员不受限制
+	DeptClaim   string        `mapstructure:"deptClaim"` // 默认 dept
+	Departments []DeptMembers `mapstructure:"departments"`
+	// 未归属任何部门的非管理员用户：none 不可查看场景数据（默认），global 可查看全部数据，须显式配置
+	UnscopedAccess string `mapstructure:"unscopedAccess"`
+}
+
+// DeptMembers 部门（与场景元数据中的 DevDept 一致）及其成员用户名
+type DeptMembers struct {
+	Dept  string   `mapstructure:"dept"`
+	Users []string `mapstructure:"users"`
+}
+
+const (
+	UnscopedAccessGlobal = "global"
+	UnscopedAccessNone   = "none"
+)
+
+// 指标数据源类型
+const (
+	DatasourceInsight    = "insight"    // DCE Insight 代理，使用调用方 token
+	DatasourcePrometheus = "prometheus" // 标准 Prometheus HTTP API（含 VictoriaMetrics）
+)
+
+// DatasourceConfig 指标数据源，每个集群由一个数据源提供数据；未配置任何数据源时使用 grafana_query 中的 DCE Insight
+type DatasourceConfig struct {
+	Name               string `mapstructure:"name"`
+	Type               string `mapstructure:"type"` // insight（默认）或 prometheus
+	URL                string `mapstructure:"url"`  // insight 为空时使用 grafana_query.clusterBaseURL
+	Token              string `mapstructure:"token"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+	// 该数据源负责的集群 ID，为空时负责其余所有集群
+	Clusters []string `mapstructure:"clusters"`
+	// 指标缺少 cluster 标签时补全的集群 ID 与名称，仅对单集群数据源生效
+	ClusterName string `mapstructure:"clusterName"`
+}
+
+// 集群所属环境
+const (
+	EnvProduction  = "生产"
+	EnvDevelopment = "开发"
+	EnvTesting     = "测试"
+)
+
+// ClusterEnvironment 集群到环境的一条规则，cluster 按集群 ID 或名称精确匹配，均不区分大小写；
+// match 为英文关键字时按集群名称中以 - _ . 或数字分隔的词整词匹配（prod 匹配 gpu-prod-01，不匹配 product），
+// 含中文时按包含匹配
+type ClusterEnvironment struct {
+	Cluster string `mapstructure:"cluster"`
+	Match   string `mapstructure:"match"`
+	Env     string `mapstructure:"env"` // 生产、开发、测试，也可以是其他自定义环境
+}
+
+// EnvironmentConfig 台账按环境分组时集群与环境的对应关系。
+// 先按 rules 中的 cluster 精确匹配，再按 match 关键字依次匹配 DCE 集群名称，未配置 rules 时按常见关键字推断
+type EnvironmentConfig struct {
+	Rules   []ClusterEnvironment `mapstructure:"rules"`
+	Default string               `mapstructure:"default"` // 无法确定环境时使用，默认 未知
+}
+
+// 查询缓存存储
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+)
+
+// RedisConfig cacheBackend 为 redis 时使用的 Redis 或兼容协议的服务
+type RedisConfig struct {
+	Addr      string `mapstructure:"addr"` // host:port
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+	DB        int    `mapstructure:"db"`
+	KeyPrefix string `mapstructure:"keyPrefix"` // 缓存键前缀，默认 monitor:cache:
+	// GetOrSet 分布式锁的持有时间（默认 30s），及等待其他副本加载的最长时间（默认 10s）
+	LockTTL     time.Duration `mapstructure:"lockTTL"`
+	LockWait    time.Duration `mapstructure:"lockWait"`
+	DialTimeout time.Duration `mapstructure:"dialTimeout"` // 默认 3s
+}
+
+// 台账文件存储后端
+const (
+	ArtifactBackendLocal = "local"
+	ArtifactBackendS3    = "s3"
+)
+
+// ArtifactConfig 生成的台账文件的存储与保留策略
+type ArtifactConfig struct {
+	Backend       string        `mapstructure:"backend"`       // local（默认）或 s3
+	LocalDir      string        `mapstructure:"localDir"`      // local 后端的存储目录，默认 ./files
+	RetentionDays int           `mapstructure:"retentionDays"` // 文件保留天数，默认 90，超期后删除文件、保留记录
+	PurgeInterval time.Duration `mapstructure:"purgeInterval"` // 清理过期文件的间隔，默认 24h
+	S3            S3Config      `mapstructure:"s3"`
+	Jobs          JobConfig     `mapstructure:"jobs"`
+}
+
+// JobConfig 后台生成台账的任务，数据量大时生成后再通知
+type JobConfig struct {
+	Workers   int           `mapstructure:"workers"`   // 同时生成的任务数，默认 2
+	AsyncRows int           `mapstructure:"asyncRows"` // 行数超过该值时自动转为后台生成，默认 20000
+	Webhook   string        `mapstructure:"webhook"`   // 任务完成或失败时 POST 通知的地址，为空时不通知
+	KeepFor   time.Duration `mapstructure:"keepFor"`   // 已结束任务的保留时间，默认 24h
+}
+
+// S3Config S3 或兼容协议（MinIO 等）的对象存储，使用路径风格访问
+type S3Config struct {
+	Endpoint           string        `mapstructure:"endpoint"` // 例如 http://minio:9000
+	Region             string        `mapstructure:"region"`   // 默认 us-east-1
+	Bucket             string        `mapstructure:"bucket"`
+	AccessKey          string        `mapstructure:"accessKey"`
+	SecretKey          string        `mapstructure:"secretKey"`
+	Prefix             string        `mapstructure:"prefix"`  // 对象键前缀
+	Timeout            time.Duration `mapstructure:"timeout"` // 单次请求超时，默认 60s
+	InsecureSkipVerify bool          `mapstructure:"insecureSkipVerify"`
+}
+
+// UpstreamConfig 上游服务的并发、限流与熔断，键为 dce、es、grafana 或指标数据源名称
+type UpstreamConfig struct {
+	MaxConcurrency int           `mapstructure:"maxConcurrency"` // 最大并发请求数，默认 8
+	RateLimit      float64       `mapstructure:"rateLimit"`      // 每秒请求数，默认 20
+	Burst          int           `mapstructure:"burst"`          // 令牌桶容量，默认 20
+	MaxWait        time.Duration `mapstructure:"maxWait"`        // 等待并发槽位或令牌的最长时间，默认 5s
+	// 连续失败 failureThreshold 次（默认 5）后熔断，openTimeout（默认 30s）后放行一个探测请求
+	FailureThreshold int           `mapstructure:"failureThreshold"`
+	OpenTimeout      time.Duration `mapstructure:"openTimeout"`
 }
 
 type KibanaConfig struct {
@@ -31,6 +189,15 @@ type ESConfig struct {
 	Password string `yaml:"password"`
 	Index    string `yaml:"index"`
 	Mock     bool   `yaml:"mock"`
+	// mock 模式下加载的网关日志样例目录，目录下所有 .json 文件都会被读取
+	MockDataPath string `yaml:"mockDataPath"`
+	// 网关日志中的 token 用量字段，日志未携带时聚合结果为 0
+	PromptTokensField     string `yaml:"promptTokensField"`
+	CompletionTokensField string `yaml:"completionTokensField"`
+	TotalTokensField      string `yaml:"totalTokensField"`
+	// 请求日志排序值相同时兜底的字段，须为每条日志唯一的 doc values 字段（如 request_id.keyword），
+	// 用于 search_after 翻页；非 mock 模式下必须配置，启动时检查索引映射
+	RequestIDField string `yaml:"requestIdField"`
 }
 
 type GrafanaConfig struct {
@@ -40,19 +207,26 @@ type GrafanaConfig struct {
 	APIKey                          string `yaml:"apikey"`
 	ModelRequestDashboardUid        string `yaml:"modelRequestDashboardUid"`
 	ModelRequestDashboardPanelTitle string `yaml:"modelRequestDashboardPanelTitle"`
+	// 场景标签映射的刷新间隔，默认 5m
+	SceneRefreshInterval time.Duration `yaml:"sceneRefreshInterval"`
 }
 
 // MySQL DB 配置
 type DBConfig struct {
-	DBType               string        `yaml:"dbType"`               // 数据库类型，默认 mysql
-	DSN                  string        `yaml:"dsn"`                  // data source name, e.g. root:123456@tcp(127.0.0.1:3306)/hydra
-	MaxIdleConns         int           `yaml:"maxIdleConns"`         // 最大空闲连接数
-	MaxOpenConns         int           `yaml:"maxOpenConns"`         // 最大连接数
-	AutoMigrate          bool          `yaml:"autoMigrate"`          // 自动建表，补全缺失字段，初始化数据
-	Debug                bool          `yaml:"debug"`                // 是否开启调试模式
-	CacheFlag            bool          `yaml:"cacheFlag"`            // 是否开启查询缓存
-	CacheExpiration      time.Duration `yaml:"cacheExpiration"`      // 缓存过期时间
-	CacheCleanupInterval time.Duration `yaml:"cacheCleanupInterval"` // 缓存清理时间间隔
+	DBType               string                   `yaml:"dbType"`               // 数据库类型，默认 mysql
+	DSN                  string                   `yaml:"dsn"`                  // data source name, e.g. root:123456@tcp(127.0.0.1:3306)/hydra
+	MaxIdleConns         int                      `yaml:"maxIdleConns"`         // 最大空闲连接数
+	MaxOpenConns         int                      `yaml:"maxOpenConns"`         // 最大连接数
+	AutoMigrate          bool                     `yaml:"autoMigrate"`          // 自动建表，补全缺失字段，初始化数据
+	Debug                bool                     `yaml:"debug"`                // 是否开启调试模式
+	CacheFlag            bool                     `yaml:"cacheFlag"`            // 是否开启查询缓存
+	CacheBackend         string                   `yaml:"cacheBackend"`         // 缓存存储：memory（默认，进程内）或 redis（多副本共享）
+	CacheExpiration      time.Duration            `yaml:"cacheExpiration"`      // 缓存过期时间
+	CacheCleanupInterval time.Duration            `yaml:"cacheCleanupInterval"` // 缓存清理时间间隔
+	CacheTTLs            map[string]time.Duration `yaml:"cacheTTLs"`            // 各来源（dce、es）的缓存过期时间
+	CacheStaleTTL        time.Duration            `yaml:"cacheStaleTTL"`        // 上游不可用时可返回的过期结果的保留时间
+	RollupBackfillDays   int                      `yaml:"rollupBackfillDays"`   // 每日调用量首次汇总时回溯的天数
+	SceneSyncInterval    time.Duration            `yaml:"sceneSyncInterval"`    // 场景登记表从 DCE、Grafana 同步的间隔
 }
 
 var (
@@ -63,6 +237,12 @@ var (
 	Grafana    GrafanaConfig
 	Kibana     KibanaConfig
 	DbConfig   DBConfig
+	Redis      RedisConfig
+	Auth       AuthConfig
+	Datasource []DatasourceConfig
+	Upstreams  map[string]UpstreamConfig
+	Artifacts  ArtifactConfig
+	Envs       EnvironmentConfig
 )
 
 func InitConfig() error {
@@ -80,45 +260,129 @@ func InitConfig() error {
 	newViper.SetConfigType("yaml")
 
 	if err := newViper.ReadInConfig(); err != nil {
-		log.Println("Error reading config file, %s", err)
+		log.Printf("Error reading config file, %s", err)
 		return err
 	}
 
 	if err := newViper.UnmarshalKey("grafana_query", &Gc); err != nil {
-		log.Println("Error reading config file, %s", err)
+		log.Printf("Error reading config file, %s", err)
 		return err
 	}
 	if err := newViper.UnmarshalKey("es", &Es); err != nil {
-		log.Println("Error reading config file, %s", err)
+		log.Printf("Error reading config file, %s", err)
 		return err
 	}
 	if err := newViper.UnmarshalKey("server", &ServerPort); err != nil {
-		log.Println("Error reading config file, %s", err)
+		log.Printf("Error reading config file, %s", err)
 		return err
 	}
 	if err := newViper.UnmarshalKey("devices", &ModelFP); err != nil {
 
-		log.Println("Error reading config file, %s", err)
+		log.Printf("Error reading config file, %s", err)
 		return err
 	}
 
 	if err := newViper.UnmarshalKey("grafana", &Grafana); err != nil {
-		log.Println("Error reading config file, %s", err)
+		log.Printf("Error reading config file, %s", err)
 		return err
 	}
 
 	if err := newViper.UnmarshalKey("kibana", &Kibana); err != nil {
-		log.Println("Error reading config file, %s", err)
+		log.Printf("Error reading config file, %s", err)
 		return err
 	}
 
 	if err := newViper.UnmarshalKey("mysql", &DbConfig); err != nil {
-		log.Println("Error reading config file, %s", err)
+		log.Printf("Error reading config file, %s", err)
+		return err
+	}
+
+	if err := newViper.UnmarshalKey("redis", &Redis); err != nil {
+		log.Printf("Error reading config file, %s", err)
+		return err
+	}
+
+	if err := newViper.UnmarshalKey("auth", &Auth); err != nil {
+		log.Printf("Error reading config file, %s", err)
+		return err
+	}
+
+	if err := newViper.UnmarshalKey("datasources", &Datasource); err != nil {
+		log.Printf("Error reading config file, %s", err)
+		return err
+	}
+
+	if err := newViper.UnmarshalKey("upstreams", &Upstreams); err != nil {
+		log.Printf("Error reading config file, %s", err)
+		return err
+	}
+
+	if err := newViper.UnmarshalKey("artifacts", &Artifacts); err != nil {
+		log.Printf("Error reading config file, %s", err)
+		return err
+	}
+
+	if err := newViper.UnmarshalKey("environments", &Envs); err != nil {
+		log.Printf("Error reading config file, %s", err)
 		return err
 	}
 
 	return nil
 }
+
+func GetAuthConfig() AuthConfig {
+	if Auth.Mode == "" {
+		Auth.Mode = AuthModeDCE
+	}
+	if Auth.RoleClaim == "" {
+		Auth.RoleClaim = "roles"
+	}
+	if Auth.UsernameClaim == "" {
+		Auth.UsernameClaim = "preferred_username"
+	}
+	if Auth.CurrentUserPath == "" {
+		Auth.CurrentUserPath = "/apis/ghippo.io/v1alpha1/current-user"
+	}
+	if Auth.CacheTTL <= 0 {
+		Auth.CacheTTL = time.Minute
+	}
+	if Auth.DeptClaim == "" {
+		Auth.DeptClaim = "dept"
+	}
+	if Auth.UnscopedAccess == "" {
+		Auth.UnscopedAccess = UnscopedAccessNone
+	}
+	return Auth
+}
+
+// GetDatasourceConfig 未配置数据源时返回基于 grafana_query 的 DCE Insight 数据源
+func GetDatasourceConfig() []DatasourceConfig {
+	gc := GetGrafanaQueryConfig()
+	if len(Datasource) == 0 {
+		return []DatasourceConfig{{
+			Name:               "dce",
+			Type:               DatasourceInsight,
+			URL:                gc.ClusterBaseURL,
+			InsecureSkipVerify: gc.InsecureSkipVerify,
+		}}
+	}
+	sources := make([]DatasourceConfig, len(Datasource))
+	for i, ds := range Datasource {
+		if ds.Type == "" {
+			ds.Type = DatasourceInsight
+		}
+		if ds.Type == DatasourceInsight && ds.URL == "" {
+			ds.URL = gc.ClusterBaseURL
+			ds.InsecureSkipVerify = ds.InsecureSkipVerify || gc.InsecureSkipVerify
+		}
+		if ds.Name == "" {
+			ds.Name = fmt.Sprintf("%s-%d", ds.Type, i)
+		}
+		sources[i] = ds
+	}
+	return sources
+}
+
 func GetDBConfig() *DBConfig {
 
 	if DbConfig.MaxIdleConns <= 0 {
@@ -133,17 +397,139 @@ func GetDBConfig() *DBConfig {
 	if DbConfig.CacheCleanupInterval == 0 {
 		DbConfig.CacheCleanupInterval = 10 * time.Minute
 	}
+	if DbConfig.CacheStaleTTL <= 0 {
+		DbConfig.CacheStaleTTL = 30 * time.Minute
+	}
+	if DbConfig.CacheBackend == "" {
+		DbConfig.CacheBackend = CacheBackendMemory
+	}
+	if DbConfig.RollupBackfillDays <= 0 {
+		DbConfig.RollupBackfillDays = 365
+	}
+	if DbConfig.SceneSyncInterval <= 0 {
+		DbConfig.SceneSyncInterval = 10 * time.Minute
+	}
 	return &DbConfig
 }
 
+func GetRedisConfig() RedisConfig {
+	if Redis.KeyPrefix == "" {
+		Redis.KeyPrefix = "monitor:cache:"
+	}
+	if Redis.LockTTL <= 0 {
+		Redis.LockTTL = 30 * time.Second
+	}
+	if Redis.LockWait <= 0 {
+		Redis.LockWait = 10 * time.Second
+	}
+	if Redis.DialTimeout <= 0 {
+		Redis.DialTimeout = 3 * time.Second
+	}
+	return Redis
+}
+
+func GetArtifactConfig() ArtifactConfig {
+	if Artifacts.Backend == "" {
+		Artifacts.Backend = ArtifactBackendLocal
+	}
+	if Artifacts.LocalDir == "" {
+		Artifacts.LocalDir = "./files"
+	}
+	if Artifacts.RetentionDays <= 0 {
+		Artifacts.RetentionDays = 90
+	}
+	if Artifacts.PurgeInterval <= 0 {
+		Artifacts.PurgeInterval = 24 * time.Hour
+	}
+	if Artifacts.S3.Region == "" {
+		Artifacts.S3.Region = "us-east-1"
+	}
+	if Artifacts.S3.Timeout <= 0 {
+		Artifacts.S3.Timeout = 60 * time.Second
+	}
+	if Artifacts.Jobs.Workers <= 0 {
+		Artifacts.Jobs.Workers = 2
+	}
+	if Artifacts.Jobs.AsyncRows <= 0 {
+		Artifacts.Jobs.AsyncRows = 20000
+	}
+	if Artifacts.Jobs.KeepFor <= 0 {
+		Artifacts.Jobs.KeepFor = 24 * time.Hour
+	}
+	return Artifacts
+}
+
+// defaultEnvRules 未配置 rules 时按 DCE 集群名称中的常见关键字推断环境，英文关键字整词匹配，sit 不会匹配 transit
+var defaultEnvRules = []ClusterEnvironment{
+	{Match: "prod", Env: EnvProduction},
+	{Match: "prd", Env: EnvProduction},
+	{Match: "生产", Env: EnvProduction},
+	{Match: "dev", Env: EnvDevelopment},
+	{Match: "开发", Env: EnvDevelopment},
+	{Match: "test", Env: EnvTesting},
+	{Match: "uat", Env: EnvTesting},
+	{Match: "sit", Env: EnvTesting},
+	{Match: "测试", Env: EnvTesting},
+}
+
+func GetEnvironmentConfig() EnvironmentConfig {
+	cfg := Envs
+	if len(cfg.Rules) == 0 {
+		cfg.Rules = defaultEnvRules
+	}
+	if cfg.Default == "" {
+		cfg.Default = "未知"
+	}
+	return cfg
+}
+
+// GetUpstreamConfig 上游服务的限流熔断配置，配置键不区分大小写
+func GetUpstreamConfig(name string) UpstreamConfig {
+	cfg := Upstreams[strings.ToLower(name)]
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = 8
+	}
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = 20
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 20
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = 5 * time.Second
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	return cfg
+}
+
 func GetFPRule() map[string]float64 {
 	return ModelFP
 }
 
 func GetGrafanaQueryConfig() GrafanaQueryConfig {
+	if Gc.TokenFallback == "" {
+		Gc.TokenFallback = TokenFallbackNone
+	}
 	return Gc
 }
 func GetEsConfig() ESConfig {
+	if Es.PromptTokensField == "" {
+		Es.PromptTokensField = "prompt_tokens"
+	}
+	if Es.CompletionTokensField == "" {
+		Es.CompletionTokensField = "completion_tokens"
+	}
+	if Es.TotalTokensField == "" {
+		Es.TotalTokensField = "total_tokens"
+	}
+	if Es.MockDataPath == "" {
+		Es.MockDataPath = "./etc/mock/es"
+	}
 	return Es
 }
 
@@ -155,5 +541,8 @@ func GetKibanaConfig() KibanaConfig {
 }
 
 func GetGrafanaConfig() GrafanaConfig {
+	if Grafana.SceneRefreshInterval <= 0 {
+		Grafana.SceneRefreshInterval = 5 * time.Minute
+	}
 	return Grafana
 }
@@ -11,11 +11,3 @@ func NewQueryConfig() *QueryConfig {
 		InsecureSkipVerify: gc.InsecureSkipVerify,
 	}
 }
-
-func (q *QueryConfig) BuildGrafanaQueryRange(expr, start, end string) map[string]string {
-	return map[string]string{
-		"query": expr,
-		"start": start,
-		"end":   end,
-	}
-}
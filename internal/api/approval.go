@@ -0,0 +1,248 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"monitor/internal/common"
+	"monitor/internal/models"
+	"monitor/internal/service/approval"
+	"monitor/internal/service/auth"
+	"monitor/internal/service/dao"
+	"monitor/internal/service/ledger"
+	"monitor/internal/service/tenant"
+	"monitor/internal/types"
+	"monitor/util"
+	"net/http"
+)
+
+// workflow 台账审批流程，数据库未连接时返回 503 并返回 nil
+func (t *LedgerService) workflow(ctx *gin.Context) *approval.Workflow {
+	w, err := approval.Default()
+	if err != nil {
+		log.Println(err)
+		result := &common.Result{}
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return nil
+	}
+	return w
+}
+
+// draftAccess 调用方可查看的草稿：审批人及管理员不限制，其他用户可查看本人生成的草稿及本部门范围内的草稿
+func draftAccess(ctx *gin.Context) dao.Access {
+	if auth.FromContext(ctx).Has(auth.RoleLedgerApprover) {
+		return dao.Access{All: true}
+	}
+	return dao.Access{Creator: operatorName(ctx), Departments: tenant.ScopeFromContext(ctx).DepartmentList()}
+}
+
+// CreateDraft 由监控数据生成待审批的台账草稿
+func (t *LedgerService) CreateDraft(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.LedgerDraftRequest
+	if err := ctx.ShouldBindJSON(&params); err != nil || params.To < params.From {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	class, err := ledger.LookupClass(ledger.LedgerClass(params.LedgerType))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	w := t.workflow(ctx)
+	if w == nil {
+		return
+	}
+	from := util.DayTomill(params.From)
+	to := util.DayTomill(params.To)
+	info := t.Domain.WithContext(ctx).GenerateLedgerData(class.ID, from, to)
+	if info.Err != nil {
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, info.Err.Error()))
+		return
+	}
+	draft, err := w.Create(class, info.Rows, from, to, operatorName(ctx), tenant.ScopeFromContext(ctx).DepartmentList())
+	if err != nil {
+		draftFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": draft}))
+}
+
+// ListDrafts 台账草稿列表，可按状态、类型过滤；审批人及管理员以外只返回本人生成及本部门范围内的草稿
+func (t *LedgerService) ListDrafts(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.DraftListRequest
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 || params.Size > 100 {
+		params.Size = 10
+	}
+	w := t.workflow(ctx)
+	if w == nil {
+		return
+	}
+	drafts, total, err := w.List(params.Status, params.LedgerType, draftAccess(ctx), params.Page, params.Size)
+	if err != nil {
+		draftFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data":  drafts,
+		"total": total,
+	}))
+}
+
+// GetDraft 草稿数据及全部操作记录，不在调用方范围内的草稿按不存在处理
+func (t *LedgerService) GetDraft(ctx *gin.Context) {
+	result := &common.Result{}
+	w := t.workflow(ctx)
+	if w == nil {
+		return
+	}
+	detail, err := w.Get(ctx.Param("id"), draftAccess(ctx))
+	if err != nil {
+		draftFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": detail}))
+}
+
+// AdjustDraft 人工调整草稿中的一个值，须填写原因
+func (t *LedgerService) AdjustDraft(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.DraftAdjustRequest
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	w := t.workflow(ctx)
+	if w == nil {
+		return
+	}
+	draft, err := w.Adjust(ctx.Param("id"), draftAccess(ctx), *params.Row, params.Field, params.Value, params.Reason, operatorName(ctx))
+	if err != nil {
+		draftFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": draft}))
+}
+
+// AnnotateDraft 为草稿的某一行或整张台账添加批注
+func (t *LedgerService) AnnotateDraft(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.DraftAnnotateRequest
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	row := -1
+	if params.Row != nil {
+		row = *params.Row
+	}
+	w := t.workflow(ctx)
+	if w == nil {
+		return
+	}
+	draft, err := w.Annotate(ctx.Param("id"), draftAccess(ctx), row, params.Note, operatorName(ctx))
+	if err != nil {
+		draftFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": draft}))
+}
+
+// ApproveDraft 审核通过，审核意见可为空
+func (t *LedgerService) ApproveDraft(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.DraftReviewRequest
+	if err := ctx.ShouldBindJSON(&params); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	w := t.workflow(ctx)
+	if w == nil {
+		return
+	}
+	draft, err := w.Approve(ctx.Param("id"), params.Comment, operatorName(ctx))
+	if err != nil {
+		draftFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": draft}))
+}
+
+// RejectDraft 驳回草稿或撤回尚未定稿的审批
+func (t *LedgerService) RejectDraft(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.DraftReviewRequest
+	if err := ctx.ShouldBindJSON(&params); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	w := t.workflow(ctx)
+	if w == nil {
+		return
+	}
+	draft, err := w.Reject(ctx.Param("id"), params.Comment, operatorName(ctx))
+	if err != nil {
+		draftFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": draft}))
+}
+
+// FinalizeDraft 输出已审批的台账为定稿文件，之后草稿不可再修改
+func (t *LedgerService) FinalizeDraft(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.DraftFinalizeRequest
+	if err := ctx.ShouldBindJSON(&params); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	format := ledger.Format(params.Format)
+	if format == "" {
+		format = ledger.FormatXLSX
+	}
+	w := t.workflow(ctx)
+	if w == nil {
+		return
+	}
+	draft, saved, err := w.Finalize(ctx, ctx.Param("id"), draftAccess(ctx), format, operatorName(ctx))
+	if err != nil {
+		draftFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data": draft,
+		"file": types.GenerateLedgerResp{
+			ID:         saved.ArtifactID,
+			LedgerName: saved.Name,
+			Size:       saved.Size,
+			Checksum:   saved.Checksum,
+		},
+	}))
+}
+
+func draftFail(ctx *gin.Context, err error) {
+	result := &common.Result{}
+	switch {
+	case errors.Is(err, approval.ErrDraftNotFound):
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusNotFound, err.Error()))
+	case errors.Is(err, approval.ErrInvalidState), errors.Is(err, approval.ErrDraftConflict):
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusConflict, err.Error()))
+	case errors.Is(err, approval.ErrSelfApproval):
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusForbidden, err.Error()))
+	case errors.Is(err, approval.ErrReasonRequired), errors.Is(err, approval.ErrInvalidRow),
+		errors.Is(err, ledger.ErrUnsupportedFormat), errors.Is(err, ledger.ErrUnknownClass):
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusBadRequest, err.Error()))
+	default:
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+	}
+}
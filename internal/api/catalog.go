@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"monitor/internal/common"
+	"monitor/internal/service/auth"
+	"monitor/internal/service/catalog"
+	"net/http"
+)
+
+// SceneCatalog 场景登记表的维护接口
+type SceneCatalog struct{}
+
+func NewSceneCatalog() *SceneCatalog {
+	return &SceneCatalog{}
+}
+
+type sceneOverrideRequest struct {
+	Field  string `json:"field" binding:"required"`
+	Value  string `json:"value"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+func (s *SceneCatalog) catalog(ctx *gin.Context) *catalog.Catalog {
+	c := catalog.Default()
+	if c == nil {
+		result := &common.Result{}
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, "场景登记表不可用：未连接数据库"))
+	}
+	return c
+}
+
+// ListScenes 登记表中的场景，includeRemoved=true 时包含上游已移除的场景
+func (s *SceneCatalog) ListScenes(ctx *gin.Context) {
+	result := &common.Result{}
+	c := s.catalog(ctx)
+	if c == nil {
+		return
+	}
+	scenes := c.Scenes(ctx.Query("includeRemoved") == "true")
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data":        scenes,
+		"status":      c.Status(),
+		"overridable": catalog.OverridableFields(),
+	}))
+}
+
+// SceneHistory 场景的改名、负责人变更及人工修正历史
+func (s *SceneCatalog) SceneHistory(ctx *gin.Context) {
+	result := &common.Result{}
+	c := s.catalog(ctx)
+	if c == nil {
+		return
+	}
+	history, err := c.History(ctx.Param("id"))
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": history}))
+}
+
+// SetOverride 人工修正场景字段，例如更正所属部门
+func (s *SceneCatalog) SetOverride(ctx *gin.Context) {
+	result := &common.Result{}
+	var req sceneOverrideRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusBadRequest, err.Error()))
+		return
+	}
+	c := s.catalog(ctx)
+	if c == nil {
+		return
+	}
+	err := c.SetOverride(ctx.Param("id"), req.Field, req.Value, req.Reason, operatorName(ctx))
+	if err != nil {
+		s.fail(ctx, err)
+		return
+	}
+	scene, _ := c.Get(ctx.Param("id"))
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": scene}))
+}
+
+// DeleteOverride 撤销修正，字段恢复为同步值
+func (s *SceneCatalog) DeleteOverride(ctx *gin.Context) {
+	result := &common.Result{}
+	c := s.catalog(ctx)
+	if c == nil {
+		return
+	}
+	if err := c.DeleteOverride(ctx.Param("id"), ctx.Param("field"), operatorName(ctx)); err != nil {
+		s.fail(ctx, err)
+		return
+	}
+	scene, _ := c.Get(ctx.Param("id"))
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": scene}))
+}
+
+// SyncScenes 立即从 DCE 与 Grafana 同步登记表
+func (s *SceneCatalog) SyncScenes(ctx *gin.Context) {
+	result := &common.Result{}
+	c := s.catalog(ctx)
+	if c == nil {
+		return
+	}
+	if err := c.Sync(ctx); err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusBadGateway, err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": c.Status()}))
+}
+
+func (s *SceneCatalog) fail(ctx *gin.Context, err error) {
+	result := &common.Result{}
+	switch {
+	case errors.Is(err, catalog.ErrSceneNotFound), errors.Is(err, catalog.ErrOverrideMissing):
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusNotFound, err.Error()))
+	case errors.Is(err, catalog.ErrInvalidField):
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusBadRequest, err.Error()))
+	default:
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+	}
+}
+
+func operatorName(ctx *gin.Context) string {
+	if identity := auth.FromContext(ctx); identity != nil {
+		return identity.Username
+	}
+	return ""
+}
@@ -2,23 +2,31 @@ package api
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"io/ioutil"
+	"io"
 	"log"
 	"math"
+	"monitor/config"
 	"monitor/internal/common"
 	"monitor/internal/models"
+	"monitor/internal/service/artifact"
+	"monitor/internal/service/auth"
 	"monitor/internal/service/dao"
 	"monitor/internal/service/excel"
+	"monitor/internal/service/job"
 	"monitor/internal/service/ledger"
+	"monitor/internal/service/provenance"
 	"monitor/internal/service/task"
+	"monitor/internal/service/tenant"
 	"monitor/internal/types"
 	"monitor/util"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type LedgerService struct {
@@ -108,62 +116,31 @@ func (t *LedgerService) LedgerAllInfo(ctx *gin.Context) {
 
 	log.Println("LedgerAllInfo", ledgerType, from, to)
 
-	info := t.Domain.GenerateLedgerData(ledgerType, from, to)
-	log.Println("LedgerAllInfo", info)
-	if info.Err != nil {
+	info := t.Domain.WithContext(ctx).GenerateLedgerData(ledgerType, from, to)
+	if errors.Is(info.Err, ledger.ErrUnknownClass) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": info.Err.Error()})
+		return
 	}
-
-	switch ledgerType {
-	case ledger.HighLevelLedgerClass:
-		var records []excel.DataRow
-		for _, item := range info.Data {
-			if row, ok := item.(excel.DataRow); ok {
-				records = append(records, row)
-			}
-		}
-		ctx.JSON(http.StatusOK, result.Success(gin.H{
-			"data": records,
-		}))
-
-	case ledger.LargeModelLedgerClass:
-		var records []excel.ServiceRecord
-		for _, item := range info.Data {
-			if row, ok := item.(excel.ServiceRecord); ok {
-				records = append(records, row)
-			}
-		}
-		ctx.JSON(http.StatusOK, result.Success(gin.H{
-			"data": records,
-		}))
-
-	case ledger.LargeModelSupportLedgerClass:
-		var records []excel.ServiceRecord
-		for _, item := range info.Data {
-			if row, ok := item.(excel.ServiceRecord); ok {
-				records = append(records, row)
-			}
-		}
-		ctx.JSON(http.StatusOK, result.Success(gin.H{
-			"data": records,
-		}))
-
-	case ledger.SceneDetailLedgerClass:
-		var records []excel.Record
-		for _, item := range info.Data {
-			if row, ok := item.(excel.Record); ok {
-				records = append(records, row)
-			}
+	if info.Err != nil {
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, info.Err.Error()))
+		return
+	}
+	resp := gin.H{"data": info.Rows.Data}
+	// 保存预览快照，生成台账时据此核对提交的数据；数据库不可用时仅返回数据
+	if snapshots, err := provenance.Default(); err != nil {
+		log.Println(err)
+	} else if class, _ := ledger.LookupClass(ledgerType); class != nil {
+		snapshot, err := snapshots.Snapshot(class, info.Rows, from, to, operatorName(ctx))
+		if err != nil {
+			log.Println(err)
+		} else {
+			resp["snapshot"] = gin.H{"id": snapshot.SnapshotID, "checksum": snapshot.Checksum}
 		}
-		ctx.JSON(http.StatusOK, result.Success(gin.H{
-			"data": records,
-		}))
-
 	}
-	ctx.JSON(http.StatusBadRequest, gin.H{"error": info.Err.Error()})
+	ctx.JSON(http.StatusOK, result.Success(resp))
 }
 
-// 台账生成
+// 台账生成，format 为 xlsx（默认）、csv、json 或 pdf
 func (t *LedgerService) GenerateLedger(ctx *gin.Context) {
 	result := &common.Result{}
 	var params models.TaskMetaRequest
@@ -173,55 +150,425 @@ func (t *LedgerService) GenerateLedger(ctx *gin.Context) {
 		return
 	}
 
-	log.Println("GenerateLedger", params)
-	// 获得post的数据，并转成excel保存到本地
-	ledgerType := ledger.LedgerClass(params.LedgerType)
-	var filename string
+	log.Println("GenerateLedger", params.Name, params.LedgerType, params.Format)
+	// 获得post的数据，按台账类别的定义输出并保存到台账文件存储
+	class, err := ledger.LookupClass(ledger.LedgerClass(params.LedgerType))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := ledger.Format(params.Format)
+	if format == "" {
+		format = ledger.FormatXLSX
+	}
+	if !class.Supports(format) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", ledger.ErrUnsupportedFormat, format)})
+		return
+	}
+	rows, err := class.Decode(params.Data)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
 
-	switch ledgerType {
-	case ledger.HighLevelLedgerClass:
-		var records []excel.DataRow
-		if err := json.Unmarshal(params.Data, &records); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
-			return
+	store, err := artifact.Default()
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	snapshots, err := provenance.Default()
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	from := util.DayTomill(params.From)
+	to := util.DayTomill(params.To)
+	rows.From, rows.To = from, to
+	// 核对提交的数据与预览快照，不一致的单元格记录到数据来源
+	var report *provenance.Report
+	if params.SnapshotID != "" {
+		report, err = snapshots.Verify(params.SnapshotID, class, rows, from, to)
+	} else {
+		report, err = provenance.Unverified(rows)
+	}
+	switch {
+	case errors.Is(err, provenance.ErrSnapshotNotFound), errors.Is(err, provenance.ErrSnapshotMismatch):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "核验台账数据失败"))
+		return
+	}
+	if report.Status == provenance.StatusModified {
+		log.Printf("GenerateLedger 提交数据与预览快照 %s 不一致：修改 %d 个单元格，新增 %d 行，删除 %d 行",
+			report.SnapshotID, report.ModifiedCells, report.AddedRows, report.RemovedRows)
+	}
+	meta := artifact.Meta{
+		LedgerType:  params.LedgerType,
+		Format:      string(format),
+		Name:        class.Name + util.GetTimeMinite() + "." + string(format),
+		PeriodFrom:  from,
+		PeriodTo:    to,
+		Creator:     operatorName(ctx),
+		Departments: tenant.ScopeFromContext(ctx).DepartmentList(),
+		Rows:        rows.Len,
+	}
+	generate := func(c context.Context, progress job.Reporter) (*dao.Artifact, error) {
+		progress(job.StageRendering, 10)
+		// 生成阶段的进度按写出的数据行在 10 至 90 之间推进
+		saved, err := store.Save(c, meta, func(w io.Writer) error {
+			return provenance.Render(w, class, format, rows, report, func(done, total int) {
+				progress(job.StageRendering, 10+80*done/total)
+			})
+		})
+		if err != nil {
+			return nil, err
 		}
-		h := excel.NewHighLevel()
-		filename = h.GenerateLedger(records)
+		progress(job.StageSaving, 90)
+		if err := snapshots.Record(saved.ArtifactID, report); err != nil {
+			log.Println(err)
+		}
+		return saved, nil
+	}
 
-	case ledger.LargeModelLedgerClass:
-		var records []excel.ServiceRecord
-		if err := json.Unmarshal(params.Data, &records); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+	// 数据量大时后台生成，完成后通知，可按任务ID查询进度
+	if params.Async || rows.Len > config.GetArtifactConfig().Jobs.AsyncRows {
+		jobs, err := job.Default()
+		if err != nil {
+			log.Println(err)
+			ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
 			return
 		}
-		h := excel.NewLargeInvokingexcel()
-		filename = h.GenerateLedgerExcel(records)
-
-	case ledger.LargeModelSupportLedgerClass:
-		var records []excel.ServiceRecord
-		if err := json.Unmarshal(params.Data, &records); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		submitted, err := jobs.Submit(dao.LedgerJob{
+			LedgerType: meta.LedgerType,
+			Name:       meta.Name,
+			Format:     meta.Format,
+			Rows:       meta.Rows,
+			Creator:    meta.Creator,
+		}, generate)
+		if errors.Is(err, job.ErrQueueFull) {
+			ctx.JSON(http.StatusOK, result.Fail(http.StatusTooManyRequests, err.Error()))
 			return
 		}
-		h := excel.NewLargeInvokingexcel()
-		filename = h.GenerateLedgerExcel(records)
-
-	case ledger.SceneDetailLedgerClass:
-		var records []excel.Record
-		if err := json.Unmarshal(params.Data, &records); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		if err != nil {
+			log.Println(err)
+			ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "提交台账任务失败"))
 			return
 		}
-		s := excel.NewServiceLedgerDetail()
-		filename = s.GenerateServiceLedger(records)
+		log.Printf("GenerateLedger 台账 %d 共 %d 行，转为后台任务 %s", class.ID, rows.Len, submitted.JobID)
+		ctx.JSON(http.StatusOK, result.Success(gin.H{
+			"job":        submitted,
+			"provenance": report,
+		}))
+		return
+	}
+
+	saved, err := generate(ctx, func(string, int) {})
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "生成台账失败"))
+		return
+	}
+	ledgerinfo := types.GenerateLedgerResp{
+		ID:         saved.ArtifactID,
+		LedgerName: saved.Name,
+		Size:       saved.Size,
+		Checksum:   saved.Checksum,
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data":       ledgerinfo,
+		"provenance": report,
+	}))
+}
+
+// jobOwner 非管理员只能查看自己提交的任务，返回过滤用的生成人；all 为 true 时可查看全部任务
+func jobOwner(ctx *gin.Context) (owner string, all bool) {
+	if auth.FromContext(ctx).Has(auth.RoleAdmin) {
+		return "", true
+	}
+	return operatorName(ctx), false
+}
+
+// artifactAccess 调用方可查看的台账文件：管理员不限制，其他用户可查看本人生成的文件及本部门范围内的文件
+func artifactAccess(ctx *gin.Context) dao.Access {
+	if auth.FromContext(ctx).Has(auth.RoleAdmin) {
+		return dao.Access{All: true}
+	}
+	return dao.Access{Creator: operatorName(ctx), Departments: tenant.ScopeFromContext(ctx).DepartmentList()}
+}
+
+// ListJobs 后台生成台账的任务，分页；非管理员只返回自己提交的任务
+func (t *LedgerService) ListJobs(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.JobListRequest
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 || params.Size > 100 {
+		params.Size = 10
+	}
+	jobs, err := job.Default()
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	owner, all := jobOwner(ctx)
+	if !all && owner == "" {
+		ctx.JSON(http.StatusOK, result.Success(gin.H{"data": []dao.LedgerJob{}, "total": 0}))
+		return
+	}
+	list, total, err := jobs.List(owner, params.Page, params.Size)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data":  list,
+		"total": total,
+	}))
+}
+
+// GetJob 后台任务的状态及进度，成功后按 artifactId 下载；非管理员查询他人的任务时按不存在处理
+func (t *LedgerService) GetJob(ctx *gin.Context) {
+	result := &common.Result{}
+	jobs, err := job.Default()
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	j, err := jobs.Get(ctx.Param("id"))
+	if owner, all := jobOwner(ctx); err == nil && !all && (owner == "" || j.Creator != owner) {
+		err = job.ErrJobNotFound
+	}
+	if errors.Is(err, job.ErrJobNotFound) {
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusNotFound, err.Error()))
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": j}))
+}
+
+// LedgerProvenance 台账文件的数据来源核验结果，与下载相同，只能查看调用方范围内的台账文件
+func (t *LedgerService) LedgerProvenance(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.DownloadLedgerReq
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	store, err := artifact.Default()
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	snapshots, err := provenance.Default()
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	var report *provenance.Report
+	if _, err = store.Get(params.ID, artifactAccess(ctx)); err == nil {
+		report, err = snapshots.Lookup(params.ID)
+	}
+	if errors.Is(err, artifact.ErrNotFound) || errors.Is(err, provenance.ErrProvenanceNotFound) {
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusNotFound, err.Error()))
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": report}))
+}
+
+// GeneratePeriodPack 生成统计周期内全部台账合并的工作簿，含封面、汇总及图表
+func (t *LedgerService) GeneratePeriodPack(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.PeriodPackRequest
+	if err := ctx.ShouldBindJSON(&params); err != nil || params.To < params.From {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	from := util.DayTomill(params.From)
+	to := util.DayTomill(params.To)
+	log.Println("GeneratePeriodPack", from, to)
+
+	store, err := artifact.Default()
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	pack, err := t.Domain.WithContext(ctx).BuildPeriodPack(from, to)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	pack.Creator = operatorName(ctx)
+	saved, err := store.Save(ctx, artifact.Meta{
+		LedgerType:  int(ledger.PeriodPackLedgerClass),
+		Format:      string(ledger.FormatXLSX),
+		Name:        ledger.PeriodPackName + util.GetTimeMinite() + "." + string(ledger.FormatXLSX),
+		PeriodFrom:  from,
+		PeriodTo:    to,
+		Creator:     pack.Creator,
+		Departments: tenant.ScopeFromContext(ctx).DepartmentList(),
+		Rows:        pack.Rows(),
+	}, pack.Render)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "生成台账失败"))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data": types.GenerateLedgerResp{
+			ID:         saved.ArtifactID,
+			LedgerName: saved.Name,
+			Size:       saved.Size,
+			Checksum:   saved.Checksum,
+		},
+	}))
+}
+
+// comparePeriods 解析对比请求的本期、对比期及维度
+func comparePeriods(params models.CompareLedgerRequest) (ledger.Period, ledger.Period, []string, error) {
+	current := ledger.Period{From: util.DayTomill(params.From), To: util.DayTomill(params.To)}
+	custom := ledger.Period{From: util.DayTomill(params.BaseFrom), To: util.DayTomill(params.BaseTo)}
+	base, err := ledger.BasePeriod(params.Mode, current, custom)
+	if err != nil {
+		return current, base, nil, err
+	}
+	dimensions := ledger.CompareDimensions
+	if params.Dimension != "" {
+		dimensions = strings.Split(params.Dimension, ",")
+	}
+	return current, base, dimensions, nil
+}
+
+// CompareLedger 任意两个周期按模型、场景、部门、GPU型号对比的变化量及变化率
+func (t *LedgerService) CompareLedger(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.CompareLedgerRequest
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	current, base, dimensions, err := comparePeriods(params)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sheets, err := t.Domain.WithContext(ctx).LedgerData.MakeComparison(current, base, dimensions)
+	if errors.Is(err, ledger.ErrInvalidPeriod) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data":    sheets,
+		"current": current,
+		"base":    base,
+	}))
+}
+
+// GenerateComparison 生成周期对比台账 xlsx，新增、消失及变化最大的记录高亮
+func (t *LedgerService) GenerateComparison(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.CompareLedgerRequest
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	current, base, dimensions, err := comparePeriods(params)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	store, err := artifact.Default()
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	sheets, err := t.Domain.WithContext(ctx).LedgerData.MakeComparison(current, base, dimensions)
+	if errors.Is(err, ledger.ErrInvalidPeriod) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	rows := 0
+	for _, s := range sheets {
+		rows += len(s.Rows)
+	}
+	saved, err := store.Save(ctx, artifact.Meta{
+		LedgerType:  int(ledger.ComparisonLedgerClass),
+		Format:      string(ledger.FormatXLSX),
+		Name:        ledger.ComparisonName + util.GetTimeMinite() + "." + string(ledger.FormatXLSX),
+		PeriodFrom:  current.From,
+		PeriodTo:    current.To,
+		Creator:     operatorName(ctx),
+		Departments: tenant.ScopeFromContext(ctx).DepartmentList(),
+		Rows:        rows,
+	}, func(w io.Writer) error {
+		return excel.NewComparison().GenerateComparison(w, sheets)
+	})
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "生成台账失败"))
+		return
 	}
-	var ledgerinfo types.GenerateLedgerResp
-	ledgerinfo.LedgerName = filename
 	ctx.JSON(http.StatusOK, result.Success(gin.H{
-		"data": ledgerinfo,
+		"data": types.GenerateLedgerResp{
+			ID:         saved.ArtifactID,
+			LedgerName: saved.Name,
+			Size:       saved.Size,
+			Checksum:   saved.Checksum,
+		},
 	}))
 }
 
+// LedgerClasses 台账类别及其表头、可输出的格式
+func (t *LedgerService) LedgerClasses(ctx *gin.Context) {
+	result := &common.Result{}
+	classes := ledger.Classes()
+	data := make([]gin.H, 0, len(classes))
+	for _, c := range classes {
+		data = append(data, gin.H{
+			"ledgerType": c.ID,
+			"title":      c.Title,
+			"columns":    c.Columns(),
+			"formats":    c.Formats(),
+		})
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": data}))
+}
+
 // 任务生成
 func (t *LedgerService) GenerateTask(ctx *gin.Context) {
 	result := &common.Result{}
@@ -245,6 +592,8 @@ func (t *LedgerService) GenerateTask(ctx *gin.Context) {
 		"data": "success",
 	}))
 }
+
+// DownloadLedger 按生成时返回的ID下载台账
 func (t *LedgerService) DownloadLedger(ctx *gin.Context) {
 
 	var params models.DownloadLedgerReq
@@ -253,31 +602,93 @@ func (t *LedgerService) DownloadLedger(ctx *gin.Context) {
 		return
 	}
 
-	filePath := fmt.Sprintf("./files/%s", params.LedgerName)
-	// 2. 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		ctx.JSON(http.StatusNotFound, gin.H{
-			"error": "文件不存在",
-			"path":  filePath,
-		})
+	store, err := artifact.Default()
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		return
 	}
+	file, reader, err := store.Open(ctx, params.ID, artifactAccess(ctx))
+	switch {
+	case errors.Is(err, artifact.ErrNotFound), errors.Is(err, artifact.ErrObjectNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	case errors.Is(err, artifact.ErrPurged):
+		ctx.JSON(http.StatusGone, gin.H{"error": "文件已超过保留期限被清理"})
+		return
+	case err != nil:
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+		return
+	}
+	defer reader.Close()
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", file.Name, url.PathEscape(file.Name)))
+	ctx.Header("Content-Type", ledger.ContentType(ledger.Format(file.Format)))
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("ETag", `"`+file.Checksum+`"`)
+	ctx.Header("X-Checksum-Sha256", file.Checksum)
+	// 支持 Range 请求，大文件可断点续传或分段下载
+	http.ServeContent(ctx.Writer, ctx.Request, file.Name, file.CreateTime, reader)
+}
 
-	// 3. 读取文件内容
-	fileBytes, err := ioutil.ReadFile(filePath)
+// ListArtifacts 已生成的台账文件，非管理员只返回本人生成及本部门范围内的文件
+func (t *LedgerService) ListArtifacts(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.ArtifactListRequest
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 || params.Size > 100 {
+		params.Size = 10
+	}
+
+	store, err := artifact.Default()
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "读取文件失败",
-			"detail": err.Error(),
-		})
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
 		return
 	}
+	artifacts, total, err := store.List(params.LedgerType, artifactAccess(ctx), params.Page, params.Size)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data":  artifacts,
+		"total": total,
+	}))
+}
 
-	fileName := filepath.Base(filePath)
-	ctx.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
-	ctx.Header("Content-Transfer-Encoding", "binary")
-	ctx.Header("Cache-Control", "no-cache")
+// token用量统计
+func (t *LedgerService) TokenUsage(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.TokenUsageRequest
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	if params.From == "" || params.To == "" {
+		now := time.Now()
+		params.To = strconv.FormatInt(now.UnixMilli(), 10)
+		params.From = strconv.FormatInt(now.AddDate(0, 0, -30).UnixMilli(), 10)
+	}
+	if params.GroupBy == "" {
+		params.GroupBy = ledger.TokenGroupScene
+	}
 
-	ctx.Data(http.StatusOK, "application/octet-stream", fileBytes)
+	usage, err := t.Domain.WithContext(ctx).LedgerData.MakeTokenUsage(util.ToInt64(params.From), util.ToInt64(params.To), params.GroupBy)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data": usage,
+	}))
 }
@@ -1,22 +1,94 @@
 package api
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"log"
+	"monitor/config"
+	"monitor/internal/client"
+	"monitor/internal/common"
+	"monitor/internal/service/auth"
+	"monitor/internal/service/ledger"
+	"monitor/internal/service/tenant"
+	"net/http"
 	"strings"
+	"sync"
 )
 
+var (
+	authenticator     auth.Authenticator
+	authenticatorOnce sync.Once
+)
+
+func getAuthenticator() auth.Authenticator {
+	authenticatorOnce.Do(func() {
+		a, err := auth.NewAuthenticator(config.GetAuthConfig())
+		if err != nil {
+			panic(err)
+		}
+		authenticator = a
+	})
+	return authenticator
+}
+
+// MakeToken 校验 Authorization: Bearer token，通过后保存 token 及当前用户，失败返回 401
 func MakeToken() gin.HandlerFunc {
+	a := getAuthenticator()
 	return func(c *gin.Context) {
-		authHeader := c.Request.Header.Get("Authorization")
-		if authHeader == "" {
+		result := &common.Result{}
+		token := ""
+		parts := strings.Split(c.Request.Header.Get("Authorization"), " ")
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			token = parts[1]
+		}
+
+		identity, err := a.Authenticate(c, token)
+		if err != nil {
+			if !errors.Is(err, auth.ErrUnauthenticated) && !errors.Is(err, auth.ErrInvalidToken) {
+				log.Println(err)
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, result.Fail(http.StatusUnauthorized, "Unauthorized"))
 			return
 		}
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		if token != "" {
+			c.Set(client.DceTokenKey, token)
+		}
+		c.Set(auth.IdentityKey, identity)
+		c.Next()
+	}
+}
+
+// RequireRole 要求当前用户具备 role 或更高级别的角色，需在 MakeToken 之后使用
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.FromContext(c).Has(role) {
+			result := &common.Result{}
+			c.AbortWithStatusJSON(http.StatusForbidden, result.Fail(http.StatusForbidden, "Forbidden"))
 			return
 		}
-		token := parts[1]
-		c.Set("DceToken", token)
 		c.Next()
 	}
 }
+
+// sceneFilter 按当前用户所属部门获取可查看的场景，全局范围时返回 nil
+func sceneFilter(c *gin.Context) (tenant.SceneFilter, error) {
+	scope := tenant.ScopeFromContext(c)
+	if scope.Global {
+		return nil, nil
+	}
+	scenes, err := ledger.NewSceneLedger(c).GetSceneInfoMap(ledger.Scene)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.NewSceneFilter(scope, scenes), nil
+}
+
+// forbidden 请求的场景不在当前用户部门范围内时返回 403
+func forbidden(c *gin.Context, err error) bool {
+	if !errors.Is(err, tenant.ErrForbidden) {
+		return false
+	}
+	result := &common.Result{}
+	c.JSON(http.StatusForbidden, result.Fail(http.StatusForbidden, "Forbidden"))
+	return true
+}
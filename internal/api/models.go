@@ -44,8 +44,15 @@ func (m *ModelReq) ModelCards(ctx *gin.Context) {
 	if err != nil {
 		log.Println(err)
 		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
 	}
-	sl := model.NewModelRepo(ctx, scnenLabel)
+	filter, err := sceneFilter(ctx)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	sl := model.NewModelRepo(ctx, scnenLabel, filter)
 	mdoelCardsResp, err := sl.ModelsCountCards(params)
 	if err != nil {
 		log.Println(err)
@@ -76,14 +83,25 @@ func (m *ModelReq) ModelReqTime(ctx *gin.Context) {
 	if err != nil {
 		log.Println(err)
 		ctx.JSON(500, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
 	}
 
-	sl := model.NewModelRepo(ctx, scnenLabel)
+	filter, err := sceneFilter(ctx)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	sl := model.NewModelRepo(ctx, scnenLabel, filter)
 
 	reqTimeResp, err := sl.ModelsDetailTrend(params)
+	if forbidden(ctx, err) {
+		return
+	}
 	if err != nil {
 		log.Println(err)
-		ctx.JSON(500, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusBadRequest, err.Error()))
+		return
 	}
 
 	ctx.JSON(http.StatusOK, result.Success(gin.H{
@@ -116,7 +134,18 @@ func (m *ModelReq) ModelDetail(ctx *gin.Context) {
 	}
 
 	scnenLabel, err := m.iGrafanaService.GenerateApiSixScenarioKeyMap()
-	sl := model.NewModelRepo(ctx, scnenLabel)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	filter, err := sceneFilter(ctx)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	sl := model.NewModelRepo(ctx, scnenLabel, filter)
 
 	modelDetailResp, err := sl.ModelsDetailInfo(params)
 	if err != nil {
@@ -151,9 +180,19 @@ func (m *ModelReq) ModelLogs(ctx *gin.Context) {
 	if err != nil {
 		log.Println(err)
 		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	filter, err := sceneFilter(ctx)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
 	}
-	sl := model.NewModelRepo(ctx, scnenLabel)
+	sl := model.NewModelRepo(ctx, scnenLabel, filter)
 	mdoelCardsResp, err := sl.ModelCountWithLog(params)
+	if forbidden(ctx, err) {
+		return
+	}
 	if err != nil {
 		log.Println(err)
 	}
@@ -4,7 +4,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"log"
 	"monitor/config"
-	"monitor/internal/client"
 	"monitor/internal/common"
 	"monitor/internal/models"
 	"monitor/internal/service/gpu"
@@ -154,9 +153,7 @@ func (s *ServiceContext) ClusterDetail(ctx *gin.Context) {
 	fromStr := strconv.FormatInt(from_timestamp, 10)
 	toStr := strconv.FormatInt(to_timestamp, 10)
 
-	c := config.GetGrafanaQueryConfig()
-	client := client.NewDCEClient(ctx, c.ClusterBaseURL, c.InsecureSkipVerify)
-	cluNames := client.GetClusterName("/apis/insight.io/v1alpha1/metric/queryrange")
+	cluNames := gpu.GetClusterNames(ctx)
 	var clusterName string
 	for i := range cluNames {
 		if cluNames[i].Cluster == params.Cluster {
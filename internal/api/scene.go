@@ -1,7 +1,7 @@
 package api
 
 import (
-	"fmt"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"log"
 	"monitor/internal/common"
@@ -48,10 +48,17 @@ func (s *Scene) CountScenes(ctx *gin.Context) {
 	}
 	scnenLabel, err := s.iGrafanaService.GenerateApiSixScenarioKeyMap()
 	if err != nil {
-		fmt.Println(err)
+		log.Println(err)
 		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
 	}
-	sl := scene.NewSceneReq(scnenLabel)
+	filter, err := sceneFilter(ctx)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	sl := scene.NewSceneReq(scnenLabel, filter)
 	cards, err := sl.SceneCountCards(params)
 
 	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": cards}))
@@ -80,15 +87,29 @@ func (s *Scene) CountModels(ctx *gin.Context) {
 		params.From = strconv.FormatInt(fifteenDaysAgoTimestamp, 10)
 	}
 	scnenLabel, err := s.iGrafanaService.GenerateApiSixScenarioKeyMap()
-	sl := scene.NewSceneReq(scnenLabel)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	filter, err := sceneFilter(ctx)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	sl := scene.NewSceneReq(scnenLabel, filter)
 	models, err := sl.SceneCountWithModel(params)
+	if forbidden(ctx, err) {
+		return
+	}
 	detail, err := sl.SceneCountWithLog(params)
-	detail.Models = models
-
 	if err != nil {
 		log.Println(err)
 		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
 	}
+	detail.Models = models
 	ctx.JSON(http.StatusOK, result.Success(gin.H{
 		"data": detail,
 	}))
@@ -111,9 +132,23 @@ func (s *Scene) CountModelDetail(ctx *gin.Context) {
 	}
 
 	scnenLabel, err := s.iGrafanaService.GenerateApiSixScenarioKeyMap()
-	sl := scene.NewSceneReq(scnenLabel)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	filter, err := sceneFilter(ctx)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	sl := scene.NewSceneReq(scnenLabel, filter)
 
 	reqTimeResp, err := sl.ModelRequestTime(params)
+	if forbidden(ctx, err) {
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
@@ -122,3 +157,59 @@ func (s *Scene) CountModelDetail(ctx *gin.Context) {
 		"data": reqTimeResp,
 	}))
 }
+
+// SearchLogs 请求日志检索，支持条件过滤、按时间或延迟排序及游标翻页
+func (s *Scene) SearchLogs(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.LogSearchRequest
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	if params.From == "" || params.To == "" {
+		now := time.Now()
+		params.To = strconv.FormatInt(now.UnixMilli(), 10)
+		params.From = strconv.FormatInt(now.AddDate(0, 0, -30).UnixMilli(), 10)
+	}
+
+	scnenLabel, err := s.iGrafanaService.GenerateApiSixScenarioKeyMap()
+	if err != nil {
+		// 日志检索不依赖场景名称，标签不可用时仍返回结果
+		log.Println(err)
+	}
+	filter, err := sceneFilter(ctx)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	sl := scene.NewSceneReq(scnenLabel, filter)
+	logs, err := sl.SearchLogs(params)
+	if forbidden(ctx, err) {
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		if errors.Is(err, scene.ErrInvalidLogQuery) {
+			ctx.JSON(http.StatusOK, result.Fail(http.StatusBadRequest, err.Error()))
+			return
+		}
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data": logs,
+	}))
+}
+
+// RefreshSceneLabels 立即从 Grafana 刷新场景标签，失败时返回错误及当前使用的结果状态
+func (s *Scene) RefreshSceneLabels(ctx *gin.Context) {
+	result := &common.Result{}
+	status, err := s.iGrafanaService.RefreshSceneLabels(ctx)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusBadGateway, err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": status}))
+}
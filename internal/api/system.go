@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"monitor/internal/cache"
+	"monitor/internal/common"
+	"monitor/internal/upstream"
+	"net/http"
+)
+
+type System struct{}
+
+func NewSystem() *System {
+	return &System{}
+}
+
+// Health 服务健康状态及各上游的熔断状态，上游熔断时为 degraded，服务本身仍可用
+func (s *System) Health(ctx *gin.Context) {
+	result := &common.Result{}
+	status := "ok"
+	upstreams := upstream.All()
+	for _, u := range upstreams {
+		if u.State != upstream.StateClosed {
+			status = "degraded"
+		}
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"status": status, "upstreams": upstreams}))
+}
+
+// CacheStats 各来源查询缓存的命中统计
+func (s *System) CacheStats(ctx *gin.Context) {
+	result := &common.Result{}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": cache.AllStats()}))
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"monitor/internal/common"
+	"monitor/internal/models"
+	"monitor/internal/service/ledger"
+	"monitor/internal/service/template"
+	"net/http"
+	"net/url"
+)
+
+// templates 台账模板存储，数据库未连接时返回 503 并返回 nil
+func (t *LedgerService) templates(ctx *gin.Context) *template.Store {
+	store, err := template.Default()
+	if err != nil {
+		log.Println(err)
+		result := &common.Result{}
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusServiceUnavailable, err.Error()))
+		return nil
+	}
+	return store
+}
+
+// ListTemplates 台账类别的模板版本，第一项为内置版式
+func (t *LedgerService) ListTemplates(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.TemplateListRequest
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	class, err := ledger.LookupClass(ledger.LedgerClass(params.LedgerType))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	store := t.templates(ctx)
+	if store == nil {
+		return
+	}
+	templates, err := store.List(class)
+	if err != nil {
+		templateFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{
+		"data": templates,
+		"vars": ledger.TemplateVars,
+	}))
+}
+
+// UploadTemplate 上传模板的新版本，上传后需选用才生效
+func (t *LedgerService) UploadTemplate(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.TemplateUploadRequest
+	if err := ctx.ShouldBind(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	class, err := ledger.LookupClass(ledger.LedgerClass(params.LedgerType))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "缺少模板文件"})
+		return
+	}
+	if header.Size > template.MaxSize {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("模板文件超过 %d MB", template.MaxSize>>20)})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "读取模板文件失败"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, template.MaxSize+1))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "读取模板文件失败"})
+		return
+	}
+	store := t.templates(ctx)
+	if store == nil {
+		return
+	}
+	name := params.Name
+	if name == "" {
+		name = header.Filename
+	}
+	saved, err := store.Upload(class, name, params.Comment, data, operatorName(ctx))
+	if err != nil {
+		templateFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": saved}))
+}
+
+// SelectTemplate 选用模板，之后该台账类别的 xlsx 均按此模板输出
+func (t *LedgerService) SelectTemplate(ctx *gin.Context) {
+	result := &common.Result{}
+	var params models.TemplateSelectRequest
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	class, err := ledger.LookupClass(ledger.LedgerClass(params.LedgerType))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	store := t.templates(ctx)
+	if store == nil {
+		return
+	}
+	if err := store.Select(class, params.ID); err != nil {
+		templateFail(ctx, err)
+		return
+	}
+	log.Printf("SelectTemplate 台账 %d 选用模板 %s，操作人 %s", class.ID, params.ID, operatorName(ctx))
+	templates, err := store.List(class)
+	if err != nil {
+		templateFail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Success(gin.H{"data": templates}))
+}
+
+// DownloadTemplate 下载上传的模板文件
+func (t *LedgerService) DownloadTemplate(ctx *gin.Context) {
+	store := t.templates(ctx)
+	if store == nil {
+		return
+	}
+	tpl, err := store.Get(ctx.Param("id"))
+	if errors.Is(err, template.ErrTemplateNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "读取模板失败"})
+		return
+	}
+	name := fmt.Sprintf("%s-v%d.xlsx", tpl.Name, tpl.Version)
+	sendTemplate(ctx, name, tpl.Content)
+}
+
+// StarterTemplate 下载台账类别的起始模板，包含全部列的占位符
+func (t *LedgerService) StarterTemplate(ctx *gin.Context) {
+	var params models.TemplateListRequest
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		return
+	}
+	class, err := ledger.LookupClass(ledger.LedgerClass(params.LedgerType))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var buf bytes.Buffer
+	if err := class.WriteStarterTemplate(&buf); err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成模板失败"})
+		return
+	}
+	sendTemplate(ctx, class.Name+"模板.xlsx", buf.Bytes())
+}
+
+func sendTemplate(ctx *gin.Context, name string, data []byte) {
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", name, url.PathEscape(name)))
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Data(http.StatusOK, ledger.ContentType(ledger.FormatXLSX), data)
+}
+
+func templateFail(ctx *gin.Context, err error) {
+	result := &common.Result{}
+	switch {
+	case errors.Is(err, template.ErrTemplateNotFound):
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusNotFound, err.Error()))
+	case errors.Is(err, template.ErrInvalidTemplate), errors.Is(err, template.ErrWrongClass):
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusBadRequest, err.Error()))
+	default:
+		log.Println(err)
+		ctx.JSON(http.StatusOK, result.Fail(http.StatusInternalServerError, "Internal service error"))
+	}
+}
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"monitor/config"
+	"monitor/internal/upstream"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 查询缓存的来源，各自使用独立的过期时间和统计
+const (
+	SourceDCE = "dce" // DCE 指标查询及场景管理接口
+	SourceES  = "es"  // 网关日志聚合
+)
+
+// 未在 mysql.cacheTTLs 中配置时的默认过期时间
+var defaultTTLs = map[string]time.Duration{
+	SourceDCE: time.Minute,
+	SourceES:  time.Minute,
+}
+
+// Stats 某个来源的缓存命中统计
+type Stats struct {
+	Source  string  `json:"source"`
+	Enabled bool    `json:"enabled"`
+	TTL     string  `json:"ttl"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	Errors  int64   `json:"errors"` // 加载失败次数，失败结果不缓存
+	Stale   int64   `json:"stale"`  // 上游不可用时返回过期结果的次数
+	HitRate float64 `json:"hitRate"`
+}
+
+// QueryCache 按来源划分的查询缓存，返回值为共享对象，调用方不可修改
+type QueryCache struct {
+	source   string
+	store    Cache
+	ttl      time.Duration
+	staleTTL time.Duration // 过期结果的保留时间，为 0 时不保留
+	enabled  bool
+
+	hits   atomic.Int64
+	misses atomic.Int64
+	errors atomic.Int64
+	stale  atomic.Int64
+}
+
+var (
+	sharedStore     Cache
+	sharedStoreOnce sync.Once
+	queryCaches     sync.Map // source -> *QueryCache
+)
+
+// Shared 查询缓存使用的存储，mysql.cacheBackend 为 redis 时多副本共享，
+// 连接失败时退回进程内缓存；过期时间与清理间隔取自 mysql 配置
+func Shared() Cache {
+	sharedStoreOnce.Do(func() {
+		cfg := config.GetDBConfig()
+		if cfg.CacheFlag && cfg.CacheBackend == config.CacheBackendRedis {
+			store, err := NewRedis(config.GetRedisConfig(), cfg.CacheExpiration)
+			if err == nil {
+				sharedStore = store
+				return
+			}
+			log.Printf("redis 缓存不可用，使用进程内缓存: %v", err)
+		}
+		sharedStore = NewWithConfig(cfg.CacheExpiration, cfg.CacheCleanupInterval)
+	})
+	return sharedStore
+}
+
+// ForSource 返回来源对应的查询缓存，mysql.cacheFlag 关闭时直接执行查询
+func ForSource(source string) *QueryCache {
+	if qc, ok := queryCaches.Load(source); ok {
+		return qc.(*QueryCache)
+	}
+	cfg := config.GetDBConfig()
+	ttl, ok := cfg.CacheTTLs[source]
+	if !ok || ttl <= 0 {
+		ttl = defaultTTLs[source]
+	}
+	if ttl <= 0 {
+		ttl = cfg.CacheExpiration
+	}
+	qc, _ := queryCaches.LoadOrStore(source, &QueryCache{
+		source:   source,
+		store:    Shared(),
+		ttl:      ttl,
+		staleTTL: max(cfg.CacheStaleTTL, ttl),
+		enabled:  cfg.CacheFlag,
+	})
+	return qc.(*QueryCache)
+}
+
+// Enabled 是否开启缓存
+func (q *QueryCache) Enabled() bool {
+	return q.enabled
+}
+
+// TTL 缓存过期时间
+func (q *QueryCache) TTL() time.Duration {
+	return q.ttl
+}
+
+// Load 命中时直接返回缓存，否则调用 loader 并缓存成功的结果，同一个 key 只有一个 loader 在执行；
+// 上游不可用（熔断、限流或请求失败）时返回 staleTTL 内最近一次的结果
+func (q *QueryCache) Load(ctx context.Context, key string, loader LoaderFunc) (interface{}, error) {
+	if !q.enabled {
+		return loader(ctx)
+	}
+	if val, ok := q.store.Get(ctx, key); ok {
+		q.hits.Add(1)
+		return val, nil
+	}
+	q.misses.Add(1)
+	val, err := q.store.GetOrSet(ctx, key, loader, q.ttl)
+	if err != nil {
+		if errors.Is(err, upstream.ErrUnavailable) {
+			if stale, ok := q.store.Get(ctx, staleKey(key)); ok {
+				q.stale.Add(1)
+				log.Printf("%s 返回过期缓存: %v", q.source, err)
+				return stale, nil
+			}
+		}
+		q.errors.Add(1)
+		return nil, err
+	}
+	if q.staleTTL > 0 {
+		q.store.Set(ctx, staleKey(key), val, q.staleTTL)
+	}
+	return val, nil
+}
+
+func staleKey(key string) string {
+	return key + ":stale"
+}
+
+// Stats 当前统计
+func (q *QueryCache) Stats() Stats {
+	s := Stats{
+		Source:  q.source,
+		Enabled: q.enabled,
+		TTL:     q.ttl.String(),
+		Hits:    q.hits.Load(),
+		Misses:  q.misses.Load(),
+		Errors:  q.errors.Load(),
+		Stale:   q.stale.Load(),
+	}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+// AllStats 所有来源的统计，按来源名称排序
+func AllStats() []Stats {
+	for source := range defaultTTLs {
+		ForSource(source)
+	}
+	stats := make([]Stats, 0)
+	queryCaches.Range(func(_, v interface{}) bool {
+		stats = append(stats, v.(*QueryCache).Stats())
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Source < stats[j].Source
+	})
+	return stats
+}
+
+// Key 由来源和查询参数生成缓存键，字符串参数中的连续空白视为一个空格
+func Key(source string, parts ...interface{}) string {
+	h := sha1.New()
+	for _, part := range parts {
+		switch v := part.(type) {
+		case string:
+			h.Write([]byte(strings.Join(strings.Fields(v), " ")))
+		case time.Time:
+			h.Write([]byte(fmt.Sprint(v.UnixMilli())))
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				data = []byte(fmt.Sprintf("%#v", v))
+			}
+			h.Write(data)
+		}
+		h.Write([]byte{0})
+	}
+	return source + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// AlignWindow 结束时间在最近一个 step 内的相对时间窗口（如 now-5m 到 now），
+// 首尾都向下取整到 step，使相邻的刷新请求命中同一个缓存；历史窗口保持不变
+func AlignWindow(from, to, now time.Time, step time.Duration) (time.Time, time.Time) {
+	if step <= 0 || now.Sub(to) >= step || to.Sub(now) >= step {
+		return from, to
+	}
+	alignedTo := to.Truncate(step)
+	alignedFrom := from.Truncate(step)
+	if !alignedFrom.Before(alignedTo) {
+		return from, to
+	}
+	return alignedFrom, alignedTo
+}
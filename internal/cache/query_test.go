@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"monitor/internal/upstream"
+	"testing"
+	"time"
+)
+
+func TestQueryCacheLoad(t *testing.T) {
+	qc := &QueryCache{source: SourceES, store: New(), ttl: time.Minute, enabled: true}
+	calls := 0
+	loader := func(context.Context) (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		val, err := qc.Load(ctx, "k", loader)
+		if err != nil || val.(int) != 1 {
+			t.Fatalf("load = %v, %v", val, err)
+		}
+	}
+	failed := errors.New("es down")
+	if _, err := qc.Load(ctx, "bad", func(context.Context) (interface{}, error) { return nil, failed }); !errors.Is(err, failed) {
+		t.Errorf("err = %v", err)
+	}
+	stats := qc.Stats()
+	if calls != 1 || stats.Hits != 2 || stats.Misses != 2 || stats.Errors != 1 || stats.HitRate != 0.5 {
+		t.Errorf("calls = %d, stats = %+v", calls, stats)
+	}
+
+	// 关闭时每次都执行查询且不计数
+	off := &QueryCache{source: SourceES, store: New(), ttl: time.Minute}
+	off.Load(ctx, "k", loader)
+	off.Load(ctx, "k", loader)
+	if calls != 3 || off.Stats().Misses != 0 {
+		t.Errorf("disabled cache: calls = %d, stats = %+v", calls, off.Stats())
+	}
+}
+
+func TestKeyAndAlignWindow(t *testing.T) {
+	if Key(SourceDCE, "sum(up)  by\n(cluster)", 1) != Key(SourceDCE, "sum(up) by (cluster)", 1) {
+		t.Error("whitespace should be normalized")
+	}
+	if Key(SourceDCE, "up", []string(nil)) == Key(SourceDCE, "up", []string{}) {
+		t.Error("nil and empty filters must not share a key")
+	}
+	if Key(SourceDCE, "up") == Key(SourceES, "up") {
+		t.Error("sources must not share a key")
+	}
+
+	now := time.Date(2024, 5, 1, 10, 7, 42, 0, time.UTC)
+	from, to := AlignWindow(now.Add(-5*time.Minute), now, now, time.Minute)
+	if !from.Equal(time.Date(2024, 5, 1, 10, 2, 0, 0, time.UTC)) || !to.Equal(time.Date(2024, 5, 1, 10, 7, 0, 0, time.UTC)) {
+		t.Errorf("aligned = %v ~ %v", from, to)
+	}
+	// 相隔几秒的刷新落在同一窗口
+	from2, to2 := AlignWindow(now.Add(-5*time.Minute+10*time.Second), now.Add(10*time.Second), now.Add(10*time.Second), time.Minute)
+	if !from2.Equal(from) || !to2.Equal(to) {
+		t.Errorf("refresh aligned = %v ~ %v", from2, to2)
+	}
+	// 历史窗口不变
+	past := now.Add(-time.Hour)
+	if f, e := AlignWindow(past.Add(-time.Hour), past, now, time.Minute); !f.Equal(past.Add(-time.Hour)) || !e.Equal(past) {
+		t.Errorf("history window changed: %v ~ %v", f, e)
+	}
+}
+
+func TestQueryCacheServesStale(t *testing.T) {
+	qc := &QueryCache{source: SourceDCE, store: New(), ttl: time.Minute, staleTTL: time.Hour, enabled: true}
+	ctx := context.Background()
+	if _, err := qc.Load(ctx, "k", func(context.Context) (interface{}, error) { return "fresh", nil }); err != nil {
+		t.Fatal(err)
+	}
+	qc.store.Delete(ctx, "k") // 模拟过期
+
+	down := &upstream.Error{Upstream: upstream.DCE, Err: upstream.ErrCircuitOpen}
+	val, err := qc.Load(ctx, "k", func(context.Context) (interface{}, error) { return nil, down })
+	if err != nil || val != "fresh" || qc.Stats().Stale != 1 {
+		t.Errorf("stale = %v, %v, stats = %+v", val, err, qc.Stats())
+	}
+	// 其他错误不返回过期结果
+	qc.store.Delete(ctx, "k")
+	if _, err := qc.Load(ctx, "k", func(context.Context) (interface{}, error) { return nil, errors.New("forbidden") }); err == nil {
+		t.Error("non-upstream error should be returned")
+	}
+}
@@ -0,0 +1,348 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"monitor/config"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisScanCount = 200                   // SCAN 每批返回的键数量
+	lockPoll       = 50 * time.Millisecond // 等待其他副本加载时的轮询间隔
+)
+
+// 仅释放自己持有的锁，避免锁过期后误删其他副本的锁
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+var (
+	typesMu    sync.RWMutex
+	valueTypes = make(map[string]reflect.Type) // 类型名 -> 类型
+)
+
+// Register 注册缓存值的具体类型。Redis 存储以 JSON 编码缓存值并按类型名还原，
+// 未注册的类型不会写入 Redis，每次都重新加载
+func Register(values ...interface{}) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	for _, v := range values {
+		t := reflect.TypeOf(v)
+		if exist, ok := valueTypes[t.String()]; ok && exist != t {
+			panic(fmt.Sprintf("缓存值类型名冲突: %s", t.String()))
+		}
+		valueTypes[t.String()] = t
+	}
+}
+
+// 缓存值的编码外层，记录值的类型名
+type redisEntry struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v"`
+}
+
+// redisCache 基于 Redis 协议的缓存，多副本共享同一份数据
+type redisCache struct {
+	client     redis.UniversalClient
+	dataPrefix string // 缓存值的键前缀
+	lockPrefix string // 加载锁的键前缀
+	defaultTTL time.Duration
+	lockTTL    time.Duration
+	lockWait   time.Duration
+	loaderMap  *sync.Map
+}
+
+// NewRedis 连接 Redis 并创建缓存，defaultExpiration 为 SetDefault 及 ttl 为 0 时的过期时间
+func NewRedis(cfg config.RedisConfig, defaultExpiration time.Duration) (Cache, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("未配置 redis.addr")
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:        cfg.Addr,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		DB:          cfg.DB,
+		DialTimeout: cfg.DialTimeout,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("连接 redis %s 失败: %w", cfg.Addr, err)
+	}
+	return newRedisCache(client, cfg, defaultExpiration), nil
+}
+
+func newRedisCache(client redis.UniversalClient, cfg config.RedisConfig, defaultExpiration time.Duration) *redisCache {
+	return &redisCache{
+		client:     client,
+		dataPrefix: cfg.KeyPrefix + "data:",
+		lockPrefix: cfg.KeyPrefix + "lock:",
+		defaultTTL: defaultExpiration,
+		lockTTL:    cfg.LockTTL,
+		lockWait:   cfg.LockWait,
+		loaderMap:  new(sync.Map),
+	}
+}
+
+// 与 go-cache 一致：0 使用默认过期时间，负数永不过期
+func (c *redisCache) expiration(ttl time.Duration) time.Duration {
+	if ttl == cache.DefaultExpiration {
+		return c.defaultTTL
+	}
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+func encode(value interface{}) ([]byte, error) {
+	if value == nil {
+		return nil, errors.New("nil 值不缓存")
+	}
+	name := reflect.TypeOf(value).String()
+	typesMu.RLock()
+	_, ok := valueTypes[name]
+	typesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("类型 %s 未通过 cache.Register 注册", name)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&redisEntry{Type: name, Value: data})
+}
+
+func decode(data []byte) (interface{}, error) {
+	var entry redisEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	typesMu.RLock()
+	t, ok := valueTypes[entry.Type]
+	typesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("类型 %s 未注册", entry.Type)
+	}
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(entry.Value, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+func nonNil(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// Get Redis 不可用或值无法解码时视为未命中
+func (c *redisCache) Get(ctx context.Context, key string) (interface{}, bool) {
+	data, err := c.client.Get(nonNil(ctx), c.dataPrefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("读取缓存 %s 失败: %v", key, err)
+		}
+		return nil, false
+	}
+	val, err := decode(data)
+	if err != nil {
+		log.Printf("缓存 %s 解码失败: %v", key, err)
+		return nil, false
+	}
+	return val, true
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) {
+	data, err := encode(value)
+	if err != nil {
+		log.Printf("缓存 %s 编码失败: %v", key, err)
+		return
+	}
+	if err := c.client.Set(nonNil(ctx), c.dataPrefix+key, data, c.expiration(ttl)).Err(); err != nil {
+		log.Printf("写入缓存 %s 失败: %v", key, err)
+	}
+}
+
+func (c *redisCache) SetDefault(ctx context.Context, key string, value interface{}) {
+	c.Set(ctx, key, value, cache.DefaultExpiration)
+}
+
+func (c *redisCache) Delete(ctx context.Context, key string) {
+	if err := c.client.Del(nonNil(ctx), c.dataPrefix+key).Err(); err != nil {
+		log.Printf("删除缓存 %s 失败: %v", key, err)
+	}
+}
+
+// Flush 仅删除本缓存前缀下的键，不影响共用 Redis 的其他数据
+func (c *redisCache) Flush(ctx context.Context) {
+	ctx = nonNil(ctx)
+	keys, err := c.scan(ctx)
+	if err != nil {
+		log.Printf("清空缓存失败: %v", err)
+		return
+	}
+	for start := 0; start < len(keys); start += redisScanCount {
+		end := min(start+redisScanCount, len(keys))
+		if err := c.client.Del(ctx, keys[start:end]...).Err(); err != nil {
+			log.Printf("清空缓存失败: %v", err)
+			return
+		}
+	}
+}
+
+// 前缀下的全部缓存键（含前缀）
+func (c *redisCache) scan(ctx context.Context) ([]string, error) {
+	keys := make([]string, 0)
+	iter := c.client.Scan(ctx, 0, c.dataPrefix+"*", redisScanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// Items 遍历前缀下的全部缓存项，Expiration 为过期时间的纳秒时间戳，永不过期时为 0
+func (c *redisCache) Items() map[string]cache.Item {
+	ctx := context.Background()
+	items := make(map[string]cache.Item)
+	keys, err := c.scan(ctx)
+	if err != nil {
+		log.Printf("遍历缓存失败: %v", err)
+		return items
+	}
+	for start := 0; start < len(keys); start += redisScanCount {
+		batch := keys[start:min(start+redisScanCount, len(keys))]
+		pipe := c.client.Pipeline()
+		gets := make([]*redis.StringCmd, len(batch))
+		ttls := make([]*redis.DurationCmd, len(batch))
+		for i, key := range batch {
+			gets[i] = pipe.Get(ctx, key)
+			ttls[i] = pipe.PTTL(ctx, key)
+		}
+		// 遍历期间过期的键返回 redis.Nil，逐条判断
+		pipe.Exec(ctx)
+		now := time.Now()
+		for i, key := range batch {
+			data, err := gets[i].Bytes()
+			if err != nil {
+				continue
+			}
+			val, err := decode(data)
+			if err != nil {
+				continue
+			}
+			item := cache.Item{Object: val}
+			if ttl := ttls[i].Val(); ttl > 0 {
+				item.Expiration = now.Add(ttl).UnixNano()
+			}
+			items[key[len(c.dataPrefix):]] = item
+		}
+	}
+	return items
+}
+
+func (c *redisCache) ItemCount() int {
+	keys, err := c.scan(context.Background())
+	if err != nil {
+		log.Printf("遍历缓存失败: %v", err)
+		return 0
+	}
+	return len(keys)
+}
+
+func (c *redisCache) GetItemsWithValues() map[string]interface{} {
+	items := c.Items()
+	result := make(map[string]interface{}, len(items))
+	for k, item := range items {
+		result[k] = item.Object
+	}
+	return result
+}
+
+// GetOrSet 同一进程内的并发加载先在本地合并，再通过 Redis 锁保证各副本中只有一个执行 loader；
+// 等待超过 lockWait 或 Redis 不可用时自行加载
+func (c *redisCache) GetOrSet(ctx context.Context, key string, loader LoaderFunc, ttl time.Duration) (interface{}, error) {
+	ctx = nonNil(ctx)
+	if val, found := c.Get(ctx, key); found {
+		return val, nil
+	}
+
+	val, _ := c.loaderMap.LoadOrStore(key, &sync.Mutex{})
+	mu := val.(*sync.Mutex)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		c.loaderMap.Delete(key)
+	}()
+
+	if val, found := c.Get(ctx, key); found {
+		return val, nil
+	}
+
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	lockKey := c.lockPrefix + key
+	deadline := time.Now().Add(c.lockWait)
+	for {
+		locked, err := c.client.SetNX(ctx, lockKey, token, c.lockTTL).Result()
+		if err != nil {
+			log.Printf("获取缓存加载锁 %s 失败: %v", key, err)
+			break
+		}
+		if locked {
+			defer unlockScript.Run(context.Background(), c.client, []string{lockKey}, token)
+			break
+		}
+		// 其他副本正在加载，等待其写入结果
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+		if val, found := c.Get(ctx, key); found {
+			return val, nil
+		}
+		if time.Now().After(deadline) {
+			log.Printf("等待缓存 %s 加载超时，自行加载", key)
+			break
+		}
+	}
+
+	if val, found := c.Get(ctx, key); found {
+		return val, nil
+	}
+	value, err := loader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loader error: %w", err)
+	}
+	c.Set(ctx, key, value, ttl)
+	return value, nil
+}
+
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+var _ Cache = (*redisCache)(nil)
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"monitor/config"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type testPoint struct {
+	Name   string  `json:"name"`
+	Values []int64 `json:"values"`
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, config.RedisConfig) {
+	srv := miniredis.RunT(t)
+	config.Redis = config.RedisConfig{Addr: srv.Addr(), LockWait: 300 * time.Millisecond}
+	return srv, config.GetRedisConfig()
+}
+
+func TestRedisCache(t *testing.T) {
+	srv, cfg := newTestRedis(t)
+	Register([]testPoint{}, map[string]int64{})
+	c, err := NewRedis(cfg, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	c.Set(ctx, "points", []testPoint{{Name: "a", Values: []int64{}}}, 0)
+	val, ok := c.Get(ctx, "points")
+	if !ok {
+		t.Fatal("points not found")
+	}
+	// 空切片编码后仍为 []，接口返回不会变成 null
+	if data, _ := json.Marshal(val); string(data) != `[{"name":"a","values":[]}]` {
+		t.Errorf("points = %s", data)
+	}
+	if ttl := srv.TTL(cfg.KeyPrefix + "data:points"); ttl != time.Minute {
+		t.Errorf("default ttl = %v", ttl)
+	}
+
+	c.Set(ctx, "counts", map[string]int64{"x": 1}, -1)
+	c.Set(ctx, "unregistered", struct{ A int }{1}, time.Minute)
+	srv.Set("other:key", "kept")
+
+	items := c.Items()
+	if len(items) != 2 || c.ItemCount() != 2 || items["counts"].Expiration != 0 || items["points"].Expiration == 0 {
+		t.Errorf("items = %+v", items)
+	}
+	if v := c.GetItemsWithValues()["counts"].(map[string]int64); v["x"] != 1 {
+		t.Errorf("counts = %v", v)
+	}
+
+	srv.FastForward(2 * time.Minute)
+	if _, ok := c.Get(ctx, "points"); ok {
+		t.Error("points should expire")
+	}
+
+	c.Flush(ctx)
+	if c.ItemCount() != 0 || !srv.Exists("other:key") {
+		t.Error("flush should only remove cache keys")
+	}
+}
+
+func TestRedisGetOrSetAcrossReplicas(t *testing.T) {
+	srv, cfg := newTestRedis(t)
+	Register(map[string]int64{})
+	client := func() Cache {
+		return newRedisCache(redis.NewClient(&redis.Options{Addr: srv.Addr()}), cfg, time.Minute)
+	}
+	replicas := []Cache{client(), client(), client()}
+
+	var calls atomic.Int32
+	loader := func(context.Context) (interface{}, error) {
+		calls.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		return map[string]int64{"n": 42}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(c Cache) {
+			defer wg.Done()
+			val, err := c.GetOrSet(context.Background(), "shared", loader, time.Minute)
+			if err != nil || val.(map[string]int64)["n"] != 42 {
+				t.Errorf("GetOrSet = %v, %v", val, err)
+			}
+		}(replicas[i%len(replicas)])
+	}
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("loader called %d times, want 1", calls.Load())
+	}
+	if srv.Exists(cfg.KeyPrefix + "lock:shared") {
+		t.Error("lock should be released")
+	}
+
+	// 持锁副本异常退出时，等待 lockWait 后自行加载
+	srv.Set(cfg.KeyPrefix+"lock:stale", "other")
+	start := time.Now()
+	if _, err := replicas[0].GetOrSet(context.Background(), "stale", loader, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < cfg.LockWait || calls.Load() != 2 {
+		t.Errorf("waited %v, calls = %d", waited, calls.Load())
+	}
+	if got, _ := srv.Get(cfg.KeyPrefix + "lock:stale"); got != "other" {
+		t.Error("lock held by another replica must not be released")
+	}
+}
@@ -1,18 +1,17 @@
 package client
 
 import (
-	"bytes"
-	"compress/gzip"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-resty/resty/v2"
 	"golang.org/x/net/context"
-	"io/ioutil"
 	"log"
 	"monitor/config"
-	"monitor/internal/types"
-	"strconv"
+	"monitor/internal/cache"
+	"monitor/internal/upstream"
+	"net/http"
 	"time"
 )
 
@@ -31,8 +30,41 @@ func NewDCEClient(ctx context.Context, dceURL string, skipVerify bool) *DCEClien
 	return &DCEClient{client: c, ctx: ctx}
 }
 
+// DceTokenKey gin 上下文中保存调用方 token 的键，gin.Context.Value 会按字符串键读取 c.Get
+const DceTokenKey = "DceToken"
+
+type dceTokenCtxKey struct{}
+
+// WithDceToken 将调用方 token 绑定到 ctx，用于脱离 gin 请求执行的异步任务
+func WithDceToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, dceTokenCtxKey{}, token)
+}
+
+// DceTokenFromContext 读取调用方 token，未携带时返回空串
+func DceTokenFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if token, ok := ctx.Value(dceTokenCtxKey{}).(string); ok && token != "" {
+		return token
+	}
+	if token, ok := ctx.Value(DceTokenKey).(string); ok {
+		return token
+	}
+	return ""
+}
+
+// 优先使用调用方 token，由 DCE 按用户权限过滤数据；没有时按 tokenFallback 配置决定是否使用服务账号
 func getDceToken(ctx context.Context) string {
-	return config.GetGrafanaQueryConfig().Token
+	if token := DceTokenFromContext(ctx); token != "" {
+		return token
+	}
+	c := config.GetGrafanaQueryConfig()
+	if c.TokenFallback == config.TokenFallbackService {
+		return c.Token
+	}
+	log.Println("请求未携带用户token，且未开启服务账号兜底")
+	return ""
 }
 
 // 定义接口响应结构
@@ -51,14 +83,15 @@ type ResponseData struct {
 }
 
 // 定义接口请求结构
+// 字段未导出，请求体中 pageParam、orderParam 为空对象，与现有 DCE 调用保持一致
 type pageparam struct {
-	page     int `json:"pageNum"`  // 当前页码
-	pageSize int `json:"pageSize"` // 每页数量
+	page     int // 当前页码 pageNum
+	pageSize int // 每页数量 pageSize
 }
 
 type orderparam struct {
-	column string `json:"column"`
-	order  string `json:"order"`
+	column string
+	order  string
 }
 
 type ReqParam struct {
@@ -81,8 +114,58 @@ type TokenItem struct {
 	Status             string `json:"status"`
 }
 
-// 获取场景管理分页接口的所有数据
+// SceneTokenListURL 场景管理（网关 token）列表接口
+const SceneTokenListURL = "/apis/auth.engine.io/v1/workspaces/2/tokens/list"
+
+func init() {
+	cache.Register([]TokenItem{})
+}
+
+// GetSceneManageInfo 获取场景管理分页接口的所有数据，返回副本，调用方可修改
 func (c *DCEClient) GetSceneManageInfo(url string, pageSize int) ([]TokenItem, error) {
+	key := cache.Key(cache.SourceDCE, "scene_manage", url, pageSize, DceTokenFromContext(c.ctx))
+	val, err := cache.ForSource(cache.SourceDCE).Load(c.ctx, key, func(ctx context.Context) (interface{}, error) {
+		var items []TokenItem
+		err := upstream.Get(upstream.DCE).Do(ctx, func(context.Context) error {
+			var err error
+			items, err = c.fetchSceneManageInfo(url, pageSize)
+			return err
+		})
+		return items, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := val.([]TokenItem)
+	return append(make([]TokenItem, 0, len(items)), items...), nil
+}
+
+// DCEError DCE 拒绝了请求：HTTP 4xx/5xx，或响应中的业务错误码
+type DCEError struct {
+	StatusCode int
+	Code       int // 业务错误码，HTTP 错误时为 0
+	Message    string
+}
+
+func (e *DCEError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("接口返回错误: 代码: %d, 消息: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("接口返回错误: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// ClientError token 过期、无权限、参数错误及业务错误由调用方引起，不计入上游熔断；
+// 限流（429）及 5xx 仍视为 DCE 故障
+func (e *DCEError) ClientError() bool {
+	if e.Code != 0 {
+		return true
+	}
+	return e.StatusCode >= http.StatusBadRequest && e.StatusCode < http.StatusInternalServerError &&
+		e.StatusCode != http.StatusTooManyRequests
+}
+
+// 逐页请求场景管理接口
+func (c *DCEClient) fetchSceneManageInfo(url string, pageSize int) ([]TokenItem, error) {
 	// 初始化返回结果
 	var allItems []TokenItem
 
@@ -98,20 +181,24 @@ func (c *DCEClient) GetSceneManageInfo(url string, pageSize int) ([]TokenItem, e
 		resp, err := c.client.R().SetAuthToken(getDceToken(c.ctx)).
 			SetBody(reqParam).Post(url)
 		if err != nil {
-			log.Println(err)
+			return nil, fmt.Errorf("请求场景管理接口失败: %w", err)
+		}
+		if resp.StatusCode() >= http.StatusBadRequest {
+			return nil, &DCEError{StatusCode: resp.StatusCode(), Message: truncate(string(resp.Body()))}
 		}
 
 		// 读取响应体
 		bodyBytes := resp.Body()
-		if err != nil {
-			return nil, fmt.Errorf("读取响应体失败: %v", err)
-		}
 
 		// 解析响应
 		var response ApiResponse
 		if err := json.Unmarshal(bodyBytes, &response); err != nil {
 			return nil, fmt.Errorf("解析JSON失败: %v, 原始响应: %s", err, string(bodyBytes))
 		}
+		// 检查API响应状态码
+		if response.Code != 0 && response.Code != 200 {
+			return nil, &DCEError{StatusCode: resp.StatusCode(), Code: response.Code, Message: response.Message}
+		}
 		// 首次请求时设置总页数
 		if currentPage == 1 {
 			totalItems := response.Data.Total
@@ -120,11 +207,6 @@ func (c *DCEClient) GetSceneManageInfo(url string, pageSize int) ([]TokenItem, e
 			allItems = make([]TokenItem, 0, totalItems)
 		}
 
-		// 检查API响应状态码
-		if response.Code != 0 && response.Code != 200 {
-			return nil, fmt.Errorf("接口返回错误: 代码: %d, 消息: %s", response.Code, response.Message)
-		}
-
 		// 添加到总结果
 		allItems = append(allItems, response.Data.Items...)
 
@@ -135,123 +217,39 @@ func (c *DCEClient) GetSceneManageInfo(url string, pageSize int) ([]TokenItem, e
 	return allItems, nil
 }
 
-func (c *DCEClient) MakeGetReqRange(query map[string]string, url string) (*types.VectorResponse, error) {
-	resp, err := c.client.R().SetAuthToken(getDceToken(c.ctx)).
-		SetQueryParam("query", query["query"]).
-		SetQueryParam("start", query["start"]).
-		SetQueryParam("end", query["end"]).
-		SetQueryParam("step", strconv.Itoa(60)).Get(url)
-	if err != nil {
-		log.Println(err)
-	}
-
-	respBody := resp.Body()
-	var decompressed []byte
-	if len(respBody) > 2 && respBody[0] == 0x1f && respBody[1] == 0x8b {
-		// GZIP 魔术头匹配 → 解压
-		gr, err := gzip.NewReader(bytes.NewReader(respBody))
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer gr.Close()
-		decompressed, err = ioutil.ReadAll(gr)
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else {
-		decompressed = respBody
-	}
-	result := &types.VectorResponse{}
-	err = json.Unmarshal(decompressed, result)
-	// 使用辅助函数填充缺失字段
-	return result, err
+// CurrentUser DCE 当前登录用户
+type CurrentUser struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
 }
 
-func (c *DCEClient) GetClusterName(urlStr string) []types.NameList {
-	f := time.Now().Unix()
-	t := time.Now().Add(-5 * time.Minute).Unix()
-	nowStr := strconv.FormatInt(f, 10)
-	fiveMinutesAgoStr := strconv.FormatInt(t, 10)
-
-	query := map[string]string{
-		"query": "kpanda_gpu_count",
-		"start": fiveMinutesAgoStr,
-		"end":   nowStr,
-	}
-
-	resp, err := c.client.R().SetAuthToken(getDceToken(c.ctx)).
-		SetQueryParam("query", query["query"]).
-		SetQueryParam("start", query["start"]).
-		SetQueryParam("end", query["end"]).
-		SetQueryParam("step", strconv.Itoa(60)).Get(urlStr)
+// ErrDceUnauthorized DCE 拒绝了当前 token
+var ErrDceUnauthorized = errors.New("dce token unauthorized")
 
+// GetCurrentUser 使用 ctx 中的调用方 token 查询当前用户，用于校验 token 是否有效
+func (c *DCEClient) GetCurrentUser(url string) (*CurrentUser, error) {
+	resp, err := c.client.R().SetAuthToken(getDceToken(c.ctx)).Get(url)
 	if err != nil {
-		log.Println(err)
+		return nil, fmt.Errorf("查询当前用户失败: %w", err)
 	}
-	respBody := resp.Body()
-	var decompressed []byte
-	if len(respBody) > 2 && respBody[0] == 0x1f && respBody[1] == 0x8b {
-		// GZIP 魔术头匹配 → 解压
-		gr, err := gzip.NewReader(bytes.NewReader(respBody))
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer gr.Close()
-		decompressed, err = ioutil.ReadAll(gr)
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else {
-		decompressed = respBody
+	if resp.StatusCode() == http.StatusUnauthorized || resp.StatusCode() == http.StatusForbidden {
+		return nil, ErrDceUnauthorized
 	}
-	var result types.VectorResponse
-	err = json.Unmarshal(decompressed, &result)
-	nMap := make(map[string]string)
-	for i := range result.Matrix {
-		clustername := result.Matrix[i].Metric.ClusterName + result.Matrix[i].Metric.Cluster_Name
-		cluster := result.Matrix[i].Metric.Cluster
-		nMap[cluster] = clustername
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("查询当前用户失败: HTTP %d", resp.StatusCode())
 	}
 
-	nameList := make([]types.NameList, 0)
-	for k, v := range nMap {
-		nameList = append(nameList, types.NameList{
-			Cluster:     k,
-			ClusterName: v,
-		})
+	user := &CurrentUser{}
+	if err := json.Unmarshal(resp.Body(), user); err != nil {
+		return nil, fmt.Errorf("解析当前用户失败: %w", err)
 	}
-
-	return nameList
-}
-
-func (c *DCEClient) MakePostReqRange(query map[string]string, url string) (types.VectorResponse, error) {
-	resp, err := c.client.R().SetAuthToken(getDceToken(c.ctx)).
-		SetQueryParam("query", query["query"]).
-		SetQueryParam("start", query["start"]).
-		SetQueryParam("end", query["end"]).
-		SetQueryParam("step", strconv.Itoa(60)).Post(url)
-	if err != nil {
-		log.Println(err)
+	if user.Username == "" {
+		user.Username = user.Name
 	}
-
-	respBody := resp.Body()
-	var decompressed []byte
-	if len(respBody) > 2 && respBody[0] == 0x1f && respBody[1] == 0x8b {
-		// GZIP 魔术头匹配 → 解压
-		gr, err := gzip.NewReader(bytes.NewReader(respBody))
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer gr.Close()
-		decompressed, err = ioutil.ReadAll(gr)
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else {
-		decompressed = respBody
+	if user.Username == "" {
+		return nil, ErrDceUnauthorized
 	}
-	var result types.VectorResponse
-	err = json.Unmarshal(decompressed, &result)
-	// 使用辅助函数填充缺失字段
-	return result, err
+	return user, nil
 }
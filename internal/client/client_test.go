@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"monitor/config"
+	"monitor/internal/upstream"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetDceToken(t *testing.T) {
+	defer func(gc config.GrafanaQueryConfig) { config.Gc = gc }(config.Gc)
+	config.Gc = config.GrafanaQueryConfig{Token: "service-token"}
+
+	// gin.Context.Value 按字符串键返回 c.Get 的值
+	ginCtx := context.WithValue(context.Background(), DceTokenKey, "user-token")
+	if got := getDceToken(ginCtx); got != "user-token" {
+		t.Errorf("gin token = %q", got)
+	}
+	if got := getDceToken(WithDceToken(context.Background(), "task-token")); got != "task-token" {
+		t.Errorf("detached token = %q", got)
+	}
+
+	if got := getDceToken(context.Background()); got != "" {
+		t.Errorf("fallback none should not use service token, got %q", got)
+	}
+	config.Gc.TokenFallback = config.TokenFallbackService
+	if got := getDceToken(context.Background()); got != "service-token" {
+		t.Errorf("fallback service = %q", got)
+	}
+}
+
+// 用户 token 过期导致的 401 不计入 DCE 熔断，其他用户不受影响
+func TestSceneManageClientErrorsKeepBreakerClosed(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") == "Bearer business-error" {
+			w.Write([]byte(`{"code":40003,"message":"workspace not found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"code":16,"message":"token expired"}`))
+	}))
+	defer srv.Close()
+
+	guard := upstream.Get(upstream.DCE)
+	for i := range 10 {
+		token := "stale-token"
+		if i%2 == 1 {
+			token = "business-error"
+		}
+		c := NewDCEClient(WithDceToken(context.Background(), token), srv.URL, false)
+		_, err := c.GetSceneManageInfo(SceneTokenListURL, 100)
+		var dceErr *DCEError
+		if !errors.As(err, &dceErr) || !dceErr.ClientError() {
+			t.Fatalf("err = %v, want client DCEError", err)
+		}
+	}
+	if calls.Load() < 10 {
+		t.Errorf("calls = %d, want every request to reach DCE", calls.Load())
+	}
+	if status := guard.Status(); status.State != upstream.StateClosed || status.Failures != 0 {
+		t.Errorf("breaker = %+v, want closed", status)
+	}
+
+	for code, client := range map[int]bool{http.StatusForbidden: true, http.StatusTooManyRequests: false, http.StatusBadGateway: false} {
+		if got := (&DCEError{StatusCode: code}).ClientError(); got != client {
+			t.Errorf("HTTP %d client error = %v", code, got)
+		}
+	}
+}
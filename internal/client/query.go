@@ -0,0 +1,516 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"monitor/internal/types"
+	"monitor/internal/upstream"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// 指标查询接口路径
+type QueryPaths struct {
+	Query       string // 即时查询
+	QueryRange  string // 区间查询
+	Series      string // 序列查询
+	LabelValues string // 标签值查询，%s 为标签名
+	// 时间参数保留毫秒（小数秒），仅 Prometheus 原生接口支持；
+	// Insight 经 grpc-gateway 按 int64 解析 start、end、step，须为整数秒
+	FractionalTime bool
+}
+
+// PrometheusPaths 标准 Prometheus HTTP API，VictoriaMetrics 兼容
+var PrometheusPaths = QueryPaths{
+	Query:          "/api/v1/query",
+	QueryRange:     "/api/v1/query_range",
+	Series:         "/api/v1/series",
+	LabelValues:    "/api/v1/label/%s/values",
+	FractionalTime: true,
+}
+
+// InsightPaths DCE Insight 指标代理接口
+var InsightPaths = QueryPaths{
+	Query:       "/apis/insight.io/v1alpha1/metric/query",
+	QueryRange:  "/apis/insight.io/v1alpha1/metric/queryrange",
+	Series:      "/apis/insight.io/v1alpha1/metric/series",
+	LabelValues: "/apis/insight.io/v1alpha1/metric/labels/%s/values",
+}
+
+const (
+	// DefaultStep 区间查询未指定步长时使用
+	DefaultStep = time.Minute
+	// 单条序列最多返回的点数，与 Prometheus 的限制一致，超过时自动放大步长
+	maxRangePoints = 11000
+)
+
+// Prometheus HTTP API 的 errorType
+const (
+	ErrorTypeBadData     = "bad_data"
+	ErrorTypeTimeout     = "timeout"
+	ErrorTypeCanceled    = "canceled"
+	ErrorTypeExecution   = "execution"
+	ErrorTypeInternal    = "internal"
+	ErrorTypeUnavailable = "unavailable"
+	ErrorTypeNotFound    = "not_found"
+	// 非 Prometheus 定义，token 无效或无权限
+	ErrorTypeUnauthorized = "unauthorized"
+)
+
+// 查询错误类别，使用 errors.Is 判断
+var (
+	ErrQueryBadData      = errors.New("query bad data")
+	ErrQueryTimeout      = errors.New("query timeout")
+	ErrQueryCanceled     = errors.New("query canceled")
+	ErrQueryExecution    = errors.New("query execution failed")
+	ErrQueryInternal     = errors.New("query internal error")
+	ErrQueryUnavailable  = errors.New("query service unavailable")
+	ErrQueryNotFound     = errors.New("query not found")
+	ErrQueryUnauthorized = errors.New("query unauthorized")
+)
+
+var queryErrorKinds = map[string]error{
+	ErrorTypeBadData:      ErrQueryBadData,
+	ErrorTypeTimeout:      ErrQueryTimeout,
+	ErrorTypeCanceled:     ErrQueryCanceled,
+	ErrorTypeExecution:    ErrQueryExecution,
+	ErrorTypeInternal:     ErrQueryInternal,
+	ErrorTypeUnavailable:  ErrQueryUnavailable,
+	ErrorTypeNotFound:     ErrQueryNotFound,
+	ErrorTypeUnauthorized: ErrQueryUnauthorized,
+}
+
+// QueryError 指标查询失败
+type QueryError struct {
+	Type       string // errorType
+	Message    string
+	StatusCode int // HTTP 状态码，请求未发出时为 0
+	Query      string
+}
+
+func (e *QueryError) Error() string {
+	if e.Query != "" {
+		return fmt.Sprintf("指标查询失败(%s): %s, query: %s", e.Type, e.Message, e.Query)
+	}
+	return fmt.Sprintf("指标查询失败(%s): %s", e.Type, e.Message)
+}
+
+func (e *QueryError) Unwrap() error {
+	if kind, ok := queryErrorKinds[e.Type]; ok {
+		return kind
+	}
+	return ErrQueryInternal
+}
+
+// ClientError 查询语句、权限等由调用方引起的错误，不计入上游熔断
+func (e *QueryError) ClientError() bool {
+	switch e.Type {
+	case ErrorTypeBadData, ErrorTypeNotFound, ErrorTypeUnauthorized, ErrorTypeCanceled:
+		return true
+	}
+	return false
+}
+
+// Range 区间查询的时间范围，Step 为 0 时使用 DefaultStep
+type Range struct {
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+// QueryClient PromQL 查询客户端，兼容 Prometheus HTTP API 与 DCE Insight 代理的响应格式
+type QueryClient struct {
+	client *resty.Client
+	paths  QueryPaths
+	token  func(ctx context.Context) string
+	guard  *upstream.Guard
+}
+
+// NewQueryClient 默认使用 Insight 代理接口，token 从每次查询的 ctx 中获取
+func NewQueryClient(baseURL string, skipVerify bool) *QueryClient {
+	c := resty.New().
+		SetRetryCount(1).
+		SetRetryWaitTime(1 * time.Second).
+		SetRetryMaxWaitTime(3 * time.Second).
+		SetTLSClientConfig(&tls.Config{InsecureSkipVerify: skipVerify}).
+		SetBaseURL(baseURL)
+	return &QueryClient{client: c, paths: InsightPaths, token: getDceToken}
+}
+
+// WithPaths 使用其他的查询接口路径
+func (q *QueryClient) WithPaths(paths QueryPaths) *QueryClient {
+	q.paths = paths
+	return q
+}
+
+// WithStaticToken 使用固定 token 而不是调用方的 DCE token，为空时不携带认证头
+func (q *QueryClient) WithStaticToken(token string) *QueryClient {
+	q.token = func(context.Context) string { return token }
+	return q
+}
+
+// WithGuard 经上游的并发限制、限流与熔断发送请求
+func (q *QueryClient) WithGuard(guard *upstream.Guard) *QueryClient {
+	q.guard = guard
+	return q
+}
+
+// Query 即时查询，at 为零值时使用当前时间
+func (q *QueryClient) Query(ctx context.Context, expr string, at time.Time) (*types.VectorResponse, error) {
+	params := map[string]string{"query": expr}
+	if !at.IsZero() {
+		params["time"] = q.formatTime(at)
+	}
+	env, err := q.do(ctx, q.paths.Query, expr, params)
+	if err != nil {
+		return nil, err
+	}
+	return env.vectorResponse(expr)
+}
+
+// QueryRange 区间查询，点数过多时自动放大步长
+func (q *QueryClient) QueryRange(ctx context.Context, expr string, r Range) (*types.VectorResponse, error) {
+	if r.End.Before(r.Start) {
+		return nil, &QueryError{Type: ErrorTypeBadData, Message: "end 不能早于 start", Query: expr}
+	}
+	step := rangeStep(r)
+	params := map[string]string{
+		"query": expr,
+		"start": q.formatTime(r.Start),
+		"end":   q.formatTime(r.End),
+		"step":  q.formatStep(step),
+	}
+	env, err := q.do(ctx, q.paths.QueryRange, expr, params)
+	if err != nil {
+		return nil, err
+	}
+	return env.vectorResponse(expr)
+}
+
+// Series 查询匹配 matchers 的序列标签
+func (q *QueryClient) Series(ctx context.Context, matchers []string, start, end time.Time) ([]map[string]string, error) {
+	if len(matchers) == 0 {
+		return nil, &QueryError{Type: ErrorTypeBadData, Message: "至少需要一个 match[]"}
+	}
+	req := q.request(ctx).SetQueryParamsFromValues(map[string][]string{"match[]": matchers})
+	q.setTimeRange(req, start, end)
+	env, err := q.send(req, q.paths.Series, strings.Join(matchers, ","))
+	if err != nil {
+		return nil, err
+	}
+	series := make([]map[string]string, 0)
+	if err := env.decodeData(&series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// LabelValues 查询标签的所有取值，matchers 为空时不限制序列
+func (q *QueryClient) LabelValues(ctx context.Context, label string, matchers []string, start, end time.Time) ([]string, error) {
+	if label == "" {
+		return nil, &QueryError{Type: ErrorTypeBadData, Message: "标签名不能为空"}
+	}
+	req := q.request(ctx)
+	if len(matchers) > 0 {
+		req.SetQueryParamsFromValues(map[string][]string{"match[]": matchers})
+	}
+	q.setTimeRange(req, start, end)
+	env, err := q.send(req, fmt.Sprintf(q.paths.LabelValues, label), label)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0)
+	if err := env.decodeData(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (q *QueryClient) request(ctx context.Context) *resty.Request {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return q.client.R().SetContext(ctx).SetAuthToken(q.token(ctx))
+}
+
+func (q *QueryClient) do(ctx context.Context, path, expr string, params map[string]string) (*queryEnvelope, error) {
+	return q.send(q.request(ctx).SetQueryParams(params), path, expr)
+}
+
+func (q *QueryClient) send(req *resty.Request, path, expr string) (*queryEnvelope, error) {
+	if q.guard == nil {
+		return q.get(req, path, expr)
+	}
+	var env *queryEnvelope
+	err := q.guard.Do(req.Context(), func(context.Context) error {
+		var err error
+		env, err = q.get(req, path, expr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func (q *QueryClient) get(req *resty.Request, path, expr string) (*queryEnvelope, error) {
+	resp, err := req.Get(path)
+	if err != nil {
+		return nil, transportError(err, expr)
+	}
+	body, err := decodeBody(resp.Body())
+	if err != nil {
+		return nil, &QueryError{Type: ErrorTypeInternal, Message: err.Error(), StatusCode: resp.StatusCode(), Query: expr}
+	}
+	return parseEnvelope(resp.StatusCode(), body, expr)
+}
+
+// 步长至少 1 秒，且保证点数不超过 maxRangePoints
+func rangeStep(r Range) time.Duration {
+	step := r.Step
+	if step <= 0 {
+		step = DefaultStep
+	}
+	if step < time.Second {
+		step = time.Second
+	}
+	if points := r.End.Sub(r.Start) / step; points > maxRangePoints {
+		step = time.Duration(math.Ceil(float64(r.End.Sub(r.Start))/maxRangePoints/float64(time.Second))) * time.Second
+	}
+	return step
+}
+
+// 秒级 unix 时间戳，Prometheus 原生接口保留毫秒，其他接口为整数秒
+func (q *QueryClient) formatTime(t time.Time) string {
+	if q.paths.FractionalTime {
+		return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// 步长秒数，不支持小数秒的接口向上取整
+func (q *QueryClient) formatStep(step time.Duration) string {
+	if q.paths.FractionalTime {
+		return strconv.FormatFloat(step.Seconds(), 'f', -1, 64)
+	}
+	return strconv.FormatInt(int64(math.Ceil(step.Seconds())), 10)
+}
+
+func (q *QueryClient) setTimeRange(req *resty.Request, start, end time.Time) {
+	if !start.IsZero() {
+		req.SetQueryParam("start", q.formatTime(start))
+	}
+	if !end.IsZero() {
+		req.SetQueryParam("end", q.formatTime(end))
+	}
+}
+
+func transportError(err error, expr string) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return &QueryError{Type: ErrorTypeCanceled, Message: err.Error(), Query: expr}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &QueryError{Type: ErrorTypeTimeout, Message: err.Error(), Query: expr}
+	default:
+		return &QueryError{Type: ErrorTypeUnavailable, Message: err.Error(), Query: expr}
+	}
+}
+
+// 响应体可能未按 Content-Encoding 声明而直接 gzip 压缩
+func decodeBody(body []byte) ([]byte, error) {
+	if len(body) < 2 || body[0] != 0x1f || body[1] != 0x8b {
+		return body, nil
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("解压响应失败: %w", err)
+	}
+	defer gr.Close()
+	data, err := io.ReadAll(gr)
+	if err != nil {
+		return nil, fmt.Errorf("解压响应失败: %w", err)
+	}
+	return data, nil
+}
+
+// queryEnvelope 同时兼容 Prometheus（status/data）与 Insight（matrix/vector，错误为 code/message）两种格式
+type queryEnvelope struct {
+	Status    string          `json:"status"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+
+	Matrix  []types.MatrixItem `json:"matrix"`
+	Vector  []insightSample    `json:"vector"`
+	Code    *int               `json:"code"`
+	Message string             `json:"message"`
+
+	statusCode int
+	query      string
+}
+
+type insightSample struct {
+	Metric types.Metric    `json:"metric"`
+	Value  types.DataPoint `json:"value"`
+}
+
+func parseEnvelope(statusCode int, body []byte, expr string) (*queryEnvelope, error) {
+	env := &queryEnvelope{statusCode: statusCode, query: expr}
+	if err := json.Unmarshal(body, env); err != nil {
+		if statusCode >= http.StatusBadRequest {
+			return nil, &QueryError{Type: httpErrorType(statusCode), Message: truncate(string(body)), StatusCode: statusCode, Query: expr}
+		}
+		return nil, &QueryError{Type: ErrorTypeInternal, Message: fmt.Sprintf("解析响应失败: %v", err), StatusCode: statusCode, Query: expr}
+	}
+	if env.Status == "error" {
+		errType := env.ErrorType
+		if errType == "" {
+			errType = httpErrorType(statusCode)
+		}
+		return nil, &QueryError{Type: errType, Message: env.Error, StatusCode: statusCode, Query: expr}
+	}
+	if env.Code != nil && *env.Code > 0 && *env.Code <= 16 {
+		return nil, &QueryError{Type: grpcErrorType(*env.Code, statusCode), Message: env.Message, StatusCode: statusCode, Query: expr}
+	}
+	if statusCode >= http.StatusBadRequest {
+		return nil, &QueryError{Type: httpErrorType(statusCode), Message: truncate(string(body)), StatusCode: statusCode, Query: expr}
+	}
+	return env, nil
+}
+
+func (e *queryEnvelope) decodeData(v interface{}) error {
+	if len(e.Data) == 0 || string(e.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return &QueryError{Type: ErrorTypeInternal, Message: fmt.Sprintf("解析响应数据失败: %v", err), StatusCode: e.statusCode, Query: e.query}
+	}
+	return nil
+}
+
+// vectorResponse 统一转换为 matrix 结构，即时查询每条序列只有一个点
+func (e *queryEnvelope) vectorResponse(expr string) (*types.VectorResponse, error) {
+	result := &types.VectorResponse{Matrix: make([]types.MatrixItem, 0)}
+	if e.Status == "" {
+		result.Matrix = append(result.Matrix, e.Matrix...)
+		for _, s := range e.Vector {
+			result.Matrix = append(result.Matrix, types.MatrixItem{Metric: s.Metric, Values: []types.DataPoint{s.Value}})
+		}
+		return result, nil
+	}
+
+	var data struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := e.decodeData(&data); err != nil {
+		return nil, err
+	}
+	switch data.ResultType {
+	case "matrix", "vector":
+		var samples []struct {
+			Metric types.Metric `json:"metric"`
+			Value  *promPoint   `json:"value"`
+			Values []promPoint  `json:"values"`
+		}
+		if err := json.Unmarshal(data.Result, &samples); err != nil {
+			return nil, &QueryError{Type: ErrorTypeInternal, Message: fmt.Sprintf("解析查询结果失败: %v", err), Query: expr}
+		}
+		for _, s := range samples {
+			item := types.MatrixItem{Metric: s.Metric, Values: make([]types.DataPoint, 0, len(s.Values)+1)}
+			if s.Value != nil {
+				item.Values = append(item.Values, types.DataPoint(*s.Value))
+			}
+			for _, p := range s.Values {
+				item.Values = append(item.Values, types.DataPoint(p))
+			}
+			result.Matrix = append(result.Matrix, item)
+		}
+	case "scalar", "string":
+		var p promPoint
+		if err := json.Unmarshal(data.Result, &p); err != nil {
+			return nil, &QueryError{Type: ErrorTypeInternal, Message: fmt.Sprintf("解析查询结果失败: %v", err), Query: expr}
+		}
+		result.Matrix = append(result.Matrix, types.MatrixItem{Values: []types.DataPoint{types.DataPoint(p)}})
+	case "":
+	default:
+		return nil, &QueryError{Type: ErrorTypeInternal, Message: "未知的结果类型: " + data.ResultType, Query: expr}
+	}
+	return result, nil
+}
+
+// promPoint Prometheus 的 [秒级时间戳, "值"]，时间戳转为毫秒字符串，与 Insight 一致
+type promPoint types.DataPoint
+
+func (p *promPoint) UnmarshalJSON(b []byte) error {
+	var raw [2]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	ts, ok := raw[0].(float64)
+	if !ok {
+		return fmt.Errorf("无效的时间戳: %v", raw[0])
+	}
+	p.Timestamp = strconv.FormatInt(int64(math.Round(ts*1000)), 10)
+	p.Value = fmt.Sprint(raw[1])
+	return nil
+}
+
+func httpErrorType(statusCode int) string {
+	switch {
+	case statusCode == http.StatusBadRequest || statusCode == http.StatusUnprocessableEntity:
+		return ErrorTypeBadData
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorTypeUnauthorized
+	case statusCode == http.StatusNotFound:
+		return ErrorTypeNotFound
+	case statusCode == http.StatusServiceUnavailable || statusCode == http.StatusBadGateway:
+		return ErrorTypeUnavailable
+	case statusCode == http.StatusGatewayTimeout:
+		return ErrorTypeTimeout
+	default:
+		return ErrorTypeInternal
+	}
+}
+
+// Insight 通过 grpc-gateway 返回错误，code 为 gRPC 状态码
+func grpcErrorType(code, statusCode int) string {
+	switch code {
+	case 1:
+		return ErrorTypeCanceled
+	case 3, 9, 11:
+		return ErrorTypeBadData
+	case 4:
+		return ErrorTypeTimeout
+	case 5:
+		return ErrorTypeNotFound
+	case 7, 16:
+		return ErrorTypeUnauthorized
+	case 14:
+		return ErrorTypeUnavailable
+	default:
+		if statusCode >= http.StatusBadRequest {
+			return httpErrorType(statusCode)
+		}
+		return ErrorTypeInternal
+	}
+}
+
+func truncate(s string) string {
+	const max = 256
+	if len(s) > max {
+		return s[:max] + "..."
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueryClient(t *testing.T) {
+	var lastQuery map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastQuery = r.URL.Query()
+		switch r.URL.Path {
+		case "/prom/query_range":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"cluster":"c1"},"values":[[1700000000,"1"],[1700000060.5,"2"]]}]}}`))
+		case "/prom/query":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		case "/prom/series":
+			w.Write([]byte(`{"status":"success","data":[{"__name__":"up","cluster":"c1"}]}`))
+		case "/prom/labels/cluster/values":
+			w.Write([]byte(`{"status":"success","data":["c1","c2"]}`))
+		case "/insight/queryrange":
+			// Insight 直接返回 gzip 压缩的 matrix
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			gw.Write([]byte(`{"matrix":[{"metric":{"cluster":"c2"},"values":[{"timestamp":"1700000000000","value":"3"}]}]}`))
+			gw.Close()
+			w.Write(buf.Bytes())
+		case "/insight/query":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":16,"message":"token expired"}`))
+		default:
+			w.Write([]byte{0x1f, 0x8b, 0x00})
+		}
+	}))
+	defer srv.Close()
+
+	ctx := WithDceToken(context.Background(), "user-token")
+	prom := NewQueryClient(srv.URL, false).WithPaths(QueryPaths{
+		Query:          "/prom/query",
+		QueryRange:     "/prom/query_range",
+		Series:         "/prom/series",
+		LabelValues:    "/prom/labels/%s/values",
+		FractionalTime: true,
+	})
+	start := time.Unix(1700000000, 0)
+
+	res, err := prom.QueryRange(ctx, "up", Range{Start: start, End: start.Add(time.Hour), Step: 30 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastQuery["step"][0] != "30" || lastQuery["start"][0] != "1700000000" {
+		t.Errorf("unexpected params: %v", lastQuery)
+	}
+	if len(res.Matrix) != 1 || res.Matrix[0].Metric.Cluster != "c1" || res.Matrix[0].Values[1].Timestamp != "1700000060500" {
+		t.Errorf("unexpected matrix: %+v", res.Matrix)
+	}
+
+	// 点数超过上限时放大步长
+	prom.QueryRange(ctx, "up", Range{Start: start, End: start.Add(30 * 24 * time.Hour), Step: time.Second})
+	if lastQuery["step"][0] != "236" {
+		t.Errorf("step = %v, want 236", lastQuery["step"])
+	}
+
+	_, err = prom.Query(ctx, "up{", time.Time{})
+	var qe *QueryError
+	if !errors.As(err, &qe) || qe.Type != ErrorTypeBadData || !errors.Is(err, ErrQueryBadData) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	series, err := prom.Series(ctx, []string{"up"}, start, time.Time{})
+	if err != nil || len(series) != 1 || series[0]["cluster"] != "c1" {
+		t.Errorf("series = %v, err = %v", series, err)
+	}
+	values, err := prom.LabelValues(ctx, "cluster", nil, time.Time{}, time.Time{})
+	if err != nil || len(values) != 2 {
+		t.Errorf("label values = %v, err = %v", values, err)
+	}
+
+	insight := NewQueryClient(srv.URL, false).WithPaths(QueryPaths{Query: "/insight/query", QueryRange: "/insight/queryrange"})
+	res, err = insight.QueryRange(ctx, "up", Range{Start: start, End: start.Add(time.Hour)})
+	if err != nil || len(res.Matrix) != 1 || res.Matrix[0].Values[0].Value != "3" {
+		t.Errorf("insight matrix = %+v, err = %v", res, err)
+	}
+	if _, err = insight.Query(ctx, "up", time.Time{}); !errors.Is(err, ErrQueryUnauthorized) {
+		t.Errorf("insight error = %v", err)
+	}
+
+	// Insight 按 int64 解析时间参数，非整秒时间截断为整数秒
+	insight.QueryRange(ctx, "up", Range{Start: start.Add(250 * time.Millisecond), End: start.Add(time.Hour + 750*time.Millisecond), Step: 1500 * time.Millisecond})
+	if lastQuery["start"][0] != "1700000000" || lastQuery["end"][0] != "1700003600" || lastQuery["step"][0] != "2" {
+		t.Errorf("insight params = %v", lastQuery)
+	}
+	// Prometheus 原生接口保留毫秒
+	prom.QueryRange(ctx, "up", Range{Start: start.Add(250 * time.Millisecond), End: start.Add(time.Hour), Step: 1500 * time.Millisecond})
+	if lastQuery["start"][0] != "1700000000.25" || lastQuery["step"][0] != "1.5" {
+		t.Errorf("prometheus params = %v", lastQuery)
+	}
+
+	// 损坏的 gzip 响应返回错误而不是退出进程
+	broken := NewQueryClient(srv.URL, false).WithPaths(QueryPaths{QueryRange: "/broken"})
+	if _, err = broken.QueryRange(ctx, "up", Range{Start: start, End: start}); !errors.Is(err, ErrQueryInternal) {
+		t.Errorf("broken gzip error = %v", err)
+	}
+}
@@ -30,6 +30,7 @@ type ClusterListRequest struct {
 	To   string `form:"to"`
 	Page int    `form:"page"`
 	Size int    `form:"size"`
+	Step string `form:"step"` // 指标查询步长，如 30s、5m，默认 1m
 }
 
 type NodesListRequest struct {
@@ -118,6 +119,11 @@ type ModelCard struct {
 	Qps       float64 `json:"qps"`      //模型qps
 	Status    string  `json:"status"`
 	Url       string  `json:"url"`
+	// token 用量
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Tps              float64 `json:"tps"` //每秒token数
 }
 
 type ModelPodDetail struct {
@@ -149,6 +155,22 @@ type SceneWithCodeRequest struct {
 	ModelName string `form:"model_name"`
 }
 
+// 请求日志检索参数，cursor 为上一页返回的 next_cursor
+type LogSearchRequest struct {
+	From       string  `form:"from"`
+	To         string  `form:"to"`
+	AuthCode   string  `form:"authorization_code"`
+	ModelName  string  `form:"model_name"`
+	Status     string  `form:"status"` // success、failed 或具体状态码
+	MinLatency float64 `form:"min_latency"`
+	MaxLatency float64 `form:"max_latency"`
+	Keyword    string  `form:"keyword"`
+	SortBy     string  `form:"sort_by"` // time、latency
+	Order      string  `form:"order"`   // desc、asc
+	Size       int     `form:"size"`
+	Cursor     string  `form:"cursor"`
+}
+
 type ModelsListRequest struct {
 	From string `form:"from"`
 	To   string `form:"to"`
@@ -160,6 +182,11 @@ type ModelWithCodeRequest struct {
 	To        string `form:"to"`
 	AuthCode  string `form:"authorization_code"`
 	ModelName string `form:"model_name"`
+	// 以下仅用于调用量趋势
+	Interval string `form:"interval"`  // minute、hour、day、week，为空或 auto 时按时间跨度自动选择
+	Timezone string `form:"timezone"`  // 默认 Asia/Shanghai
+	SeriesBy string `form:"series_by"` // model、scene，为空时只返回一条序列
+	Series   string `form:"series"`    // 逗号分隔的对比模型或场景token
 }
 
 type TaskListRequest struct {
@@ -181,6 +208,12 @@ type TaskSearchRequest struct {
 	Name string `form:"name"`
 }
 
+type TokenUsageRequest struct {
+	From    string `form:"from"`
+	To      string `form:"to"`
+	GroupBy string `form:"group_by"` // scene、model、dept
+}
+
 type DataGenerateReq struct {
 	LedgerType int `form:"ledger_type"`
 	From       int `form:"from"`
@@ -190,6 +223,7 @@ type TaskMetaRequest struct {
 	Data         json.RawMessage `json:"data"` // 使用 RawMessage 处理动态数据
 	Name         string          `json:"name"`
 	LedgerType   int             `json:"ledger_type"`
+	Format       string          `json:"format"` // 输出格式：xlsx（默认）、csv、json、pdf
 	From         int             `json:"from"`
 	To           int             `json:"to"`
 	ExecuteAt    time.Time       `json:"executeAt"`
@@ -197,11 +231,95 @@ type TaskMetaRequest struct {
 	MailType     int             `json:"mailType"`
 	MailHeader   string          `json:"mailHeader"`
 	Path         string          `json:"path"`
+	SnapshotID   string          `json:"snapshot_id"` // 数据预览返回的快照ID，用于核对提交的数据
+	Async        bool            `json:"async"`       // 后台生成，完成后通知；行数较多时自动转为后台生成
 }
 
-type DownloadLedgerReq struct {
-	LedgerName string `form:"ledger_name"`
+// PeriodPackRequest 周期汇总台账，from/to 与预览接口相同，为距 1970-01-01 的天数
+type PeriodPackRequest struct {
+	From int `json:"from" binding:"required"`
+	To   int `json:"to" binding:"required"`
+}
+
+// CompareLedgerRequest 周期对比台账，日期均为距 1970-01-01 的天数。
+// mode 为空时与紧邻的上一周期对比，wow/mom/yoy 为周、月、年同比，custom 时使用 base_from/base_to；
+// dimension 为 model、scene、dept、gpu，可用逗号分隔多个，为空表示全部
+type CompareLedgerRequest struct {
+	From      int    `form:"from" json:"from" binding:"required"`
+	To        int    `form:"to" json:"to" binding:"required"`
+	Mode      string `form:"mode" json:"mode"`
+	BaseFrom  int    `form:"base_from" json:"base_from"`
+	BaseTo    int    `form:"base_to" json:"base_to"`
+	Dimension string `form:"dimension" json:"dimension"`
+}
+
+// LedgerDraftRequest 由监控数据生成待审批的台账草稿，from/to 为距 1970-01-01 的天数
+type LedgerDraftRequest struct {
+	LedgerType int `json:"ledger_type" binding:"required"`
+	From       int `json:"from" binding:"required"`
+	To         int `json:"to" binding:"required"`
+}
+
+type DraftListRequest struct {
+	Status     string `form:"status"` // draft、approved、rejected、finalized
 	LedgerType int    `form:"ledger_type"`
+	Page       int    `form:"page"`
+	Size       int    `form:"size"`
+}
+
+// DraftAdjustRequest 调整草稿第 row 行（从 0 开始）的字段，field 为预览数据中的字段名
+type DraftAdjustRequest struct {
+	Row    *int            `json:"row" binding:"required"`
+	Field  string          `json:"field" binding:"required"`
+	Value  json.RawMessage `json:"value" binding:"required"`
+	Reason string          `json:"reason" binding:"required"`
+}
+
+// DraftAnnotateRequest 批注，未指定 row 时针对整张台账
+type DraftAnnotateRequest struct {
+	Row  *int   `json:"row"`
+	Note string `json:"note" binding:"required"`
+}
+
+// DraftReviewRequest 审核意见，驳回时必填
+type DraftReviewRequest struct {
+	Comment string `json:"comment"`
+}
+
+type DraftFinalizeRequest struct {
+	Format string `json:"format"` // xlsx（默认）、csv、json、pdf
+}
+
+type TemplateListRequest struct {
+	LedgerType int `form:"ledger_type" binding:"required"`
+}
+
+// TemplateUploadRequest 上传台账模板，模板文件为表单字段 file
+type TemplateUploadRequest struct {
+	LedgerType int    `form:"ledger_type" binding:"required"`
+	Name       string `form:"name"`
+	Comment    string `form:"comment"` // 版本说明
+}
+
+// TemplateSelectRequest 选用模板，id 为 builtin 时恢复内置版式
+type TemplateSelectRequest struct {
+	LedgerType int    `json:"ledger_type" binding:"required"`
+	ID         string `json:"id" binding:"required"`
+}
+
+type DownloadLedgerReq struct {
+	ID string `form:"id" binding:"required"` // 生成台账时返回的文件ID
+}
+
+type ArtifactListRequest struct {
+	LedgerType int `form:"ledger_type"`
+	Page       int `form:"page"`
+	Size       int `form:"size"`
+}
+
+type JobListRequest struct {
+	Page int `form:"page"`
+	Size int `form:"size"`
 }
 
 type TaskMetaResp struct {
@@ -0,0 +1,391 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"monitor/internal/service/artifact"
+	"monitor/internal/service/dao"
+	"monitor/internal/service/ledger"
+	"monitor/util"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDraftNotFound  = dao.ErrDraftNotFound
+	ErrDraftConflict  = dao.ErrDraftConflict
+	ErrInvalidState   = errors.New("operation not allowed in current draft status")
+	ErrReasonRequired = errors.New("reason is required")
+	ErrInvalidRow     = errors.New("invalid row or field")
+	ErrSelfApproval   = errors.New("draft cannot be approved by its creator")
+)
+
+// Saver 保存定稿台账文件，即 artifact.Store
+type Saver interface {
+	Save(ctx context.Context, meta artifact.Meta, render func(w io.Writer) error) (*dao.Artifact, error)
+}
+
+// Workflow 台账审批流程：由监控数据生成草稿，审核人调整或批注（须填写原因），
+// 审批通过或驳回，通过后定稿输出附带审批信息及数据校验和的台账文件，定稿后不可再修改
+type Workflow struct {
+	dao   dao.IApprovalDao
+	saver Saver
+	now   func() time.Time
+}
+
+func NewWorkflow(approvalDao dao.IApprovalDao, saver Saver) *Workflow {
+	return &Workflow{dao: approvalDao, saver: saver, now: time.Now}
+}
+
+// Default 使用数据库及台账文件存储，数据库未连接时返回错误
+func Default() (*Workflow, error) {
+	store, err := artifact.Default()
+	if err != nil {
+		return nil, err
+	}
+	return NewWorkflow(dao.NewApprovalDao(nil), store), nil
+}
+
+// Detail 草稿及其数据、操作记录
+type Detail struct {
+	*dao.LedgerDraft
+	Data   json.RawMessage   `json:"data"`
+	Audits []dao.LedgerAudit `json:"audits"`
+}
+
+// Create 以监控数据生成的台账创建草稿，departments 为生成人的部门范围，为空时仅生成人及审批人可查看
+func (w *Workflow) Create(class *ledger.Class, rows ledger.Rows, from, to int64, creator string, departments []string) (*dao.LedgerDraft, error) {
+	data, err := json.Marshal(rows.Data)
+	if err != nil {
+		return nil, fmt.Errorf("台账数据格式错误: %w", err)
+	}
+	if rows.Data == nil {
+		data = []byte("[]")
+	}
+	now := w.now()
+	draft := &dao.LedgerDraft{
+		DraftID:        dao.NewUUID(),
+		LedgerType:     int(class.ID),
+		PeriodFrom:     from,
+		PeriodTo:       to,
+		Status:         dao.DraftStatusDraft,
+		Data:           string(data),
+		Rows:           rows.Len,
+		SourceChecksum: checksum(data),
+		Creator:        creator,
+		Departments:    departments,
+		Version:        1,
+		CreateTime:     now,
+		UpdateTime:     now,
+	}
+	audit := w.audit(draft, dao.DraftActionCreate, creator)
+	if err := w.dao.CreateDraft(draft, audit); err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// Get 草稿详情，不在 access 范围内时返回 ErrDraftNotFound
+func (w *Workflow) Get(id string, access dao.Access) (*Detail, error) {
+	draft, err := w.draft(id, access)
+	if err != nil {
+		return nil, err
+	}
+	audits, err := w.dao.ListAudits(id)
+	if err != nil {
+		return nil, err
+	}
+	return &Detail{LedgerDraft: draft, Data: json.RawMessage(draft.Data), Audits: audits}, nil
+}
+
+// List 分页查询 access 范围内的草稿，不含台账数据
+func (w *Workflow) List(status string, ledgerType int, access dao.Access, page, pageSize int) ([]dao.LedgerDraft, int64, error) {
+	return w.dao.ListDrafts(status, ledgerType, access, page, pageSize)
+}
+
+// Adjust 修改第 row 行（从 0 开始）字段 field 的值，记录原值、新值及原因。
+// 草稿或已驳回时可调整，已驳回的草稿调整后重新进入草稿状态
+func (w *Workflow) Adjust(id string, access dao.Access, row int, field string, value json.RawMessage, reason, operator string) (*dao.LedgerDraft, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	draft, err := w.editable(id, access)
+	if err != nil {
+		return nil, err
+	}
+	class, err := ledger.LookupClass(ledger.LedgerClass(draft.LedgerType))
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(draft.Data), &rows); err != nil {
+		return nil, fmt.Errorf("台账数据格式错误: %w", err)
+	}
+	if row < 0 || row >= len(rows) {
+		return nil, fmt.Errorf("%w: 第 %d 行不存在", ErrInvalidRow, row)
+	}
+	old, ok := rows[row][field]
+	if !ok {
+		return nil, fmt.Errorf("%w: 字段 %s 不存在", ErrInvalidRow, field)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, value); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRow, err)
+	}
+	rows[row][field] = compact.Bytes()
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	// 按台账类别的行类型校验，例如数值字段不能改为文本
+	if _, err := class.Decode(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRow, err)
+	}
+
+	version := draft.Version
+	draft.Data = string(data)
+	draft.Status = dao.DraftStatusDraft
+	draft.Adjustments++
+	audit := w.audit(draft, dao.DraftActionAdjust, operator)
+	audit.Row = row
+	audit.Field = field
+	audit.OldValue = string(old)
+	audit.NewValue = compact.String()
+	audit.Reason = reason
+	if err := w.dao.UpdateDraft(draft, version, audit); err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// Annotate 为第 row 行（-1 表示整张台账）添加批注，批注随审批信息输出
+func (w *Workflow) Annotate(id string, access dao.Access, row int, note, operator string) (*dao.LedgerDraft, error) {
+	if strings.TrimSpace(note) == "" {
+		return nil, ErrReasonRequired
+	}
+	draft, err := w.editable(id, access)
+	if err != nil {
+		return nil, err
+	}
+	if row < -1 || row >= draft.Rows {
+		return nil, fmt.Errorf("%w: 第 %d 行不存在", ErrInvalidRow, row)
+	}
+	version := draft.Version
+	audit := w.audit(draft, dao.DraftActionAnnotate, operator)
+	audit.Row = row
+	audit.Reason = note
+	if err := w.dao.UpdateDraft(draft, version, audit); err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// Approve 审核通过，生成人不能审批自己的草稿
+func (w *Workflow) Approve(id, comment, operator string) (*dao.LedgerDraft, error) {
+	draft, err := w.dao.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Status != dao.DraftStatusDraft {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidState, draft.Status)
+	}
+	if draft.Creator != "" && draft.Creator == operator {
+		return nil, ErrSelfApproval
+	}
+	return draft, w.review(draft, dao.DraftStatusApproved, dao.DraftActionApprove, comment, operator)
+}
+
+// Reject 驳回草稿或撤回尚未定稿的审批，须填写原因
+func (w *Workflow) Reject(id, reason, operator string) (*dao.LedgerDraft, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	draft, err := w.dao.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Status != dao.DraftStatusDraft && draft.Status != dao.DraftStatusApproved {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidState, draft.Status)
+	}
+	return draft, w.review(draft, dao.DraftStatusRejected, dao.DraftActionReject, reason, operator)
+}
+
+// Finalize 输出已审批的台账并保存为定稿文件，文件末尾附审批信息、人工调整记录及数据校验和
+func (w *Workflow) Finalize(ctx context.Context, id string, access dao.Access, format ledger.Format, operator string) (*dao.LedgerDraft, *dao.Artifact, error) {
+	draft, err := w.draft(id, access)
+	if err != nil {
+		return nil, nil, err
+	}
+	if draft.Status != dao.DraftStatusApproved {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidState, draft.Status)
+	}
+	class, err := ledger.LookupClass(ledger.LedgerClass(draft.LedgerType))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !class.Supports(format) {
+		return nil, nil, fmt.Errorf("%w: %s", ledger.ErrUnsupportedFormat, format)
+	}
+	rows, err := class.Decode([]byte(draft.Data))
+	if err != nil {
+		return nil, nil, err
+	}
+	rows.From, rows.To = draft.PeriodFrom, draft.PeriodTo
+	audits, err := w.dao.ListAudits(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := draft.Version
+	now := w.now()
+	draft.Status = dao.DraftStatusFinalized
+	draft.DataChecksum = checksum([]byte(draft.Data))
+	draft.FinalizedBy = operator
+	draft.FinalizedAt = &now
+	notes := Footer(draft, audits)
+	saved, err := w.saver.Save(ctx, artifact.Meta{
+		LedgerType:  draft.LedgerType,
+		Format:      string(format),
+		Name:        class.Name + "（定稿）" + util.GetTimeMinite() + "." + string(format),
+		PeriodFrom:  draft.PeriodFrom,
+		PeriodTo:    draft.PeriodTo,
+		Creator:     draft.Creator,
+		Departments: draft.Departments,
+		Rows:        rows.Len,
+		Final:       true,
+	}, func(out io.Writer) error {
+		return class.RenderNotes(out, format, rows, notes)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	draft.ArtifactID = saved.ArtifactID
+	audit := w.audit(draft, dao.DraftActionFinalize, operator)
+	audit.NewValue = saved.ArtifactID
+	if err := w.dao.UpdateDraft(draft, version, audit); err != nil {
+		return nil, nil, err
+	}
+	return draft, saved, nil
+}
+
+// Footer 定稿台账末尾的审批信息
+func Footer(draft *dao.LedgerDraft, audits []dao.LedgerAudit) []string {
+	notes := []string{
+		"审批信息",
+		"台账编号：" + draft.DraftID,
+		fmt.Sprintf("统计周期：%s 至 %s", formatTime(draft.PeriodFrom, "2006-01-02"), formatTime(draft.PeriodTo, "2006-01-02")),
+		fmt.Sprintf("生成人：%s，生成时间：%s", draft.Creator, formatTime(draft.CreateTime.UnixMilli(), time.DateTime)),
+	}
+	if draft.ReviewedAt != nil {
+		line := fmt.Sprintf("审核人：%s，审核时间：%s", draft.Reviewer, formatTime(draft.ReviewedAt.UnixMilli(), time.DateTime))
+		if draft.ReviewComment != "" {
+			line += "，审核意见：" + draft.ReviewComment
+		}
+		notes = append(notes, line)
+	}
+	if draft.FinalizedAt != nil {
+		notes = append(notes, fmt.Sprintf("定稿人：%s，定稿时间：%s", draft.FinalizedBy, formatTime(draft.FinalizedAt.UnixMilli(), time.DateTime)))
+	}
+
+	var adjusted, annotated []string
+	for _, a := range audits {
+		when := formatTime(a.CreateTime.UnixMilli(), time.DateTime)
+		switch a.Action {
+		case dao.DraftActionAdjust:
+			adjusted = append(adjusted, fmt.Sprintf("- 第 %d 行 %s：%s → %s，原因：%s（%s，%s）",
+				a.Row+1, a.Field, a.OldValue, a.NewValue, a.Reason, a.Operator, when))
+		case dao.DraftActionAnnotate:
+			target := "整张台账"
+			if a.Row >= 0 {
+				target = fmt.Sprintf("第 %d 行", a.Row+1)
+			}
+			annotated = append(annotated, fmt.Sprintf("- %s：%s（%s，%s）", target, a.Reason, a.Operator, when))
+		}
+	}
+	if len(adjusted) == 0 {
+		notes = append(notes, "人工调整：无")
+	} else {
+		notes = append(notes, fmt.Sprintf("人工调整 %d 处：", len(adjusted)))
+		notes = append(notes, adjusted...)
+	}
+	if len(annotated) > 0 {
+		notes = append(notes, "审核批注：")
+		notes = append(notes, annotated...)
+	}
+	notes = append(notes, "生成时数据校验和（SHA-256）："+draft.SourceChecksum)
+	if draft.DataChecksum != "" {
+		notes = append(notes, "定稿数据校验和（SHA-256）："+draft.DataChecksum)
+	}
+	return notes
+}
+
+// draft 按 ID 查询草稿，不在 access 范围内时按不存在处理
+func (w *Workflow) draft(id string, access dao.Access) (*dao.LedgerDraft, error) {
+	draft, err := w.dao.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	if !access.Allow(draft.Creator, draft.Departments) {
+		return nil, ErrDraftNotFound
+	}
+	return draft, nil
+}
+
+// editable 草稿或已驳回状态可调整、批注
+func (w *Workflow) editable(id string, access dao.Access) (*dao.LedgerDraft, error) {
+	draft, err := w.draft(id, access)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Status != dao.DraftStatusDraft && draft.Status != dao.DraftStatusRejected {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidState, draft.Status)
+	}
+	return draft, nil
+}
+
+func (w *Workflow) review(draft *dao.LedgerDraft, status, action, comment, operator string) error {
+	version := draft.Version
+	now := w.now()
+	draft.Status = status
+	draft.Reviewer = operator
+	draft.ReviewComment = comment
+	draft.ReviewedAt = &now
+	audit := w.audit(draft, action, operator)
+	audit.Reason = comment
+	return w.dao.UpdateDraft(draft, version, audit)
+}
+
+// audit 生成操作记录，同时更新草稿的版本号和更新时间
+func (w *Workflow) audit(draft *dao.LedgerDraft, action, operator string) *dao.LedgerAudit {
+	now := w.now()
+	if action != dao.DraftActionCreate {
+		draft.Version++
+		draft.UpdateTime = now
+	}
+	return &dao.LedgerAudit{
+		DraftID:    draft.DraftID,
+		Action:     action,
+		Row:        -1,
+		Operator:   operator,
+		CreateTime: now,
+	}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func formatTime(ms int64, layout string) string {
+	loc, err := util.LoadLocation("")
+	if err != nil {
+		loc = time.Local
+	}
+	return time.UnixMilli(ms).In(loc).Format(layout)
+}
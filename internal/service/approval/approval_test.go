@@ -0,0 +1,258 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"monitor/internal/service/artifact"
+	"monitor/internal/service/dao"
+	"monitor/internal/service/ledger"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type memApprovalDao struct {
+	drafts map[string]dao.LedgerDraft
+	audits []dao.LedgerAudit
+}
+
+func (m *memApprovalDao) CreateDraft(d *dao.LedgerDraft, a *dao.LedgerAudit) error {
+	m.drafts[d.DraftID] = *d
+	m.audits = append(m.audits, *a)
+	return nil
+}
+
+func (m *memApprovalDao) GetDraft(id string) (*dao.LedgerDraft, error) {
+	d, ok := m.drafts[id]
+	if !ok {
+		return nil, dao.ErrDraftNotFound
+	}
+	return &d, nil
+}
+
+func (m *memApprovalDao) ListDrafts(status string, ledgerType int, access dao.Access, page, pageSize int) ([]dao.LedgerDraft, int64, error) {
+	var out []dao.LedgerDraft
+	for _, d := range m.drafts {
+		if access.Allow(d.Creator, d.Departments) {
+			out = append(out, d)
+		}
+	}
+	return out, int64(len(out)), nil
+}
+
+func (m *memApprovalDao) UpdateDraft(d *dao.LedgerDraft, version int, a *dao.LedgerAudit) error {
+	if m.drafts[d.DraftID].Version != version {
+		return dao.ErrDraftConflict
+	}
+	m.drafts[d.DraftID] = *d
+	m.audits = append(m.audits, *a)
+	return nil
+}
+
+func (m *memApprovalDao) ListAudits(id string) ([]dao.LedgerAudit, error) {
+	var out []dao.LedgerAudit
+	for _, a := range m.audits {
+		if a.DraftID == id {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+type memSaver struct {
+	meta artifact.Meta
+	data []byte
+}
+
+func (s *memSaver) Save(ctx context.Context, meta artifact.Meta, render func(w io.Writer) error) (*dao.Artifact, error) {
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		return nil, err
+	}
+	s.meta, s.data = meta, buf.Bytes()
+	return &dao.Artifact{ArtifactID: "f0", Name: meta.Name, Final: meta.Final}, nil
+}
+
+func newDraft(t *testing.T, w *Workflow, class ledger.LedgerClass, raw string) (*ledger.Class, *dao.LedgerDraft) {
+	t.Helper()
+	c, _ := ledger.LookupClass(class)
+	rows, err := c.Decode([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	draft, err := w.Create(c, rows, 1759248000000, 1761840000000, "alice", []string{"数据管理部"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, draft
+}
+
+var all = dao.Access{All: true}
+
+func TestWorkflow(t *testing.T) {
+	d := &memApprovalDao{drafts: map[string]dao.LedgerDraft{}}
+	saver := &memSaver{}
+	w := NewWorkflow(d, saver)
+	w.now = func() time.Time { return time.Date(2026, 11, 1, 10, 0, 0, 0, time.UTC) }
+	_, draft := newDraft(t, w, ledger.SceneDetailLedgerClass,
+		`[{"environment":"生产","model":"Qwen3-8B","scenario":"信用卡审批支持助手","department":"数据管理部","success":80,"history":1000}]`)
+	id := draft.DraftID
+
+	if _, err := w.Adjust(id, all, 0, "success", json.RawMessage(`90`), " ", "bob"); !errors.Is(err, ErrReasonRequired) {
+		t.Errorf("err = %v, want reason required", err)
+	}
+	for _, c := range []struct {
+		row   int
+		field string
+		value string
+	}{{1, "success", "90"}, {0, "missing", "90"}, {0, "success", `"很多"`}} {
+		if _, err := w.Adjust(id, all, c.row, c.field, json.RawMessage(c.value), "复核", "bob"); !errors.Is(err, ErrInvalidRow) {
+			t.Errorf("adjust %+v: err = %v, want invalid row", c, err)
+		}
+	}
+	if _, err := w.Adjust(id, all, 0, "success", json.RawMessage(` 90 `), "网关日志漏采，按供应商账单补齐", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Annotate(id, all, -1, "已与财务核对", "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 驳回后调整重新进入草稿
+	if _, err := w.Reject(id, "", "carol"); !errors.Is(err, ErrReasonRequired) {
+		t.Errorf("err = %v, want reason required", err)
+	}
+	if _, err := w.Reject(id, "历史调用量需复核", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Approve(id, "", "carol"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("approve rejected draft: err = %v", err)
+	}
+	if got, err := w.Adjust(id, all, 0, "history", json.RawMessage(`1200`), "补齐上月调用量", "bob"); err != nil || got.Status != dao.DraftStatusDraft {
+		t.Fatalf("adjust rejected draft: status = %v, err = %v", got, err)
+	}
+
+	if _, err := w.Approve(id, "", "alice"); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("err = %v, want self approval", err)
+	}
+	if _, err := w.Approve(id, "同意", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Adjust(id, all, 0, "success", json.RawMessage(`1`), "改", "bob"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("adjust approved draft: err = %v", err)
+	}
+
+	final, saved, err := w.Finalize(context.Background(), id, all, ledger.FormatCSV, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.Status != dao.DraftStatusFinalized || final.ArtifactID != saved.ArtifactID || !saver.meta.Final ||
+		len(saver.meta.Departments) != 1 || saver.meta.Departments[0] != "数据管理部" {
+		t.Errorf("final = %+v, meta = %+v", final, saver.meta)
+	}
+	if final.DataChecksum == final.SourceChecksum || final.Adjustments != 2 {
+		t.Errorf("checksums = %s / %s, adjustments = %d", final.SourceChecksum, final.DataChecksum, final.Adjustments)
+	}
+	csv := string(saver.data)
+	for _, want := range []string{
+		"信用卡审批支持助手,数据管理部,,,0,90,1200",
+		"审核人：carol，审核时间：2026-11-01 18:00:00，审核意见：同意",
+		"人工调整 2 处：",
+		"第 1 行 success：80 → 90，原因：网关日志漏采，按供应商账单补齐（bob，2026-11-01 18:00:00）",
+		"整张台账：已与财务核对",
+		"定稿数据校验和（SHA-256）：" + final.DataChecksum,
+	} {
+		if !strings.Contains(csv, want) {
+			t.Errorf("csv missing %q:\n%s", want, csv)
+		}
+	}
+
+	// 定稿后不可修改
+	if _, err := w.Annotate(id, all, 0, "补充", "bob"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("annotate finalized: err = %v", err)
+	}
+	if _, err := w.Reject(id, "撤回", "carol"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("reject finalized: err = %v", err)
+	}
+	if _, _, err := w.Finalize(context.Background(), id, all, ledger.FormatCSV, "bob"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("finalize twice: err = %v", err)
+	}
+
+	detail, _ := w.Get(id, all)
+	var actions []string
+	for _, a := range detail.Audits {
+		actions = append(actions, a.Action)
+	}
+	if got := strings.Join(actions, ","); got != "create,adjust,annotate,reject,adjust,approve,finalize" {
+		t.Errorf("audits = %s", got)
+	}
+
+	// 版本号已变化的更新被拒绝
+	stale := *final
+	if err := d.UpdateDraft(&stale, final.Version-1, &dao.LedgerAudit{}); !errors.Is(err, ErrDraftConflict) {
+		t.Errorf("err = %v, want conflict", err)
+	}
+}
+
+func TestDraftAccess(t *testing.T) {
+	w := NewWorkflow(&memApprovalDao{drafts: map[string]dao.LedgerDraft{}}, &memSaver{})
+	_, draft := newDraft(t, w, ledger.SceneDetailLedgerClass,
+		`[{"environment":"生产","model":"Qwen3-8B","scenario":"信用卡审批支持助手","department":"数据管理部","success":80,"history":1000}]`)
+	id := draft.DraftID
+
+	same := dao.Access{Creator: "dave", Departments: []string{"数据管理部"}}
+	other := dao.Access{Creator: "erin", Departments: []string{"研发部"}}
+	if detail, err := w.Get(id, same); err != nil || string(detail.Data) == "" {
+		t.Errorf("same department: err = %v", err)
+	}
+	if _, err := w.Get(id, dao.Access{Creator: "alice"}); err != nil {
+		t.Errorf("creator: err = %v", err)
+	}
+	if _, err := w.Get(id, other); !errors.Is(err, ErrDraftNotFound) {
+		t.Errorf("other department: err = %v, want not found", err)
+	}
+	if _, err := w.Adjust(id, other, 0, "success", json.RawMessage(`1`), "改", "erin"); !errors.Is(err, ErrDraftNotFound) {
+		t.Errorf("adjust from other department: err = %v, want not found", err)
+	}
+	if _, err := w.Annotate(id, other, -1, "批注", "erin"); !errors.Is(err, ErrDraftNotFound) {
+		t.Errorf("annotate from other department: err = %v, want not found", err)
+	}
+	if list, _, _ := w.List("", 0, other, 1, 10); len(list) != 0 {
+		t.Errorf("other department lists %d drafts", len(list))
+	}
+	if list, _, _ := w.List("", 0, same, 1, 10); len(list) != 1 {
+		t.Errorf("same department lists %d drafts", len(list))
+	}
+}
+
+func TestFinalizeCustomLayout(t *testing.T) {
+	saver := &memSaver{}
+	w := NewWorkflow(&memApprovalDao{drafts: map[string]dao.LedgerDraft{}}, saver)
+	_, draft := newDraft(t, w, ledger.HighLevelLedgerClass,
+		`[{"env":"生产","computeP":461.5,"model":"910B","serverNum":175,"cardNum":1400,"modelUsed":"Qwen3-32B","usedCompute":8.7,"usedCard":27}]`)
+	if _, err := w.Approve(draft.DraftID, "", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := w.Finalize(context.Background(), draft.DraftID, all, ledger.FormatXLSX, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(saver.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, _ := f.GetRows(f.GetSheetName(f.GetActiveSheetIndex()))
+	var footer []string
+	for _, r := range rows {
+		if len(r) > 0 && strings.HasPrefix(r[0], "台账编号：") {
+			footer = r
+		}
+	}
+	if footer == nil || footer[0] != "台账编号："+draft.DraftID {
+		t.Errorf("approval footer not found in %v", rows)
+	}
+}
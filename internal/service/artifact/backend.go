@@ -0,0 +1,141 @@
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// Backend 台账文件的存储后端，key 由 Store 生成，只包含小写字母、数字、'/'、'-' 和 '.'
+type Backend interface {
+	Name() string
+	// Put 写入 size 字节的内容，checksum 为内容的 SHA-256（十六进制）
+	Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error
+	// Stat 检查内容是否存在，不存在时返回 ErrObjectNotFound
+	Stat(ctx context.Context, key string) error
+	// Open 读取内容，不存在时返回 ErrObjectNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// OpenRange 从 offset 开始读取 length 字节，用于按范围下载
+	OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete 删除内容，不存在时不报错
+	Delete(ctx context.Context, key string) error
+}
+
+// localBackend 保存在本地目录
+type localBackend struct {
+	dir string
+}
+
+func newLocalBackend(dir string) (*localBackend, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("无效的台账存储目录 %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return nil, fmt.Errorf("创建台账存储目录失败: %w", err)
+	}
+	return &localBackend{dir: abs}, nil
+}
+
+func (b *localBackend) Name() string {
+	return "local"
+}
+
+// path key 对应的文件路径，拒绝指向存储目录之外的 key
+func (b *localBackend) path(key string) (string, error) {
+	p := filepath.Join(b.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, b.dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("非法的存储键: %s", key)
+	}
+	return p, nil
+}
+
+func (b *localBackend) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	// 先写临时文件再改名，读取方不会看到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("保存文件失败: %w", err)
+	}
+	return nil
+}
+
+func (b *localBackend) Stat(_ context.Context, key string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("读取文件失败: %w", err)
+	}
+	return nil
+}
+
+func (b *localBackend) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	return f, nil
+}
+
+func (b *localBackend) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	r, err := b.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	f := r.(*os.File)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (b *localBackend) Delete(_ context.Context, key string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("删除文件失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package artifact
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"monitor/config"
+	"monitor/internal/service/dao"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = dao.ErrArtifactNotFound
+	ErrPurged   = errors.New("artifact purged by retention policy")
+)
+
+// idPattern 台账文件 ID，为 16 字节随机数的十六进制
+var idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+const purgeBatch = 100
+
+// Meta 台账文件的元数据
+type Meta struct {
+	LedgerType  int
+	Format      string // 文件扩展名，例如 xlsx
+	Name        string // 下载文件名
+	PeriodFrom  int64  // 统计区间(毫秒)
+	PeriodTo    int64
+	Creator     string
+	Departments []string // 生成人的部门范围，为空时仅生成人及管理员可查看
+	Rows        int
+	Final       bool // 经审批定稿，不按保留策略删除
+}
+
+// Store 台账文件存储：文件写入存储后端，ID、类型、周期、生成人、大小、校验和及行数记录在数据库，
+// 下载只能按 ID 进行；超过保留期限的文件定时删除，记录保留
+type Store struct {
+	dao       dao.IArtifactDao
+	backend   Backend
+	retention time.Duration
+	interval  time.Duration
+	now       func() time.Time
+}
+
+func NewStore(artifactDao dao.IArtifactDao, backend Backend, retention time.Duration) *Store {
+	return &Store{
+		dao:       artifactDao,
+		backend:   backend,
+		retention: retention,
+		interval:  24 * time.Hour,
+		now:       time.Now,
+	}
+}
+
+var (
+	defaultMu    sync.Mutex
+	defaultStore *Store
+)
+
+// Default 按配置创建的全局存储，数据库未连接或存储后端配置错误时返回错误
+func Default() (*Store, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultStore != nil {
+		return defaultStore, nil
+	}
+	if dao.GetDB() == nil {
+		return nil, errors.New("台账文件存储不可用：未连接数据库")
+	}
+	cfg := config.GetArtifactConfig()
+	var backend Backend
+	var err error
+	switch cfg.Backend {
+	case config.ArtifactBackendLocal:
+		backend, err = newLocalBackend(cfg.LocalDir)
+	case config.ArtifactBackendS3:
+		backend, err = newS3Backend(cfg.S3)
+	default:
+		err = fmt.Errorf("未知的台账存储后端: %s", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	store := NewStore(dao.NewArtifactDao(nil), backend, time.Duration(cfg.RetentionDays)*24*time.Hour)
+	store.interval = cfg.PurgeInterval
+	defaultStore = store
+	return defaultStore, nil
+}
+
+// Save 调用 render 生成文件内容，写入存储后端并记录元数据
+func (s *Store) Save(ctx context.Context, meta Meta, render func(w io.Writer) error) (*dao.Artifact, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	// 先渲染到临时文件，得到大小和校验和后再上传，对象存储需要预先知道内容长度
+	tmp, err := os.CreateTemp("", "ledger-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	if err := render(io.MultiWriter(tmp, hash, counter)); err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("读取临时文件失败: %w", err)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	now := s.now()
+	key := fmt.Sprintf("ledger/%s/%s.%s", now.Format("2006/01"), id, meta.Format)
+	if err := s.backend.Put(ctx, key, tmp, counter.n, checksum); err != nil {
+		return nil, fmt.Errorf("保存台账文件失败: %w", err)
+	}
+
+	artifact := &dao.Artifact{
+		ArtifactID:  id,
+		LedgerType:  meta.LedgerType,
+		Format:      meta.Format,
+		Name:        meta.Name,
+		PeriodFrom:  meta.PeriodFrom,
+		PeriodTo:    meta.PeriodTo,
+		Creator:     meta.Creator,
+		Departments: meta.Departments,
+		Size:        counter.n,
+		Checksum:    checksum,
+		Rows:        meta.Rows,
+		Final:       meta.Final,
+		Backend:     s.backend.Name(),
+		StorageKey:  key,
+		CreateTime:  now,
+	}
+	if err := s.dao.CreateArtifact(artifact); err != nil {
+		// 没有记录的文件无法下载，也不会被清理，直接删除
+		if delErr := s.backend.Delete(ctx, key); delErr != nil {
+			log.Printf("删除未登记的台账文件 %s 失败: %v", key, delErr)
+		}
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// Get 按 ID 查询元数据，ID 格式不合法或文件不在 access 范围内时返回 ErrNotFound
+func (s *Store) Get(id string, access dao.Access) (*dao.Artifact, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	artifact, err := s.dao.GetArtifact(id)
+	if err != nil {
+		return nil, err
+	}
+	if !access.Allow(artifact.Creator, artifact.Departments) {
+		return nil, ErrNotFound
+	}
+	return artifact, nil
+}
+
+// Open 按 ID 读取文件内容，文件已按保留策略删除时返回 ErrPurged，存储后端中不存在时返回 ErrObjectNotFound；
+// 返回的内容可 Seek，首次读取时才从存储后端按当前位置读取，用于按范围下载
+func (s *Store) Open(ctx context.Context, id string, access dao.Access) (*dao.Artifact, io.ReadSeekCloser, error) {
+	artifact, err := s.Get(id, access)
+	if err != nil {
+		return nil, nil, err
+	}
+	if artifact.PurgedAt != nil {
+		return artifact, nil, ErrPurged
+	}
+	if artifact.Backend != s.backend.Name() {
+		return artifact, nil, fmt.Errorf("台账文件保存在 %s 存储中，当前使用 %s", artifact.Backend, s.backend.Name())
+	}
+	// 开始响应后无法再返回 404，先确认文件存在
+	if err := s.backend.Stat(ctx, artifact.StorageKey); err != nil {
+		return artifact, nil, err
+	}
+	return artifact, &rangeReader{ctx: ctx, backend: s.backend, key: artifact.StorageKey, size: artifact.Size}, nil
+}
+
+// List 分页查询 access 范围内的台账文件，ledgerType 为 0 时不过滤
+func (s *Store) List(ledgerType int, access dao.Access, page, pageSize int) ([]dao.Artifact, int64, error) {
+	return s.dao.ListArtifacts(ledgerType, access, page, pageSize)
+}
+
+// Purge 删除超过保留期限的文件，定稿台账除外，返回删除的数量
+func (s *Store) Purge(ctx context.Context) (int, error) {
+	before := s.now().Add(-s.retention)
+	purged := 0
+	for {
+		expired, err := s.dao.ListExpired(before, purgeBatch)
+		if err != nil {
+			return purged, err
+		}
+		for _, a := range expired {
+			// 切换存储后端前生成的文件无法从这里删除，只更新记录
+			if a.Backend == s.backend.Name() {
+				if err := s.backend.Delete(ctx, a.StorageKey); err != nil {
+					return purged, fmt.Errorf("删除过期台账文件 %s 失败: %w", a.ArtifactID, err)
+				}
+			}
+			if err := s.dao.MarkPurged(a.ArtifactID, s.now()); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if len(expired) < purgeBatch {
+			return purged, nil
+		}
+	}
+}
+
+// Start 立即清理一次过期文件，之后按配置的间隔定时清理
+func (s *Store) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.Purge(ctx); err != nil {
+				log.Printf("清理过期台账文件失败: %v", err)
+			} else if n > 0 {
+				log.Printf("已清理 %d 个过期台账文件", n)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成台账文件ID失败: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// rangeReader 按需从存储后端读取：Seek 只记录位置，之后的 Read 从该位置读取到文件末尾
+type rangeReader struct {
+	ctx     context.Context
+	backend Backend
+	key     string
+	size    int64
+	off     int64
+	body    io.ReadCloser
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		var (
+			body io.ReadCloser
+			err  error
+		)
+		if r.off == 0 {
+			body, err = r.backend.Open(r.ctx, r.key)
+		} else {
+			body, err = r.backend.OpenRange(r.ctx, r.key, r.off, r.size-r.off)
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of artifact")
+	}
+	if offset != r.off && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"monitor/config"
+	"strings"
+)
+
+// 角色按权限从低到高排列，高级角色拥有低级角色的全部权限
+const (
+	RoleViewer         = "viewer"          // 查看监控、场景、模型及台账预览
+	RoleLedgerOperator = "ledger_operator" // 生成、下载台账及维护台账任务
+	RoleLedgerApprover = "ledger_approver" // 审批台账草稿
+	RoleAdmin          = "admin"           // 规则等配置的修改
+)
+
+var roleLevel = map[string]int{
+	RoleViewer:         1,
+	RoleLedgerOperator: 2,
+	RoleLedgerApprover: 3,
+	RoleAdmin:          4,
+}
+
+// IdentityKey gin 上下文中保存当前用户的键
+const IdentityKey = "Identity"
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrInvalidToken    = errors.New("invalid token")
+)
+
+// Identity 通过认证的调用方
+type Identity struct {
+	Username    string   `json:"username"`
+	Roles       []string `json:"roles"`
+	Departments []string `json:"departments"`
+}
+
+// Has 判断是否具备 role 或更高级别的角色
+func (i *Identity) Has(role string) bool {
+	if i == nil {
+		return false
+	}
+	need, ok := roleLevel[role]
+	if !ok {
+		return false
+	}
+	for _, r := range i.Roles {
+		if roleLevel[r] >= need {
+			return true
+		}
+	}
+	return false
+}
+
+// FromContext 读取当前用户，gin.Context.Value 会按字符串键读取 c.Get
+func FromContext(ctx context.Context) *Identity {
+	if ctx == nil {
+		return nil
+	}
+	identity, _ := ctx.Value(IdentityKey).(*Identity)
+	return identity
+}
+
+type Authenticator interface {
+	// Authenticate 校验调用方 token，ctx 用于向 DCE 发起校验请求
+	Authenticate(ctx context.Context, token string) (*Identity, error)
+}
+
+func NewAuthenticator(cfg config.AuthConfig) (Authenticator, error) {
+	switch cfg.Mode {
+	case config.AuthModeDCE:
+		return newDceAuthenticator(cfg), nil
+	case config.AuthModeJWT:
+		return newJWTAuthenticator(cfg)
+	case config.AuthModeNone:
+		log.Println("认证已关闭，所有请求视为管理员，仅可用于本地开发")
+		return noneAuthenticator{}, nil
+	default:
+		return nil, fmt.Errorf("不支持的认证方式: %s", cfg.Mode)
+	}
+}
+
+type noneAuthenticator struct{}
+
+func (noneAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	return &Identity{Username: "anonymous", Roles: []string{RoleAdmin}}, nil
+}
+
+// resolveRoles 合并 token 自带的角色与配置中的用户角色映射，至少为 viewer
+func resolveRoles(cfg config.AuthConfig, username string, claimed []string) []string {
+	roles := []string{RoleViewer}
+	seen := map[string]bool{RoleViewer: true}
+	add := func(role string) {
+		if _, ok := roleLevel[role]; ok && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	for _, role := range claimed {
+		add(strings.TrimSpace(role))
+	}
+	for _, name := range cfg.LedgerOperators {
+		if name == username {
+			add(RoleLedgerOperator)
+		}
+	}
+	for _, name := range cfg.LedgerApprovers {
+		if name == username {
+			add(RoleLedgerApprover)
+		}
+	}
+	for _, name := range cfg.Admins {
+		if name == username {
+			add(RoleAdmin)
+		}
+	}
+	return roles
+}
+
+// resolveDepartments 合并 token 自带的部门与配置中的部门成员
+func resolveDepartments(cfg config.AuthConfig, username string, claimed []string) []string {
+	depts := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(dept string) {
+		if dept = strings.TrimSpace(dept); dept != "" && !seen[dept] {
+			seen[dept] = true
+			depts = append(depts, dept)
+		}
+	}
+	for _, dept := range claimed {
+		add(dept)
+	}
+	for _, members := range cfg.Departments {
+		for _, name := range members.Users {
+			if name == username {
+				add(members.Dept)
+			}
+		}
+	}
+	return depts
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"monitor/config"
+	"monitor/internal/client"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// dceAuthenticator 通过 DCE 当前用户接口校验 token，校验结果按 token 摘要短暂缓存
+type dceAuthenticator struct {
+	cfg   config.AuthConfig
+	cache *cache.Cache
+}
+
+func newDceAuthenticator(cfg config.AuthConfig) *dceAuthenticator {
+	return &dceAuthenticator{
+		cfg:   cfg,
+		cache: cache.New(cfg.CacheTTL, 2*cfg.CacheTTL),
+	}
+}
+
+func (d *dceAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	if v, ok := d.cache.Get(key); ok {
+		return v.(*Identity), nil
+	}
+
+	gc := config.GetGrafanaQueryConfig()
+	dce := client.NewDCEClient(client.WithDceToken(ctx, token), gc.ClusterBaseURL, gc.InsecureSkipVerify)
+	user, err := dce.GetCurrentUser(d.cfg.CurrentUserPath)
+	if errors.Is(err, client.ErrDceUnauthorized) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("校验 token 失败: %w", err)
+	}
+
+	identity := &Identity{
+		Username:    user.Username,
+		Roles:       resolveRoles(d.cfg, user.Username, nil),
+		Departments: resolveDepartments(d.cfg, user.Username, nil),
+	}
+	d.cache.SetDefault(key, identity)
+	return identity, nil
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"monitor/config"
+	"os"
+	"strings"
+	"time"
+)
+
+// 校验 exp、nbf 时允许的时钟偏差
+const jwtLeeway = 30 * time.Second
+
+// jwtAuthenticator 使用配置的密钥校验 JWT，支持 HS256 与 RS256
+type jwtAuthenticator struct {
+	cfg       config.AuthConfig
+	secret    []byte
+	publicKey *rsa.PublicKey
+	now       func() time.Time
+}
+
+func newJWTAuthenticator(cfg config.AuthConfig) (*jwtAuthenticator, error) {
+	j := &jwtAuthenticator{cfg: cfg, now: time.Now}
+	if cfg.JWTSecret != "" {
+		j.secret = []byte(cfg.JWTSecret)
+	}
+	if cfg.JWTPublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.JWTPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 JWT 公钥失败: %w", err)
+		}
+		key, err := parseRSAPublicKey(data)
+		if err != nil {
+			return nil, err
+		}
+		j.publicKey = key
+	}
+	if j.secret == nil && j.publicKey == nil {
+		return nil, fmt.Errorf("jwt 认证需要配置 jwtSecret 或 jwtPublicKeyFile")
+	}
+	return j, nil
+}
+
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("无效的 JWT 公钥 PEM")
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析 JWT 公钥失败: %w", err)
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("JWT 公钥不是 RSA 公钥")
+	}
+	return key, nil
+}
+
+func (j *jwtAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	claims, err := j.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	username, _ := claims[j.cfg.UsernameClaim].(string)
+	if username == "" {
+		username, _ = claims["sub"].(string)
+	}
+	if username == "" {
+		return nil, fmt.Errorf("%w: 缺少用户名", ErrInvalidToken)
+	}
+	return &Identity{
+		Username:    username,
+		Roles:       resolveRoles(j.cfg, username, claimStrings(claims[j.cfg.RoleClaim])),
+		Departments: resolveDepartments(j.cfg, username, claimStrings(claims[j.cfg.DeptClaim])),
+	}, nil
+}
+
+func (j *jwtAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("格式错误")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("解析 header 失败: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("解析签名失败: %v", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	// 只接受已配置密钥对应的算法，防止 alg 混淆
+	switch {
+	case header.Alg == "HS256" && j.secret != nil:
+		mac := hmac.New(sha256.New, j.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, fmt.Errorf("签名错误")
+		}
+	case header.Alg == "RS256" && j.publicKey != nil:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(j.publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, fmt.Errorf("签名错误")
+		}
+	default:
+		return nil, fmt.Errorf("不支持的签名算法: %s", header.Alg)
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("解析 payload 失败: %v", err)
+	}
+
+	now := j.now()
+	// 未携带 exp 的 token 永不过期，不予接受
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("token 缺少 exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, fmt.Errorf("token 已过期")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("token 尚未生效")
+	}
+	if j.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != j.cfg.Issuer {
+			return nil, fmt.Errorf("issuer 不匹配")
+		}
+	}
+	if j.cfg.Audience != "" {
+		matched := false
+		for _, aud := range claimStrings(claims["aud"]) {
+			if aud == j.cfg.Audience {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("audience 不匹配")
+		}
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// 声明可能是字符串数组，也可能是逗号或空格分隔的字符串
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == ' ' })
+	case []interface{}:
+		result := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
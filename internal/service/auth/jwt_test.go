@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"monitor/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, alg string, claims map[string]interface{}, sign func([]byte) []byte) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(secret string) func([]byte) []byte {
+	return func(data []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(data)
+		return mac.Sum(nil)
+	}
+}
+
+func TestJWTAuthenticatorHS256(t *testing.T) {
+	cfg := config.AuthConfig{
+		Mode:            config.AuthModeJWT,
+		JWTSecret:       "s3cret",
+		Issuer:          "dce",
+		Audience:        "monitor",
+		RoleClaim:       "roles",
+		UsernameClaim:   "preferred_username",
+		LedgerOperators: []string{"alice"},
+	}
+	a, err := NewAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	token := signJWT(t, "HS256", map[string]interface{}{
+		"preferred_username": "alice", "iss": "dce", "aud": []string{"monitor"}, "exp": exp,
+	}, hs256("s3cret"))
+	identity, err := a.Authenticate(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "alice" || !identity.Has(RoleLedgerOperator) || identity.Has(RoleAdmin) {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	cases := map[string]string{
+		"bad signature": signJWT(t, "HS256", map[string]interface{}{"sub": "bob", "iss": "dce", "aud": "monitor", "exp": exp}, hs256("other")),
+		"expired":       signJWT(t, "HS256", map[string]interface{}{"sub": "bob", "iss": "dce", "aud": "monitor", "exp": float64(time.Now().Add(-time.Hour).Unix())}, hs256("s3cret")),
+		"missing exp":   signJWT(t, "HS256", map[string]interface{}{"sub": "bob", "iss": "dce", "aud": "monitor"}, hs256("s3cret")),
+		"wrong aud":     signJWT(t, "HS256", map[string]interface{}{"sub": "bob", "iss": "dce", "aud": "other", "exp": exp}, hs256("s3cret")),
+		"alg none":      signJWT(t, "none", map[string]interface{}{"sub": "bob", "iss": "dce", "aud": "monitor", "exp": exp}, func([]byte) []byte { return nil }),
+		"malformed":     "not-a-jwt",
+	}
+	for name, token := range cases {
+		if _, err := a.Authenticate(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: want ErrInvalidToken, got %v", name, err)
+		}
+	}
+	if _, err := a.Authenticate(context.Background(), ""); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("empty token: want ErrUnauthenticated, got %v", err)
+	}
+}
+
+func TestJWTAuthenticatorRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	keyFile := filepath.Join(t.TempDir(), "pub.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAuthenticator(config.AuthConfig{
+		Mode:             config.AuthModeJWT,
+		JWTPublicKeyFile: keyFile,
+		RoleClaim:        "roles",
+		UsernameClaim:    "preferred_username",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256 := func(data []byte) []byte {
+		digest := sha256.Sum256(data)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return sig
+	}
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	token := signJWT(t, "RS256", map[string]interface{}{"sub": "root", "roles": "admin", "exp": exp}, rs256)
+	identity, err := a.Authenticate(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.Has(RoleAdmin) || !identity.Has(RoleViewer) {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	// 只配置了公钥时不接受 HS256，避免用公钥当 HMAC 密钥伪造
+	forged := signJWT(t, "HS256", map[string]interface{}{"sub": "root", "roles": "admin", "exp": exp}, hs256(string(der)))
+	if _, err := a.Authenticate(context.Background(), forged); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want ErrInvalidToken, got %v", err)
+	}
+}
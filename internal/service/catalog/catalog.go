@@ -0,0 +1,478 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"monitor/config"
+	"monitor/internal/client"
+	"monitor/internal/models"
+	"monitor/internal/service/dao"
+	"monitor/internal/service/scene"
+	"monitor/internal/types"
+	"monitor/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSceneNotFound   = errors.New("scene not found")
+	ErrInvalidField    = errors.New("field can not be overridden")
+	ErrOverrideMissing = errors.New("override not found")
+)
+
+// grafanaIDPrefix 只在 Grafana 映射中出现、DCE 没有对应记录的场景 ID 前缀
+const grafanaIDPrefix = "grafana:"
+
+const historyLimit = 200
+
+// Scene 应用人工修正后的场景信息
+type Scene struct {
+	dao.SceneRecord
+	Overrides map[string]dao.SceneOverride `json:"overrides,omitempty"` // 字段 -> 生效中的修正
+}
+
+// SceneInfo 转换为台账等使用的场景信息
+func (s *Scene) SceneInfo() types.SceneInfoItem {
+	status, _ := strconv.Atoi(s.Status)
+	return types.SceneInfoItem{
+		CallModelName:      s.CallModelName,
+		ApisixScenarioName: s.ApisixScenarioName,
+		CallModelId:        s.CallModelId,
+		DevDept:            s.DevDept,
+		DevManager:         s.DevManager,
+		EnvAlias:           s.EnvAlias,
+		EnvName:            s.EnvName,
+		ModelName:          s.ModelName,
+		Token:              s.Token,
+		MaxConcurrency:     int64(s.MaxConcurrency),
+		Status:             status,
+	}
+}
+
+// Status 最近一次同步的状态
+type Status struct {
+	Scenes       int        `json:"scenes"`
+	SyncedAt     *time.Time `json:"syncedAt,omitempty"`      // 最近一次成功同步的时间
+	LastAttempt  *time.Time `json:"lastAttemptAt,omitempty"` // 最近一次同步的时间
+	LastError    string     `json:"lastError,omitempty"`
+	LastChanges  int        `json:"lastChanges"` // 最近一次同步记录的变更数
+	LoadedFromDB bool       `json:"loaded"`      // 内存快照是否已从登记表加载
+}
+
+// Catalog 场景登记表：定时从 DCE 场景管理与 Grafana 映射同步到 MySQL，
+// 合并人工修正后在内存中保留一份快照，供台账、场景名称和租户过滤使用
+type Catalog struct {
+	dao         dao.ISceneDao
+	fetchTokens func(ctx context.Context) ([]client.TokenItem, error)
+	fetchLabels func(ctx context.Context) (map[string]models.Item, error)
+	interval    time.Duration
+
+	syncMu sync.Mutex
+	mu     sync.RWMutex
+	scenes []Scene
+	status Status
+}
+
+func newCatalog(sceneDao dao.ISceneDao) *Catalog {
+	grafanaConf := config.GetGrafanaConfig()
+	registry := scene.GetSceneRegistry(&grafanaConf)
+	return &Catalog{
+		dao:      sceneDao,
+		interval: config.GetDBConfig().SceneSyncInterval,
+		fetchTokens: func(ctx context.Context) ([]client.TokenItem, error) {
+			c := config.GetGrafanaQueryConfig()
+			// 同步不属于任何用户请求，使用服务账号读取全部场景
+			dce := client.NewDCEClient(client.WithDceToken(ctx, c.Token), c.ClusterBaseURL, c.InsecureSkipVerify)
+			return dce.GetSceneManageInfo(client.SceneTokenListURL, 50)
+		},
+		fetchLabels: func(ctx context.Context) (map[string]models.Item, error) {
+			if err := registry.Refresh(ctx); err != nil {
+				log.Printf("刷新场景标签失败，使用最近一次的结果: %v", err)
+			}
+			return registry.Mapping(ctx)
+		},
+	}
+}
+
+var (
+	defaultMu      sync.Mutex
+	defaultCatalog *Catalog
+)
+
+// Default 全局登记表，未连接数据库时返回 nil，调用方应回退到直接查询上游
+func Default() *Catalog {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultCatalog == nil && dao.GetDB() != nil {
+		defaultCatalog = newCatalog(dao.NewSceneDao(nil))
+	}
+	return defaultCatalog
+}
+
+// Start 加载已有登记表并立即同步一次，之后按配置的间隔定时同步
+func (c *Catalog) Start(ctx context.Context) {
+	go func() {
+		if err := c.Reload(); err != nil {
+			log.Printf("加载场景登记表失败: %v", err)
+		}
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			if err := c.Sync(ctx); err != nil {
+				log.Printf("同步场景登记表失败: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Sync 从上游读取场景并写入登记表，字段变化记入历史，上游不存在的场景标记为已移除
+func (c *Catalog) Sync(ctx context.Context) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	changes, err := c.sync(ctx)
+	now := time.Now()
+	c.mu.Lock()
+	c.status.LastAttempt = &now
+	if err != nil {
+		c.status.LastError = err.Error()
+	} else {
+		c.status.SyncedAt = &now
+		c.status.LastError = ""
+		c.status.LastChanges = changes
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.Reload()
+}
+
+func (c *Catalog) sync(ctx context.Context) (int, error) {
+	tokens, err := c.fetchTokens(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("读取 DCE 场景管理失败: %w", err)
+	}
+	labels, err := c.fetchLabels(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("读取 Grafana 场景标签失败: %w", err)
+	}
+	fresh := buildRecords(tokens, labels)
+
+	changes := 0
+	var skipped error
+	err = c.dao.SyncScenes(func(existing []dao.SceneRecord) ([]dao.SceneRecord, []dao.SceneHistory) {
+		// 上游返回空列表多半是权限或接口异常，不能据此把全部场景标记为已移除
+		if len(tokens) == 0 && len(existing) > 0 {
+			skipped = errors.New("DCE 场景管理返回空列表，跳过本次同步")
+			return nil, nil
+		}
+		records, history := mergeRecords(existing, fresh, time.Now())
+		changes = len(history)
+		return records, history
+	})
+	if err != nil {
+		return 0, err
+	}
+	return changes, skipped
+}
+
+// buildRecords 以 DCE 记录为主，按网关场景名称与 Grafana 映射文本（忽略大小写）关联 token，
+// 没有 DCE 记录的映射单独登记
+func buildRecords(tokens []client.TokenItem, labels map[string]models.Item) []dao.SceneRecord {
+	byLabel := make(map[string]string, len(labels))
+	for token, item := range labels {
+		byLabel[strings.ToLower(item.Text)] = token
+	}
+
+	matched := make(map[string]bool, len(labels))
+	records := make([]dao.SceneRecord, 0, len(tokens)+len(labels))
+	for _, t := range tokens {
+		if t.Id == "" {
+			continue
+		}
+		r := dao.SceneRecord{
+			SceneID:            t.Id,
+			ApisixScenarioName: t.ApisixScenarioName,
+			CallModelName:      t.CallModelName,
+			CallModelId:        t.CallModelId,
+			ModelName:          t.ModelName,
+			DevDept:            t.DevDept,
+			DevManager:         t.DevManager,
+			EnvAlias:           t.EnvAlias,
+			EnvName:            t.EnvName,
+			MaxConcurrency:     t.MaxConcurrency,
+			Status:             t.Status,
+		}
+		if token, ok := byLabel[strings.ToLower(t.ApisixScenarioName)]; ok {
+			r.Token = token
+			r.Label = labels[token].Text
+			r.Name = util.ProcessSceneString(r.Label)
+			matched[token] = true
+		} else {
+			r.Name = t.ApisixScenarioName
+		}
+		records = append(records, r)
+	}
+	for token, item := range labels {
+		if matched[token] {
+			continue
+		}
+		records = append(records, dao.SceneRecord{
+			SceneID: grafanaIDPrefix + token,
+			Token:   token,
+			Label:   item.Text,
+			Name:    util.ProcessSceneString(item.Text),
+		})
+	}
+	return records
+}
+
+// mergeRecords 计算需要写入的记录及字段变更历史
+func mergeRecords(existing, fresh []dao.SceneRecord, now time.Time) ([]dao.SceneRecord, []dao.SceneHistory) {
+	old := make(map[string]dao.SceneRecord, len(existing))
+	for _, r := range existing {
+		old[r.SceneID] = r
+	}
+
+	var history []dao.SceneHistory
+	record := func(sceneID, field, from, to string) {
+		history = append(history, dao.SceneHistory{
+			SceneID: sceneID, Field: field, OldValue: from, NewValue: to,
+			Source: dao.SceneChangeSync, ChangedAt: now,
+		})
+	}
+
+	seen := make(map[string]bool, len(fresh))
+	records := make([]dao.SceneRecord, 0, len(fresh))
+	for _, r := range fresh {
+		seen[r.SceneID] = true
+		r.SyncedAt = now
+		prev, ok := old[r.SceneID]
+		if !ok {
+			record(r.SceneID, "created", "", r.Name)
+			records = append(records, r)
+			continue
+		}
+		for _, f := range trackedFields {
+			if from, to := f.get(&prev), f.get(&r); from != to {
+				record(r.SceneID, f.name, from, to)
+			}
+		}
+		if prev.Removed {
+			record(r.SceneID, "removed", "true", "false")
+		}
+		r.ID = prev.ID
+		r.CreateTime = prev.CreateTime
+		records = append(records, r)
+	}
+	for _, r := range existing {
+		if seen[r.SceneID] || r.Removed {
+			continue
+		}
+		r.Removed = true
+		record(r.SceneID, "removed", "false", "true")
+		records = append(records, r)
+	}
+	return records, history
+}
+
+// Reload 从登记表重新加载快照
+func (c *Catalog) Reload() error {
+	records, err := c.dao.ListScenes()
+	if err != nil {
+		return err
+	}
+	overrides, err := c.dao.ListOverrides()
+	if err != nil {
+		return err
+	}
+	byScene := make(map[string]map[string]dao.SceneOverride)
+	for _, o := range overrides {
+		if byScene[o.SceneID] == nil {
+			byScene[o.SceneID] = make(map[string]dao.SceneOverride)
+		}
+		byScene[o.SceneID][o.Field] = o
+	}
+
+	scenes := make([]Scene, 0, len(records))
+	active := 0
+	for _, r := range records {
+		s := Scene{SceneRecord: r, Overrides: byScene[r.SceneID]}
+		for field, o := range s.Overrides {
+			if f, ok := overridableFields[field]; ok {
+				f.set(&s.SceneRecord, o.Value)
+			}
+		}
+		if !s.Removed {
+			active++
+		}
+		scenes = append(scenes, s)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scenes = scenes
+	c.status.Scenes = active
+	c.status.LoadedFromDB = true
+	return nil
+}
+
+// Ready 快照已加载且非空，否则调用方应回退到直接查询上游
+func (c *Catalog) Ready() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status.LoadedFromDB && c.status.Scenes > 0
+}
+
+// Status 同步状态
+func (c *Catalog) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status
+}
+
+// Scenes 快照中的场景，includeRemoved 为 false 时只返回上游仍存在的场景；返回值不可修改
+func (c *Catalog) Scenes(includeRemoved bool) []Scene {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if includeRemoved {
+		return c.scenes
+	}
+	scenes := make([]Scene, 0, len(c.scenes))
+	for _, s := range c.scenes {
+		if !s.Removed {
+			scenes = append(scenes, s)
+		}
+	}
+	return scenes
+}
+
+// Get 按场景 ID 查询
+func (c *Catalog) Get(sceneID string) (Scene, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, s := range c.scenes {
+		if s.SceneID == sceneID {
+			return s, true
+		}
+	}
+	return Scene{}, false
+}
+
+// ByToken 网关 token -> 场景信息，仅包含有 DCE 记录且已关联 token 的场景
+func (c *Catalog) ByToken() map[string]types.SceneInfoItem {
+	return c.index(func(s *Scene) string {
+		if strings.HasPrefix(s.SceneID, grafanaIDPrefix) {
+			return ""
+		}
+		return s.Token
+	})
+}
+
+// ByModel 模型名称 -> 场景信息
+func (c *Catalog) ByModel() map[string]types.SceneInfoItem {
+	return c.index(func(s *Scene) string { return s.ModelName })
+}
+
+// ByCallModelName 调用模型描述 -> 场景信息
+func (c *Catalog) ByCallModelName() map[string]types.SceneInfoItem {
+	return c.index(func(s *Scene) string { return s.CallModelName })
+}
+
+func (c *Catalog) index(key func(s *Scene) string) map[string]types.SceneInfoItem {
+	scenes := c.Scenes(false)
+	m := make(map[string]types.SceneInfoItem, len(scenes))
+	for i := range scenes {
+		if k := key(&scenes[i]); k != "" {
+			m[k] = scenes[i].SceneInfo()
+		}
+	}
+	return m
+}
+
+// Labels 网关 token -> 场景名称
+func (c *Catalog) Labels() map[string]string {
+	scenes := c.Scenes(false)
+	m := make(map[string]string, len(scenes))
+	for _, s := range scenes {
+		if s.Token != "" {
+			m[s.Token] = s.Name
+		}
+	}
+	return m
+}
+
+// LabelTokens 小写场景标签 -> 网关 token
+func (c *Catalog) LabelTokens() map[string]string {
+	scenes := c.Scenes(false)
+	m := make(map[string]string, len(scenes))
+	for _, s := range scenes {
+		if s.Token != "" && s.Label != "" {
+			m[strings.ToLower(s.Label)] = s.Token
+		}
+	}
+	return m
+}
+
+// SetOverride 人工修正场景字段，例如更正所属部门
+func (c *Catalog) SetOverride(sceneID, field, value, reason, operator string) error {
+	if _, ok := overridableFields[field]; !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidField, field)
+	}
+	s, ok := c.Get(sceneID)
+	if !ok {
+		return ErrSceneNotFound
+	}
+	override := &dao.SceneOverride{SceneID: sceneID, Field: field, Value: value, Reason: reason, Operator: operator}
+	history := &dao.SceneHistory{
+		SceneID: sceneID, Field: field, OldValue: overridableFields[field].get(&s.SceneRecord), NewValue: value,
+		Source: dao.SceneChangeOverride, Operator: operator, ChangedAt: time.Now(),
+	}
+	if err := c.dao.SaveOverride(override, history); err != nil {
+		return err
+	}
+	return c.Reload()
+}
+
+// DeleteOverride 撤销修正，字段恢复为同步值
+func (c *Catalog) DeleteOverride(sceneID, field, operator string) error {
+	s, ok := c.Get(sceneID)
+	if !ok {
+		return ErrSceneNotFound
+	}
+	o, ok := s.Overrides[field]
+	if !ok {
+		return ErrOverrideMissing
+	}
+	history := &dao.SceneHistory{
+		SceneID: sceneID, Field: field, OldValue: o.Value, NewValue: "",
+		Source: dao.SceneChangeOverride, Operator: operator, ChangedAt: time.Now(),
+	}
+	if err := c.dao.DeleteOverride(sceneID, field, history); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOverrideMissing
+		}
+		return err
+	}
+	return c.Reload()
+}
+
+// History 场景的变更历史，按时间倒序
+func (c *Catalog) History(sceneID string) ([]dao.SceneHistory, error) {
+	return c.dao.ListHistory(sceneID, historyLimit)
+}
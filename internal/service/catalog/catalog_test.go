@@ -0,0 +1,209 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"monitor/internal/client"
+	"monitor/internal/models"
+	"monitor/internal/service/dao"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type memSceneDao struct {
+	records   []dao.SceneRecord
+	overrides []dao.SceneOverride
+	history   []dao.SceneHistory
+	nextID    uint
+}
+
+func (m *memSceneDao) ListScenes() ([]dao.SceneRecord, error) {
+	return append([]dao.SceneRecord(nil), m.records...), nil
+}
+
+func (m *memSceneDao) SyncScenes(merge dao.SceneMerge) error {
+	records, history := merge(append([]dao.SceneRecord(nil), m.records...))
+	for _, r := range records {
+		if r.ID == 0 {
+			m.nextID++
+			r.ID = m.nextID
+			m.records = append(m.records, r)
+			continue
+		}
+		for i := range m.records {
+			if m.records[i].ID == r.ID {
+				m.records[i] = r
+			}
+		}
+	}
+	m.history = append(m.history, history...)
+	return nil
+}
+
+func (m *memSceneDao) ListOverrides() ([]dao.SceneOverride, error) {
+	return append([]dao.SceneOverride(nil), m.overrides...), nil
+}
+
+func (m *memSceneDao) SaveOverride(o *dao.SceneOverride, h *dao.SceneHistory) error {
+	for i := range m.overrides {
+		if m.overrides[i].SceneID == o.SceneID && m.overrides[i].Field == o.Field {
+			m.overrides[i] = *o
+			m.history = append(m.history, *h)
+			return nil
+		}
+	}
+	m.overrides = append(m.overrides, *o)
+	m.history = append(m.history, *h)
+	return nil
+}
+
+func (m *memSceneDao) DeleteOverride(sceneID, field string, h *dao.SceneHistory) error {
+	for i := range m.overrides {
+		if m.overrides[i].SceneID == sceneID && m.overrides[i].Field == field {
+			m.overrides = append(m.overrides[:i], m.overrides[i+1:]...)
+			m.history = append(m.history, *h)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *memSceneDao) ListHistory(sceneID string, limit int) ([]dao.SceneHistory, error) {
+	var out []dao.SceneHistory
+	for i := len(m.history) - 1; i >= 0 && len(out) < limit; i-- {
+		if m.history[i].SceneID == sceneID {
+			out = append(out, m.history[i])
+		}
+	}
+	return out, nil
+}
+
+func newTestCatalog(d dao.ISceneDao, tokens *[]client.TokenItem, labels *map[string]models.Item) *Catalog {
+	return &Catalog{
+		dao:         d,
+		fetchTokens: func(context.Context) ([]client.TokenItem, error) { return *tokens, nil },
+		fetchLabels: func(context.Context) (map[string]models.Item, error) { return *labels, nil },
+	}
+}
+
+func historyFields(h []dao.SceneHistory) map[string]dao.SceneHistory {
+	m := make(map[string]dao.SceneHistory, len(h))
+	for _, e := range h {
+		m[e.Field] = e
+	}
+	return m
+}
+
+func TestCatalogSyncHistoryAndOverrides(t *testing.T) {
+	d := &memSceneDao{}
+	tokens := []client.TokenItem{
+		{Id: "1", ApisixScenarioName: "dept#Scene A#alice", ModelName: "qwen", DevDept: "研发一部", DevManager: "alice", Status: "1"},
+	}
+	labels := map[string]models.Item{
+		"tok-a": {Text: "dept#Scene A#alice"},
+		"tok-x": {Text: "dept#Orphan#bob"},
+	}
+	c := newTestCatalog(d, &tokens, &labels)
+	ctx := context.Background()
+
+	if c.Ready() {
+		t.Fatal("catalog should not be ready before sync")
+	}
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Ready() || len(c.Scenes(false)) != 2 {
+		t.Fatalf("scenes = %+v", c.Scenes(true))
+	}
+	byToken := c.ByToken()
+	if info := byToken["tok-a"]; info.DevDept != "研发一部" || info.Status != 1 {
+		t.Errorf("byToken = %+v", byToken)
+	}
+	if _, ok := byToken["tok-x"]; ok {
+		t.Error("grafana-only scene should not appear in ledger map")
+	}
+	if labels := c.Labels(); labels["tok-a"] != "Scene A" || labels["tok-x"] != "Orphan" {
+		t.Errorf("labels = %v", labels)
+	}
+
+	// 上游改名、换负责人，孤立映射消失
+	tokens[0].DevManager = "carol"
+	labels = map[string]models.Item{"tok-a": {Text: "dept#Scene B#alice"}}
+	tokens[0].ApisixScenarioName = "dept#Scene B#alice"
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	changes := historyFields(d.history[2:])
+	if h := changes["name"]; h.OldValue != "Scene A" || h.NewValue != "Scene B" || h.SceneID != "1" {
+		t.Errorf("rename history = %+v", h)
+	}
+	if h := changes["devManager"]; h.OldValue != "alice" || h.NewValue != "carol" {
+		t.Errorf("owner history = %+v", h)
+	}
+	if h := changes["removed"]; h.SceneID != "grafana:tok-x" || h.NewValue != "true" {
+		t.Errorf("removed history = %+v", h)
+	}
+	if len(c.Scenes(false)) != 1 || len(c.Scenes(true)) != 2 {
+		t.Errorf("active scenes = %d, all = %d", len(c.Scenes(false)), len(c.Scenes(true)))
+	}
+
+	// 人工修正部门，同步后仍然生效，撤销后恢复同步值
+	if err := c.SetOverride("1", "devDept", "研发二部", "部门调整", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if dept := c.ByToken()["tok-a"].DevDept; dept != "研发二部" {
+		t.Errorf("overridden dept = %s", dept)
+	}
+	if dept := c.ByModel()["qwen"].DevDept; dept != "研发二部" {
+		t.Errorf("overridden dept by model = %s", dept)
+	}
+	if err := c.DeleteOverride("1", "devDept", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if dept := c.ByToken()["tok-a"].DevDept; dept != "研发一部" {
+		t.Errorf("restored dept = %s", dept)
+	}
+	history, _ := c.History("1")
+	if len(history) < 2 || history[0].Source != dao.SceneChangeOverride || history[0].Operator != "admin" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestCatalogOverrideErrors(t *testing.T) {
+	tokens := []client.TokenItem{{Id: "1", ApisixScenarioName: "a"}}
+	labels := map[string]models.Item{}
+	c := newTestCatalog(&memSceneDao{}, &tokens, &labels)
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetOverride("1", "status", "0", "r", "admin"); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("err = %v, want invalid field", err)
+	}
+	if err := c.SetOverride("2", "devDept", "x", "r", "admin"); !errors.Is(err, ErrSceneNotFound) {
+		t.Errorf("err = %v, want scene not found", err)
+	}
+	if err := c.DeleteOverride("1", "devDept", "admin"); !errors.Is(err, ErrOverrideMissing) {
+		t.Errorf("err = %v, want override missing", err)
+	}
+}
+
+func TestCatalogSkipsEmptyUpstream(t *testing.T) {
+	d := &memSceneDao{}
+	tokens := []client.TokenItem{{Id: "1", ApisixScenarioName: "a"}}
+	labels := map[string]models.Item{}
+	c := newTestCatalog(d, &tokens, &labels)
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tokens = nil
+	if err := c.Sync(context.Background()); err == nil {
+		t.Error("empty upstream should fail the sync")
+	}
+	if d.records[0].Removed || c.Status().LastError == "" {
+		t.Errorf("records = %+v, status = %+v", d.records, c.Status())
+	}
+}
@@ -0,0 +1,66 @@
+package catalog
+
+import (
+	"monitor/internal/service/dao"
+	"strconv"
+)
+
+type field struct {
+	name string
+	get  func(r *dao.SceneRecord) string
+	set  func(r *dao.SceneRecord, v string)
+}
+
+func stringField(name string, p func(r *dao.SceneRecord) *string) field {
+	return field{
+		name: name,
+		get:  func(r *dao.SceneRecord) string { return *p(r) },
+		set:  func(r *dao.SceneRecord, v string) { *p(r) = v },
+	}
+}
+
+var (
+	tokenField         = stringField("token", func(r *dao.SceneRecord) *string { return &r.Token })
+	nameField          = stringField("name", func(r *dao.SceneRecord) *string { return &r.Name })
+	apisixField        = stringField("apisixScenarioName", func(r *dao.SceneRecord) *string { return &r.ApisixScenarioName })
+	callModelNameField = stringField("callModelName", func(r *dao.SceneRecord) *string { return &r.CallModelName })
+	modelNameField     = stringField("modelName", func(r *dao.SceneRecord) *string { return &r.ModelName })
+	devDeptField       = stringField("devDept", func(r *dao.SceneRecord) *string { return &r.DevDept })
+	devManagerField    = stringField("devManager", func(r *dao.SceneRecord) *string { return &r.DevManager })
+	envAliasField      = stringField("envAlias", func(r *dao.SceneRecord) *string { return &r.EnvAlias })
+	envNameField       = stringField("envName", func(r *dao.SceneRecord) *string { return &r.EnvName })
+	statusField        = stringField("status", func(r *dao.SceneRecord) *string { return &r.Status })
+	concurrencyField   = field{
+		name: "maxConcurrency",
+		get:  func(r *dao.SceneRecord) string { return strconv.Itoa(r.MaxConcurrency) },
+	}
+)
+
+// trackedFields 同步时比较并记入历史的字段
+var trackedFields = []field{
+	tokenField, nameField, apisixField, callModelNameField, modelNameField,
+	devDeptField, devManagerField, envAliasField, envNameField, statusField, concurrencyField,
+}
+
+// overridableFields 允许人工修正的字段，token 可用于补齐名称无法自动关联的场景
+var overridableFields = map[string]field{
+	tokenField.name:         tokenField,
+	nameField.name:          nameField,
+	callModelNameField.name: callModelNameField,
+	modelNameField.name:     modelNameField,
+	devDeptField.name:       devDeptField,
+	devManagerField.name:    devManagerField,
+	envAliasField.name:      envAliasField,
+	envNameField.name:       envNameField,
+}
+
+// OverridableFields 允许人工修正的字段名
+func OverridableFields() []string {
+	names := make([]string, 0, len(overridableFields))
+	for _, f := range trackedFields {
+		if _, ok := overridableFields[f.name]; ok {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
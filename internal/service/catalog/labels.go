@@ -0,0 +1,26 @@
+package catalog
+
+import "monitor/internal/service/scene"
+
+// LabelService 优先从场景登记表读取场景名称（已应用人工修正），登记表不可用时回退到 Grafana
+type LabelService struct {
+	scene.IGrafanaService
+}
+
+func NewLabelService(fallback scene.IGrafanaService) scene.IGrafanaService {
+	return &LabelService{IGrafanaService: fallback}
+}
+
+func (s *LabelService) GenerateApiSixScenarioKeyMap() (map[string]string, error) {
+	if c := Default(); c.Ready() {
+		return c.Labels(), nil
+	}
+	return s.IGrafanaService.GenerateApiSixScenarioKeyMap()
+}
+
+func (s *LabelService) GenerateApiSixScenarioKeyMapMock() (map[string]string, error) {
+	if c := Default(); c.Ready() {
+		return c.LabelTokens(), nil
+	}
+	return s.IGrafanaService.GenerateApiSixScenarioKeyMapMock()
+}
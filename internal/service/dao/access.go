@@ -0,0 +1,46 @@
+package dao
+
+import (
+	"encoding/json"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// Access 台账文件、草稿等按生成人部门隔离的记录的查看范围：All 为 true 时不限制，
+// 否则可查看本人生成的记录，以及生成人部门全部在 Departments 内的记录
+type Access struct {
+	All         bool
+	Creator     string
+	Departments []string
+}
+
+// Allow 判断生成人为 creator、部门范围为 departments 的记录是否可查看，departments 为空时仅生成人可查看
+func (a Access) Allow(creator string, departments []string) bool {
+	if a.All || (a.Creator != "" && creator == a.Creator) {
+		return true
+	}
+	if len(departments) == 0 {
+		return false
+	}
+	for _, dept := range departments {
+		if !slices.Contains(a.Departments, dept) {
+			return false
+		}
+	}
+	return true
+}
+
+// where 按查看范围过滤，表中须有 creator 及 JSON 类型的 departments 列
+func (a Access) where(query *gorm.DB) (*gorm.DB, error) {
+	if a.All {
+		return query, nil
+	}
+	// JSON_CONTAINS(范围, 生成人部门) 即生成人部门全部在范围内
+	depts, err := json.Marshal(a.Departments)
+	if err != nil {
+		return nil, err
+	}
+	return query.Where("(creator <> '' AND creator = ?) OR (JSON_LENGTH(departments) > 0 AND JSON_CONTAINS(CAST(? AS JSON), departments))",
+		a.Creator, string(depts)), nil
+}
@@ -0,0 +1,193 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 台账草稿状态
+const (
+	DraftStatusDraft     = "draft"     // 可调整、批注，等待审核
+	DraftStatusApproved  = "approved"  // 已审核通过，等待定稿
+	DraftStatusRejected  = "rejected"  // 已驳回，调整后重新进入草稿
+	DraftStatusFinalized = "finalized" // 已定稿，不可再修改
+)
+
+// 草稿审计动作
+const (
+	DraftActionCreate   = "create"
+	DraftActionAdjust   = "adjust"
+	DraftActionAnnotate = "annotate"
+	DraftActionApprove  = "approve"
+	DraftActionReject   = "reject"
+	DraftActionFinalize = "finalize"
+)
+
+// LedgerDraft 待审批的台账，数据由监控数据生成，审核人可调整、批注，审批定稿后不可修改
+type LedgerDraft struct {
+	ID             uint       `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	DraftID        string     `json:"id" gorm:"column:draft_id;type:varchar(64);not null;uniqueIndex:uk_draft_id;comment:草稿ID"`
+	LedgerType     int        `json:"ledgerType" gorm:"column:ledger_type;type:int;not null;index:idx_draft_type;comment:台账类型"`
+	PeriodFrom     int64      `json:"periodFrom" gorm:"column:period_from;type:bigint;not null;default:0;comment:统计开始时间(毫秒)"`
+	PeriodTo       int64      `json:"periodTo" gorm:"column:period_to;type:bigint;not null;default:0;comment:统计结束时间(毫秒)"`
+	Status         string     `json:"status" gorm:"column:status;type:varchar(16);not null;index:idx_draft_status;comment:状态 draft/approved/rejected/finalized"`
+	Data           string     `json:"-" gorm:"column:data;type:longtext;not null;comment:台账数据 JSON"`
+	Rows           int        `json:"rows" gorm:"column:rows;type:int;not null;default:0;comment:数据行数"`
+	SourceChecksum string     `json:"sourceChecksum" gorm:"column:source_checksum;type:char(64);not null;comment:生成时数据的 SHA-256"`
+	DataChecksum   string     `json:"dataChecksum" gorm:"column:data_checksum;type:varchar(64);not null;default:'';comment:定稿数据的 SHA-256"`
+	Adjustments    int        `json:"adjustments" gorm:"column:adjustments;type:int;not null;default:0;comment:人工调整次数"`
+	Creator        string     `json:"creator" gorm:"column:creator;type:varchar(128);not null;default:'';index:idx_draft_creator;comment:生成人"`
+	Departments    []string   `json:"departments" gorm:"column:departments;type:json;serializer:json;comment:生成人的部门范围，为空时仅生成人、审批人及管理员可查看"`
+	Reviewer       string     `json:"reviewer" gorm:"column:reviewer;type:varchar(128);not null;default:'';comment:审核人"`
+	ReviewComment  string     `json:"reviewComment" gorm:"column:review_comment;type:varchar(512);not null;default:'';comment:审核意见或驳回原因"`
+	ReviewedAt     *time.Time `json:"reviewedAt,omitempty" gorm:"column:reviewed_at;type:datetime;comment:审核时间"`
+	FinalizedBy    string     `json:"finalizedBy" gorm:"column:finalized_by;type:varchar(128);not null;default:'';comment:定稿人"`
+	FinalizedAt    *time.Time `json:"finalizedAt,omitempty" gorm:"column:finalized_at;type:datetime;comment:定稿时间"`
+	ArtifactID     string     `json:"artifactId" gorm:"column:artifact_id;type:varchar(64);not null;default:'';comment:定稿台账文件ID"`
+	Version        int        `json:"version" gorm:"column:version;type:int;not null;default:1;comment:版本号，每次修改加一"`
+	CreateTime     time.Time  `json:"createTime" gorm:"column:create_time;type:datetime;not null;index:idx_draft_create_time;comment:生成时间"`
+	UpdateTime     time.Time  `json:"updateTime" gorm:"column:update_time;type:datetime;not null;comment:更新时间"`
+}
+
+func (*LedgerDraft) TableName() string {
+	return "ledger_draft"
+}
+
+// LedgerAudit 草稿的操作记录，包括每一次人工调整的原值、新值及原因
+type LedgerAudit struct {
+	ID         uint      `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	DraftID    string    `json:"draftId" gorm:"column:draft_id;type:varchar(64);not null;index:idx_audit_draft;comment:草稿ID"`
+	Action     string    `json:"action" gorm:"column:action;type:varchar(16);not null;comment:动作 create/adjust/annotate/approve/reject/finalize"`
+	Row        int       `json:"row" gorm:"column:row;type:int;not null;default:-1;comment:数据行序号，从 0 开始，-1 表示整张台账"`
+	Field      string    `json:"field" gorm:"column:field;type:varchar(64);not null;default:'';comment:调整的字段"`
+	OldValue   string    `json:"oldValue" gorm:"column:old_value;type:text;comment:调整前"`
+	NewValue   string    `json:"newValue" gorm:"column:new_value;type:text;comment:调整后"`
+	Reason     string    `json:"reason" gorm:"column:reason;type:varchar(512);not null;default:'';comment:原因、批注或审核意见"`
+	Operator   string    `json:"operator" gorm:"column:operator;type:varchar(128);not null;default:'';comment:操作人"`
+	CreateTime time.Time `json:"createTime" gorm:"column:create_time;type:datetime;not null;comment:操作时间"`
+}
+
+func (*LedgerAudit) TableName() string {
+	return "ledger_audit"
+}
+
+func init() {
+	registerInjector(func(d *daoInit) {
+		setupTableModel(d, &LedgerDraft{})
+		setupTableModel(d, &LedgerAudit{})
+	})
+}
+
+var (
+	ErrDraftNotFound = errors.New("ledger draft not found")
+	ErrDraftConflict = errors.New("ledger draft was modified concurrently")
+)
+
+type IApprovalDao interface {
+	// 保存新草稿及生成记录
+	CreateDraft(draft *LedgerDraft, audit *LedgerAudit) error
+
+	// 按 ID 查询，不存在时返回 ErrDraftNotFound
+	GetDraft(draftID string) (*LedgerDraft, error)
+
+	// 分页查询 access 范围内的草稿，status 为空、ledgerType 为 0 时不过滤，按生成时间倒序
+	ListDrafts(status string, ledgerType int, access Access, page, pageSize int) ([]LedgerDraft, int64, error)
+
+	// 版本号仍为 version 时更新草稿并记录操作，否则返回 ErrDraftConflict
+	UpdateDraft(draft *LedgerDraft, version int, audit *LedgerAudit) error
+
+	// 草稿的全部操作记录，按时间顺序
+	ListAudits(draftID string) ([]LedgerAudit, error)
+}
+
+type ApprovalDao struct {
+	DB *gorm.DB
+}
+
+func NewApprovalDao(db *gorm.DB) IApprovalDao {
+	if db == nil {
+		db = GetDB()
+	}
+	return &ApprovalDao{DB: db}
+}
+
+var _ IApprovalDao = (*ApprovalDao)(nil)
+
+func (dao *ApprovalDao) CreateDraft(draft *LedgerDraft, audit *LedgerAudit) error {
+	err := dao.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(draft).Error; err != nil {
+			return err
+		}
+		return tx.Create(audit).Error
+	})
+	if err != nil {
+		return fmt.Errorf("保存台账草稿失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *ApprovalDao) GetDraft(draftID string) (*LedgerDraft, error) {
+	var draft LedgerDraft
+	err := dao.DB.Where("draft_id = ?", draftID).First(&draft).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDraftNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询台账草稿失败: %w", err)
+	}
+	return &draft, nil
+}
+
+func (dao *ApprovalDao) ListDrafts(status string, ledgerType int, access Access, page, pageSize int) ([]LedgerDraft, int64, error) {
+	query := dao.DB.Model(&LedgerDraft{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if ledgerType != 0 {
+		query = query.Where("ledger_type = ?", ledgerType)
+	}
+	query, err := access.where(query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询台账草稿失败: %w", err)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计台账草稿失败: %w", err)
+	}
+	var drafts []LedgerDraft
+	offset := (page - 1) * pageSize
+	// 列表不返回台账数据
+	err = query.Omit("data").Order("create_time DESC, id DESC").Offset(offset).Limit(pageSize).Find(&drafts).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询台账草稿失败: %w", err)
+	}
+	return drafts, total, nil
+}
+
+func (dao *ApprovalDao) UpdateDraft(draft *LedgerDraft, version int, audit *LedgerAudit) error {
+	return dao.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&LedgerDraft{}).Where("draft_id = ? AND version = ?", draft.DraftID, version).
+			Select("*").Omit("id", "draft_id", "create_time").Updates(draft)
+		if result.Error != nil {
+			return fmt.Errorf("更新台账草稿失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrDraftConflict
+		}
+		if err := tx.Create(audit).Error; err != nil {
+			return fmt.Errorf("记录台账草稿操作失败: %w", err)
+		}
+		return nil
+	})
+}
+
+func (dao *ApprovalDao) ListAudits(draftID string) ([]LedgerAudit, error) {
+	var audits []LedgerAudit
+	if err := dao.DB.Where("draft_id = ?", draftID).Order("id").Find(&audits).Error; err != nil {
+		return nil, fmt.Errorf("查询台账草稿操作记录失败: %w", err)
+	}
+	return audits, nil
+}
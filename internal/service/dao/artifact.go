@@ -0,0 +1,128 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Artifact 生成的台账文件，文件内容保存在存储后端，下载只能通过 ArtifactID
+type Artifact struct {
+	ID          uint       `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	ArtifactID  string     `json:"id" gorm:"column:artifact_id;type:varchar(64);not null;uniqueIndex:uk_artifact_id;comment:台账文件ID"`
+	LedgerType  int        `json:"ledgerType" gorm:"column:ledger_type;type:int;not null;index:idx_ledger_type;comment:台账类型"`
+	Format      string     `json:"format" gorm:"column:format;type:varchar(16);not null;comment:文件格式"`
+	Name        string     `json:"name" gorm:"column:name;type:varchar(255);not null;comment:下载文件名"`
+	PeriodFrom  int64      `json:"periodFrom" gorm:"column:period_from;type:bigint;not null;default:0;comment:统计开始时间(毫秒)"`
+	PeriodTo    int64      `json:"periodTo" gorm:"column:period_to;type:bigint;not null;default:0;comment:统计结束时间(毫秒)"`
+	Creator     string     `json:"creator" gorm:"column:creator;type:varchar(128);not null;default:'';index:idx_artifact_creator;comment:生成人"`
+	Departments []string   `json:"departments" gorm:"column:departments;type:json;serializer:json;comment:生成人的部门范围，为空时仅生成人及管理员可查看"`
+	Size        int64      `json:"size" gorm:"column:size;type:bigint;not null;comment:文件大小(字节)"`
+	Checksum    string     `json:"checksum" gorm:"column:checksum;type:char(64);not null;comment:文件内容 SHA-256"`
+	Rows        int        `json:"rows" gorm:"column:rows;type:int;not null;default:0;comment:数据行数"`
+	Backend     string     `json:"backend" gorm:"column:backend;type:varchar(16);not null;comment:存储后端"`
+	StorageKey  string     `json:"-" gorm:"column:storage_key;type:varchar(512);not null;comment:存储后端中的键"`
+	Final       bool       `json:"final" gorm:"column:final;not null;default:false;comment:经审批定稿的台账，不按保留策略删除"`
+	PurgedAt    *time.Time `json:"purgedAt,omitempty" gorm:"column:purged_at;type:datetime;comment:文件按保留策略删除的时间"`
+	CreateTime  time.Time  `json:"createTime" gorm:"column:create_time;type:datetime;not null;index:idx_create_time;comment:生成时间"`
+}
+
+func (*Artifact) TableName() string {
+	return "ledger_artifact"
+}
+
+func init() {
+	registerInjector(func(d *daoInit) {
+		setupTableModel(d, &Artifact{})
+	})
+}
+
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+type IArtifactDao interface {
+	CreateArtifact(artifact *Artifact) error
+
+	// 按 ID 查询，不存在时返回 ErrArtifactNotFound
+	GetArtifact(artifactID string) (*Artifact, error)
+
+	// 分页查询 access 范围内的文件，ledgerType 为 0 时不过滤，按生成时间倒序
+	ListArtifacts(ledgerType int, access Access, page, pageSize int) ([]Artifact, int64, error)
+
+	// 生成时间早于 before 且文件尚未删除的记录，不含定稿台账
+	ListExpired(before time.Time, limit int) ([]Artifact, error)
+
+	// 标记文件已删除，记录保留用于审计
+	MarkPurged(artifactID string, at time.Time) error
+}
+
+type ArtifactDao struct {
+	DB *gorm.DB
+}
+
+func NewArtifactDao(db *gorm.DB) IArtifactDao {
+	if db == nil {
+		db = GetDB()
+	}
+	return &ArtifactDao{DB: db}
+}
+
+var _ IArtifactDao = (*ArtifactDao)(nil)
+
+func (dao *ArtifactDao) CreateArtifact(artifact *Artifact) error {
+	if err := dao.DB.Create(artifact).Error; err != nil {
+		return fmt.Errorf("保存台账文件记录失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *ArtifactDao) GetArtifact(artifactID string) (*Artifact, error) {
+	var artifact Artifact
+	err := dao.DB.Where("artifact_id = ?", artifactID).First(&artifact).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询台账文件记录失败: %w", err)
+	}
+	return &artifact, nil
+}
+
+func (dao *ArtifactDao) ListArtifacts(ledgerType int, access Access, page, pageSize int) ([]Artifact, int64, error) {
+	query := dao.DB.Model(&Artifact{})
+	if ledgerType != 0 {
+		query = query.Where("ledger_type = ?", ledgerType)
+	}
+	query, err := access.where(query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询台账文件失败: %w", err)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计台账文件失败: %w", err)
+	}
+	var artifacts []Artifact
+	offset := (page - 1) * pageSize
+	if err := query.Order("create_time DESC, id DESC").Offset(offset).Limit(pageSize).Find(&artifacts).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询台账文件失败: %w", err)
+	}
+	return artifacts, total, nil
+}
+
+func (dao *ArtifactDao) ListExpired(before time.Time, limit int) ([]Artifact, error) {
+	var artifacts []Artifact
+	err := dao.DB.Where("create_time < ? AND purged_at IS NULL AND final = ?", before, false).Order("id").Limit(limit).Find(&artifacts).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询过期台账文件失败: %w", err)
+	}
+	return artifacts, nil
+}
+
+func (dao *ArtifactDao) MarkPurged(artifactID string, at time.Time) error {
+	err := dao.DB.Model(&Artifact{}).Where("artifact_id = ?", artifactID).Update("purged_at", at).Error
+	if err != nil {
+		return fmt.Errorf("更新台账文件记录失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InvokingDaily 场景×模型 每日调用量汇总，用于计算累计调用量，避免每次扫描全量网关日志
+type InvokingDaily struct {
+	ID         uint      `json:"id" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	Day        string    `json:"day" gorm:"column:day;type:char(10);not null;uniqueIndex:uk_day_scene_model,priority:1;comment:统计日期 yyyy-mm-dd"`
+	Scene      string    `json:"scene" gorm:"column:scene;type:varchar(255);not null;uniqueIndex:uk_day_scene_model,priority:2;index:idx_scene_model,priority:1;comment:场景token"`
+	Model      string    `json:"model" gorm:"column:model;type:varchar(255);not null;uniqueIndex:uk_day_scene_model,priority:3;index:idx_scene_model,priority:2;comment:模型名称"`
+	Total      int64     `json:"total" gorm:"column:total;type:bigint;not null;default:0;comment:调用总量"`
+	Success    int64     `json:"success" gorm:"column:success;type:bigint;not null;default:0;comment:成功调用量"`
+	CreateTime time.Time `json:"createTime,omitempty" gorm:"column:create_time;type:datetime;default:CURRENT_TIMESTAMP;comment:创建时间"`
+	UpdateTime time.Time `json:"updateTime,omitempty" gorm:"column:update_time;type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;comment:更新时间"`
+}
+
+func (*InvokingDaily) TableName() string {
+	return "invoking_daily"
+}
+
+func init() {
+	registerInjector(func(d *daoInit) {
+		setupTableModel(d, &InvokingDaily{})
+	})
+}
+
+// InvokingSum 场景×模型 的汇总调用量
+type InvokingSum struct {
+	Scene   string `gorm:"column:scene"`
+	Model   string `gorm:"column:model"`
+	Total   int64  `gorm:"column:total"`
+	Success int64  `gorm:"column:success"`
+}
+
+type IInvokingDao interface {
+	// 写入某一天的汇总数据，已存在的记录覆盖
+	UpsertDaily(rows []InvokingDaily) error
+
+	// 已汇总的最新日期，无数据时返回空串
+	LatestDay() (string, error)
+
+	// 汇总 before 之前（不含）所有日期的调用量
+	SumBefore(before string) ([]InvokingSum, error)
+}
+
+type InvokingDao struct {
+	DB *gorm.DB
+}
+
+func NewInvokingDao(db *gorm.DB) IInvokingDao {
+	if db == nil {
+		db = GetDB()
+	}
+	return &InvokingDao{DB: db}
+}
+
+var _ IInvokingDao = (*InvokingDao)(nil)
+
+func (dao *InvokingDao) UpsertDaily(rows []InvokingDaily) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	err := dao.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "day"}, {Name: "scene"}, {Name: "model"}},
+		DoUpdates: clause.AssignmentColumns([]string{"total", "success", "update_time"}),
+	}).CreateInBatches(rows, 200).Error
+	if err != nil {
+		return fmt.Errorf("写入每日调用量失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *InvokingDao) LatestDay() (string, error) {
+	var row InvokingDaily
+	err := dao.DB.Model(&InvokingDaily{}).Order("day DESC").Limit(1).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("查询最新汇总日期失败: %w", err)
+	}
+	return row.Day, nil
+}
+
+func (dao *InvokingDao) SumBefore(before string) ([]InvokingSum, error) {
+	var sums []InvokingSum
+	err := dao.DB.Model(&InvokingDaily{}).
+		Select("scene, model, SUM(total) AS total, SUM(success) AS success").
+		Where("day < ?", before).
+		Group("scene, model").
+		Scan(&sums).Error
+	if err != nil {
+		return nil, fmt.Errorf("汇总累计调用量失败: %w", err)
+	}
+	return sums, nil
+}
@@ -0,0 +1,161 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 后台生成台账的任务状态
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// LedgerJob 后台生成台账的任务，结束后文件可按 ArtifactID 下载
+type LedgerJob struct {
+	ID         uint       `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	JobID      string     `json:"id" gorm:"column:job_id;type:varchar(64);not null;uniqueIndex:uk_job_id;comment:任务ID"`
+	LedgerType int        `json:"ledgerType" gorm:"column:ledger_type;type:int;not null;comment:台账类型"`
+	Name       string     `json:"name" gorm:"column:name;type:varchar(255);not null;comment:下载文件名"`
+	Format     string     `json:"format" gorm:"column:format;type:varchar(16);not null;comment:文件格式"`
+	Rows       int        `json:"rows" gorm:"column:rows;type:int;not null;default:0;comment:数据行数"`
+	Creator    string     `json:"creator" gorm:"column:creator;type:varchar(128);not null;default:'';index:idx_job_creator;comment:生成人"`
+	Instance   string     `json:"-" gorm:"column:instance;type:varchar(128);not null;default:'';index:idx_job_instance;comment:执行任务的服务实例"`
+	Status     string     `json:"status" gorm:"column:status;type:varchar(16);not null;index:idx_job_status;comment:状态 queued/running/succeeded/failed"`
+	Stage      string     `json:"stage" gorm:"column:stage;type:varchar(16);not null;default:'';comment:生成阶段"`
+	Progress   int        `json:"progress" gorm:"column:progress;type:int;not null;default:0;comment:进度 0-100"`
+	ArtifactID string     `json:"artifactId,omitempty" gorm:"column:artifact_id;type:varchar(64);not null;default:'';comment:生成的台账文件ID"`
+	Size       int64      `json:"size,omitempty" gorm:"column:size;type:bigint;not null;default:0;comment:文件大小(字节)"`
+	Checksum   string     `json:"checksum,omitempty" gorm:"column:checksum;type:varchar(64);not null;default:'';comment:文件内容 SHA-256"`
+	Error      string     `json:"error,omitempty" gorm:"column:error;type:text;comment:失败原因"`
+	CreateTime time.Time  `json:"createTime" gorm:"column:create_time;type:datetime;not null;index:idx_job_create_time;comment:提交时间"`
+	StartTime  *time.Time `json:"startTime,omitempty" gorm:"column:start_time;type:datetime;comment:开始生成时间"`
+	FinishTime *time.Time `json:"finishTime,omitempty" gorm:"column:finish_time;type:datetime;index:idx_job_finish_time;comment:结束时间"`
+	LeaseTime  *time.Time `json:"-" gorm:"column:lease_time;type:datetime;comment:执行实例最近一次续约的时间"`
+}
+
+func (*LedgerJob) TableName() string {
+	return "ledger_job"
+}
+
+func init() {
+	registerInjector(func(d *daoInit) {
+		setupTableModel(d, &LedgerJob{})
+	})
+}
+
+var ErrJobNotFound = errors.New("ledger job not found")
+
+type IJobDao interface {
+	CreateJob(job *LedgerJob) error
+
+	// 按 ID 查询，不存在时返回 ErrJobNotFound
+	GetJob(jobID string) (*LedgerJob, error)
+
+	// 分页查询，creator 为空时不过滤，按提交时间倒序
+	ListJobs(creator string, page, pageSize int) ([]LedgerJob, int64, error)
+
+	// 更新未结束任务的部分字段，键为列名；任务已结束时不更新，返回 false
+	UpdateJob(jobID string, fields map[string]any) (bool, error)
+
+	// 续约 instance 执行的未结束任务
+	RenewJobs(instance string, at time.Time) error
+
+	// 未结束且最近一次续约早于 before 的任务，即执行实例已停止的任务
+	ListStaleJobs(before time.Time) ([]LedgerJob, error)
+
+	// 删除结束时间早于 before 的任务
+	DeleteJobsFinishedBefore(before time.Time) (int64, error)
+}
+
+type JobDao struct {
+	DB *gorm.DB
+}
+
+func NewJobDao(db *gorm.DB) IJobDao {
+	if db == nil {
+		db = GetDB()
+	}
+	return &JobDao{DB: db}
+}
+
+var _ IJobDao = (*JobDao)(nil)
+
+func (dao *JobDao) CreateJob(job *LedgerJob) error {
+	if err := dao.DB.Create(job).Error; err != nil {
+		return fmt.Errorf("保存台账任务失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *JobDao) GetJob(jobID string) (*LedgerJob, error) {
+	var job LedgerJob
+	err := dao.DB.Where("job_id = ?", jobID).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询台账任务失败: %w", err)
+	}
+	return &job, nil
+}
+
+func (dao *JobDao) ListJobs(creator string, page, pageSize int) ([]LedgerJob, int64, error) {
+	query := dao.DB.Model(&LedgerJob{})
+	if creator != "" {
+		query = query.Where("creator = ?", creator)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计台账任务失败: %w", err)
+	}
+	var jobs []LedgerJob
+	offset := (page - 1) * pageSize
+	if err := query.Order("create_time DESC, id DESC").Offset(offset).Limit(pageSize).Find(&jobs).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询台账任务失败: %w", err)
+	}
+	return jobs, total, nil
+}
+
+// unfinished 排队或生成中的任务
+var unfinished = []string{JobStatusQueued, JobStatusRunning}
+
+func (dao *JobDao) UpdateJob(jobID string, fields map[string]any) (bool, error) {
+	result := dao.DB.Model(&LedgerJob{}).Where("job_id = ? AND status IN ?", jobID, unfinished).Updates(fields)
+	if result.Error != nil {
+		return false, fmt.Errorf("更新台账任务失败: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (dao *JobDao) RenewJobs(instance string, at time.Time) error {
+	err := dao.DB.Model(&LedgerJob{}).Where("instance = ? AND status IN ?", instance, unfinished).
+		Update("lease_time", at).Error
+	if err != nil {
+		return fmt.Errorf("续约台账任务失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *JobDao) ListStaleJobs(before time.Time) ([]LedgerJob, error) {
+	var jobs []LedgerJob
+	err := dao.DB.Where("status IN ? AND (lease_time IS NULL OR lease_time < ?)", unfinished, before).
+		Order("id").Find(&jobs).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询中断的台账任务失败: %w", err)
+	}
+	return jobs, nil
+}
+
+func (dao *JobDao) DeleteJobsFinishedBefore(before time.Time) (int64, error) {
+	result := dao.DB.Where("finish_time < ?", before).Delete(&LedgerJob{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("清理台账任务失败: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,202 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SceneRecord 场景登记表，由 DCE 场景管理记录与 Grafana 面板值映射定时同步
+type SceneRecord struct {
+	ID                 uint      `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	SceneID            string    `json:"id" gorm:"column:scene_id;type:varchar(128);not null;uniqueIndex:uk_scene_id;comment:场景标识，DCE 记录 ID，仅存在于 Grafana 映射时为 grafana:<token>"`
+	Token              string    `json:"token" gorm:"column:token;type:varchar(255);not null;default:'';index:idx_token;comment:网关日志中的场景token，即 Grafana 映射的值"`
+	Label              string    `json:"label" gorm:"column:label;type:varchar(512);not null;default:'';comment:Grafana 映射的原始文本"`
+	Name               string    `json:"name" gorm:"column:name;type:varchar(255);not null;default:'';comment:场景名称"`
+	ApisixScenarioName string    `json:"apisixScenarioName" gorm:"column:apisix_scenario_name;type:varchar(255);not null;default:'';comment:网关场景名称"`
+	CallModelName      string    `json:"callModelName" gorm:"column:call_model_name;type:varchar(255);not null;default:'';comment:调用模型描述"`
+	CallModelId        string    `json:"callModelId" gorm:"column:call_model_id;type:varchar(128);not null;default:'';comment:调用模型ID"`
+	ModelName          string    `json:"modelName" gorm:"column:model_name;type:varchar(255);not null;default:'';comment:模型名称"`
+	DevDept            string    `json:"devDept" gorm:"column:dev_dept;type:varchar(255);not null;default:'';comment:开发部门"`
+	DevManager         string    `json:"devManager" gorm:"column:dev_manager;type:varchar(255);not null;default:'';comment:开发负责人"`
+	EnvAlias           string    `json:"envAlias" gorm:"column:env_alias;type:varchar(255);not null;default:'';comment:环境别名"`
+	EnvName            string    `json:"envName" gorm:"column:env_name;type:varchar(255);not null;default:'';comment:环境名称"`
+	MaxConcurrency     int       `json:"maxConcurrency" gorm:"column:max_concurrency;type:int;not null;default:0;comment:最大并发"`
+	Status             string    `json:"status" gorm:"column:status;type:varchar(32);not null;default:'';comment:DCE 记录状态"`
+	Removed            bool      `json:"removed" gorm:"column:removed;not null;default:false;comment:上游已不存在"`
+	SyncedAt           time.Time `json:"syncedAt" gorm:"column:synced_at;type:datetime;comment:最近一次同步时间"`
+	CreateTime         time.Time `json:"createTime,omitempty" gorm:"column:create_time;type:datetime;default:CURRENT_TIMESTAMP;comment:创建时间"`
+	UpdateTime         time.Time `json:"updateTime,omitempty" gorm:"column:update_time;type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;comment:更新时间"`
+}
+
+func (*SceneRecord) TableName() string {
+	return "scene_registry"
+}
+
+// SceneOverride 人工修正的场景字段，优先于同步值
+type SceneOverride struct {
+	ID         uint      `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	SceneID    string    `json:"sceneId" gorm:"column:scene_id;type:varchar(128);not null;uniqueIndex:uk_scene_field,priority:1;comment:场景标识"`
+	Field      string    `json:"field" gorm:"column:field;type:varchar(64);not null;uniqueIndex:uk_scene_field,priority:2;comment:字段名"`
+	Value      string    `json:"value" gorm:"column:value;type:varchar(512);not null;default:'';comment:修正值"`
+	Reason     string    `json:"reason" gorm:"column:reason;type:varchar(512);not null;default:'';comment:修正原因"`
+	Operator   string    `json:"operator" gorm:"column:operator;type:varchar(128);not null;default:'';comment:操作人"`
+	CreateTime time.Time `json:"createTime,omitempty" gorm:"column:create_time;type:datetime;default:CURRENT_TIMESTAMP;comment:创建时间"`
+	UpdateTime time.Time `json:"updateTime,omitempty" gorm:"column:update_time;type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;comment:更新时间"`
+}
+
+func (*SceneOverride) TableName() string {
+	return "scene_override"
+}
+
+// 场景变更来源
+const (
+	SceneChangeSync     = "sync"     // 定时同步发现的上游变更
+	SceneChangeOverride = "override" // 人工修正或撤销修正
+)
+
+// SceneHistory 场景字段的变更历史
+type SceneHistory struct {
+	ID        uint      `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	SceneID   string    `json:"sceneId" gorm:"column:scene_id;type:varchar(128);not null;index:idx_scene_changed,priority:1;comment:场景标识"`
+	Field     string    `json:"field" gorm:"column:field;type:varchar(64);not null;comment:字段名"`
+	OldValue  string    `json:"oldValue" gorm:"column:old_value;type:varchar(512);not null;default:'';comment:变更前"`
+	NewValue  string    `json:"newValue" gorm:"column:new_value;type:varchar(512);not null;default:'';comment:变更后"`
+	Source    string    `json:"source" gorm:"column:source;type:varchar(32);not null;comment:变更来源 sync/override"`
+	Operator  string    `json:"operator" gorm:"column:operator;type:varchar(128);not null;default:'';comment:操作人，同步时为空"`
+	ChangedAt time.Time `json:"changedAt" gorm:"column:changed_at;type:datetime;not null;index:idx_scene_changed,priority:2;comment:变更时间"`
+}
+
+func (*SceneHistory) TableName() string {
+	return "scene_history"
+}
+
+func init() {
+	registerInjector(func(d *daoInit) {
+		setupTableModel(d, &SceneRecord{})
+		setupTableModel(d, &SceneOverride{})
+		setupTableModel(d, &SceneHistory{})
+	})
+}
+
+// SceneMerge 根据已有记录计算需要写入的记录（ID 为 0 时新增）与变更历史
+type SceneMerge func(existing []SceneRecord) ([]SceneRecord, []SceneHistory)
+
+type ISceneDao interface {
+	// 全部场景记录，包含已从上游移除的
+	ListScenes() ([]SceneRecord, error)
+
+	// 在事务中锁定场景表后执行 merge 并写入结果，多个副本同时同步时串行执行
+	SyncScenes(merge SceneMerge) error
+
+	// 全部人工修正
+	ListOverrides() ([]SceneOverride, error)
+
+	// 新增或更新修正，并记录变更历史
+	SaveOverride(override *SceneOverride, history *SceneHistory) error
+
+	// 删除修正，并记录变更历史；修正不存在时返回 gorm.ErrRecordNotFound
+	DeleteOverride(sceneID, field string, history *SceneHistory) error
+
+	// 场景的变更历史，按时间倒序
+	ListHistory(sceneID string, limit int) ([]SceneHistory, error)
+}
+
+type SceneDao struct {
+	DB *gorm.DB
+}
+
+func NewSceneDao(db *gorm.DB) ISceneDao {
+	if db == nil {
+		db = GetDB()
+	}
+	return &SceneDao{DB: db}
+}
+
+var _ ISceneDao = (*SceneDao)(nil)
+
+func (dao *SceneDao) ListScenes() ([]SceneRecord, error) {
+	var records []SceneRecord
+	if err := dao.DB.Order("id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询场景登记表失败: %w", err)
+	}
+	return records, nil
+}
+
+func (dao *SceneDao) SyncScenes(merge SceneMerge) error {
+	err := dao.DB.Transaction(func(tx *gorm.DB) error {
+		var existing []SceneRecord
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id").Find(&existing).Error; err != nil {
+			return err
+		}
+		records, history := merge(existing)
+		for i := range records {
+			if err := tx.Save(&records[i]).Error; err != nil {
+				return err
+			}
+		}
+		if len(history) > 0 {
+			if err := tx.CreateInBatches(history, 200).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("写入场景登记表失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *SceneDao) ListOverrides() ([]SceneOverride, error) {
+	var overrides []SceneOverride
+	if err := dao.DB.Find(&overrides).Error; err != nil {
+		return nil, fmt.Errorf("查询场景修正失败: %w", err)
+	}
+	return overrides, nil
+}
+
+func (dao *SceneDao) SaveOverride(override *SceneOverride, history *SceneHistory) error {
+	err := dao.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "scene_id"}, {Name: "field"}},
+			DoUpdates: clause.AssignmentColumns([]string{"value", "reason", "operator", "update_time"}),
+		}).Create(override).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(history).Error
+	})
+	if err != nil {
+		return fmt.Errorf("保存场景修正失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *SceneDao) DeleteOverride(sceneID, field string, history *SceneHistory) error {
+	return dao.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("scene_id = ? AND field = ?", sceneID, field).Delete(&SceneOverride{})
+		if result.Error != nil {
+			return fmt.Errorf("删除场景修正失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Create(history).Error; err != nil {
+			return fmt.Errorf("记录场景变更失败: %w", err)
+		}
+		return nil
+	})
+}
+
+func (dao *SceneDao) ListHistory(sceneID string, limit int) ([]SceneHistory, error) {
+	var history []SceneHistory
+	err := dao.DB.Where("scene_id = ?", sceneID).Order("changed_at DESC, id DESC").Limit(limit).Find(&history).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询场景变更历史失败: %w", err)
+	}
+	return history, nil
+}
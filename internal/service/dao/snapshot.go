@@ -0,0 +1,132 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LedgerSnapshot 台账预览时服务端保存的数据快照，生成台账时用于核对调用方提交的数据
+type LedgerSnapshot struct {
+	ID         uint      `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	SnapshotID string    `json:"id" gorm:"column:snapshot_id;type:varchar(64);not null;uniqueIndex:uk_snapshot_id;comment:快照ID"`
+	LedgerType int       `json:"ledgerType" gorm:"column:ledger_type;type:int;not null;comment:台账类型"`
+	PeriodFrom int64     `json:"periodFrom" gorm:"column:period_from;type:bigint;not null;default:0;comment:统计开始时间(毫秒)"`
+	PeriodTo   int64     `json:"periodTo" gorm:"column:period_to;type:bigint;not null;default:0;comment:统计结束时间(毫秒)"`
+	Data       string    `json:"-" gorm:"column:data;type:longtext;not null;comment:预览数据 JSON"`
+	Rows       int       `json:"rows" gorm:"column:rows;type:int;not null;default:0;comment:数据行数"`
+	Checksum   string    `json:"checksum" gorm:"column:checksum;type:char(64);not null;comment:预览数据 SHA-256"`
+	Creator    string    `json:"creator" gorm:"column:creator;type:varchar(128);not null;default:'';comment:预览人"`
+	CreateTime time.Time `json:"createTime" gorm:"column:create_time;type:datetime;not null;index:idx_snapshot_create_time;comment:预览时间"`
+}
+
+func (*LedgerSnapshot) TableName() string {
+	return "ledger_snapshot"
+}
+
+// LedgerProvenance 台账文件的数据来源核验结果，记录提交数据与预览快照不一致的单元格
+type LedgerProvenance struct {
+	ID               uint      `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	ArtifactID       string    `json:"artifactId" gorm:"column:artifact_id;type:varchar(64);not null;uniqueIndex:uk_provenance_artifact;comment:台账文件ID"`
+	SnapshotID       string    `json:"snapshotId" gorm:"column:snapshot_id;type:varchar(64);not null;default:'';index:idx_provenance_snapshot;comment:预览快照ID，未提供时为空"`
+	SnapshotChecksum string    `json:"snapshotChecksum" gorm:"column:snapshot_checksum;type:varchar(64);not null;default:'';comment:预览快照 SHA-256"`
+	DataChecksum     string    `json:"dataChecksum" gorm:"column:data_checksum;type:char(64);not null;comment:提交数据 SHA-256"`
+	Status           string    `json:"status" gorm:"column:status;type:varchar(16);not null;comment:verified/modified/unverified"`
+	ModifiedCells    int       `json:"modifiedCells" gorm:"column:modified_cells;type:int;not null;default:0;comment:修改的单元格数"`
+	AddedRows        int       `json:"addedRows" gorm:"column:added_rows;type:int;not null;default:0;comment:快照中没有的行数"`
+	RemovedRows      int       `json:"removedRows" gorm:"column:removed_rows;type:int;not null;default:0;comment:提交时删除的行数"`
+	Changes          string    `json:"-" gorm:"column:changes;type:longtext;comment:修改的单元格 JSON"`
+	CreateTime       time.Time `json:"createTime" gorm:"column:create_time;type:datetime;not null;comment:核验时间"`
+}
+
+func (*LedgerProvenance) TableName() string {
+	return "ledger_provenance"
+}
+
+func init() {
+	registerInjector(func(d *daoInit) {
+		setupTableModel(d, &LedgerSnapshot{})
+		setupTableModel(d, &LedgerProvenance{})
+	})
+}
+
+var (
+	ErrSnapshotNotFound   = errors.New("ledger snapshot not found")
+	ErrProvenanceNotFound = errors.New("ledger provenance not found")
+)
+
+type ISnapshotDao interface {
+	CreateSnapshot(snapshot *LedgerSnapshot) error
+
+	// 按 ID 查询，不存在时返回 ErrSnapshotNotFound
+	GetSnapshot(snapshotID string) (*LedgerSnapshot, error)
+
+	// 删除预览时间早于 before 的快照，返回删除的数量
+	DeleteSnapshotsBefore(before time.Time) (int64, error)
+
+	CreateProvenance(provenance *LedgerProvenance) error
+
+	// 按台账文件 ID 查询，不存在时返回 ErrProvenanceNotFound
+	GetProvenance(artifactID string) (*LedgerProvenance, error)
+}
+
+type SnapshotDao struct {
+	DB *gorm.DB
+}
+
+func NewSnapshotDao(db *gorm.DB) ISnapshotDao {
+	if db == nil {
+		db = GetDB()
+	}
+	return &SnapshotDao{DB: db}
+}
+
+var _ ISnapshotDao = (*SnapshotDao)(nil)
+
+func (dao *SnapshotDao) CreateSnapshot(snapshot *LedgerSnapshot) error {
+	if err := dao.DB.Create(snapshot).Error; err != nil {
+		return fmt.Errorf("保存台账预览快照失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *SnapshotDao) GetSnapshot(snapshotID string) (*LedgerSnapshot, error) {
+	var snapshot LedgerSnapshot
+	err := dao.DB.Where("snapshot_id = ?", snapshotID).First(&snapshot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询台账预览快照失败: %w", err)
+	}
+	return &snapshot, nil
+}
+
+func (dao *SnapshotDao) DeleteSnapshotsBefore(before time.Time) (int64, error) {
+	result := dao.DB.Where("create_time < ?", before).Delete(&LedgerSnapshot{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("删除过期台账预览快照失败: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (dao *SnapshotDao) CreateProvenance(provenance *LedgerProvenance) error {
+	if err := dao.DB.Create(provenance).Error; err != nil {
+		return fmt.Errorf("保存台账数据来源失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *SnapshotDao) GetProvenance(artifactID string) (*LedgerProvenance, error) {
+	var provenance LedgerProvenance
+	err := dao.DB.Where("artifact_id = ?", artifactID).First(&provenance).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrProvenanceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询台账数据来源失败: %w", err)
+	}
+	return &provenance, nil
+}
@@ -0,0 +1,140 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LedgerTemplate 上传的台账 xlsx 模板，同一台账类别的模板按上传顺序编号，最多一个处于选用状态；
+// 没有选用的模板时使用内置版式
+type LedgerTemplate struct {
+	ID         uint      `json:"-" gorm:"column:id;primaryKey;autoIncrement;comment:主键"`
+	TemplateID string    `json:"id" gorm:"column:template_id;type:varchar(64);not null;uniqueIndex:uk_template_id;comment:模板ID"`
+	LedgerType int       `json:"ledgerType" gorm:"column:ledger_type;type:int;not null;uniqueIndex:uk_template_version,priority:1;comment:台账类型"`
+	Version    int       `json:"version" gorm:"column:version;type:int;not null;uniqueIndex:uk_template_version,priority:2;comment:版本号，同一台账类型内递增"`
+	Name       string    `json:"name" gorm:"column:name;type:varchar(255);not null;comment:模板名称"`
+	Comment    string    `json:"comment" gorm:"column:comment;type:varchar(512);not null;default:'';comment:版本说明"`
+	Content    []byte    `json:"-" gorm:"column:content;type:mediumblob;not null;comment:模板文件"`
+	Size       int64     `json:"size" gorm:"column:size;type:bigint;not null;comment:文件大小(字节)"`
+	Checksum   string    `json:"checksum" gorm:"column:checksum;type:char(64);not null;comment:文件内容 SHA-256"`
+	Active     bool      `json:"active" gorm:"column:active;not null;default:false;comment:是否为该台账类型选用的模板"`
+	Creator    string    `json:"creator" gorm:"column:creator;type:varchar(128);not null;default:'';comment:上传人"`
+	CreateTime time.Time `json:"createTime" gorm:"column:create_time;type:datetime;not null;comment:上传时间"`
+}
+
+func (*LedgerTemplate) TableName() string {
+	return "ledger_template"
+}
+
+func init() {
+	registerInjector(func(d *daoInit) {
+		setupTableModel(d, &LedgerTemplate{})
+	})
+}
+
+var ErrTemplateNotFound = errors.New("ledger template not found")
+
+type ITemplateDao interface {
+	// 保存模板，版本号为该台账类型已有的最大版本号加一
+	CreateTemplate(template *LedgerTemplate) error
+
+	// 按 ID 查询，含模板文件，不存在时返回 ErrTemplateNotFound
+	GetTemplate(templateID string) (*LedgerTemplate, error)
+
+	// 某一台账类型的全部版本，不含模板文件，按版本号倒序
+	ListTemplates(ledgerType int) ([]LedgerTemplate, error)
+
+	// 台账类型选用的模板，含模板文件，未选用时返回 ErrTemplateNotFound
+	GetActiveTemplate(ledgerType int) (*LedgerTemplate, error)
+
+	// 选用模板，templateID 为空时取消选用，恢复内置版式；模板不属于该台账类型时返回 ErrTemplateNotFound
+	ActivateTemplate(ledgerType int, templateID string) error
+}
+
+type TemplateDao struct {
+	DB *gorm.DB
+}
+
+func NewTemplateDao(db *gorm.DB) ITemplateDao {
+	if db == nil {
+		db = GetDB()
+	}
+	return &TemplateDao{DB: db}
+}
+
+var _ ITemplateDao = (*TemplateDao)(nil)
+
+func (dao *TemplateDao) CreateTemplate(template *LedgerTemplate) error {
+	err := dao.DB.Transaction(func(tx *gorm.DB) error {
+		var version int
+		err := tx.Model(&LedgerTemplate{}).Where("ledger_type = ?", template.LedgerType).
+			Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+		if err != nil {
+			return err
+		}
+		template.Version = version + 1
+		return tx.Create(template).Error
+	})
+	if err != nil {
+		return fmt.Errorf("保存台账模板失败: %w", err)
+	}
+	return nil
+}
+
+func (dao *TemplateDao) GetTemplate(templateID string) (*LedgerTemplate, error) {
+	var template LedgerTemplate
+	err := dao.DB.Where("template_id = ?", templateID).First(&template).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询台账模板失败: %w", err)
+	}
+	return &template, nil
+}
+
+func (dao *TemplateDao) ListTemplates(ledgerType int) ([]LedgerTemplate, error) {
+	var templates []LedgerTemplate
+	err := dao.DB.Omit("content").Where("ledger_type = ?", ledgerType).Order("version DESC").Find(&templates).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询台账模板失败: %w", err)
+	}
+	return templates, nil
+}
+
+func (dao *TemplateDao) GetActiveTemplate(ledgerType int) (*LedgerTemplate, error) {
+	var template LedgerTemplate
+	err := dao.DB.Where("ledger_type = ? AND active = ?", ledgerType, true).First(&template).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询台账模板失败: %w", err)
+	}
+	return &template, nil
+}
+
+func (dao *TemplateDao) ActivateTemplate(ledgerType int, templateID string) error {
+	return dao.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&LedgerTemplate{}).Where("ledger_type = ? AND active = ?", ledgerType, true).
+			Update("active", false).Error
+		if err != nil {
+			return fmt.Errorf("选用台账模板失败: %w", err)
+		}
+		if templateID == "" {
+			return nil
+		}
+		result := tx.Model(&LedgerTemplate{}).Where("ledger_type = ? AND template_id = ?", ledgerType, templateID).
+			Update("active", true)
+		if result.Error != nil {
+			return fmt.Errorf("选用台账模板失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrTemplateNotFound
+		}
+		return nil
+	})
+}
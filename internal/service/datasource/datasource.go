@@ -0,0 +1,278 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"monitor/config"
+	"monitor/internal/cache"
+	"monitor/internal/client"
+	"monitor/internal/types"
+	"monitor/internal/upstream"
+	"sync"
+	"time"
+)
+
+// Datasource 单个指标数据源
+type Datasource interface {
+	Name() string
+	Type() string
+	Query(ctx context.Context, expr string, at time.Time) (*types.VectorResponse, error)
+	QueryRange(ctx context.Context, expr string, r client.Range) (*types.VectorResponse, error)
+}
+
+// Querier 按集群合并多个数据源的查询结果
+type Querier interface {
+	Query(ctx context.Context, expr string, at time.Time) (*types.VectorResponse, error)
+	QueryRange(ctx context.Context, expr string, r client.Range) (*types.VectorResponse, error)
+}
+
+type source struct {
+	cfg    config.DatasourceConfig
+	client *client.QueryClient
+}
+
+func newSource(cfg config.DatasourceConfig) (*source, error) {
+	c := client.NewQueryClient(cfg.URL, cfg.InsecureSkipVerify).WithGuard(upstream.Get(cfg.Name))
+	switch cfg.Type {
+	case config.DatasourceInsight:
+		// Insight 代理默认使用调用方 token，配置了 token 时使用固定 token
+		if cfg.Token != "" {
+			c.WithStaticToken(cfg.Token)
+		}
+	case config.DatasourcePrometheus:
+		c.WithPaths(client.PrometheusPaths).WithStaticToken(cfg.Token)
+	default:
+		return nil, fmt.Errorf("数据源 %s 类型不支持: %s", cfg.Name, cfg.Type)
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("数据源 %s 未配置 url", cfg.Name)
+	}
+	return &source{cfg: cfg, client: c}, nil
+}
+
+func (s *source) Name() string { return s.cfg.Name }
+func (s *source) Type() string { return s.cfg.Type }
+
+func (s *source) Query(ctx context.Context, expr string, at time.Time) (*types.VectorResponse, error) {
+	result, err := s.client.Query(ctx, expr, at)
+	if err != nil {
+		return nil, err
+	}
+	s.fillCluster(result)
+	return result, nil
+}
+
+func (s *source) QueryRange(ctx context.Context, expr string, r client.Range) (*types.VectorResponse, error) {
+	result, err := s.client.QueryRange(ctx, expr, r)
+	if err != nil {
+		return nil, err
+	}
+	s.fillCluster(result)
+	return result, nil
+}
+
+// 单集群数据源的指标可能没有 cluster 标签，按配置补全
+func (s *source) fillCluster(result *types.VectorResponse) {
+	if len(s.cfg.Clusters) != 1 {
+		return
+	}
+	for i := range result.Matrix {
+		metric := &result.Matrix[i].Metric
+		if metric.Cluster == "" {
+			metric.Cluster = s.cfg.Clusters[0]
+		}
+		if metric.ClusterName == "" && metric.Cluster_Name == "" {
+			metric.ClusterName = s.cfg.ClusterName
+		}
+	}
+}
+
+// Set 配置的全部数据源，每个集群的数据只取自负责它的数据源
+type Set struct {
+	sources  []*source
+	owners   map[string]*source // 集群 ID -> 负责的数据源
+	fallback *source            // 未指定集群的数据源，负责其余集群
+}
+
+// NewSet 校验配置并创建数据源，同一集群不能由多个数据源负责
+func NewSet(cfgs []config.DatasourceConfig) (*Set, error) {
+	set := &Set{owners: make(map[string]*source)}
+	for _, cfg := range cfgs {
+		s, err := newSource(cfg)
+		if err != nil {
+			return nil, err
+		}
+		set.sources = append(set.sources, s)
+		if len(cfg.Clusters) == 0 {
+			if set.fallback != nil {
+				return nil, fmt.Errorf("数据源 %s 与 %s 都未指定集群", set.fallback.cfg.Name, cfg.Name)
+			}
+			set.fallback = s
+			continue
+		}
+		for _, cluster := range cfg.Clusters {
+			if owner, exist := set.owners[cluster]; exist {
+				return nil, fmt.Errorf("集群 %s 同时配置在数据源 %s 与 %s 中", cluster, owner.cfg.Name, cfg.Name)
+			}
+			set.owners[cluster] = s
+		}
+	}
+	if len(set.sources) == 0 {
+		return nil, errors.New("未配置指标数据源")
+	}
+	return set, nil
+}
+
+var (
+	defaultMu  sync.Mutex
+	defaultSet *Set
+)
+
+// Init 按配置创建数据源集合并设为默认，配置错误时返回错误；服务启动时调用，配置错误时不启动
+func Init() error {
+	set, err := NewSet(config.GetDatasourceConfig())
+	if err != nil {
+		return fmt.Errorf("指标数据源配置错误: %w", err)
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultSet = set
+	return nil
+}
+
+// Default 默认的数据源集合，未调用 Init 时按配置创建；配置已在启动时由 Init 校验，
+// 此处仍出错时每次调用都 panic 并给出原因，不会留下空的集合
+func Default() *Set {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultSet == nil {
+		set, err := NewSet(config.GetDatasourceConfig())
+		if err != nil {
+			panic(fmt.Sprintf("指标数据源配置错误: %v", err))
+		}
+		defaultSet = set
+	}
+	return defaultSet
+}
+
+// ForCluster 返回负责该集群的数据源，未找到时返回 nil
+func (s *Set) ForCluster(cluster string) Datasource {
+	if owner, exist := s.owners[cluster]; exist {
+		return owner
+	}
+	if s.fallback != nil {
+		return s.fallback
+	}
+	return nil
+}
+
+// Sources 全部数据源
+func (s *Set) Sources() []Datasource {
+	sources := make([]Datasource, len(s.sources))
+	for i := range s.sources {
+		sources[i] = s.sources[i]
+	}
+	return sources
+}
+
+// ConfiguredClusters 数据源配置中显式指定的集群，及其配置的名称
+func (s *Set) ConfiguredClusters() []types.NameList {
+	names := make([]types.NameList, 0)
+	for _, src := range s.sources {
+		for _, cluster := range src.cfg.Clusters {
+			name := ""
+			if len(src.cfg.Clusters) == 1 {
+				name = src.cfg.ClusterName
+			}
+			names = append(names, types.NameList{Cluster: cluster, ClusterName: name})
+		}
+	}
+	return names
+}
+
+func (s *Set) Query(ctx context.Context, expr string, at time.Time) (*types.VectorResponse, error) {
+	// 未指定时间时查询的是当前值，由缓存过期时间控制新鲜度
+	key := cache.Key(cache.SourceDCE, "query", expr, at, client.DceTokenFromContext(ctx))
+	return s.load(ctx, key, func() (*types.VectorResponse, error) {
+		return s.fanOut(func(src *source) (*types.VectorResponse, error) {
+			return src.Query(ctx, expr, at)
+		})
+	})
+}
+
+func (s *Set) QueryRange(ctx context.Context, expr string, r client.Range) (*types.VectorResponse, error) {
+	if cache.ForSource(cache.SourceDCE).Enabled() {
+		step := r.Step
+		if step <= 0 {
+			step = client.DefaultStep
+		}
+		r.Start, r.End = cache.AlignWindow(r.Start, r.End, time.Now(), step)
+	}
+	key := cache.Key(cache.SourceDCE, "query_range", expr, r.Start, r.End, r.Step, client.DceTokenFromContext(ctx))
+	return s.load(ctx, key, func() (*types.VectorResponse, error) {
+		return s.fanOut(func(src *source) (*types.VectorResponse, error) {
+			return src.QueryRange(ctx, expr, r)
+		})
+	})
+}
+
+func init() {
+	cache.Register(&types.VectorResponse{})
+}
+
+// load 经查询缓存执行，Insight 按用户权限过滤结果，缓存键中包含调用方 token
+func (s *Set) load(ctx context.Context, key string, fn func() (*types.VectorResponse, error)) (*types.VectorResponse, error) {
+	val, err := cache.ForSource(cache.SourceDCE).Load(ctx, key, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val.(*types.VectorResponse), nil
+}
+
+// fanOut 并发查询所有数据源并合并结果，部分数据源失败时记录日志并返回其余结果，全部失败时返回错误
+func (s *Set) fanOut(fn func(src *source) (*types.VectorResponse, error)) (*types.VectorResponse, error) {
+	if len(s.sources) == 1 {
+		return fn(s.sources[0])
+	}
+
+	results := make([]*types.VectorResponse, len(s.sources))
+	errs := make([]error, len(s.sources))
+	var wg sync.WaitGroup
+	for i := range s.sources {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = fn(s.sources[i])
+		}(i)
+	}
+	wg.Wait()
+
+	merged := &types.VectorResponse{Matrix: make([]types.MatrixItem, 0)}
+	var firstErr error
+	failed := 0
+	for i, src := range s.sources {
+		if errs[i] != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			log.Printf("数据源 %s 查询失败: %v", src.cfg.Name, errs[i])
+			continue
+		}
+		for _, item := range results[i].Matrix {
+			// 没有 cluster 标签的汇总结果无法区分来源，全部保留
+			if item.Metric.Cluster != "" && s.ForCluster(item.Metric.Cluster) != Datasource(src) {
+				continue
+			}
+			merged.Matrix = append(merged.Matrix, item)
+		}
+	}
+	if failed == len(s.sources) {
+		return nil, firstErr
+	}
+	return merged, nil
+}
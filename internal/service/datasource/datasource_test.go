@@ -0,0 +1,104 @@
+package datasource
+
+import (
+	"context"
+	"monitor/config"
+	"monitor/internal/client"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetMergeByCluster(t *testing.T) {
+	insight := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != client.InsightPaths.QueryRange {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"matrix":[
+			{"metric":{"cluster":"c1"},"values":[{"timestamp":"1","value":"1"}]},
+			{"metric":{"cluster":"edge-1"},"values":[{"timestamp":"1","value":"99"}]}]}`))
+	}))
+	defer insight.Close()
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != client.PrometheusPaths.QueryRange || r.Header.Get("Authorization") != "Bearer edge-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status":"error","errorType":"unauthorized","error":"denied"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"node":"n1"},"values":[[1,"2"]]}]}}`))
+	}))
+	defer prom.Close()
+
+	set, err := NewSet([]config.DatasourceConfig{
+		{Name: "dce", Type: config.DatasourceInsight, URL: insight.URL},
+		{Name: "edge", Type: config.DatasourcePrometheus, URL: prom.URL, Token: "edge-token", Clusters: []string{"edge-1"}, ClusterName: "边缘集群"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.ForCluster("edge-1").Name() != "edge" || set.ForCluster("c1").Name() != "dce" {
+		t.Fatalf("unexpected cluster owners")
+	}
+
+	now := time.Now()
+	result, err := set.QueryRange(context.Background(), "up", client.Range{Start: now.Add(-time.Minute), End: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, item := range result.Matrix {
+		got[item.Metric.Cluster] = item.Values[0].Value
+		if item.Metric.Cluster == "edge-1" && item.Metric.ClusterName != "边缘集群" {
+			t.Errorf("cluster name not filled: %+v", item.Metric)
+		}
+	}
+	// edge-1 只取自 Prometheus 数据源，Insight 中的同名集群被忽略
+	if len(got) != 2 || got["c1"] != "1" || got["edge-1"] != "2" {
+		t.Errorf("merged = %v", got)
+	}
+
+	_, err = NewSet([]config.DatasourceConfig{
+		{Name: "a", Type: config.DatasourcePrometheus, URL: prom.URL, Clusters: []string{"x"}},
+		{Name: "b", Type: config.DatasourcePrometheus, URL: prom.URL, Clusters: []string{"x"}},
+	})
+	if err == nil {
+		t.Error("duplicate cluster owner should be rejected")
+	}
+}
+
+func TestInitRejectsInvalidConfig(t *testing.T) {
+	saved := config.Datasource
+	defer func() {
+		config.Datasource = saved
+		defaultSet = nil
+	}()
+	config.Datasource = []config.DatasourceConfig{
+		{Name: "a", URL: "http://a", Clusters: []string{"c1"}},
+		{Name: "b", URL: "http://b", Clusters: []string{"c1"}},
+	}
+	if err := Init(); err == nil {
+		t.Fatal("duplicate cluster should fail Init")
+	}
+	// 配置错误时每次调用都给出原因，而不是返回空的集合
+	for range 2 {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("Default should panic on invalid config")
+				}
+			}()
+			Default()
+		}()
+	}
+
+	config.Datasource = []config.DatasourceConfig{{Name: "a", URL: "http://a"}}
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	if Default() == nil || Default().ForCluster("any").Name() != "a" {
+		t.Error("Default should return the initialized set")
+	}
+}
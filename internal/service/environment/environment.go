@@ -0,0 +1,124 @@
+package environment
+
+import (
+	"monitor/config"
+	"strings"
+	"unicode"
+)
+
+// Resolver 将集群 ID、集群名称或场景登记的环境名称归到台账使用的环境（生产、开发、测试）
+type Resolver struct {
+	rules []config.ClusterEnvironment
+	def   string
+	known map[string]bool
+}
+
+// Default 使用 environments 配置
+func Default() *Resolver {
+	return NewResolver(config.GetEnvironmentConfig())
+}
+
+func NewResolver(cfg config.EnvironmentConfig) *Resolver {
+	r := &Resolver{rules: cfg.Rules, def: cfg.Default, known: make(map[string]bool)}
+	if r.def == "" {
+		r.def = "未知"
+	}
+	for _, env := range []string{config.EnvProduction, config.EnvDevelopment, config.EnvTesting} {
+		r.known[env] = true
+	}
+	for _, rule := range cfg.Rules {
+		r.known[rule.Env] = true
+	}
+	return r
+}
+
+// Resolve 依次尝试各候选值：本身已是环境名称的直接使用，其次按集群精确匹配，最后按关键字匹配；都未匹配时为默认环境。
+// 英文关键字按名称中的词整词匹配，避免 dev 误匹配 device、sit 误匹配 deposit
+func (r *Resolver) Resolve(candidates ...string) string {
+	for _, c := range candidates {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if r.known[c] {
+			return c
+		}
+		for _, rule := range r.rules {
+			if rule.Cluster != "" && strings.EqualFold(rule.Cluster, c) {
+				return rule.Env
+			}
+		}
+	}
+	for _, c := range candidates {
+		if strings.TrimSpace(c) == "" {
+			continue
+		}
+		for _, rule := range r.rules {
+			if rule.Match != "" && matchKeyword(c, rule.Match) {
+				return rule.Env
+			}
+		}
+	}
+	return r.def
+}
+
+// matchKeyword 关键字含中文时按包含匹配，中文名称没有分隔符；
+// 否则将两者拆成词后要求关键字的词在名称中连续出现，gpu-prod 匹配 k8s-gpu-prod-01
+func matchKeyword(name, keyword string) bool {
+	for _, r := range keyword {
+		if unicode.Is(unicode.Han, r) {
+			return strings.Contains(strings.ToLower(name), strings.ToLower(keyword))
+		}
+	}
+	words := splitWords(keyword)
+	if len(words) == 0 {
+		return false
+	}
+	return strings.Contains("-"+strings.Join(splitWords(name), "-")+"-", "-"+strings.Join(words, "-")+"-")
+}
+
+// splitWords 按非字母数字字符及字母、数字的交界拆词并转为小写，prd01 拆为 prd、01
+func splitWords(s string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case len(word) > 0 && unicode.IsDigit(r) != unicode.IsDigit(word[len(word)-1]):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+	return words
+}
+
+// Rank 环境在台账中的排列顺序：生产、开发、测试，其他环境在后
+func Rank(env string) int {
+	switch env {
+	case config.EnvProduction:
+		return 0
+	case config.EnvDevelopment:
+		return 1
+	case config.EnvTesting:
+		return 2
+	}
+	return 3
+}
+
+// Less 按环境排序，其他环境之间按名称排序
+func Less(a, b string) bool {
+	if ra, rb := Rank(a), Rank(b); ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
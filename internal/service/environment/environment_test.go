@@ -0,0 +1,70 @@
+package environment
+
+import (
+	"monitor/config"
+	"sort"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	r := NewResolver(config.EnvironmentConfig{Rules: []config.ClusterEnvironment{
+		{Cluster: "c-7f3a", Env: config.EnvTesting},
+		{Cluster: "gpu-prod-bj", Env: config.EnvDevelopment}, // 精确匹配优先于关键字
+		{Match: "prod", Env: config.EnvProduction},
+		{Match: "dev", Env: config.EnvDevelopment},
+		{Match: "灾备", Env: "灾备"},
+	}})
+	cases := []struct {
+		candidates []string
+		want       string
+	}{
+		{[]string{"C-7F3A", "gpu-prod-sh"}, config.EnvTesting},
+		{[]string{"c-unknown", "GPU-Prod-SH"}, config.EnvProduction},
+		{[]string{"c-unknown", "gpu-prod-bj"}, config.EnvDevelopment},
+		{[]string{"开发"}, config.EnvDevelopment},
+		{[]string{"", "llm-dev-01"}, config.EnvDevelopment},
+		{[]string{"llm_DEV02"}, config.EnvDevelopment},
+		{[]string{"device-pool", "products"}, "未知"},
+		{[]string{"同城灾备集群"}, "灾备"},
+		{[]string{"c-unknown", "edge"}, "未知"},
+		{nil, "未知"},
+	}
+	for _, c := range cases {
+		if got := r.Resolve(c.candidates...); got != c.want {
+			t.Errorf("Resolve(%q) = %q, want %q", c.candidates, got, c.want)
+		}
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	r := NewResolver(config.GetEnvironmentConfig())
+	for name, want := range map[string]string{
+		"kpanda-prd-01": config.EnvProduction,
+		"生产集群":          config.EnvProduction,
+		"AI-UAT":        config.EnvTesting,
+		"dev-gpu":       config.EnvDevelopment,
+		"gpu.sit2":      config.EnvTesting,
+		"edge":          "未知",
+		// 关键字只是其他单词的一部分时不匹配
+		"deposit-gpu": "未知",
+		"transit-cn":  "未知",
+		"device-farm": "未知",
+		"testbed":     "未知",
+		"kpandaprod":  "未知",
+	} {
+		if got := r.Resolve(name); got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLess(t *testing.T) {
+	envs := []string{"未知", config.EnvTesting, "灾备", config.EnvProduction, config.EnvDevelopment}
+	sort.Slice(envs, func(i, j int) bool { return Less(envs[i], envs[j]) })
+	want := []string{config.EnvProduction, config.EnvDevelopment, config.EnvTesting, "未知", "灾备"}
+	for i := range want {
+		if envs[i] != want[i] {
+			t.Fatalf("order = %v, want %v", envs, want)
+		}
+	}
+}
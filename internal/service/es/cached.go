@@ -0,0 +1,127 @@
+package es
+
+import (
+	"context"
+	"monitor/internal/cache"
+	"monitor/internal/types"
+	"time"
+)
+
+// 相对时间窗口对齐的粒度
+const esCacheStep = time.Minute
+
+func init() {
+	cache.Register(map[string]map[string]int64{}, map[string]int64{}, []types.TrendSeries{},
+		map[string]map[string]types.TokenUsage{})
+}
+
+// cachedES 缓存聚合查询结果，日志明细及检索不缓存
+type cachedES struct {
+	EsRepo
+	cache *cache.QueryCache
+}
+
+// withCache 开启查询缓存时为聚合查询加一层缓存
+func withCache(repo EsRepo) EsRepo {
+	qc := cache.ForSource(cache.SourceES)
+	if !qc.Enabled() {
+		return repo
+	}
+	return &cachedES{EsRepo: repo, cache: qc}
+}
+
+// 毫秒时间戳窗口按 esCacheStep 对齐
+func alignMillis(from, to int64) (int64, int64) {
+	f, t := cache.AlignWindow(time.UnixMilli(from), time.UnixMilli(to), time.Now(), esCacheStep)
+	return f.UnixMilli(), t.UnixMilli()
+}
+
+func (c *cachedES) load(key string, loader func() (interface{}, error)) (interface{}, error) {
+	return c.cache.Load(context.Background(), key, func(context.Context) (interface{}, error) {
+		return loader()
+	})
+}
+
+func (c *cachedES) Count(from, to int64, statusType string, reqType string, keyword string) (map[string]map[string]int64, error) {
+	from, to = alignMillis(from, to)
+	v, err := c.load(cache.Key(cache.SourceES, "Count", from, to, statusType, reqType, keyword), func() (interface{}, error) {
+		return c.EsRepo.Count(from, to, statusType, reqType, keyword)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]map[string]int64), nil
+}
+
+func (c *cachedES) CountByNestedAggs(from, to int64) (map[string]map[string]int64, error) {
+	from, to = alignMillis(from, to)
+	v, err := c.load(cache.Key(cache.SourceES, "CountByNestedAggs", from, to), func() (interface{}, error) {
+		return c.EsRepo.CountByNestedAggs(from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]map[string]int64), nil
+}
+
+func (c *cachedES) CountByModel(from, to int64) (map[string]map[string]int64, error) {
+	from, to = alignMillis(from, to)
+	v, err := c.load(cache.Key(cache.SourceES, "CountByModel", from, to), func() (interface{}, error) {
+		return c.EsRepo.CountByModel(from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]map[string]int64), nil
+}
+
+func (c *cachedES) CountSceneWithModel(from int64, to int64, modelName string) (map[string]int64, error) {
+	from, to = alignMillis(from, to)
+	v, err := c.load(cache.Key(cache.SourceES, "CountSceneWithModel", from, to, modelName), func() (interface{}, error) {
+		return c.EsRepo.CountSceneWithModel(from, to, modelName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]int64), nil
+}
+
+func (c *cachedES) CountTrend(params types.TrendParams) ([]types.TrendSeries, error) {
+	params.From, params.To = alignMillis(params.From, params.To)
+	location := ""
+	if params.Location != nil {
+		location = params.Location.String()
+	}
+	key := cache.Key(cache.SourceES, "CountTrend", params.From, params.To, params.Interval, location,
+		params.AuthCode, params.AuthCodes, params.ModelName, params.SeriesBy, params.Series)
+	v, err := c.load(key, func() (interface{}, error) {
+		return c.EsRepo.CountTrend(params)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]types.TrendSeries), nil
+}
+
+func (c *cachedES) BatchCountFieldOccurrences(authValues, modelValues []string) (map[string]int64, error) {
+	v, err := c.load(cache.Key(cache.SourceES, "BatchCountFieldOccurrences", authValues, modelValues), func() (interface{}, error) {
+		return c.EsRepo.BatchCountFieldOccurrences(authValues, modelValues)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]int64), nil
+}
+
+func (c *cachedES) SumTokens(from, to int64, reqType string) (map[string]map[string]types.TokenUsage, error) {
+	from, to = alignMillis(from, to)
+	v, err := c.load(cache.Key(cache.SourceES, "SumTokens", from, to, reqType), func() (interface{}, error) {
+		return c.EsRepo.SumTokens(from, to, reqType)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]map[string]types.TokenUsage), nil
+}
+
+var _ EsRepo = (*cachedES)(nil)
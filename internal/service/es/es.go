@@ -10,6 +10,8 @@ import (
 	"monitor/config"
 	"monitor/internal/client"
 	"monitor/internal/types"
+	"monitor/util"
+	"sync"
 	"time"
 )
 
@@ -19,8 +21,10 @@ type EsRepo interface {
 	GetDocumentFields(from, to int64, statusType string, sceneValue string, modelValue string) ([]map[string]interface{}, error)
 	CountByModel(from, to int64) (map[string]map[string]int64, error)
 	CountSceneWithModel(from int64, to int64, modelName string) (map[string]int64, error)
-	CountDailyLogsByFixedAuthModel(modelValue string, authValue string) ([]types.DateCount, error)
+	CountTrend(params types.TrendParams) ([]types.TrendSeries, error)
 	BatchCountFieldOccurrences(authValues, modelValues []string) (map[string]int64, error)
+	SumTokens(from, to int64, reqType string) (map[string]map[string]types.TokenUsage, error)
+	SearchLogs(params types.LogSearchParams) (*types.LogSearchResult, error)
 }
 
 type ESService struct {
@@ -28,15 +32,106 @@ type ESService struct {
 	Index    string
 }
 
+var (
+	servicesMu sync.Mutex
+	services   = make(map[config.ESConfig]EsRepo)
+)
+
+// NewESService 返回按配置创建的 ES 服务，同一配置只创建一次；
+// 创建失败时 panic，服务启动时应先调用 Init 检查配置
 func NewESService(appConfig config.ESConfig) EsRepo {
-	client, err := client.NewEsClient(appConfig)
+	repo, err := service(appConfig)
+	if err != nil {
+		panic(err.Error())
+	}
+	return repo
+}
+
+// Init 启动时创建 ES 服务：mock 模式加载样例日志，否则连接 ES 并检查请求日志翻页字段，失败时返回错误
+func Init(appConfig config.ESConfig) error {
+	_, err := service(appConfig)
+	return err
+}
+
+// service mock 样例只在首次创建时读取，ago 表示的时间相对于读取时刻
+func service(appConfig config.ESConfig) (EsRepo, error) {
+	servicesMu.Lock()
+	defer servicesMu.Unlock()
+	if repo, ok := services[appConfig]; ok {
+		return repo, nil
+	}
+
+	var repo EsRepo
+	if appConfig.Mock {
+		mock, err := NewMockESService(appConfig.MockDataPath)
+		if err != nil {
+			return nil, fmt.Errorf("加载 ES mock 样例失败: %w", err)
+		}
+		repo = withCache(withGuard(mock))
+	} else {
+		c, err := client.NewEsClient(appConfig)
+		if err != nil {
+			return nil, fmt.Errorf("连接 ES 失败: %w", err)
+		}
+		if err := checkRequestIDField(c, appConfig); err != nil {
+			return nil, err
+		}
+		repo = withCache(withGuard(&ESService{
+			ESClient: c,
+			Index:    appConfig.Index,
+		}))
+	}
+	services[appConfig] = repo
+	return repo, nil
+}
+
+// checkRequestIDField 检查请求日志翻页兜底字段：排序值相同的日志靠该字段排出全序，
+// 未配置或索引中没有该字段的映射时 search_after 翻页会漏行、重复，直接返回错误；
+// mock 加载样例时已校验每条日志都有唯一的 request_id
+func checkRequestIDField(c *client.ESClient, appConfig config.ESConfig) error {
+	if appConfig.RequestIDField == "" {
+		return errors.New("未配置 es.requestIdField，请求日志无法稳定翻页")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resp, err := c.Client.GetFieldMapping().Index(appConfig.Index).Field(appConfig.RequestIDField).Do(ctx)
 	if err != nil {
-		panic("es connect error")
+		return fmt.Errorf("查询 %s 的字段映射失败: %w", appConfig.RequestIDField, err)
+	}
+	return checkFieldMapping(resp, appConfig.Index, appConfig.RequestIDField)
+}
+
+// checkFieldMapping 要求每个索引都有 field 的映射且可排序，text 字段没有 doc values
+func checkFieldMapping(resp map[string]interface{}, index, field string) error {
+	if len(resp) == 0 {
+		return fmt.Errorf("索引 %s 不存在", index)
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	var indices map[string]struct {
+		Mappings map[string]struct {
+			Mapping map[string]struct {
+				Type string `json:"type"`
+			} `json:"mapping"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal(data, &indices); err != nil {
+		return fmt.Errorf("解析字段映射失败: %w", err)
 	}
-	return &ESService{
-		ESClient: client,
-		Index:    appConfig.Index,
+	for name, idx := range indices {
+		m, ok := idx.Mappings[field]
+		if !ok {
+			return fmt.Errorf("索引 %s 中没有字段 %s 的映射", name, field)
+		}
+		for _, f := range m.Mapping {
+			if f.Type == "text" {
+				return fmt.Errorf("索引 %s 中字段 %s 为 text 类型，不能用于排序", name, field)
+			}
+		}
 	}
+	return nil
 }
 
 func (e *ESService) CountSceneWithModel(from int64, to int64, modelName string) (map[string]int64, error) {
@@ -50,7 +145,7 @@ func (e *ESService) CountSceneWithModel(from int64, to int64, modelName string)
 
 	// 时间范围校验
 	if from == 0 || to == 0 || to <= from {
-		return nil, fmt.Errorf("invalid time range: from=%d to=%d", from, to)
+		return nil, invalidParam("invalid time range: from=%d to=%d", from, to)
 	}
 
 	// 构建主查询 (必须条件)
@@ -100,7 +195,7 @@ func (e *ESService) CountSceneWithModel(from int64, to int64, modelName string)
 
 func (e *ESService) Count(from, to int64, statusType string, reqType string, keyword string) (map[string]map[string]int64, error) {
 	if from == 0 || to == 0 || to <= from {
-		return nil, fmt.Errorf("invalid time range: from=%d to=%d", from, to)
+		return nil, invalidParam("invalid time range: from=%d to=%d", from, to)
 	}
 
 	boolQuery := elastic.NewBoolQuery()
@@ -234,7 +329,7 @@ func (e *ESService) CountByNestedAggs(from, to int64) (map[string]map[string]int
 
 	// 验证时间范围
 	if from == 0 || to == 0 || to <= from {
-		return nil, fmt.Errorf("invalid time range: from=%d to=%d", from, to)
+		return nil, invalidParam("invalid time range: from=%d to=%d", from, to)
 	}
 
 	termQueries = append(termQueries,
@@ -416,7 +511,7 @@ func (e *ESService) CountByModel(from, to int64) (map[string]map[string]int64, e
 
 	// 验证时间范围
 	if from == 0 || to == 0 || to <= from {
-		return nil, fmt.Errorf("invalid time range: from=%d to=%d", from, to)
+		return nil, invalidParam("invalid time range: from=%d to=%d", from, to)
 	}
 
 	termQueries = append(termQueries,
@@ -496,60 +591,148 @@ func (e *ESService) CountByModel(from, to int64) (map[string]map[string]int64, e
 	return requestCountMap, nil
 }
 
-func (e *ESService) CountDailyLogsByFixedAuthModel(modelValue string, authValue string) ([]types.DateCount, error) {
-	const (
-		maxAggSize = 500
-		dateFormat = "2006-01-02" // Go日期格式模板
-	)
+// CountTrend 按时区和粒度统计调用量趋势，支持多个模型或场景的对比序列
+func (e *ESService) CountTrend(params types.TrendParams) ([]types.TrendSeries, error) {
+	if params.From == 0 || params.To == 0 || params.To <= params.From {
+		return nil, invalidParam("invalid time range: from=%d to=%d", params.From, params.To)
+	}
 
-	from := time.Now().AddDate(0, 0, -30).UnixMilli()
-	to := time.Now().UnixMilli()
-	boolQuery := elastic.NewBoolQuery().Must(
-		elastic.NewTermQuery("http_authorization.keyword", authValue),
-		elastic.NewTermQuery("http_model.keyword", modelValue),
+	seriesField, keys, err := trendSeriesKeys(params)
+	if err != nil {
+		return nil, err
+	}
+
+	boolQuery := elastic.NewBoolQuery().Filter(
 		elastic.NewRangeQuery("@timestamp").
-			Gte(from).Lte(to).
+			Gte(params.From).Lte(params.To).
 			Format("epoch_millis"),
 	)
+	if params.SeriesBy != types.SeriesByScene && params.AuthCode != "" {
+		boolQuery.Filter(elastic.NewTermQuery("http_authorization.keyword", params.AuthCode))
+	}
+	if params.SeriesBy != types.SeriesByModel && params.ModelName != "" {
+		boolQuery.Filter(elastic.NewTermQuery("http_model.keyword", params.ModelName))
+	}
+	if params.AuthCodes != nil {
+		boolQuery.Filter(elastic.NewTermsQuery("http_authorization.keyword", stringValues(params.AuthCodes)...))
+	}
 
-	// 创建日期直方图聚合
-	dateHistogramAgg := elastic.NewDateHistogramAggregation().
+	histogram := elastic.NewDateHistogramAggregation().
 		Field("@timestamp").
-		CalendarInterval("1d").
+		CalendarInterval(trendCalendarInterval(params.Interval)).
+		TimeZone(types.TrendZoneID(params.Location, params.From)).
 		MinDocCount(0).
-		ExtendedBounds(from, to) // 确保返回完整日期范围// 包含零值日期
+		ExtendedBounds(params.From, params.To)
 
-	// 执行ES查询
+	// 按序列字段拆分，每个序列各自做日期直方图
+	seriesValues := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		seriesValues = append(seriesValues, key)
+	}
+	boolQuery.Filter(elastic.NewTermsQuery(seriesField, seriesValues...))
+	seriesAgg := elastic.NewTermsAggregation().
+		Field(seriesField).
+		Size(len(keys)).
+		SubAggregation("trend", histogram)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	searchResult, err := e.ESClient.Client.Search().
 		Index(e.Index).
 		Query(boolQuery).
 		Size(0).
-		Aggregation("daily_counts", dateHistogramAgg).
-		Do(context.Background())
-
+		IgnoreUnavailable(true).
+		Aggregation("series", seriesAgg).
+		Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("ES查询失败: %w", err)
 	}
-	log.Printf("Raw Agg Result: %s", searchResult.Aggregations["daily_counts"])
-	// 处理结果 - 使用切片保持排序
-	var dailyCounts []types.DateCount
-	log.Println(searchResult.Aggregations.DateHistogram("daily_counts"))
-	if histAgg, found := searchResult.Aggregations.DateHistogram("daily_counts"); found {
-		for _, bucket := range histAgg.Buckets {
-			date := time.Unix(0, int64(bucket.Key)*int64(time.Millisecond)).Format(dateFormat)
-			dailyCounts = append(dailyCounts, types.DateCount{
-				Date:  date,
-				Count: bucket.DocCount,
-			})
+
+	counts := make(map[string]map[int64]int64)
+	if terms, found := searchResult.Aggregations.Terms("series"); found {
+		for _, bucket := range terms.Buckets {
+			key := fmt.Sprintf("%v", bucket.Key)
+			counts[key] = make(map[int64]int64)
+			if histAgg, found := bucket.Aggregations.DateHistogram("trend"); found {
+				for _, point := range histAgg.Buckets {
+					counts[key][int64(point.Key)] = point.DocCount
+				}
+			}
 		}
 	}
+	return buildTrendSeries(params, keys, counts), nil
+}
 
-	return dailyCounts, nil
+func trendCalendarInterval(interval string) string {
+	switch interval {
+	case types.TrendMinute:
+		return "1m"
+	case types.TrendHour:
+		return "1h"
+	case types.TrendWeek:
+		return "1w"
+	default:
+		return "1d"
+	}
+}
+
+// 返回拆分序列使用的字段及序列取值，未指定对比序列时按模型拆分出唯一一条
+func trendSeriesKeys(params types.TrendParams) (string, []string, error) {
+	switch params.SeriesBy {
+	case "":
+		if params.ModelName != "" {
+			return "http_model.keyword", []string{params.ModelName}, nil
+		}
+		if params.AuthCode != "" {
+			return "http_authorization.keyword", []string{params.AuthCode}, nil
+		}
+		return "", nil, invalidParam("model_name 与 authorization_code 不能同时为空")
+	case types.SeriesByModel:
+		if len(params.Series) == 0 {
+			return "", nil, invalidParam("对比序列不能为空")
+		}
+		return "http_model.keyword", params.Series, nil
+	case types.SeriesByScene:
+		if len(params.Series) == 0 {
+			return "", nil, invalidParam("对比序列不能为空")
+		}
+		return "http_authorization.keyword", params.Series, nil
+	default:
+		return "", nil, invalidParam("不支持的序列维度: %s", params.SeriesBy)
+	}
+}
+
+// terms 查询参数，空集合不匹配任何文档
+func stringValues(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		result = append(result, v)
+	}
+	return result
+}
+
+// 以分桶起始时间补齐范围内的零值点，各序列的点位保持一致
+func buildTrendSeries(params types.TrendParams, keys []string, counts map[string]map[int64]int64) []types.TrendSeries {
+	layout := types.TrendDateFormat(params.Interval)
+	end := time.UnixMilli(params.To)
+	series := make([]types.TrendSeries, 0, len(keys))
+	for _, key := range keys {
+		s := types.TrendSeries{Key: key, Name: key, Points: make([]types.TrendPoint, 0)}
+		for t := types.TrendBucketStart(time.UnixMilli(params.From), params.Interval, params.Location); !t.After(end); t = types.NextTrendBucket(t, params.Interval) {
+			s.Points = append(s.Points, types.TrendPoint{
+				Time:  t.UnixMilli(),
+				Date:  t.Format(layout),
+				Count: counts[key][t.UnixMilli()],
+			})
+		}
+		series = append(series, s)
+	}
+	return series
 }
 
 func (e *ESService) BatchCountFieldOccurrences(authValues, modelValues []string) (map[string]int64, error) {
 	if len(authValues) != len(modelValues) {
-		return nil, fmt.Errorf("authValues and modelValues must have same length")
+		return nil, invalidParam("authValues and modelValues must have same length")
 	}
 	// 获取当前时间（UTC）
 	now := time.Now().UTC()
@@ -625,3 +808,203 @@ func parseAggregationResult(res *elastic.SearchResult, auths, models []string) (
 
 	return results, nil
 }
+
+// tokenUsagePageSize token 用量组合聚合每页的桶数
+const tokenUsagePageSize = 1000
+
+// SumTokens 按 场景/模型 两层聚合 token 用量，reqType 与 Count 一致：
+// onAuth 场景在外层，onModel 模型在外层。日志未携带用量字段时各项为 0。
+func (e *ESService) SumTokens(from, to int64, reqType string) (map[string]map[string]types.TokenUsage, error) {
+	if from == 0 || to == 0 || to <= from {
+		return nil, invalidParam("invalid time range: from=%d to=%d", from, to)
+	}
+	cfg := config.GetEsConfig()
+
+	boolQuery := elastic.NewBoolQuery().
+		Must(elastic.NewTermQuery("method.keyword", "POST")).
+		Filter(elastic.NewRangeQuery("@timestamp").Gte(from).Lte(to).Format("epoch_millis")).
+		MustNot(elastic.NewTermsQuery("http_model.keyword", "-", ""))
+
+	outerField, innerField := "http_authorization.keyword", "http_model.keyword"
+	if reqType == "onModel" {
+		outerField, innerField = innerField, outerField
+	}
+
+	// 按 场景+模型 组合分页聚合，场景、模型数量不受单次聚合桶数限制
+	compositeAgg := elastic.NewCompositeAggregation().
+		Sources(
+			elastic.NewCompositeAggregationTermsValuesSource("outer").Field(outerField),
+			elastic.NewCompositeAggregationTermsValuesSource("inner").Field(innerField),
+		).
+		Size(tokenUsagePageSize).
+		SubAggregation("prompt_tokens", elastic.NewSumAggregation().Field(cfg.PromptTokensField)).
+		SubAggregation("completion_tokens", elastic.NewSumAggregation().Field(cfg.CompletionTokensField)).
+		SubAggregation("total_tokens", elastic.NewSumAggregation().Field(cfg.TotalTokensField))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	usageMap := make(map[string]map[string]types.TokenUsage)
+	for {
+		searchResult, err := e.ESClient.Client.Search().
+			Index(e.Index).
+			Query(boolQuery).
+			Size(0).
+			IgnoreUnavailable(true).
+			Aggregation("token_usage", compositeAgg).
+			Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ES查询失败: %w", err)
+		}
+		composite, found := searchResult.Aggregations.Composite("token_usage")
+		if !found {
+			return usageMap, fmt.Errorf("未找到聚合结果")
+		}
+		for _, bucket := range composite.Buckets {
+			outerKey := fmt.Sprintf("%v", bucket.Key["outer"])
+			innerKey := fmt.Sprintf("%v", bucket.Key["inner"])
+			usage := types.TokenUsage{
+				PromptTokens:     sumValue(bucket.Aggregations, "prompt_tokens"),
+				CompletionTokens: sumValue(bucket.Aggregations, "completion_tokens"),
+				TotalTokens:      sumValue(bucket.Aggregations, "total_tokens"),
+				Count:            bucket.DocCount,
+			}
+			// 部分网关只记录输入/输出，没有总量字段
+			if usage.TotalTokens == 0 {
+				usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+			}
+			if usageMap[outerKey] == nil {
+				usageMap[outerKey] = make(map[string]types.TokenUsage)
+			}
+			usageMap[outerKey][innerKey] = usage
+		}
+		if len(composite.Buckets) < tokenUsagePageSize || len(composite.AfterKey) == 0 {
+			return usageMap, nil
+		}
+		compositeAgg = compositeAgg.AggregateAfter(composite.AfterKey)
+	}
+}
+
+func sumValue(aggs elastic.Aggregations, name string) int64 {
+	sum, found := aggs.Sum(name)
+	if !found || sum.Value == nil {
+		return 0
+	}
+	return int64(*sum.Value)
+}
+
+// SearchLogs 按条件检索请求日志，排序字段相同时以请求ID兜底，保证 search_after 翻页稳定；
+// 不使用 _id 兜底，_id 排序需加载 fielddata，ES 7 起已不推荐
+func (e *ESService) SearchLogs(params types.LogSearchParams) (*types.LogSearchResult, error) {
+	query := elastic.NewBoolQuery()
+	query = query.Filter(elastic.NewRangeQuery("@timestamp").
+		Format("epoch_millis").
+		Gte(params.From).
+		Lte(params.To))
+	query = query.Must(elastic.NewTermQuery("method.keyword", "POST"))
+	query = query.MustNot(elastic.NewTermQuery("http_model.keyword", "-"))
+	query = query.MustNot(elastic.NewTermQuery("http_model.keyword", ""))
+
+	if params.AuthCode != "" {
+		query = query.Filter(elastic.NewTermQuery("http_authorization.keyword", params.AuthCode))
+	}
+	if params.AuthCodes != nil {
+		query = query.Filter(elastic.NewTermsQuery("http_authorization.keyword", stringValues(params.AuthCodes)...))
+	}
+	if params.ModelName != "" {
+		query = query.Filter(elastic.NewTermQuery("http_model.keyword", params.ModelName))
+	}
+	switch params.Status {
+	case "", "all":
+	case "success":
+		query = query.Filter(elastic.NewTermQuery("status", "200"))
+	case "failed":
+		query = query.MustNot(elastic.NewTermQuery("status", "200"))
+	default:
+		query = query.Filter(elastic.NewTermQuery("status", params.Status))
+	}
+	if params.MinLatency > 0 || params.MaxLatency > 0 {
+		latency := elastic.NewRangeQuery("request_time")
+		if params.MinLatency > 0 {
+			latency = latency.Gte(params.MinLatency)
+		}
+		if params.MaxLatency > 0 {
+			latency = latency.Lte(params.MaxLatency)
+		}
+		query = query.Filter(latency)
+	}
+	if params.Keyword != "" {
+		query = query.Must(elastic.NewSimpleQueryStringQuery(params.Keyword).
+			Field("request").
+			Field("request_uri").
+			Field("path").
+			Field("http_host").
+			DefaultOperator("AND").
+			Lenient(true))
+	}
+
+	sortField := "@timestamp"
+	if params.SortBy == "latency" {
+		sortField = "request_time"
+	}
+
+	fields := []string{"@timestamp", "request_time", "upstream_response_time", "request_uri", "path", "time", "status", "http_model", "http_host", "request", "http_authorization"}
+
+	// 多取一条用于判断是否还有下一页
+	searchService := e.ESClient.Client.Search().
+		Index(e.Index).
+		Query(query).
+		Size(params.Size+1).
+		TrackTotalHits(true).
+		IgnoreUnavailable(true).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include(fields...)).
+		SortBy(
+			elastic.NewFieldSort(sortField).Order(params.Ascending),
+			elastic.NewFieldSort(config.GetEsConfig().RequestIDField).Order(params.Ascending),
+		)
+	if len(params.SearchAfter) > 0 {
+		searchService = searchService.SearchAfter(params.SearchAfter...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	searchResult, err := searchService.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ES查询失败: %v", err)
+	}
+
+	result := &types.LogSearchResult{Hits: make([]types.LogHit, 0)}
+	if searchResult.Hits == nil {
+		return result, nil
+	}
+	if searchResult.Hits.TotalHits != nil {
+		result.Total = searchResult.Hits.TotalHits.Value
+	}
+
+	for i, hit := range searchResult.Hits.Hits {
+		if i >= params.Size {
+			result.HasNext = true
+			break
+		}
+		source := make(map[string]interface{})
+		if err := json.Unmarshal(hit.Source, &source); err != nil {
+			log.Printf("解析文档失败: %v", err)
+			continue
+		}
+		result.Hits = append(result.Hits, types.LogHit{
+			Id:           hit.Id,
+			Timestamp:    util.ToString(source["@timestamp"], ""),
+			Time:         util.ToString(source["time"], ""),
+			Status:       util.ToString(source["status"], ""),
+			RequestTime:  util.ToFloat64(source["request_time"], 0),
+			UpstreamTime: util.ToFloat64(source["upstream_response_time"], 0),
+			ModelName:    util.ToString(source["http_model"], ""),
+			SceneLabel:   util.ToString(source["http_authorization"], ""),
+			RequestUri:   util.ToString(source["request_uri"], ""),
+			Path:         util.ToString(source["path"], ""),
+			Host:         util.ToString(source["http_host"], ""),
+			Request:      util.ToString(source["request"], ""),
+			Sort:         hit.Sort,
+		})
+	}
+	return result, nil
+}
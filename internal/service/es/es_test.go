@@ -1,7 +1,14 @@
 package es
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/olivere/elastic/v7"
+	"monitor/config"
+	"monitor/internal/client"
+	"monitor/internal/types"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 )
@@ -18,3 +25,153 @@ func TestEs(t *testing.T) {
 	lowerStr := strings.ToLower(str)
 	fmt.Println(lowerStr)
 }
+
+// newFakeES 由 handle 按请求体返回检索结果的 ES 替身
+func newFakeES(t *testing.T, handle func(body map[string]any) any) *ESService {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/_search") {
+			http.NotFound(w, r)
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(handle(body))
+	}))
+	t.Cleanup(srv.Close)
+	c, err := elastic.NewSimpleClient(elastic.SetURL(srv.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ESService{ESClient: &client.ESClient{Client: c}, Index: "gateway-*"}
+}
+
+func TestSumTokensPaginates(t *testing.T) {
+	var afters []any
+	e := newFakeES(t, func(body map[string]any) any {
+		composite := body["aggregations"].(map[string]any)["token_usage"].(map[string]any)["composite"].(map[string]any)
+		after := composite["after"]
+		afters = append(afters, after)
+		var buckets []map[string]any
+		n := tokenUsagePageSize
+		if after != nil {
+			n = 2
+		}
+		for i := range n {
+			scene := fmt.Sprintf("sk-%d", i)
+			if after != nil {
+				scene = fmt.Sprintf("sk-next-%d", i)
+			}
+			buckets = append(buckets, map[string]any{
+				"key":               map[string]any{"outer": scene, "inner": "m1"},
+				"doc_count":         3,
+				"prompt_tokens":     map[string]any{"value": 10},
+				"completion_tokens": map[string]any{"value": 5},
+				"total_tokens":      map[string]any{"value": 0},
+			})
+		}
+		return map[string]any{
+			"hits": map[string]any{"total": map[string]any{"value": 0}, "hits": []any{}},
+			"aggregations": map[string]any{"token_usage": map[string]any{
+				"after_key": buckets[len(buckets)-1]["key"],
+				"buckets":   buckets,
+			}},
+		}
+	})
+
+	usage, err := e.SumTokens(1, 2, "onAuth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(afters) != 2 || afters[0] != nil {
+		t.Fatalf("requests after = %v, want 2 pages", afters)
+	}
+	if key, _ := afters[1].(map[string]any); key["outer"] != fmt.Sprintf("sk-%d", tokenUsagePageSize-1) {
+		t.Errorf("second page after = %v", afters[1])
+	}
+	if len(usage) != tokenUsagePageSize+2 {
+		t.Errorf("scenes = %d, want %d", len(usage), tokenUsagePageSize+2)
+	}
+	if got := usage["sk-next-1"]["m1"]; got.TotalTokens != 15 || got.Count != 3 {
+		t.Errorf("usage = %+v", got)
+	}
+}
+
+func TestSearchLogsSortAndPaging(t *testing.T) {
+	field := config.Es.RequestIDField
+	config.Es.RequestIDField = "request_id.keyword"
+	t.Cleanup(func() { config.Es.RequestIDField = field })
+
+	var requests []map[string]any
+	e := newFakeES(t, func(body map[string]any) any {
+		requests = append(requests, body)
+		hit := func(id string, latency float64) map[string]any {
+			return map[string]any{
+				"_id":     id,
+				"_source": map[string]any{"request_time": latency, "http_model": "m1", "http_authorization": "sk-a", "status": "200"},
+				"sort":    []any{latency, "req-" + id},
+			}
+		}
+		return map[string]any{
+			"hits": map[string]any{
+				"total": map[string]any{"value": 3, "relation": "eq"},
+				"hits":  []any{hit("a", 9), hit("b", 4.2), hit("c", 1.5)},
+			},
+		}
+	})
+
+	res, err := e.SearchLogs(types.LogSearchParams{
+		From: 1, To: 2, SortBy: "latency", Size: 2,
+		SearchAfter: []any{json.Number("12.5"), "req-z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 || len(res.Hits) != 2 || !res.HasNext || res.Hits[1].Id != "b" || res.Hits[1].RequestTime != 4.2 {
+		t.Errorf("result = %+v", res)
+	}
+	if sort := res.Hits[1].Sort; len(sort) != 2 || sort[1] != "req-b" {
+		t.Errorf("sort = %v", sort)
+	}
+
+	body := requests[0]
+	if body["size"] != float64(3) {
+		t.Errorf("size = %v, want page size + 1", body["size"])
+	}
+	sorts, _ := json.Marshal(body["sort"])
+	// 兜底字段未映射时应由 ES 报错，而不是按缺失值排序导致翻页不稳定
+	if strings.Contains(string(sorts), `"_id"`) || !strings.Contains(string(sorts), `"request_id.keyword"`) ||
+		strings.Contains(string(sorts), `"unmapped_type"`) {
+		t.Errorf("sort = %s, want request_id tiebreaker", sorts)
+	}
+	if after, _ := json.Marshal(body["search_after"]); string(after) != `[12.5,"req-z"]` {
+		t.Errorf("search_after = %s", after)
+	}
+}
+
+func TestCheckFieldMapping(t *testing.T) {
+	mapped := func(typ string) map[string]any {
+		return map[string]any{"mappings": map[string]any{"request_id.keyword": map[string]any{
+			"full_name": "request_id.keyword",
+			"mapping":   map[string]any{"keyword": map[string]any{"type": typ}},
+		}}}
+	}
+	for _, c := range []struct {
+		name string
+		resp map[string]any
+		ok   bool
+	}{
+		{"mapped", map[string]any{"gateway-1": mapped("keyword"), "gateway-2": mapped("keyword")}, true},
+		{"no index", map[string]any{}, false},
+		{"missing in one index", map[string]any{"gateway-1": mapped("keyword"), "gateway-2": map[string]any{"mappings": map[string]any{}}}, false},
+		{"text", map[string]any{"gateway-1": mapped("text")}, false},
+	} {
+		if err := checkFieldMapping(c.resp, "gateway-*", "request_id.keyword"); (err == nil) != c.ok {
+			t.Errorf("%s: err = %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package es
+
+import (
+	"context"
+	"fmt"
+	"monitor/internal/types"
+	"monitor/internal/upstream"
+)
+
+// paramError 查询参数错误，由调用方引起，不计入 ES 熔断
+type paramError struct {
+	msg string
+}
+
+func (e *paramError) Error() string {
+	return e.msg
+}
+
+func (e *paramError) ClientError() bool {
+	return true
+}
+
+func invalidParam(format string, args ...interface{}) error {
+	return &paramError{msg: fmt.Sprintf(format, args...)}
+}
+
+// guardedES 所有查询经过 ES 上游的并发限制、限流与熔断
+type guardedES struct {
+	repo  EsRepo
+	guard *upstream.Guard
+}
+
+func withGuard(repo EsRepo) EsRepo {
+	return &guardedES{repo: repo, guard: upstream.Get(upstream.ES)}
+}
+
+func (g *guardedES) do(fn func() error) error {
+	return g.guard.Do(context.Background(), func(context.Context) error {
+		return fn()
+	})
+}
+
+func (g *guardedES) Count(from, to int64, statusType string, reqType string, keyword string) (result map[string]map[string]int64, err error) {
+	err = g.do(func() error {
+		result, err = g.repo.Count(from, to, statusType, reqType, keyword)
+		return err
+	})
+	return result, err
+}
+
+func (g *guardedES) CountByNestedAggs(from, to int64) (result map[string]map[string]int64, err error) {
+	err = g.do(func() error {
+		result, err = g.repo.CountByNestedAggs(from, to)
+		return err
+	})
+	return result, err
+}
+
+func (g *guardedES) GetDocumentFields(from, to int64, statusType string, sceneValue string, modelValue string) (result []map[string]interface{}, err error) {
+	err = g.do(func() error {
+		result, err = g.repo.GetDocumentFields(from, to, statusType, sceneValue, modelValue)
+		return err
+	})
+	return result, err
+}
+
+func (g *guardedES) CountByModel(from, to int64) (result map[string]map[string]int64, err error) {
+	err = g.do(func() error {
+		result, err = g.repo.CountByModel(from, to)
+		return err
+	})
+	return result, err
+}
+
+func (g *guardedES) CountSceneWithModel(from int64, to int64, modelName string) (result map[string]int64, err error) {
+	err = g.do(func() error {
+		result, err = g.repo.CountSceneWithModel(from, to, modelName)
+		return err
+	})
+	return result, err
+}
+
+func (g *guardedES) CountTrend(params types.TrendParams) (result []types.TrendSeries, err error) {
+	err = g.do(func() error {
+		result, err = g.repo.CountTrend(params)
+		return err
+	})
+	return result, err
+}
+
+func (g *guardedES) BatchCountFieldOccurrences(authValues, modelValues []string) (result map[string]int64, err error) {
+	err = g.do(func() error {
+		result, err = g.repo.BatchCountFieldOccurrences(authValues, modelValues)
+		return err
+	})
+	return result, err
+}
+
+func (g *guardedES) SumTokens(from, to int64, reqType string) (result map[string]map[string]types.TokenUsage, err error) {
+	err = g.do(func() error {
+		result, err = g.repo.SumTokens(from, to, reqType)
+		return err
+	})
+	return result, err
+}
+
+func (g *guardedES) SearchLogs(params types.LogSearchParams) (result *types.LogSearchResult, err error) {
+	err = g.do(func() error {
+		result, err = g.repo.SearchLogs(params)
+		return err
+	})
+	return result, err
+}
+
+var _ EsRepo = (*guardedES)(nil)
@@ -0,0 +1,536 @@
+package es
+
+import (
+	"encoding/json"
+	"fmt"
+	"monitor/config"
+	"monitor/internal/types"
+	"monitor/util"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MockESService 基于本地 JSON 样例日志的 EsRepo 实现，供本地开发和测试使用。
+// 过滤、分组规则与 ESService 中对应的查询保持一致。
+type MockESService struct {
+	docs []mockDoc
+}
+
+type mockDoc struct {
+	id        string
+	timestamp int64
+	source    map[string]interface{}
+}
+
+// 样例文件为文档数组，字段与网关日志一致；
+// 可用 ago（如 "36h"）代替 @timestamp 表示相对加载时刻的时间，避免样例过期。
+func NewMockESService(dir string) (*MockESService, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("目录 %s 下没有样例文件", dir)
+	}
+	sort.Strings(files)
+
+	now := time.Now()
+	m := &MockESService{}
+	requestIDs := map[string]string{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var sources []map[string]interface{}
+		if err := json.Unmarshal(data, &sources); err != nil {
+			return nil, fmt.Errorf("解析样例文件 %s 失败: %w", file, err)
+		}
+		for i, source := range sources {
+			doc, err := newMockDoc(source, now)
+			if err != nil {
+				return nil, fmt.Errorf("样例文件 %s 第 %d 条: %w", file, i+1, err)
+			}
+			if doc.id == "" {
+				doc.id = fmt.Sprintf("%s-%d", strings.TrimSuffix(filepath.Base(file), ".json"), i+1)
+			}
+			// 请求日志按 request_id 兜底排序，缺失或重复时翻页会漏行、重复
+			id := doc.requestID()
+			if id == "" {
+				return nil, fmt.Errorf("样例文件 %s 第 %d 条: 缺少 request_id", file, i+1)
+			}
+			if prev, ok := requestIDs[id]; ok {
+				return nil, fmt.Errorf("样例文件 %s 第 %d 条: request_id %s 与 %s 重复", file, i+1, id, prev)
+			}
+			requestIDs[id] = doc.id
+			m.docs = append(m.docs, doc)
+		}
+	}
+	return m, nil
+}
+
+func newMockDoc(source map[string]interface{}, now time.Time) (mockDoc, error) {
+	doc := mockDoc{
+		id:     util.ToString(source["_id"], ""),
+		source: source,
+	}
+	delete(source, "_id")
+
+	if ago, ok := source["ago"].(string); ok {
+		d, err := time.ParseDuration(ago)
+		if err != nil {
+			return doc, fmt.Errorf("无效的 ago: %v", err)
+		}
+		delete(source, "ago")
+		doc.timestamp = now.Add(-d).UnixMilli()
+		source["@timestamp"] = time.UnixMilli(doc.timestamp).UTC().Format(time.RFC3339Nano)
+		return doc, nil
+	}
+
+	switch ts := source["@timestamp"].(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return doc, fmt.Errorf("无效的 @timestamp: %v", err)
+		}
+		doc.timestamp = t.UnixMilli()
+	case float64:
+		doc.timestamp = int64(ts)
+	default:
+		return doc, fmt.Errorf("缺少 @timestamp 或 ago")
+	}
+	return doc, nil
+}
+
+func (d mockDoc) str(field string) string {
+	return util.ToString(d.source[field], "")
+}
+
+// requestID 排序兜底的请求ID，对应 ES 中配置的 requestIdField
+func (d mockDoc) requestID() string {
+	return d.str("request_id")
+}
+
+func (d mockDoc) num(field string) float64 {
+	return util.ToFloat64(d.source[field], 0)
+}
+
+func (d mockDoc) inRange(from, to int64) bool {
+	return d.timestamp >= from && d.timestamp <= to
+}
+
+func (d mockDoc) isPost() bool {
+	return d.str("method") == "POST"
+}
+
+// 对应查询中的 must_not http_model.keyword: "-" / ""，字段缺失的文档不会被排除
+func (d mockDoc) validModel() bool {
+	model, ok := d.source["http_model"]
+	if !ok || model == nil {
+		return true
+	}
+	m := util.ToString(model, "")
+	return m != "-" && m != ""
+}
+
+func (d mockDoc) has(field string) bool {
+	v, ok := d.source[field]
+	return ok && v != nil
+}
+
+func (d mockDoc) success() bool {
+	return d.str("status") == "200"
+}
+
+func matchStatus(d mockDoc, statusType string) bool {
+	switch statusType {
+	case "success":
+		return d.success()
+	case "failed":
+		return !d.success()
+	default:
+		return true
+	}
+}
+
+func addCount(m map[string]map[string]int64, outer, inner string) {
+	if _, ok := m[outer]; !ok {
+		m[outer] = make(map[string]int64)
+	}
+	m[outer][inner]++
+}
+
+func validRange(from, to int64) error {
+	if from == 0 || to == 0 || to <= from {
+		return invalidParam("invalid time range: from=%d to=%d", from, to)
+	}
+	return nil
+}
+
+func (m *MockESService) CountSceneWithModel(from int64, to int64, modelName string) (map[string]int64, error) {
+	if err := validRange(from, to); err != nil {
+		return nil, err
+	}
+	resultMap := make(map[string]int64)
+	for _, d := range m.docs {
+		if !d.inRange(from, to) || !d.isPost() || d.str("http_model") != modelName || !d.has("http_authorization") {
+			continue
+		}
+		resultMap[d.str("http_authorization")]++
+	}
+	return resultMap, nil
+}
+
+func (m *MockESService) Count(from, to int64, statusType string, reqType string, keyword string) (map[string]map[string]int64, error) {
+	if err := validRange(from, to); err != nil {
+		return nil, err
+	}
+	if reqType != "model" && reqType != "scene" && reqType != "onModel" && reqType != "onAuth" {
+		return nil, invalidParam("unsupported reqType: %s", reqType)
+	}
+
+	resultMap := make(map[string]map[string]int64)
+	for _, d := range m.docs {
+		if !d.inRange(from, to) || !d.isPost() || !d.validModel() || !matchStatus(d, statusType) {
+			continue
+		}
+		if !d.has("http_authorization") {
+			continue
+		}
+		auth := d.str("http_authorization")
+		model := "N/A"
+		if d.has("http_model") {
+			model = d.str("http_model")
+		}
+		switch reqType {
+		case "model":
+			if model == keyword {
+				addCount(resultMap, model, auth)
+			}
+		case "scene":
+			if auth == keyword {
+				addCount(resultMap, auth, model)
+			}
+		case "onModel":
+			addCount(resultMap, model, auth)
+		case "onAuth":
+			addCount(resultMap, auth, model)
+		}
+	}
+	return resultMap, nil
+}
+
+func (m *MockESService) CountByNestedAggs(from, to int64) (map[string]map[string]int64, error) {
+	if err := validRange(from, to); err != nil {
+		return nil, err
+	}
+	resultMap := make(map[string]map[string]int64)
+	for _, d := range m.docs {
+		if !d.inRange(from, to) || !d.isPost() || !d.validModel() {
+			continue
+		}
+		if !d.has("http_authorization") || !d.has("http_model") {
+			continue
+		}
+		addCount(resultMap, d.str("http_authorization"), d.str("http_model"))
+	}
+	return resultMap, nil
+}
+
+func (m *MockESService) CountByModel(from, to int64) (map[string]map[string]int64, error) {
+	if err := validRange(from, to); err != nil {
+		return nil, err
+	}
+	resultMap := make(map[string]map[string]int64)
+	for _, d := range m.docs {
+		if !d.inRange(from, to) || !d.isPost() || !d.validModel() || !d.has("http_authorization") {
+			continue
+		}
+		model := "N/A"
+		if d.has("http_model") {
+			model = d.str("http_model")
+		}
+		addCount(resultMap, model, d.str("http_authorization"))
+	}
+	return resultMap, nil
+}
+
+func (m *MockESService) GetDocumentFields(from, to int64, statusType string, sceneValue string, modelValue string) ([]map[string]interface{}, error) {
+	fields := []string{"_id", "request_time", "upstream_response_time", "request_uri", "path", "time", "status", "http_model", "http_host", "request", "http_authorization"}
+
+	matched := make([]mockDoc, 0)
+	for _, d := range m.docs {
+		if !d.inRange(from, to) || !d.isPost() || !d.validModel() || !matchStatus(d, statusType) {
+			continue
+		}
+		if sceneValue != "" && d.str("http_authorization") != sceneValue {
+			continue
+		}
+		if modelValue != "" && d.str("http_model") != modelValue {
+			continue
+		}
+		matched = append(matched, d)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].timestamp > matched[j].timestamp
+	})
+	if len(matched) > 100 {
+		matched = matched[:100]
+	}
+
+	results := make([]map[string]interface{}, 0, len(matched))
+	for _, d := range matched {
+		result := make(map[string]interface{})
+		for _, field := range fields {
+			result[field] = d.source[field]
+		}
+		result["_id"] = d.id
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (m *MockESService) CountTrend(params types.TrendParams) ([]types.TrendSeries, error) {
+	if err := validRange(params.From, params.To); err != nil {
+		return nil, err
+	}
+	seriesField, keys, err := trendSeriesKeys(params)
+	if err != nil {
+		return nil, err
+	}
+	field := strings.TrimSuffix(seriesField, ".keyword")
+
+	counts := make(map[string]map[int64]int64)
+	for _, key := range keys {
+		counts[key] = make(map[int64]int64)
+	}
+	for _, d := range m.docs {
+		if !d.inRange(params.From, params.To) {
+			continue
+		}
+		if params.SeriesBy != types.SeriesByScene && params.AuthCode != "" && d.str("http_authorization") != params.AuthCode {
+			continue
+		}
+		if params.SeriesBy != types.SeriesByModel && params.ModelName != "" && d.str("http_model") != params.ModelName {
+			continue
+		}
+		if params.AuthCodes != nil && !containsString(params.AuthCodes, d.str("http_authorization")) {
+			continue
+		}
+		bucket, ok := counts[d.str(field)]
+		if !ok {
+			continue
+		}
+		bucket[types.TrendBucketStart(time.UnixMilli(d.timestamp), params.Interval, params.Location).UnixMilli()]++
+	}
+	return buildTrendSeries(params, keys, counts), nil
+}
+
+func (m *MockESService) BatchCountFieldOccurrences(authValues, modelValues []string) (map[string]int64, error) {
+	if len(authValues) != len(modelValues) {
+		return nil, invalidParam("authValues and modelValues must have same length")
+	}
+	now := time.Now().UTC()
+	from := now.AddDate(-1, 0, 0).UnixMilli()
+	to := now.UnixMilli()
+
+	results := make(map[string]int64)
+	for i := range authValues {
+		results[fmt.Sprintf("%s|%s", authValues[i], modelValues[i])] = 0
+	}
+	for _, d := range m.docs {
+		if !d.inRange(from, to) || !d.isPost() || !d.validModel() {
+			continue
+		}
+		key := fmt.Sprintf("%s|%s", d.str("http_authorization"), d.str("http_model"))
+		if _, ok := results[key]; ok {
+			results[key]++
+		}
+	}
+	return results, nil
+}
+
+func (m *MockESService) SumTokens(from, to int64, reqType string) (map[string]map[string]types.TokenUsage, error) {
+	if err := validRange(from, to); err != nil {
+		return nil, err
+	}
+	cfg := config.GetEsConfig()
+
+	usageMap := make(map[string]map[string]types.TokenUsage)
+	for _, d := range m.docs {
+		if !d.inRange(from, to) || !d.isPost() || !d.validModel() {
+			continue
+		}
+		if !d.has("http_authorization") || !d.has("http_model") {
+			continue
+		}
+		outer, inner := d.str("http_authorization"), d.str("http_model")
+		if reqType == "onModel" {
+			outer, inner = inner, outer
+		}
+		if _, ok := usageMap[outer]; !ok {
+			usageMap[outer] = make(map[string]types.TokenUsage)
+		}
+		usage := usageMap[outer][inner]
+		usage.Add(types.TokenUsage{
+			PromptTokens:     int64(d.num(cfg.PromptTokensField)),
+			CompletionTokens: int64(d.num(cfg.CompletionTokensField)),
+			TotalTokens:      int64(d.num(cfg.TotalTokensField)),
+			Count:            1,
+		})
+		usageMap[outer][inner] = usage
+	}
+	for _, inner := range usageMap {
+		for k, usage := range inner {
+			if usage.TotalTokens == 0 {
+				usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+				inner[k] = usage
+			}
+		}
+	}
+	return usageMap, nil
+}
+
+func (m *MockESService) SearchLogs(params types.LogSearchParams) (*types.LogSearchResult, error) {
+	terms := strings.Fields(strings.ToLower(params.Keyword))
+	matched := make([]mockDoc, 0)
+	for _, d := range m.docs {
+		if !d.inRange(params.From, params.To) || !d.isPost() || !d.validModel() {
+			continue
+		}
+		if params.AuthCode != "" && d.str("http_authorization") != params.AuthCode {
+			continue
+		}
+		if params.AuthCodes != nil && !containsString(params.AuthCodes, d.str("http_authorization")) {
+			continue
+		}
+		if params.ModelName != "" && d.str("http_model") != params.ModelName {
+			continue
+		}
+		switch params.Status {
+		case "", "all":
+		case "success", "failed":
+			if !matchStatus(d, params.Status) {
+				continue
+			}
+		default:
+			if d.str("status") != params.Status {
+				continue
+			}
+		}
+		latency := d.num("request_time")
+		if params.MinLatency > 0 && latency < params.MinLatency {
+			continue
+		}
+		if params.MaxLatency > 0 && latency > params.MaxLatency {
+			continue
+		}
+		if !matchKeyword(d, terms) {
+			continue
+		}
+		matched = append(matched, d)
+	}
+
+	sortValue := func(d mockDoc) float64 {
+		if params.SortBy == "latency" {
+			return d.num("request_time")
+		}
+		return float64(d.timestamp)
+	}
+	// less 为升序比较，降序时取反，与 ES 的 sort + 请求ID兜底保持一致
+	less := func(a, b mockDoc) bool {
+		va, vb := sortValue(a), sortValue(b)
+		if va != vb {
+			return va < vb
+		}
+		return a.requestID() < b.requestID()
+	}
+	before := func(a, b mockDoc) bool {
+		if params.Ascending {
+			return less(a, b)
+		}
+		return less(b, a)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return before(matched[i], matched[j])
+	})
+
+	result := &types.LogSearchResult{
+		Total: int64(len(matched)),
+		Hits:  make([]types.LogHit, 0),
+	}
+
+	start := 0
+	if len(params.SearchAfter) == 2 {
+		cursor := mockDoc{
+			source: map[string]interface{}{
+				"request_time": util.ToFloat64(params.SearchAfter[0], 0),
+				"request_id":   util.ToString(params.SearchAfter[1], ""),
+			},
+		}
+		cursor.timestamp = int64(util.ToFloat64(params.SearchAfter[0], 0))
+		start = sort.Search(len(matched), func(i int) bool {
+			return before(cursor, matched[i])
+		})
+	}
+
+	for i := start; i < len(matched); i++ {
+		if len(result.Hits) >= params.Size {
+			result.HasNext = true
+			break
+		}
+		d := matched[i]
+		var first interface{} = float64(d.timestamp)
+		if params.SortBy == "latency" {
+			first = d.num("request_time")
+		}
+		result.Hits = append(result.Hits, types.LogHit{
+			Id:           d.id,
+			Timestamp:    d.str("@timestamp"),
+			Time:         d.str("time"),
+			Status:       d.str("status"),
+			RequestTime:  d.num("request_time"),
+			UpstreamTime: d.num("upstream_response_time"),
+			ModelName:    d.str("http_model"),
+			SceneLabel:   d.str("http_authorization"),
+			RequestUri:   d.str("request_uri"),
+			Path:         d.str("path"),
+			Host:         d.str("http_host"),
+			Request:      d.str("request"),
+			Sort:         []interface{}{first, d.requestID()},
+		})
+	}
+	return result, nil
+}
+
+// 近似 simple_query_string 的 AND 语义：每个词都需出现在任一检索字段中
+func matchKeyword(d mockDoc, terms []string) bool {
+	fields := []string{"request", "request_uri", "path", "http_host"}
+	for _, term := range terms {
+		found := false
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(d.str(field)), term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, v string) bool {
+	for _, item := range values {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+var _ EsRepo = (*MockESService)(nil)
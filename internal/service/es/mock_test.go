@@ -0,0 +1,236 @@
+package es
+
+import (
+	"fmt"
+	"monitor/config"
+	"monitor/internal/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMockESService(t *testing.T) {
+	ec := NewESService(config.ESConfig{Mock: true, MockDataPath: "testdata"})
+	now := time.Now()
+	from := now.AddDate(0, 0, -7).UnixMilli()
+	to := now.UnixMilli()
+
+	nested, err := ec.CountByNestedAggs(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nested["sk-a"]["m1"] != 2 || nested["sk-a"]["m2"] != 1 || nested["sk-b"]["m1"] != 1 {
+		t.Errorf("unexpected nested counts: %v", nested)
+	}
+	if _, ok := nested["sk-c"]; ok {
+		t.Errorf("out of range doc counted: %v", nested)
+	}
+
+	failed, err := ec.Count(from, to, "failed", "onModel", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed["m1"]["sk-a"] != 1 {
+		t.Errorf("unexpected failed counts: %v", failed)
+	}
+
+	tokens, err := ec.SumTokens(from, to, "onAuth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := types.TokenUsage{PromptTokens: 180, CompletionTokens: 50, TotalTokens: 150, Count: 2}
+	if tokens["sk-a"]["m1"] != want {
+		t.Errorf("unexpected token usage: %+v", tokens["sk-a"]["m1"])
+	}
+	if tokens["sk-a"]["m2"].TotalTokens != 20 {
+		t.Errorf("total should fall back to prompt+completion: %+v", tokens["sk-a"]["m2"])
+	}
+
+	trend, err := ec.CountTrend(types.TrendParams{
+		From:     from,
+		To:       to,
+		Interval: types.TrendDay,
+		Location: time.Local,
+		AuthCode: "sk-a",
+		SeriesBy: types.SeriesByModel,
+		Series:   []string{"m1", "m2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trend) != 2 {
+		t.Fatalf("want 2 series, got %d", len(trend))
+	}
+	for i, want := range []int64{2, 1} {
+		var sum int64
+		for _, p := range trend[i].Points {
+			sum += p.Count
+		}
+		if len(trend[i].Points) < 7 || sum != want {
+			t.Errorf("series %s: %d points, sum %d, want sum %d", trend[i].Key, len(trend[i].Points), sum, want)
+		}
+	}
+}
+
+func TestMockSearchLogsPaging(t *testing.T) {
+	ec := NewESService(config.ESConfig{Mock: true, MockDataPath: "testdata"})
+	params := types.LogSearchParams{
+		From:   time.Now().AddDate(0, 0, -7).UnixMilli(),
+		To:     time.Now().UnixMilli(),
+		SortBy: "latency",
+		Size:   2,
+	}
+
+	var ids []string
+	for page := 0; page < 5; page++ {
+		res, err := ec.SearchLogs(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 4 {
+			t.Fatalf("total = %d, want 4", res.Total)
+		}
+		for _, hit := range res.Hits {
+			ids = append(ids, hit.Id)
+		}
+		if !res.HasNext {
+			break
+		}
+		params.SearchAfter = res.Hits[len(res.Hits)-1].Sort
+	}
+
+	want := []string{"a2", "b1", "a1", "a3"}
+	if len(ids) != len(want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("ids = %v, want %v", ids, want)
+		}
+	}
+
+	params.SearchAfter = nil
+	params.Keyword = "embeddings"
+	res, err := ec.SearchLogs(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].Id != "a3" {
+		t.Errorf("keyword search got %+v", res.Hits)
+	}
+
+	// 部门隔离：仅检索指定场景，空集合不返回数据
+	params.Keyword = ""
+	params.AuthCodes = []string{"sk-b"}
+	res, err = ec.SearchLogs(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].Id != "b1" {
+		t.Errorf("scoped search got %+v", res.Hits)
+	}
+	params.AuthCodes = []string{}
+	res, err = ec.SearchLogs(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 0 {
+		t.Errorf("empty scope total = %d, want 0", res.Total)
+	}
+}
+
+// writeLogs 在临时目录写入样例日志，返回目录
+func writeLogs(t *testing.T, docs ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	data := "[" + strings.Join(docs, ",") + "]"
+	if err := os.WriteFile(filepath.Join(dir, "logs.json"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestMockSearchLogsDuplicateSortKeys(t *testing.T) {
+	// 时间和耗时完全相同，只能靠 request_id 排出全序
+	var docs []string
+	for _, id := range []string{"r3", "r1", "r5", "r2", "r4"} {
+		docs = append(docs, fmt.Sprintf(`{"_id":"d-%s","request_id":"%s","ago":"1h","method":"POST","status":"200",`+
+			`"http_authorization":"sk-a","http_model":"m1","request_time":2.5}`, id, id))
+	}
+	ec, err := NewMockESService(writeLogs(t, docs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		sortBy    string
+		ascending bool
+		want      string
+	}{
+		{"", false, "r5,r4,r3,r2,r1"},
+		{"", true, "r1,r2,r3,r4,r5"},
+		{"latency", false, "r5,r4,r3,r2,r1"},
+		{"latency", true, "r1,r2,r3,r4,r5"},
+	} {
+		params := types.LogSearchParams{
+			From:      time.Now().Add(-2 * time.Hour).UnixMilli(),
+			To:        time.Now().UnixMilli(),
+			SortBy:    c.sortBy,
+			Ascending: c.ascending,
+			Size:      2,
+		}
+		var ids []string
+		for page := 0; page < 5; page++ {
+			res, err := ec.SearchLogs(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, hit := range res.Hits {
+				ids = append(ids, strings.TrimPrefix(hit.Id, "d-"))
+			}
+			if !res.HasNext {
+				break
+			}
+			params.SearchAfter = res.Hits[len(res.Hits)-1].Sort
+		}
+		// 每条恰好出现一次，既不漏行也不重复
+		if got := strings.Join(ids, ","); got != c.want {
+			t.Errorf("sort %q ascending %v: ids = %s, want %s", c.sortBy, c.ascending, got, c.want)
+		}
+	}
+}
+
+func TestMockRequiresUniqueRequestID(t *testing.T) {
+	doc := `{"request_id":"%s","ago":"1h","method":"POST","status":"200","http_model":"m1"}`
+	if _, err := NewMockESService(writeLogs(t, fmt.Sprintf(doc, "r1"), fmt.Sprintf(doc, ""))); err == nil ||
+		!strings.Contains(err.Error(), "缺少 request_id") {
+		t.Errorf("missing request_id: err = %v", err)
+	}
+	if _, err := NewMockESService(writeLogs(t, fmt.Sprintf(doc, "r1"), fmt.Sprintf(doc, "r1"))); err == nil ||
+		!strings.Contains(err.Error(), "重复") {
+		t.Errorf("duplicate request_id: err = %v", err)
+	}
+}
+
+func TestMockLoadedOnce(t *testing.T) {
+	dir := writeLogs(t, `{"request_id":"r1","ago":"1h","method":"POST","status":"200","http_model":"m1"}`)
+	cfg := config.ESConfig{Mock: true, MockDataPath: dir}
+	if err := Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	first := NewESService(cfg)
+	// 样例只在首次创建时读取，之后不再访问文件
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if NewESService(cfg) != first {
+		t.Error("mock should be created once per config")
+	}
+
+	bad := writeLogs(t, `{"request_id":"r1","ago":"一小时"}`)
+	if err := Init(config.ESConfig{Mock: true, MockDataPath: bad}); err == nil || !strings.Contains(err.Error(), "无效的 ago") {
+		t.Errorf("bad fixture: err = %v", err)
+	}
+}
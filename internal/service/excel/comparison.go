@@ -0,0 +1,198 @@
+package excel
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 对比行的状态
+const (
+	CompareNew  = "new"  // 对比期没有、本期出现
+	CompareGone = "gone" // 对比期有、本期消失
+	CompareUp   = "up"
+	CompareDown = "down"
+	CompareFlat = "flat"
+)
+
+var compareStatusText = map[string]string{
+	CompareNew:  "新增",
+	CompareGone: "消失",
+	CompareUp:   "上升",
+	CompareDown: "下降",
+	CompareFlat: "持平",
+}
+
+// CompareValue 某一指标在两个周期的取值，对比期为 0 时变化率为 nil
+type CompareValue struct {
+	Base    float64  `json:"base"`
+	Current float64  `json:"current"`
+	Delta   float64  `json:"delta"`
+	Percent *float64 `json:"percent"` // 百分比，12.5 表示增长 12.5%
+}
+
+// CompareRow 对比台账的一行
+type CompareRow struct {
+	Key      string         `json:"key"`
+	Name     string         `json:"name"`
+	Status   string         `json:"status"`
+	TopMover bool           `json:"topMover"` // 第一个指标变化量绝对值排名靠前
+	Values   []CompareValue `json:"values"`   // 与 CompareSheet.Metrics 顺序一致
+}
+
+// CompareSheet 一个维度的对比结果
+type CompareSheet struct {
+	Title   string       `json:"title"`   // 工作表名，例如 模型
+	Caption string       `json:"caption"` // 标题行，包含两个周期
+	Metrics []string     `json:"metrics"`
+	Rows    []CompareRow `json:"rows"`
+}
+
+type Comparison struct {
+}
+
+func NewComparison() *Comparison {
+	return &Comparison{}
+}
+
+// GenerateComparison 生成周期对比台账并写入 w，每个维度一个工作表。
+// 新增行绿色、消失行灰色，变化量排名靠前的行加粗并以黄色标出变化量
+func (c *Comparison) GenerateComparison(w io.Writer, sheets []CompareSheet) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	for i, sheet := range sheets {
+		if i == 0 {
+			if err := f.SetSheetName("Sheet1", sheet.Title); err != nil {
+				return fmt.Errorf("创建工作表失败: %w", err)
+			}
+		} else if _, err := f.NewSheet(sheet.Title); err != nil {
+			return fmt.Errorf("创建工作表失败: %w", err)
+		}
+		if err := c.writeSheet(f, sheet); err != nil {
+			return err
+		}
+	}
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("写入台账失败: %w", err)
+	}
+	return nil
+}
+
+func (c *Comparison) writeSheet(f *excelize.File, sheet CompareSheet) error {
+	name := sheet.Title
+	headers := []interface{}{"名称", "状态"}
+	for _, m := range sheet.Metrics {
+		headers = append(headers, m+"(对比期)", m+"(本期)", m+"变化", m+"变化率")
+	}
+	lastCol, _ := excelize.ColumnNumberToName(len(headers))
+
+	f.SetCellValue(name, "A1", sheet.Caption)
+	f.MergeCell(name, "A1", lastCol+"1")
+	f.SetSheetRow(name, "A2", &headers)
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"#4472C4"}, Pattern: 1},
+		Font:      &excelize.Font{Bold: true, Color: "#FFFFFF"},
+		Border:    getBorderStyle(),
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	f.SetCellStyle(name, "A1", lastCol+"2", headerStyle)
+
+	styles, err := newCompareStyles(f)
+	if err != nil {
+		return err
+	}
+	for i, row := range sheet.Rows {
+		r := i + 3
+		values := []interface{}{row.Name, compareStatusText[row.Status]}
+		for _, v := range row.Values {
+			var percent interface{} = "—"
+			if v.Percent != nil {
+				percent = *v.Percent / 100
+			}
+			values = append(values, v.Base, v.Current, v.Delta, percent)
+		}
+		f.SetSheetRow(name, fmt.Sprintf("A%d", r), &values)
+
+		kind := row.Status
+		if kind != CompareNew && kind != CompareGone {
+			kind = ""
+		}
+		if row.TopMover {
+			kind += "top"
+		}
+		f.SetCellStyle(name, fmt.Sprintf("A%d", r), fmt.Sprintf("%s%d", lastCol, r), styles[kind].text)
+		for m := range row.Values {
+			start, _ := excelize.ColumnNumberToName(3 + m*4)
+			delta, _ := excelize.ColumnNumberToName(5 + m*4)
+			percent, _ := excelize.ColumnNumberToName(6 + m*4)
+			f.SetCellStyle(name, fmt.Sprintf("%s%d", start, r), fmt.Sprintf("%s%d", percent, r), styles[kind].number)
+			f.SetCellStyle(name, fmt.Sprintf("%s%d", percent, r), fmt.Sprintf("%s%d", percent, r), styles[kind].percent)
+			if row.TopMover && m == 0 {
+				f.SetCellStyle(name, fmt.Sprintf("%s%d", delta, r), fmt.Sprintf("%s%d", delta, r), styles[kind].mover)
+				f.SetCellStyle(name, fmt.Sprintf("%s%d", percent, r), fmt.Sprintf("%s%d", percent, r), styles[kind].moverPercent)
+			}
+		}
+	}
+
+	legend := len(sheet.Rows) + 4
+	f.SetCellValue(name, fmt.Sprintf("A%d", legend), "说明：绿色为本期新增，灰色为本期消失，加粗且变化量标黄的为变化最大的记录；对比期为 0 时变化率记为“—”")
+	f.SetColWidth(name, "A", "A", 40)
+	f.SetColWidth(name, "B", "B", 8)
+	f.SetColWidth(name, "C", lastCol, 14)
+	return nil
+}
+
+// compareStyle 同一类行的文本、数值、百分比及变化量样式
+type compareStyle struct {
+	text, number, percent, mover, moverPercent int
+}
+
+// newCompareStyles 按行类别（""、new、gone，以及加 top 后缀的变化最大行）创建样式
+func newCompareStyles(f *excelize.File) (map[string]compareStyle, error) {
+	fills := map[string]string{"": "", CompareNew: "#E2EFDA", CompareGone: "#D9D9D9"}
+	percentFmt := "0.00%"
+	numberFmt := "#,##0.##"
+	styles := make(map[string]compareStyle)
+	for kind, fill := range fills {
+		for _, top := range []bool{false, true} {
+			base := excelize.Style{Border: getBorderStyle(), Font: &excelize.Font{Bold: top}}
+			if fill != "" {
+				base.Fill = excelize.Fill{Type: "pattern", Color: []string{fill}, Pattern: 1}
+			}
+			if kind == CompareGone {
+				base.Font.Color = "#7F7F7F"
+			}
+			var s compareStyle
+			var err error
+			if s.text, err = f.NewStyle(&base); err != nil {
+				return nil, fmt.Errorf("创建样式失败: %w", err)
+			}
+			number := base
+			number.CustomNumFmt = &numberFmt
+			if s.number, err = f.NewStyle(&number); err != nil {
+				return nil, fmt.Errorf("创建样式失败: %w", err)
+			}
+			percent := base
+			percent.CustomNumFmt = &percentFmt
+			if s.percent, err = f.NewStyle(&percent); err != nil {
+				return nil, fmt.Errorf("创建样式失败: %w", err)
+			}
+			mover := number
+			mover.Fill = excelize.Fill{Type: "pattern", Color: []string{"#FFEB9C"}, Pattern: 1}
+			if s.mover, err = f.NewStyle(&mover); err != nil {
+				return nil, fmt.Errorf("创建样式失败: %w", err)
+			}
+			mover.CustomNumFmt = &percentFmt
+			if s.moverPercent, err = f.NewStyle(&mover); err != nil {
+				return nil, fmt.Errorf("创建样式失败: %w", err)
+			}
+			key := kind
+			if top {
+				key += "top"
+			}
+			styles[key] = s
+		}
+	}
+	return styles, nil
+}
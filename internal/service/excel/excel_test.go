@@ -1,5 +1,101 @@
 package excel
 
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func mergedRanges(t *testing.T, f *excelize.File, sheet string) []string {
+	t.Helper()
+	merged, err := f.GetMergeCells(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges := make([]string, 0, len(merged))
+	for _, m := range merged {
+		ranges = append(ranges, m.GetStartAxis()+":"+m.GetEndAxis())
+	}
+	return ranges
+}
+
+func TestGenerateServiceLedger(t *testing.T) {
+	data := []Record{
+		{Environment: "生产", Model: "Qwen3-8B", Scenario: "罗盘-知识问答", Concurrency: 10, Success: 80, History: 1000, TotalTokens: 5},
+		{Environment: "生产", Model: "Qwen3-8B", Scenario: "OA系统公文校对", Concurrency: 5, Success: 20, History: 10, TotalTokens: 7},
+		{Environment: "生产", Model: "QwQ-32B", Scenario: "信用卡审批支持助手", Concurrency: 3, Success: 1, History: 2, TotalTokens: 3},
+		{Environment: "开发", Model: "Qwen3-8B", Scenario: "罗盘-知识问答", Concurrency: 1, Success: 4, History: 4, TotalTokens: 1},
+	}
+	var buf bytes.Buffer
+	if err := NewServiceLedgerDetail().GenerateServiceLedger(&buf, data, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sheet := "服务调用情况"
+	// 生产 Qwen3-8B 第3、4行及合计第5行；QwQ-32B 第6行及合计第7行；开发第8行及合计第9行
+	for cell, want := range map[string]string{
+		"A1": "智能平台服务调用情况表", "C2": "场景",
+		"C4": "OA系统公文校对", "C5": "总计", "G5": "15", "H5": "100", "I5": "1010", "L5": "12",
+		"C7": "总计", "H7": "1", "A8": "开发", "H9": "4",
+	} {
+		if got, _ := f.GetCellValue(sheet, cell); got != want {
+			t.Errorf("%s = %q, want %q", cell, got, want)
+		}
+	}
+	ranges := mergedRanges(t, f, sheet)
+	for _, want := range []string{"A1:L1", "A3:A7", "B3:B5", "C5:F5", "B6:B7", "A8:A9", "B8:B9"} {
+		if !slices.Contains(ranges, want) {
+			t.Errorf("merged cells %v missing %s", ranges, want)
+		}
+	}
+}
+
+// 大量数据按行流式写入
+func TestGenerateLedgerExcelStreaming(t *testing.T) {
+	const n = 20000
+	data := make([]ServiceRecord, n)
+	for i := range data {
+		env := "生产"
+		if i >= n/2 {
+			env = "开发"
+		}
+		data[i] = ServiceRecord{
+			Environment: env, SerialNumber: i + 1, Scene: fmt.Sprintf("场景%d", i/4), Department: "人工智能中心",
+			Model: "Qwen3-8B", CallVolume: i, TotalTokens: int64(i) * 10,
+		}
+	}
+	var buf bytes.Buffer
+	if err := NewLargeInvokingexcel().GenerateLedgerExcel(&buf, data, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sheet := "服务调用情况"
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != n+2 || rows[1][0] != "环境" || rows[n+1][1] != fmt.Sprint(n) || rows[n+1][12] != fmt.Sprint((n-1)*10) {
+		t.Errorf("rows = %d, last = %v", len(rows), rows[len(rows)-1])
+	}
+	ranges := mergedRanges(t, f, sheet)
+	for _, want := range []string{"A1:M1", fmt.Sprintf("A3:A%d", n/2+2), fmt.Sprintf("A%d:A%d", n/2+3, n+2), "C3:C6", "G7:G10"} {
+		if !slices.Contains(ranges, want) {
+			t.Errorf("merged cells missing %s", want)
+		}
+	}
+}
+
 //
 //func TestExcelGenerator(t *testing.T) {
 //	h := NewHighLevel()
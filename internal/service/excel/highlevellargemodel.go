@@ -3,8 +3,8 @@ package excel
 import (
 	"fmt"
 	"github.com/xuri/excelize/v2"
-	"log"
-	"monitor/util"
+	"io"
+	"monitor/internal/service/export"
 	"strconv"
 )
 
@@ -46,7 +46,9 @@ type HighLevel struct {
 func NewHighLevel() *HighLevel {
 	return &HighLevel{}
 }
-func (h *HighLevel) GenerateLedger(newData []DataRow) string {
+
+// GenerateLedger 生成算力分布台账并写入 w，extras 在写出前追加到同一文件
+func (h *HighLevel) GenerateLedger(w io.Writer, newData []DataRow, extras *export.Extras) error {
 	// 新数据示例（按环境分组，相同型号连续）
 	//newData = []DataRow{
 	//	{"生产", 461.5, "910B", 175, 1400, "DeepSeek-R1-Distill-Qwen-32B", 45, 144, ""},
@@ -65,7 +67,7 @@ func (h *HighLevel) GenerateLedger(newData []DataRow) string {
 	sheetName := "算力分布"
 	index, err := f.NewSheet(sheetName)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("创建工作表失败: %w", err)
 	}
 	f.SetActiveSheet(index)
 
@@ -131,6 +133,7 @@ func (h *HighLevel) GenerateLedger(newData []DataRow) string {
 
 		// 写入行数据
 		h.writeDataRow(f, sheetName, rowNum, row)
+		extras.Report(rowIndex+1, len(newData))
 	}
 
 	// 添加最后一个环境组
@@ -182,18 +185,14 @@ func (h *HighLevel) GenerateLedger(newData []DataRow) string {
 			}
 		}
 	}
-	// 5. 将 Excel 内容写入缓冲区
-	timeStr := util.GetTimeMinite()
-	fileName := "新算力精确分布表" + timeStr + ".xlsx"
-	fmt.Println("Excel文件生成成功: 新算力精确分布表.xlsx")
-	filePath := fmt.Sprintf("./files/%s", fileName)
-	if err := f.SaveAs(filePath); err != nil {
-		log.Fatal(err)
-		return ""
+	if err := extras.Finish(f, sheetName, nil, len(newData)+3); err != nil {
+		return err
 	}
-	return fileName
-
-	//return buf
+	// 5. 将 Excel 内容写入 w
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("写入台账失败: %w", err)
+	}
+	return nil
 }
 
 func (h *HighLevel) writeHeader(f *excelize.File, sheet string) {
@@ -3,9 +3,8 @@ package excel
 import (
 	"fmt"
 	"github.com/xuri/excelize/v2"
-	"log"
-	"monitor/util"
-	"os"
+	"io"
+	"monitor/internal/service/export"
 )
 
 // ServiceRecord 定义服务调用记录结构
@@ -20,6 +19,9 @@ type ServiceRecord struct {
 	Model             string `json:"model"`             // 调用模型
 	Concurrency       int    `json:"concurrency"`       //申请并发
 	CallVolume        int    `json:"callVolume"`        //本期调用
+	PromptTokens      int64  `json:"promptTokens"`      //输入token
+	CompletionTokens  int64  `json:"completionTokens"`  //输出token
+	TotalTokens       int64  `json:"totalTokens"`       //token总量
 }
 
 type LargeInvokingexcel struct {
@@ -30,7 +32,8 @@ func NewLargeInvokingexcel() *LargeInvokingexcel {
 }
 
 // 智能平台大模型服务调用情况表
-func (l *LargeInvokingexcel) GenerateLedgerExcel(newData []ServiceRecord) string {
+// GenerateLedgerExcel 生成大模型服务调用情况台账并写入 w，extras 在写出前追加到同一文件
+func (l *LargeInvokingexcel) GenerateLedgerExcel(w io.Writer, newData []ServiceRecord, extras *export.Extras) error {
 	// 示例数据 - 替换为实际数据
 	//newData = []ServiceRecord{
 	//	{"生产", 1, "知识工程平台知识增强与语料标注", "表单识别", "人工智能中心", "程思香", "实时", "DeepSeek-R1-Distill-Qwen-32B", 144, 4730},
@@ -45,32 +48,59 @@ func (l *LargeInvokingexcel) GenerateLedgerExcel(newData []ServiceRecord) string
 	//	{"开发", 10, "贷前投揭进件材料智能记录", "表单识别", "数据管理部", "李霄昊", "实时", "Qwen3-32B", 1, 0},
 	//}
 
-	// 创建新的Excel文件
+	// 逐行流式写入，数据量大时内存占用与行数无关；合并单元格在写完后登记
 	f := excelize.NewFile()
+	defer f.Close()
 	sheet := "服务调用情况"
 	f.SetSheetName("Sheet1", sheet)
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
 
-	// 设置主标题（合并A1:J1）
-	f.SetCellValue(sheet, "A1", "2025年7月28日-8月1日智能平台大模型服务调用情况表")
-	if err := f.MergeCell(sheet, "A1", "J1"); err != nil {
-		fmt.Println("合并标题单元格失败:", err)
-		os.Exit(1)
+	// 设置列宽（根据实际情况调整），须在写入行之前
+	for _, w := range []struct {
+		from, to int
+		width    float64
+	}{
+		{1, 1, 10},   // 环境
+		{2, 2, 6},    // 序号
+		{3, 3, 35},   // 场景
+		{4, 4, 15},   // 开发部门
+		{5, 5, 20},   // 中心
+		{6, 6, 20},   // 负责人
+		{7, 7, 10},   // 调用频度
+		{8, 8, 30},   // 调用模型
+		{9, 9, 15},   // 申请并发(页)
+		{10, 10, 15}, // 本期调用量
+		{11, 13, 15}, // token用量
+	} {
+		if err := sw.SetColWidth(w.from, w.to, w.width); err != nil {
+			return err
+		}
 	}
 
+	// 设置主标题（合并A1:M1）
 	headerStyle := l.createHeaderStyle(f)
-	f.SetCellStyle(sheet, "A1", "A1", headerStyle)
+	if err := sw.SetRow("A1", []interface{}{excelize.Cell{StyleID: headerStyle, Value: "2025年7月28日-8月1日智能平台大模型服务调用情况表"}}); err != nil {
+		return err
+	}
+	if err := sw.MergeCell("A1", "M1"); err != nil {
+		return fmt.Errorf("合并标题单元格失败: %w", err)
+	}
 	// 设置表头行
 	headers := []string{
 		"环境", "序号", "场景", "开发部门", "中心", "负责人",
 		"调用频度", "调用模型", "申请并发(页)", "本期调用量",
+		"输入Token", "输出Token", "Token总量",
 	}
-
-	// 写入表头
-	for col, header := range headers {
-		cell := fmt.Sprintf("%c%d", 'A'+col, 2)
-		f.SetCellValue(sheet, cell, header)
+	header := make([]interface{}, len(headers))
+	for col, h := range headers {
+		header[col] = excelize.Cell{StyleID: headerStyle, Value: h}
+	}
+	if err := sw.SetRow("A2", header); err != nil {
+		return err
 	}
-	f.SetCellStyle(sheet, "A2", "J2", headerStyle)
 
 	// 设置数据样式
 	dataStyle, err := f.NewStyle(&excelize.Style{
@@ -86,181 +116,61 @@ func (l *LargeInvokingexcel) GenerateLedgerExcel(newData []ServiceRecord) string
 		},
 	})
 	if err != nil {
-		fmt.Println("创建数据样式失败:", err)
-		os.Exit(1)
-	}
-
-	// 场景分组信息
-	type sceneGroup struct {
-		name  string
-		start int // 起始行号（从1开始）
-		end   int // 结束行号（从1开始）
-	}
-
-	// 存储所有场景分组
-	var sceneGroups []sceneGroup
-	currentScene := ""
-	sceneStart := 0
-
-	// 环境分组信息
-	type envGroup struct {
-		name  string
-		start int
-		end   int
+		return fmt.Errorf("创建数据样式失败: %w", err)
 	}
 
-	// 存储所有环境分组
-	var envGroups []envGroup
-	currentEnv := ""
-	envStart := 0
-
-	// 写入数据行
+	// 写入数据行，数据从第3行开始；中心列暂无数据
 	for rowIndex, record := range newData {
-		rowNum := rowIndex + 3 // 数据从第3行开始
-
-		// 环境分组逻辑
-		if record.Environment != currentEnv {
-			// 上一个环境组结束
-			if currentEnv != "" && envStart > 0 {
-				envGroups = append(envGroups, envGroup{
-					name:  currentEnv,
-					start: envStart,
-					end:   rowNum - 1,
-				})
-			}
-			// 开始新的环境组
-			currentEnv = record.Environment
-			envStart = rowNum
+		values := []interface{}{
+			record.Environment, record.SerialNumber, record.Scene, record.Department, nil, record.ResponsiblePerson,
+			record.Frequency, record.Model, record.Concurrency, record.CallVolume,
+			record.PromptTokens, record.CompletionTokens, record.TotalTokens,
 		}
-
-		// 场景分组逻辑
-		if record.Scene != currentScene {
-			// 上一个场景组结束
-			if currentScene != "" && sceneStart > 0 {
-				sceneGroups = append(sceneGroups, sceneGroup{
-					name:  currentScene,
-					start: sceneStart,
-					end:   rowNum - 1,
-				})
-			}
-			// 开始新的场景组
-			currentScene = record.Scene
-			sceneStart = rowNum
+		cells := make([]interface{}, len(values))
+		for i, v := range values {
+			cells[i] = excelize.Cell{StyleID: dataStyle, Value: v}
 		}
-
-		// 写入行数据
-		f.SetCellValue(sheet, fmt.Sprintf("A%d", rowNum), record.Environment)
-		f.SetCellValue(sheet, fmt.Sprintf("B%d", rowNum), record.SerialNumber)
-		f.SetCellValue(sheet, fmt.Sprintf("C%d", rowNum), record.Scene)
-		f.SetCellValue(sheet, fmt.Sprintf("D%d", rowNum), record.Department)
-		f.SetCellValue(sheet, fmt.Sprintf("F%d", rowNum), record.ResponsiblePerson)
-		f.SetCellValue(sheet, fmt.Sprintf("G%d", rowNum), record.Frequency)
-		f.SetCellValue(sheet, fmt.Sprintf("H%d", rowNum), record.Model)
-		f.SetCellValue(sheet, fmt.Sprintf("I%d", rowNum), record.Concurrency)
-		f.SetCellValue(sheet, fmt.Sprintf("J%d", rowNum), record.CallVolume)
-
-		// 应用数据样式
-		f.SetCellStyle(sheet, fmt.Sprintf("A%d", rowNum), fmt.Sprintf("J%d", rowNum), dataStyle)
-	}
-
-	// 添加最后一个环境组
-	if currentEnv != "" && envStart > 0 {
-		envGroups = append(envGroups, envGroup{
-			name:  currentEnv,
-			start: envStart,
-			end:   len(newData) + 2,
-		})
-	}
-
-	// 添加最后一个场景组
-	if currentScene != "" && sceneStart > 0 {
-		sceneGroups = append(sceneGroups, sceneGroup{
-			name:  currentScene,
-			start: sceneStart,
-			end:   len(newData) + 2,
-		})
-	}
-
-	// 合并环境单元格（根据环境分组）
-	for _, group := range envGroups {
-		// 只有当组内有多行时才需要合并
-		if group.start < group.end {
-			startCell := fmt.Sprintf("A%d", group.start)
-			endCell := fmt.Sprintf("A%d", group.end)
-			if err := f.MergeCell(sheet, startCell, endCell); err != nil {
-				fmt.Printf("合并环境单元格 %s:%s 失败: %v\n", startCell, endCell, err)
-			}
+		if err := sw.SetRow(fmt.Sprintf("A%d", rowIndex+3), cells); err != nil {
+			return err
 		}
+		extras.Report(rowIndex+1, len(newData))
 	}
 
-	// 合并场景单元格（根据场景分组）
-	for _, group := range sceneGroups {
-		// 只有当组内有多行时才需要合并
-		if group.start < group.end {
-			// 合并场景列
-			startCell := fmt.Sprintf("C%d", group.start)
-			endCell := fmt.Sprintf("C%d", group.end)
-			if err := f.MergeCell(sheet, startCell, endCell); err != nil {
-				fmt.Printf("合并场景单元格 %s:%s 失败: %v\n", startCell, endCell, err)
-			}
-
-			// 合并开发部门列
-			startCell = fmt.Sprintf("D%d", group.start)
-			endCell = fmt.Sprintf("D%d", group.end)
-			if err := f.MergeCell(sheet, startCell, endCell); err != nil {
-				fmt.Printf("合并开发部门单元格 %s:%s 失败: %v\n", startCell, endCell, err)
-			}
-
-			// 合并中心列
-			startCell = fmt.Sprintf("E%d", group.start)
-			endCell = fmt.Sprintf("E%d", group.end)
-			if err := f.MergeCell(sheet, startCell, endCell); err != nil {
-				fmt.Printf("合并中心单元格 %s:%s 失败: %v\n", startCell, endCell, err)
+	// 合并环境单元格（相同环境连续的行），以及同一环境内相同场景的场景、开发部门、中心、负责人、调用频度列
+	mergeRuns := func(same func(a, b ServiceRecord) bool, cols ...string) error {
+		for start := 0; start < len(newData); {
+			end := start + 1
+			for end < len(newData) && same(newData[start], newData[end]) {
+				end++
 			}
-
-			// 合并负责人列
-			startCell = fmt.Sprintf("F%d", group.start)
-			endCell = fmt.Sprintf("F%d", group.end)
-			if err := f.MergeCell(sheet, startCell, endCell); err != nil {
-				fmt.Printf("合并负责人单元格 %s:%s 失败: %v\n", startCell, endCell, err)
-			}
-
-			// 合并调用频度列
-			startCell = fmt.Sprintf("G%d", group.start)
-			endCell = fmt.Sprintf("G%d", group.end)
-			if err := f.MergeCell(sheet, startCell, endCell); err != nil {
-				fmt.Printf("合并调用频度单元格 %s:%s 失败: %v\n", startCell, endCell, err)
+			// 只有当组内有多行时才需要合并
+			if end-start > 1 {
+				for _, col := range cols {
+					if err := sw.MergeCell(fmt.Sprintf("%s%d", col, start+3), fmt.Sprintf("%s%d", col, end+2)); err != nil {
+						return fmt.Errorf("合并单元格失败: %w", err)
+					}
+				}
 			}
+			start = end
 		}
+		return nil
+	}
+	if err := mergeRuns(func(a, b ServiceRecord) bool { return a.Environment == b.Environment }, "A"); err != nil {
+		return err
+	}
+	sameScene := func(a, b ServiceRecord) bool { return a.Environment == b.Environment && a.Scene == b.Scene }
+	if err := mergeRuns(sameScene, "C", "D", "E", "F", "G"); err != nil {
+		return err
 	}
-
-	// 设置列宽（根据实际情况调整）
-	f.SetColWidth(sheet, "A", "A", 10) // 环境
-	f.SetColWidth(sheet, "B", "B", 6)  // 序号
-	f.SetColWidth(sheet, "C", "C", 35) // 场景
-	f.SetColWidth(sheet, "D", "D", 15) // 开发部门
-	f.SetColWidth(sheet, "E", "E", 20) // 中心
-	f.SetColWidth(sheet, "F", "F", 20) // 负责人
-	f.SetColWidth(sheet, "G", "G", 10) // 调用频度
-	f.SetColWidth(sheet, "H", "H", 30) // 调用模型
-	f.SetColWidth(sheet, "I", "I", 15) // 申请并发(页)
-	f.SetColWidth(sheet, "J", "J", 15) // 本期调用量
 
 	// 保存文件
-	//if err := f.SaveAs("智能平台服务调用情况表.xlsx"); err != nil {
-	//	fmt.Println("保存文件失败:", err)
-	//	os.Exit(1)
-	//}
-	timeStr := util.GetTimeMinite()
-	fileName := "智能平台大模型服务调用情况表" + timeStr + ".xlsx"
-	filePath := fmt.Sprintf("./files/%s", fileName)
-
-	if err := f.SaveAs(filePath); err != nil {
-		log.Println(err)
-		return fileName
+	if err := extras.Finish(f, sheet, sw, len(newData)+3); err != nil {
+		return err
 	}
-	return ""
-
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("写入台账失败: %w", err)
+	}
+	return nil
 }
 
 func (l *LargeInvokingexcel) createHeaderStyle(f *excelize.File) int {
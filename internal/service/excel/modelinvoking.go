@@ -2,10 +2,8 @@ package excel
 
 import (
 	"fmt"
-	"log"
-	"monitor/util"
-	"strconv"
-	"strings"
+	"io"
+	"monitor/internal/service/export"
 
 	"github.com/xuri/excelize/v2"
 )
@@ -19,6 +17,11 @@ type Record struct {
 	Manager     string `json:"manager"`
 	Concurrency int    `json:"concurrency"`
 	Success     int    `json:"success"`
+	History     int64  `json:"history"` // 累计调用量
+	// token 用量
+	PromptTokens     int64 `json:"promptTokens"`
+	CompletionTokens int64 `json:"completionTokens"`
+	TotalTokens      int64 `json:"totalTokens"`
 }
 
 type ServiceLedgerDetail struct {
@@ -29,7 +32,8 @@ func NewServiceLedgerDetail() *ServiceLedgerDetail {
 }
 
 // 智能平台服务调用情况表
-func (s *ServiceLedgerDetail) GenerateServiceLedger(data []Record) string {
+// GenerateServiceLedger 生成场景调用模型量明细台账并写入 w，extras 在写出前追加到同一文件
+func (s *ServiceLedgerDetail) GenerateServiceLedger(w io.Writer, data []Record, extras *export.Extras) error {
 	//data = []Record{
 	//	// 生产环境 - DeepSeek-R1
 	//	{"生产", "DeepSeek-R1-Distill-Qwen-32B", "知识工程平台知识增强与语料标注", "表单识别", "人工智能中心", "程思香", 144, 4730},
@@ -50,38 +54,33 @@ func (s *ServiceLedgerDetail) GenerateServiceLedger(data []Record) string {
 	//	{"开发", "Qwen3-32B", "贷前投揭进件材料智能记录", "表单识别", "数据管理部", "李霄昊", 1, 0},
 	//}
 
-	// 创建新的Excel文件
+	// 逐行流式写入，数据量大时内存占用与行数无关；合并单元格在写完后登记
 	f := excelize.NewFile()
+	defer f.Close()
 	sheetName := "服务调用情况"
 	index, err := f.NewSheet(sheetName)
 	if err != nil {
-		log.Println(err)
-		return ""
+		return fmt.Errorf("创建工作表失败: %w", err)
 	}
 	f.SetActiveSheet(index)
+	sw, err := f.NewStreamWriter(sheetName)
+	if err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
 
-	// ================= 1. 添加主标题 =================
-	mainTitle := "智能平台服务调用情况表"
-	f.MergeCell(sheetName, "A1", "H1")
-	f.SetCellValue(sheetName, "A1", mainTitle)
-	mainTitleStyle, _ := f.NewStyle(&excelize.Style{
-		Font: &excelize.Font{Bold: true, Color: "#FFFFFF"},
-		Fill: excelize.Fill{Type: "pattern", Color: []string{"#4472C4"}, Pattern: 1},
-		Alignment: &excelize.Alignment{
-			Horizontal: "center",
-			Vertical:   "center",
-		},
-		Border: getBorderStyle(),
-	})
-	f.SetCellStyle(sheetName, "A1", "H1", mainTitleStyle)
-
-	// ================= 2. 添加表头 =================
-	rowOffset := 1
-	headers := []string{"环境", "模型", "场景", "开发部门", "中心", "负责人", "申请并发(页)", "本期成功调用量"}
-	for col, header := range headers {
-		f.SetCellValue(sheetName, s.getCell(col, 1+rowOffset), header)
+	headers := []string{"环境", "模型", "场景", "开发部门", "中心", "负责人", "申请并发(页)", "本期成功调用量", "累计调用量", "输入Token", "输出Token", "Token总量"}
+	// ================= 1. 设置列宽，须在写入行之前 =================
+	for col := 0; col < len(headers); col++ {
+		width := 15.0
+		if col == 1 || col == 2 { // 模型和场景列更宽
+			width = 35.0
+		}
+		if err := sw.SetColWidth(col+1, col+1, width); err != nil {
+			return err
+		}
 	}
 
+	// ================= 2. 主标题及表头 =================
 	headerStyle, _ := f.NewStyle(&excelize.Style{
 		Font: &excelize.Font{
 			Bold:  true,
@@ -98,20 +97,24 @@ func (s *ServiceLedgerDetail) GenerateServiceLedger(data []Record) string {
 		},
 		Border: getBorderStyle(),
 	})
-	f.SetCellStyle(sheetName, s.getCell(0, 1+rowOffset), s.getCell(len(headers)-1, 1+rowOffset), headerStyle)
-
-	// ================= 3. 处理数据行 =================
-	currentEnv := ""
-	currentModel := ""
-	envStartRow := make(map[string]int)
-	envEndRow := make(map[string]int)
-	modelStartRow := make(map[string]int)
-	modelEndRow := make(map[string]int)
-
-	// 当前行号（表头之后开始）
-	currentRow := 1 + rowOffset
-	var mergeRanges []string
+	title := make([]interface{}, len(headers))
+	header := make([]interface{}, len(headers))
+	for col, h := range headers {
+		title[col] = excelize.Cell{StyleID: headerStyle}
+		header[col] = excelize.Cell{StyleID: headerStyle, Value: h}
+	}
+	title[0] = excelize.Cell{StyleID: headerStyle, Value: "智能平台服务调用情况表"}
+	if err := sw.SetRow("A1", title); err != nil {
+		return err
+	}
+	if err := sw.SetRow("A2", header); err != nil {
+		return err
+	}
+	if err := sw.MergeCell("A1", "L1"); err != nil {
+		return err
+	}
 
+	// ================= 3. 数据行，每个模型之后写合计行 =================
 	dataStyle, _ := f.NewStyle(&excelize.Style{
 		Alignment: &excelize.Alignment{
 			Horizontal: "center",
@@ -119,173 +122,13 @@ func (s *ServiceLedgerDetail) GenerateServiceLedger(data []Record) string {
 		},
 		Border: getBorderStyle(),
 	})
-
-	for _, record := range data {
-		currentRow++
-
-		// 处理环境变更
-		if record.Environment != currentEnv {
-			if currentEnv != "" {
-				envEndRow[currentEnv] = currentRow - 1
-			}
-			currentEnv = record.Environment
-			envStartRow[currentEnv] = currentRow
-		}
-
-		// 处理模型变更
-		if record.Model != currentModel {
-			if currentModel != "" {
-				// 为上一个模型添加合计行
-				s.addTotalRow(f, sheetName, currentRow, modelStartRow[currentModel], currentRow-1)
-				modelEndRow[currentModel] = currentRow
-				currentRow++ // 增加了合计行，再进一行
-			}
-			currentModel = record.Model
-			modelStartRow[currentModel] = currentRow
-		}
-
-		// 写入数据行
-		f.SetCellValue(sheetName, s.getCell(0, currentRow), record.Environment)
-		f.SetCellValue(sheetName, s.getCell(1, currentRow), record.Model)
-		f.SetCellValue(sheetName, s.getCell(2, currentRow), record.Scenario)
-		f.SetCellValue(sheetName, s.getCell(3, currentRow), record.Department)
-		f.SetCellValue(sheetName, s.getCell(4, currentRow), record.Center)
-		f.SetCellValue(sheetName, s.getCell(5, currentRow), record.Manager)
-		f.SetCellValue(sheetName, s.getCell(6, currentRow), record.Concurrency)
-		f.SetCellValue(sheetName, s.getCell(7, currentRow), record.Success)
-
-		// 应用数据行样式（居中，边框）
-		f.SetCellStyle(sheetName, s.getCell(0, currentRow), s.getCell(7, currentRow), dataStyle)
-	}
-
-	// ================= 4. 处理最后一个模型和环境 =================
-	if currentModel != "" {
-		s.addTotalRow(f, sheetName, currentRow+1, modelStartRow[currentModel], currentRow)
-		modelEndRow[currentModel] = currentRow + 1
-		currentRow++ // 增加总计行
-	}
-
-	if currentEnv != "" {
-		envEndRow[currentEnv] = currentRow
-	}
-
-	// ================= 5. 合并单元格 =================
-	// 合并环境单元格（A列）
-	for env, start := range envStartRow {
-		end := envEndRow[env]
-		if start < end {
-			startCell := s.getCell(0, start)
-			endCell := s.getCell(0, end)
-			mergeRanges = append(mergeRanges, fmt.Sprintf("%s:%s", startCell, endCell))
-
-			// 设置垂直居中样式
-			centerStyle, _ := f.NewStyle(&excelize.Style{
-				Alignment: &excelize.Alignment{
-					Vertical: "center",
-				},
-				Border: getBorderStyle(),
-			})
-			f.SetCellStyle(sheetName, startCell, endCell, centerStyle)
-		}
-	}
-
-	// 合并模型单元格（B列）
-	for model, start := range modelStartRow {
-		end := modelEndRow[model]
-		if start < end {
-			startCell := s.getCell(1, start)
-			endCell := s.getCell(1, end)
-			mergeRanges = append(mergeRanges, fmt.Sprintf("%s:%s", startCell, endCell))
-
-			// 设置垂直居中样式
-			centerStyle, _ := f.NewStyle(&excelize.Style{
-				Alignment: &excelize.Alignment{
-					Vertical: "center",
-				},
-				Border: getBorderStyle(),
-			})
-			f.SetCellStyle(sheetName, startCell, endCell, centerStyle)
-		}
-	}
-
-	// 应用所有合并
-	for _, mergeRange := range mergeRanges {
-		parts := strings.Split(mergeRange, ":")
-		if len(parts) == 2 {
-			f.MergeCell(sheetName, parts[0], parts[1])
-		}
-	}
-
-	// ================= 6. 设置列宽 =================
-
-	for col := 0; col < len(headers); col++ {
-		width := 15.0
-		if col == 1 || col == 2 { // 模型和场景列更宽
-			width = 35.0
-		}
-		colName, _ := excelize.ColumnNumberToName(col + 1)
-		f.SetColWidth(sheetName, colName, colName, width)
-	}
-
-	// ================= 7. 保存文件 =================
-	timeStr := util.GetTimeMinite()
-	fileName := "智能平台服务调用情况表" + timeStr + ".xlsx"
-	filePath := fmt.Sprintf("./files/%s", fileName)
-
-	if err := f.SaveAs(filePath); err != nil {
-		log.Println(err)
-		return fileName
-	}
-	return ""
-}
-
-//}
-//
-//log.Println("Excel文件生成成功：智能平台服务调用情况表.xlsx")
-//	buf, err := f.WriteToBuffer()
-//	return buf
-//}
-
-// 添加合计行（合并场景到负责人列）
-func (s *ServiceLedgerDetail) addTotalRow(f *excelize.File, sheetName string, row int, startRow, endRow int) {
-	// 计算合计值
-	totalConcurrency := 0
-	totalSuccess := 0
-
-	// 遍历需要计算的数据行
-	for r := startRow; r <= endRow; r++ {
-		// 直接获取并发数
-		concurrencyCell := s.getCell(6, r)
-		concurrency, err := f.GetCellValue(sheetName, concurrencyCell)
-		if err != nil {
-			continue
-		}
-		concurrencyInt, err := strconv.Atoi(concurrency)
-		if err == nil {
-			totalConcurrency += concurrencyInt
-		}
-
-		// 直接获取成功数
-		successCell := s.getCell(7, r)
-		success, err := f.GetCellValue(sheetName, successCell)
-		if err != nil {
-			continue
-		}
-		successInt, err := strconv.Atoi(success)
-		if err == nil {
-			totalSuccess += successInt
-		}
-	}
-
-	// 写入"总计"到场景列
-	f.SetCellValue(sheetName, s.getCell(2, row), "总计")
-
-	// 合并场景到负责人列（C列到F列）
-	startMerge := s.getCell(2, row) // C列
-	endMerge := s.getCell(5, row)   // F列
-	f.MergeCell(sheetName, startMerge, endMerge)
-
-	// 设置总计行样式（浅蓝色背景，加粗，居中）
+	// 合并后的环境、模型单元格只垂直居中
+	groupStyle, _ := f.NewStyle(&excelize.Style{
+		Alignment: &excelize.Alignment{
+			Vertical: "center",
+		},
+		Border: getBorderStyle(),
+	})
 	totalStyle, _ := f.NewStyle(&excelize.Style{
 		Font: &excelize.Font{Bold: true},
 		Fill: excelize.Fill{
@@ -300,12 +143,94 @@ func (s *ServiceLedgerDetail) addTotalRow(f *excelize.File, sheetName string, ro
 		Border: getBorderStyle(),
 	})
 
-	// 应用样式到总计行（从环境列到成功调用量列）
-	f.SetCellStyle(sheetName, s.getCell(0, row), s.getCell(7, row), totalStyle)
+	row, done := 2, 0
+	for envStart := 0; envStart < len(data); {
+		envEnd := envStart
+		for envEnd < len(data) && data[envEnd].Environment == data[envStart].Environment {
+			envEnd++
+		}
+		envFirstRow := row + 1
+		for modelStart := envStart; modelStart < envEnd; {
+			modelEnd := modelStart
+			for modelEnd < envEnd && data[modelEnd].Model == data[modelStart].Model {
+				modelEnd++
+			}
+			modelFirstRow := row + 1
+			var total modelTotal
+			for _, record := range data[modelStart:modelEnd] {
+				row++
+				total.add(record)
+				values := []interface{}{
+					record.Environment, record.Model, record.Scenario, record.Department, record.Center, record.Manager,
+					record.Concurrency, record.Success, record.History, record.PromptTokens, record.CompletionTokens, record.TotalTokens,
+				}
+				if err := sw.SetRow(s.getCell(0, row), styledRow(values, dataStyle, groupStyle)); err != nil {
+					return err
+				}
+				done++
+				extras.Report(done, len(data))
+			}
+			// 合计行：场景到负责人列合并写"总计"
+			row++
+			values := []interface{}{
+				nil, nil, "总计", nil, nil, nil,
+				total.concurrency, total.success, total.history, total.prompt, total.completion, total.tokens,
+			}
+			if err := sw.SetRow(s.getCell(0, row), styledRow(values, totalStyle, groupStyle)); err != nil {
+				return err
+			}
+			if err := sw.MergeCell(s.getCell(2, row), s.getCell(5, row)); err != nil {
+				return err
+			}
+			if err := sw.MergeCell(s.getCell(1, modelFirstRow), s.getCell(1, row)); err != nil {
+				return err
+			}
+			modelStart = modelEnd
+		}
+		if row > envFirstRow {
+			if err := sw.MergeCell(s.getCell(0, envFirstRow), s.getCell(0, row)); err != nil {
+				return err
+			}
+		}
+		envStart = envEnd
+	}
+
+	// ================= 4. 保存文件 =================
+	if err := extras.Finish(f, sheetName, sw, row+1); err != nil {
+		return err
+	}
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("写入台账失败: %w", err)
+	}
+	return nil
+}
 
-	// 写入数值
-	f.SetCellValue(sheetName, s.getCell(6, row), totalConcurrency)
-	f.SetCellValue(sheetName, s.getCell(7, row), totalSuccess)
+// modelTotal 一个模型的合计
+type modelTotal struct {
+	concurrency, success                int
+	history, prompt, completion, tokens int64
+}
+
+func (t *modelTotal) add(r Record) {
+	t.concurrency += r.Concurrency
+	t.success += r.Success
+	t.history += r.History
+	t.prompt += r.PromptTokens
+	t.completion += r.CompletionTokens
+	t.tokens += r.TotalTokens
+}
+
+// styledRow 环境、模型列使用 groupStyle，其余列使用 style
+func styledRow(values []interface{}, style, groupStyle int) []interface{} {
+	cells := make([]interface{}, len(values))
+	for i, v := range values {
+		id := style
+		if i < 2 {
+			id = groupStyle
+		}
+		cells[i] = excelize.Cell{StyleID: id, Value: v}
+	}
+	return cells
 }
 
 // 根据列索引和行号获取单元格名称
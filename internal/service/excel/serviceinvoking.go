@@ -1,6 +1,158 @@
 package excel
 
-// 大模型调用量情况
-func GenerateServicInvoking() {
+import (
+	"fmt"
+	"io"
+	"monitor/internal/service/export"
 
+	"github.com/xuri/excelize/v2"
+)
+
+// DeptScenes 某一开发部门使用该模型的场景数
+type DeptScenes struct {
+	Department string `json:"department"`
+	SceneCount int    `json:"sceneCount"`
+}
+
+// SupportRecord 大模型支撑场景调用量，每个模型一条
+type SupportRecord struct {
+	SerialNumber int          `json:"serialNumber"` //序号
+	Model        string       `json:"model"`        //模型
+	SceneCount   int          `json:"sceneCount"`   //支撑场景数
+	Departments  []DeptScenes `json:"departments"`  //各部门场景数
+	TotalCalls   int64        `json:"totalCalls"`   //本期调用总量
+	SuccessCalls int64        `json:"successCalls"` //本期成功调用量
+	SuccessRate  float64      `json:"successRate"`  //成功率，百分比
+	Concurrency  int64        `json:"concurrency"`  //申请并发
+}
+
+type SupportInvoking struct {
+}
+
+func NewSupportInvoking() *SupportInvoking {
+	return &SupportInvoking{}
+}
+
+// 大模型支撑场景调用量统计表
+// GenerateSupportLedger 生成大模型支撑场景调用量台账并写入 w。
+// 每个模型按开发部门分行，模型级的列纵向合并，末行为合计；extras 在写出前追加到同一文件
+func (s *SupportInvoking) GenerateSupportLedger(w io.Writer, data []SupportRecord, extras *export.Extras) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := "支撑场景调用量"
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+
+	headers := []interface{}{"序号", "模型", "支撑场景数", "开发部门", "部门场景数", "本期调用总量", "本期成功调用量", "成功率", "申请并发"}
+	f.SetCellValue(sheet, "A1", "智能平台大模型支撑场景调用量统计表")
+	if err := f.MergeCell(sheet, "A1", "I1"); err != nil {
+		return fmt.Errorf("合并标题单元格失败: %w", err)
+	}
+	f.SetSheetRow(sheet, "A2", &headers)
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"#4472C4"}, Pattern: 1},
+		Font:      &excelize.Font{Bold: true, Color: "#FFFFFF"},
+		Border:    getBorderStyle(),
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	f.SetCellStyle(sheet, "A1", "I2", headerStyle)
+
+	percentFmt := "0.00%"
+	dataStyle, err := f.NewStyle(&excelize.Style{
+		Border:    getBorderStyle(),
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	if err != nil {
+		return fmt.Errorf("创建数据样式失败: %w", err)
+	}
+	rateStyle, _ := f.NewStyle(&excelize.Style{
+		Border:       getBorderStyle(),
+		Alignment:    &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+		CustomNumFmt: &percentFmt,
+	})
+
+	row := 3
+	var scenes int
+	var totalCalls, successCalls, concurrency int64
+	for i, record := range data {
+		depts := record.Departments
+		if len(depts) == 0 {
+			depts = []DeptScenes{{}}
+		}
+		start := row
+		for _, d := range depts {
+			f.SetCellValue(sheet, fmt.Sprintf("D%d", row), d.Department)
+			f.SetCellValue(sheet, fmt.Sprintf("E%d", row), d.SceneCount)
+			row++
+		}
+		end := row - 1
+
+		f.SetCellValue(sheet, fmt.Sprintf("A%d", start), record.SerialNumber)
+		f.SetCellValue(sheet, fmt.Sprintf("B%d", start), record.Model)
+		f.SetCellValue(sheet, fmt.Sprintf("C%d", start), record.SceneCount)
+		f.SetCellValue(sheet, fmt.Sprintf("F%d", start), record.TotalCalls)
+		f.SetCellValue(sheet, fmt.Sprintf("G%d", start), record.SuccessCalls)
+		f.SetCellValue(sheet, fmt.Sprintf("H%d", start), record.SuccessRate/100)
+		f.SetCellValue(sheet, fmt.Sprintf("I%d", start), record.Concurrency)
+		f.SetCellStyle(sheet, fmt.Sprintf("A%d", start), fmt.Sprintf("I%d", end), dataStyle)
+		f.SetCellStyle(sheet, fmt.Sprintf("H%d", start), fmt.Sprintf("H%d", end), rateStyle)
+
+		// 模型级的列在部门行之间合并
+		if end > start {
+			for _, col := range []string{"A", "B", "C", "F", "G", "H", "I"} {
+				if err := f.MergeCell(sheet, fmt.Sprintf("%s%d", col, start), fmt.Sprintf("%s%d", col, end)); err != nil {
+					return fmt.Errorf("合并单元格失败: %w", err)
+				}
+			}
+		}
+
+		scenes += record.SceneCount
+		totalCalls += record.TotalCalls
+		successCalls += record.SuccessCalls
+		concurrency += record.Concurrency
+		extras.Report(i+1, len(data))
+	}
+
+	// 合计行
+	f.SetCellValue(sheet, fmt.Sprintf("A%d", row), "合计")
+	f.MergeCell(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("B%d", row))
+	f.SetCellValue(sheet, fmt.Sprintf("C%d", row), scenes)
+	f.SetCellValue(sheet, fmt.Sprintf("F%d", row), totalCalls)
+	f.SetCellValue(sheet, fmt.Sprintf("G%d", row), successCalls)
+	if totalCalls > 0 {
+		f.SetCellValue(sheet, fmt.Sprintf("H%d", row), float64(successCalls)/float64(totalCalls))
+	}
+	f.SetCellValue(sheet, fmt.Sprintf("I%d", row), concurrency)
+	totalStyle, _ := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"#D6DCE4"}, Pattern: 1},
+		Border:    getBorderStyle(),
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	totalRateStyle, _ := f.NewStyle(&excelize.Style{
+		Font:         &excelize.Font{Bold: true},
+		Fill:         excelize.Fill{Type: "pattern", Color: []string{"#D6DCE4"}, Pattern: 1},
+		Border:       getBorderStyle(),
+		Alignment:    &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+		CustomNumFmt: &percentFmt,
+	})
+	f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("I%d", row), totalStyle)
+	f.SetCellStyle(sheet, fmt.Sprintf("H%d", row), fmt.Sprintf("H%d", row), totalRateStyle)
+
+	f.SetColWidth(sheet, "A", "A", 6)  // 序号
+	f.SetColWidth(sheet, "B", "B", 32) // 模型
+	f.SetColWidth(sheet, "C", "C", 12) // 支撑场景数
+	f.SetColWidth(sheet, "D", "D", 20) // 开发部门
+	f.SetColWidth(sheet, "E", "E", 12) // 部门场景数
+	f.SetColWidth(sheet, "F", "G", 16) // 调用量
+	f.SetColWidth(sheet, "H", "I", 12) // 成功率、申请并发
+
+	if err := extras.Finish(f, sheet, nil, row+1); err != nil {
+		return err
+	}
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("写入台账失败: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,229 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// PDF 版面：A4 横向，单位为点
+const (
+	pdfPageWidth  = 842.0
+	pdfPageHeight = 595.0
+	pdfMargin     = 36.0
+	pdfTitleSize  = 14.0
+	pdfFontSize   = 8.0
+	pdfRowHeight  = 14.0
+	pdfCellPad    = 3.0
+	pdfMinColumn  = 30.0
+)
+
+// WritePDF 输出分页的表格 PDF，每页重复表头。
+// 使用 Adobe 预置的 STSong-Light 中文字体（UniGB-UCS2-H 编码），不嵌入字体文件，阅读器需支持亚洲字体。
+func WritePDF(w io.Writer, t Table) error {
+	cells := t.Strings()
+	widths := pdfColumnWidths(t.Columns, cells)
+	available := pdfPageHeight - 2*pdfMargin - pdfTitleSize*2 - pdfRowHeight
+	perPage := int(available / pdfRowHeight)
+	var pages [][][]string
+	for start := 0; start < len(cells); start += perPage {
+		end := start + perPage
+		if end > len(cells) {
+			end = len(cells)
+		}
+		pages = append(pages, cells[start:end])
+	}
+	if len(pages) == 0 {
+		pages = [][][]string{nil}
+	}
+	// 说明行接在最后一页表格之后，放不下时另起一页
+	if len(t.Notes) > 0 && len(pages[len(pages)-1])+len(t.Notes)+1 > perPage {
+		pages = append(pages, nil)
+	}
+
+	p := &pdfWriter{}
+	p.buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	// 1 目录，2 页树，3-5 字体，之后每页占用页面和内容流两个对象
+	const firstPage = 6
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	p.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	p.object(3, "<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light-UniGB-UCS2-H /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>")
+	p.object(4, "<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>")
+	p.object(5, "<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] "+
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+
+	for i, rows := range pages {
+		content := pdfPageContent(t, widths, rows, i+1, len(pages))
+		pageObj, contentObj := firstPage+2*i, firstPage+2*i+1
+		p.object(pageObj, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, contentObj))
+		p.object(contentObj, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+	p.finish()
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int // 对象号 -> 偏移，对象号从 1 开始
+}
+
+func (p *pdfWriter) object(num int, body string) {
+	for len(p.offsets) < num {
+		p.offsets = append(p.offsets, 0)
+	}
+	p.offsets[num-1] = p.buf.Len()
+	fmt.Fprintf(&p.buf, "%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+func (p *pdfWriter) finish() {
+	xref := p.buf.Len()
+	fmt.Fprintf(&p.buf, "xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, off := range p.offsets {
+		fmt.Fprintf(&p.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&p.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, xref)
+}
+
+func pdfPageContent(t Table, widths []float64, rows [][]string, page, pages int) string {
+	var b strings.Builder
+	y := pdfPageHeight - pdfMargin - pdfTitleSize
+	title := t.Title
+	if pages > 1 {
+		title = fmt.Sprintf("%s（%d/%d）", t.Title, page, pages)
+	}
+	pdfText(&b, pdfMargin, y, pdfTitleSize, title)
+	y -= pdfTitleSize
+
+	tableWidth := 0.0
+	for _, w := range widths {
+		tableWidth += w
+	}
+	// 表头底色
+	fmt.Fprintf(&b, "0.9 g %.2f %.2f %.2f %.2f re f 0 g\n", pdfMargin, y-pdfRowHeight, tableWidth, pdfRowHeight)
+	all := append([][]string{t.Columns}, rows...)
+	b.WriteString("0.5 w\n")
+	for _, row := range all {
+		x := pdfMargin
+		for i, w := range widths {
+			if i < len(row) {
+				pdfCell(&b, x, y-pdfRowHeight, w, row[i])
+			}
+			x += w
+		}
+		fmt.Fprintf(&b, "%.2f %.2f m %.2f %.2f l S\n", pdfMargin, y, pdfMargin+tableWidth, y)
+		y -= pdfRowHeight
+	}
+	fmt.Fprintf(&b, "%.2f %.2f m %.2f %.2f l S\n", pdfMargin, y, pdfMargin+tableWidth, y)
+	top := pdfPageHeight - pdfMargin - 2*pdfTitleSize
+	x := pdfMargin
+	for i := 0; i <= len(widths); i++ {
+		fmt.Fprintf(&b, "%.2f %.2f m %.2f %.2f l S\n", x, top, x, y)
+		if i < len(widths) {
+			x += widths[i]
+		}
+	}
+	if page == pages {
+		y -= pdfRowHeight
+		for _, n := range t.Notes {
+			pdfCell(&b, pdfMargin-pdfCellPad, y-pdfRowHeight, pdfPageWidth-2*pdfMargin+2*pdfCellPad, n)
+			y -= pdfRowHeight
+		}
+	}
+	return b.String()
+}
+
+func pdfText(b *strings.Builder, x, y, size float64, text string) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(b, "BT /F1 %g Tf %.2f %.2f Td <%s> Tj ET\n", size, x, y, pdfHex(text))
+}
+
+// pdfCell 在 (x, y) 起、宽 w 的单元格内输出文本：先按列宽截断，再用裁剪路径限定在单元格内，
+// 估算宽度有偏差时也不会压到相邻单元格
+func pdfCell(b *strings.Builder, x, y, w float64, text string) {
+	text = pdfFit(text, w-2*pdfCellPad)
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(b, "q %.2f %.2f %.2f %.2f re W n\n", x, y, w, pdfRowHeight)
+	pdfText(b, x+pdfCellPad, y+4, pdfFontSize, text)
+	b.WriteString("Q\n")
+}
+
+// pdfHex UCS-2 大端十六进制，BMP 之外的字符替换为 '?'
+func pdfHex(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r > 0xFFFF || utf16.IsSurrogate(r) {
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
+
+// pdfMeasure 文本宽度（点）：与字体 /W 一致，ASCII 可打印字符按 0.5 em，其余（中文、全角及其他符号）按 1 em
+func pdfMeasure(text string, size float64) float64 {
+	width := 0.0
+	for _, r := range text {
+		if r >= 0x20 && r <= 0x7E {
+			width += size / 2
+		} else {
+			width += size
+		}
+	}
+	return width
+}
+
+// pdfFit 截断到 width 之内，截断时以省略号结尾
+func pdfFit(text string, width float64) string {
+	if pdfMeasure(text, pdfFontSize) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && pdfMeasure(string(runes)+"…", pdfFontSize) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// pdfColumnWidths 按内容宽度分配列宽并缩放到页面可用宽度
+func pdfColumnWidths(columns []string, rows [][]string) []float64 {
+	widths := make([]float64, len(columns))
+	for i, c := range columns {
+		widths[i] = pdfMeasure(c, pdfFontSize)
+	}
+	for _, row := range rows {
+		for i := 0; i < len(row) && i < len(widths); i++ {
+			if w := pdfMeasure(row[i], pdfFontSize); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	total := 0.0
+	for i := range widths {
+		widths[i] += 2 * pdfCellPad
+		if widths[i] < pdfMinColumn {
+			widths[i] = pdfMinColumn
+		}
+		total += widths[i]
+	}
+	if total == 0 {
+		return widths
+	}
+	scale := (pdfPageWidth - 2*pdfMargin) / total
+	for i := range widths {
+		widths[i] *= scale
+	}
+	return widths
+}
@@ -0,0 +1,44 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPDFCellClippedToColumn(t *testing.T) {
+	long := strings.Repeat("研发部·", 40)
+	table := Table{
+		Title:   "各部门场景数",
+		Columns: []string{"部门", "场景数"},
+		Rows:    [][]any{{long, 3}},
+	}
+	cells := table.Strings()
+	widths := pdfColumnWidths(table.Columns, cells)
+	content := pdfPageContent(table, widths, cells, 1, 1)
+
+	// 每个单元格都包在与单元格同大小的裁剪路径内
+	y := pdfPageHeight - pdfMargin - 2*pdfTitleSize - 2*pdfRowHeight
+	clip := fmt.Sprintf("q %.2f %.2f %.2f %.2f re W n\n", pdfMargin, y, widths[0], pdfRowHeight)
+	if !strings.Contains(content, clip) {
+		t.Fatalf("缺少单元格裁剪路径 %q:\n%s", clip, content)
+	}
+	if strings.Count(content, " re W n\n") != strings.Count(content, "Q\n") {
+		t.Fatalf("裁剪路径与 Q 不成对:\n%s", content)
+	}
+	if strings.Contains(content, pdfHex(long)) {
+		t.Fatal("超长单元格未截断")
+	}
+}
+
+func TestPDFMeasureNonASCII(t *testing.T) {
+	// STSong 中 ASCII 以外的字符（如 ·、×）均为全宽
+	for _, s := range []string{"中", "·", "×", "é"} {
+		if got := pdfMeasure(s, pdfFontSize); got != pdfFontSize {
+			t.Errorf("pdfMeasure(%q) = %v, want %v", s, got, pdfFontSize)
+		}
+	}
+	if got := pdfMeasure("ab", pdfFontSize); got != pdfFontSize {
+		t.Errorf("pdfMeasure(ab) = %v, want %v", got, pdfFontSize)
+	}
+}
@@ -0,0 +1,245 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Table 与版式无关的二维表，供 CSV、PDF 及通用 xlsx 输出
+type Table struct {
+	Title   string
+	Columns []string
+	Rows    [][]any
+	Notes   []string // 表格后附加的说明行，例如审批信息
+}
+
+// FirstDataRow WriteSheet 输出的工作表中数据的起始行：第一行为标题，第二行为表头
+const FirstDataRow = 3
+
+// utf8BOM Excel 打开不带 BOM 的 UTF-8 CSV 时中文会乱码
+const utf8BOM = "\xEF\xBB\xBF"
+
+// Text 单元格的文本形式
+func Text(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		// 避免大数输出为科学计数法
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// Strings 全部数据行的文本形式
+func (t Table) Strings() [][]string {
+	rows := make([][]string, len(t.Rows))
+	for i, r := range t.Rows {
+		rows[i] = make([]string, len(r))
+		for j, v := range r {
+			rows[i][j] = Text(v)
+		}
+	}
+	return rows
+}
+
+// WriteCSV 输出带表头的 CSV
+func WriteCSV(w io.Writer, t Table) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.Columns); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(t.Strings()); err != nil {
+		return fmt.Errorf("写入CSV失败: %w", err)
+	}
+	if len(t.Notes) == 0 {
+		return nil
+	}
+	notes := [][]string{{}}
+	for _, n := range t.Notes {
+		notes = append(notes, []string{n})
+	}
+	if err := cw.WriteAll(notes); err != nil {
+		return fmt.Errorf("写入CSV失败: %w", err)
+	}
+	return nil
+}
+
+// WriteXLSX 输出单个工作表的 xlsx，extras 为同一文件中附加的内容，可为 nil
+func WriteXLSX(w io.Writer, t Table, extras *Extras) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := SheetName(t.Title)
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+	sw, next, err := streamSheet(f, sheet, t, extras)
+	if err != nil {
+		return err
+	}
+	if err := extras.Finish(f, sheet, sw, next); err != nil {
+		return err
+	}
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("写入台账失败: %w", err)
+	}
+	return nil
+}
+
+// WriteSheet 将表写入 f 中已存在的空工作表，第一行为标题，第二行为表头，数值保留为数字单元格
+func WriteSheet(f *excelize.File, sheet string, t Table) error {
+	sw, _, err := streamSheet(f, sheet, t, nil)
+	if err != nil {
+		return err
+	}
+	return sw.Flush()
+}
+
+// streamSheet 流式写入表，返回尚未 Flush 的写入器及第一个空行
+func streamSheet(f *excelize.File, sheet string, t Table, extras *Extras) (*excelize.StreamWriter, int, error) {
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建工作表失败: %w", err)
+	}
+	headerStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err := sw.SetRow("A1", []interface{}{excelize.Cell{StyleID: headerStyle, Value: t.Title}}); err != nil {
+		return nil, 0, err
+	}
+	header := make([]interface{}, len(t.Columns))
+	for i, c := range t.Columns {
+		header[i] = excelize.Cell{StyleID: headerStyle, Value: c}
+	}
+	if err := sw.SetRow("A2", header); err != nil {
+		return nil, 0, err
+	}
+	for i, r := range t.Rows {
+		values := make([]interface{}, len(r))
+		copy(values, r)
+		if err := sw.SetRow(fmt.Sprintf("A%d", FirstDataRow+i), values); err != nil {
+			return nil, 0, err
+		}
+		extras.Report(i+1, len(t.Rows))
+	}
+	next := FirstDataRow + len(t.Rows)
+	// 说明行与数据之间空一行
+	for i, n := range t.Notes {
+		if err := sw.SetRow(fmt.Sprintf("A%d", next+1+i), []interface{}{n}); err != nil {
+			return nil, 0, err
+		}
+	}
+	if len(t.Notes) > 0 {
+		next += 1 + len(t.Notes)
+	}
+	return sw, next, nil
+}
+
+// SheetName 工作表名不能为空、不能超过 31 个字符，也不能包含 : \ / ? * [ ]
+func SheetName(title string) string {
+	if title == "" {
+		return "Sheet1"
+	}
+	runes := make([]rune, 0, 31)
+	for _, r := range title {
+		switch r {
+		case ':', '\\', '/', '?', '*', '[', ']':
+			r = '_'
+		}
+		runes = append(runes, r)
+		if len(runes) == 31 {
+			break
+		}
+	}
+	return string(runes)
+}
+
+// Extras 输出 xlsx 时写入同一文件的附加内容，渲染器在写出文件之前调用 Finish 完成，
+// 不再重新解析已生成的 xlsx。nil 表示没有附加内容
+type Extras struct {
+	Notes    []string              // 主工作表内容之后空一行追加的说明行，例如审批信息
+	Sheets   []Sheet               // 追加在末尾的工作表，例如隐藏的数据来源
+	Progress func(done, total int) // 每写出一条数据报告一次进度
+}
+
+// Sheet 附加的工作表
+type Sheet struct {
+	Name   string
+	Rows   [][]any
+	Hidden bool
+}
+
+// Report 报告已写出 total 条数据中的 done 条
+func (e *Extras) Report(done, total int) {
+	if e != nil && e.Progress != nil {
+		e.Progress(done, total)
+	}
+}
+
+// Finish 在写出 f 之前追加说明行及附加工作表。
+// sw 为主工作表 sheet 尚未 Flush 的流式写入器，说明行经 sw 写入后由 Finish 负责 Flush；
+// 主工作表不是流式写入时 sw 为 nil。next 为主工作表内容之后的第一个空行
+func (e *Extras) Finish(f *excelize.File, sheet string, sw *excelize.StreamWriter, next int) error {
+	if e != nil {
+		for i, n := range e.Notes {
+			cell := fmt.Sprintf("A%d", next+1+i)
+			var err error
+			if sw != nil {
+				err = sw.SetRow(cell, []interface{}{n})
+			} else {
+				err = f.SetCellValue(sheet, cell, n)
+			}
+			if err != nil {
+				return fmt.Errorf("写入说明行失败: %w", err)
+			}
+		}
+	}
+	if sw != nil {
+		if err := sw.Flush(); err != nil {
+			return fmt.Errorf("写入台账失败: %w", err)
+		}
+	}
+	if e == nil {
+		return nil
+	}
+	for _, s := range e.Sheets {
+		if err := appendSheet(f, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendSheet 在 f 的末尾新增工作表并流式写入 s.Rows
+func appendSheet(f *excelize.File, s Sheet) error {
+	if _, err := f.NewSheet(s.Name); err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+	sw, err := f.NewStreamWriter(s.Name)
+	if err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+	for i, row := range s.Rows {
+		values := make([]interface{}, len(row))
+		copy(values, row)
+		if err := sw.SetRow(fmt.Sprintf("A%d", i+1), values); err != nil {
+			return err
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	if s.Hidden {
+		if err := f.SetSheetVisible(s.Name, false); err != nil {
+			return fmt.Errorf("隐藏工作表失败: %w", err)
+		}
+	}
+	return nil
+}
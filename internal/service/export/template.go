@@ -0,0 +1,581 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 台账模板是上传的 xlsx，单元格中的占位符在输出时替换为台账数据：
+//
+//	{{title}} {{generated}} {{count}}  标题、生成时间、数据行数等，由调用方通过 vars 提供
+//	{{sum.列标题}}                      该列数值合计
+//	{{row.列标题}} {{row.#}}            数据行的某一列、行号（从 1 开始）
+//
+// 含 {{row.*}} 的连续若干行为重复区域，每条数据复制一次，行内的样式、行高、常量、公式及横向合并随之复制，
+// 重复区域之后的内容整体下移。{{row.列标题|merge}} 将该列相邻且取值相同的单元格纵向合并，
+// 左侧同样标记 merge 的列取值变化时重新开始合并，仅重复区域为单行时可用。
+// 单元格只包含一个占位符时保留原始类型（数值仍为数字单元格），否则按文本替换。
+
+var ErrInvalidTemplate = errors.New("invalid ledger template")
+
+// 模板为用户上传的文件，打开时限制解压后的大小，避免压缩炸弹耗尽内存
+const (
+	templateUnzipLimit    = 32 << 20
+	templateUnzipXMLLimit = 8 << 20
+)
+
+// openTemplate 以解压大小限制打开模板
+func openTemplate(data []byte) (*excelize.File, error) {
+	return excelize.OpenReader(bytes.NewReader(data), excelize.Options{
+		UnzipSizeLimit:    templateUnzipLimit,
+		UnzipXMLSizeLimit: templateUnzipXMLLimit,
+	})
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}|]+?)\s*(?:\|\s*(\w+)\s*)?\}\}`)
+
+type placeholder struct {
+	name  string
+	merge bool
+}
+
+// templateCell 重复区域中含占位符的单元格
+type templateCell struct {
+	col    int
+	row    int // 相对重复区域首行的偏移
+	text   string
+	single *placeholder // 单元格只包含一个占位符
+	merge  bool
+}
+
+// templateSheet 一个工作表的重复区域，first 为 0 表示没有重复区域
+type templateSheet struct {
+	name        string
+	first, last int
+	cells       []templateCell
+}
+
+// Template 解析后的台账模板
+type Template struct {
+	data   []byte
+	sheets []templateSheet
+}
+
+// ParseTemplate 解析模板并检查占位符：列标题须在 columns 中，其余名称须在 vars 中
+func ParseTemplate(data []byte, columns []string, vars []string) (*Template, error) {
+	f, err := openTemplate(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无法读取 xlsx: %v", ErrInvalidTemplate, err)
+	}
+	defer f.Close()
+	t := &Template{data: data}
+	found := false
+	for _, sheet := range f.GetSheetList() {
+		ts, n, err := parseSheet(f, sheet, columns, vars)
+		if err != nil {
+			return nil, err
+		}
+		found = found || n > 0
+		t.sheets = append(t.sheets, ts)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: 模板中没有占位符", ErrInvalidTemplate)
+	}
+	return t, nil
+}
+
+func parseSheet(f *excelize.File, sheet string, columns, vars []string) (templateSheet, int, error) {
+	ts := templateSheet{name: sheet}
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return ts, 0, fmt.Errorf("%w: 读取工作表 %s 失败: %v", ErrInvalidTemplate, sheet, err)
+	}
+	count := 0
+	for i, row := range rows {
+		rowNum := i + 1
+		for j, text := range row {
+			matches := placeholderPattern.FindAllStringSubmatch(text, -1)
+			if len(matches) == 0 {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(j+1, rowNum)
+			isRow := false
+			var list []placeholder
+			for _, m := range matches {
+				p := placeholder{name: m[1], merge: m[2] == "merge"}
+				if m[2] != "" && !p.merge {
+					return ts, 0, fmt.Errorf("%w: %s!%s 不支持的选项 %s", ErrInvalidTemplate, sheet, cell, m[2])
+				}
+				switch {
+				case strings.HasPrefix(p.name, "row."):
+					isRow = true
+					if col := strings.TrimPrefix(p.name, "row."); col != "#" && !slices.Contains(columns, col) {
+						return ts, 0, fmt.Errorf("%w: %s!%s 台账中没有列 %s", ErrInvalidTemplate, sheet, cell, col)
+					}
+				case strings.HasPrefix(p.name, "sum."):
+					if col := strings.TrimPrefix(p.name, "sum."); !slices.Contains(columns, col) {
+						return ts, 0, fmt.Errorf("%w: %s!%s 台账中没有列 %s", ErrInvalidTemplate, sheet, cell, col)
+					}
+				case !slices.Contains(vars, p.name):
+					return ts, 0, fmt.Errorf("%w: %s!%s 未知的占位符 %s", ErrInvalidTemplate, sheet, cell, p.name)
+				}
+				if p.merge && !strings.HasPrefix(p.name, "row.") {
+					return ts, 0, fmt.Errorf("%w: %s!%s 只有数据行占位符可以合并", ErrInvalidTemplate, sheet, cell)
+				}
+				list = append(list, p)
+			}
+			count += len(list)
+			if !isRow {
+				continue
+			}
+			switch {
+			case ts.first == 0:
+				ts.first, ts.last = rowNum, rowNum
+			case rowNum == ts.last+1:
+				ts.last = rowNum
+			case rowNum > ts.last:
+				return ts, 0, fmt.Errorf("%w: 工作表 %s 只能有一个连续的重复区域（第 %d 行）", ErrInvalidTemplate, sheet, rowNum)
+			}
+			tc := templateCell{col: j + 1, row: rowNum - ts.first, text: text}
+			if len(list) == 1 && strings.TrimSpace(text) == matches[0][0] {
+				tc.single = &list[0]
+			}
+			for _, p := range list {
+				tc.merge = tc.merge || p.merge
+			}
+			if tc.merge && tc.single == nil {
+				return ts, 0, fmt.Errorf("%w: %s!%s 合并的单元格只能包含一个占位符", ErrInvalidTemplate, sheet, cell)
+			}
+			ts.cells = append(ts.cells, tc)
+		}
+	}
+	if ts.first > 0 && ts.last > ts.first {
+		for _, c := range ts.cells {
+			if c.merge {
+				return ts, 0, fmt.Errorf("%w: 工作表 %s 的重复区域有多行，不能使用 merge", ErrInvalidTemplate, sheet)
+			}
+		}
+	}
+	return ts, count, nil
+}
+
+// Execute 用表 t 及变量 vars 填充模板，写入 w。extras 的说明行追加在当前工作表已有内容之后
+func (tpl *Template) Execute(w io.Writer, t Table, vars map[string]any, extras *Extras) error {
+	f, err := openTemplate(tpl.data)
+	if err != nil {
+		return fmt.Errorf("读取台账模板失败: %w", err)
+	}
+	defer f.Close()
+	v := &templateValues{table: t, vars: vars, extras: extras}
+	for _, ts := range tpl.sheets {
+		// 先替换重复区域以外的占位符，数据中的文本不会被当作占位符
+		if err := ts.replace(f, v); err != nil {
+			return fmt.Errorf("填充台账模板失败: %w", err)
+		}
+		if err := ts.expand(f, v); err != nil {
+			return fmt.Errorf("填充台账模板失败: %w", err)
+		}
+	}
+	if extras != nil {
+		sheet := f.GetSheetName(f.GetActiveSheetIndex())
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return fmt.Errorf("填充台账模板失败: %w", err)
+		}
+		if err := extras.Finish(f, sheet, nil, len(rows)+1); err != nil {
+			return err
+		}
+	}
+	// 台账内容变化后由 Excel 重新计算模板中的公式
+	if err := f.UpdateLinkedValue(); err != nil {
+		return fmt.Errorf("填充台账模板失败: %w", err)
+	}
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("写入台账失败: %w", err)
+	}
+	return nil
+}
+
+// expand 复制重复区域并填充数据行
+func (ts templateSheet) expand(f *excelize.File, v *templateValues) error {
+	if ts.first == 0 {
+		return nil
+	}
+	height := ts.last - ts.first + 1
+	n := len(v.table.Rows)
+	if n == 0 {
+		for i := 0; i < height; i++ {
+			if err := f.RemoveRow(ts.name, ts.first); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var region templateRegion
+	if n > 1 {
+		// 一次插入全部副本所需的行，再逐行复制格式，避免逐行插入时反复移动其后的行
+		var err error
+		if region, err = ts.copyRegion(f); err != nil {
+			return err
+		}
+		if err := f.InsertRows(ts.name, ts.last+1, (n-1)*height); err != nil {
+			return err
+		}
+		for k := 1; k < n; k++ {
+			if err := region.paste(f, ts.name, k*height); err != nil {
+				return err
+			}
+		}
+	}
+	for k := 0; k < n; k++ {
+		for _, c := range ts.cells {
+			cell, _ := excelize.CoordinatesToCellName(c.col, ts.first+k*height+c.row)
+			value, err := v.fill(c.text, c.single, k)
+			if err != nil {
+				return fmt.Errorf("%s!%s: %w", ts.name, cell, err)
+			}
+			if err := f.SetCellValue(ts.name, cell, value); err != nil {
+				return err
+			}
+		}
+		v.extras.Report(k+1, n)
+	}
+	// 合并放在填充之后：excelize 每次读写单元格都会遍历全部合并区域
+	for k := 1; k < n; k++ {
+		if err := region.merge(f, ts.name, k*height); err != nil {
+			return err
+		}
+	}
+	return ts.mergeRuns(f, v)
+}
+
+// regionRow 重复区域一行的格式
+type regionRow struct {
+	row    int
+	height float64 // 0 表示使用默认行高
+	cells  []regionCell
+	merges [][2]int // 行内横向合并的起止列
+}
+
+// regionCell 重复区域中的单元格，占位符之外的常量及公式原样复制
+type regionCell struct {
+	col     int
+	style   int
+	value   any
+	formula string
+}
+
+type templateRegion []regionRow
+
+// copyRegion 读取重复区域各行的行高、单元格样式、常量、公式及横向合并
+func (ts templateSheet) copyRegion(f *excelize.File) (templateRegion, error) {
+	// 复制到工作表范围、区域内的最后一个有值单元格及合并区域中最靠右的一列
+	lastCol := 1
+	if dim, err := f.GetSheetDimension(ts.name); err == nil && dim != "" {
+		if col, _, err := excelize.CellNameToCoordinates(dim[strings.LastIndex(dim, ":")+1:]); err == nil {
+			lastCol = col
+		}
+	}
+	rows, err := f.GetRows(ts.name, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+	for r := ts.first; r <= ts.last && r <= len(rows); r++ {
+		lastCol = max(lastCol, len(rows[r-1]))
+	}
+	// Excel 未设置默认行高时为 15 磅
+	defaultHeight := 15.0
+	if props, err := f.GetSheetProps(ts.name); err == nil && props.DefaultRowHeight != nil {
+		defaultHeight = *props.DefaultRowHeight
+	}
+	merged, err := f.GetMergeCells(ts.name)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range merged {
+		if col, _, err := excelize.CellNameToCoordinates(m.GetEndAxis()); err == nil {
+			lastCol = max(lastCol, col)
+		}
+	}
+	region := make(templateRegion, 0, ts.last-ts.first+1)
+	for r := ts.first; r <= ts.last; r++ {
+		rr := regionRow{row: r}
+		if h, err := f.GetRowHeight(ts.name, r); err == nil && h != defaultHeight {
+			rr.height = h
+		}
+		for col := 1; col <= lastCol; col++ {
+			if slices.ContainsFunc(ts.cells, func(c templateCell) bool { return c.col == col && ts.first+c.row == r }) {
+				style, _ := f.GetCellStyle(ts.name, mustCellName(col, r))
+				rr.cells = append(rr.cells, regionCell{col: col, style: style})
+				continue
+			}
+			cell, err := copyCell(f, ts.name, col, r)
+			if err != nil {
+				return nil, err
+			}
+			if cell.style != 0 || cell.value != nil || cell.formula != "" {
+				rr.cells = append(rr.cells, cell)
+			}
+		}
+		for _, m := range merged {
+			from, to := m.GetStartAxis(), m.GetEndAxis()
+			c1, r1, _ := excelize.CellNameToCoordinates(from)
+			c2, r2, _ := excelize.CellNameToCoordinates(to)
+			if r1 == r && r2 == r {
+				rr.merges = append(rr.merges, [2]int{c1, c2})
+			}
+		}
+		region = append(region, rr)
+	}
+	return region, nil
+}
+
+func copyCell(f *excelize.File, sheet string, col, row int) (regionCell, error) {
+	cell := mustCellName(col, row)
+	c := regionCell{col: col}
+	var err error
+	if c.style, err = f.GetCellStyle(sheet, cell); err != nil {
+		return c, err
+	}
+	if c.formula, err = f.GetCellFormula(sheet, cell); err != nil || c.formula != "" {
+		return c, err
+	}
+	raw, err := f.GetCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+	if err != nil || raw == "" {
+		return c, err
+	}
+	c.value = raw
+	if typ, _ := f.GetCellType(sheet, cell); typ == excelize.CellTypeNumber || typ == excelize.CellTypeUnset {
+		if n, err := strconv.ParseFloat(raw, 64); err == nil {
+			c.value = n
+		}
+	}
+	return c, nil
+}
+
+// paste 把重复区域的行高、样式、常量及公式复制到下移 offset 行的位置
+func (region templateRegion) paste(f *excelize.File, sheet string, offset int) error {
+	for _, rr := range region {
+		row := rr.row + offset
+		if rr.height > 0 {
+			if err := f.SetRowHeight(sheet, row, rr.height); err != nil {
+				return err
+			}
+		}
+		for _, c := range rr.cells {
+			cell := mustCellName(c.col, row)
+			if c.style != 0 {
+				if err := f.SetCellStyle(sheet, cell, cell, c.style); err != nil {
+					return err
+				}
+			}
+			var err error
+			switch {
+			case c.formula != "":
+				err = f.SetCellFormula(sheet, cell, shiftFormulaRows(c.formula, offset))
+			case c.value != nil:
+				err = f.SetCellValue(sheet, cell, c.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// merge 把重复区域的横向合并复制到下移 offset 行的位置
+func (region templateRegion) merge(f *excelize.File, sheet string, offset int) error {
+	for _, rr := range region {
+		row := rr.row + offset
+		for _, m := range rr.merges {
+			if err := f.MergeCell(sheet, mustCellName(m[0], row), mustCellName(m[1], row)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var cellRefPattern = regexp.MustCompile(`(^|[^A-Za-z0-9_.$])(\$?[A-Z]{1,3})(\$?)([0-9]+)`)
+
+// shiftFormulaRows 公式中的相对行引用下移 offset 行，绝对行引用及双引号内的文本不变
+func shiftFormulaRows(formula string, offset int) string {
+	parts := strings.Split(formula, `"`)
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = cellRefPattern.ReplaceAllStringFunc(parts[i], func(m string) string {
+			s := cellRefPattern.FindStringSubmatch(m)
+			if s[3] == "$" {
+				return m
+			}
+			row, _ := strconv.Atoi(s[4])
+			return s[1] + s[2] + strconv.Itoa(row+offset)
+		})
+	}
+	return strings.Join(parts, `"`)
+}
+
+func mustCellName(col, row int) string {
+	cell, _ := excelize.CoordinatesToCellName(col, row)
+	return cell
+}
+
+// mergeRuns 纵向合并标记 merge 的列，左侧合并列取值变化时重新开始
+func (ts templateSheet) mergeRuns(f *excelize.File, v *templateValues) error {
+	var cols []templateCell
+	for _, c := range ts.cells {
+		if c.merge {
+			cols = append(cols, c)
+		}
+	}
+	slices.SortFunc(cols, func(a, b templateCell) int { return a.col - b.col })
+	for ci, c := range cols {
+		key := func(k int) string {
+			parts := make([]string, ci+1)
+			for i := 0; i <= ci; i++ {
+				value, _ := v.row(cols[i].single.name, k)
+				parts[i] = Text(value)
+			}
+			return strings.Join(parts, "\x00")
+		}
+		start := 0
+		for k := 1; k <= len(v.table.Rows); k++ {
+			if k < len(v.table.Rows) && key(k) == key(start) {
+				continue
+			}
+			if k-1 > start {
+				from, _ := excelize.CoordinatesToCellName(c.col, ts.first+start)
+				to, _ := excelize.CoordinatesToCellName(c.col, ts.first+k-1)
+				if err := f.MergeCell(ts.name, from, to); err != nil {
+					return err
+				}
+			}
+			start = k
+		}
+	}
+	return nil
+}
+
+// replace 替换重复区域以外的占位符
+func (ts templateSheet) replace(f *excelize.File, v *templateValues) error {
+	rows, err := f.GetRows(ts.name, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if ts.first > 0 && i+1 >= ts.first && i+1 <= ts.last {
+			continue
+		}
+		for j, text := range row {
+			matches := placeholderPattern.FindAllStringSubmatch(text, -1)
+			if len(matches) == 0 {
+				continue
+			}
+			var single *placeholder
+			if len(matches) == 1 && strings.TrimSpace(text) == matches[0][0] {
+				single = &placeholder{name: matches[0][1]}
+			}
+			value, err := v.fill(text, single, -1)
+			cell, _ := excelize.CoordinatesToCellName(j+1, i+1)
+			if err != nil {
+				return fmt.Errorf("%s!%s: %w", ts.name, cell, err)
+			}
+			if err := f.SetCellValue(ts.name, cell, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type templateValues struct {
+	table  Table
+	vars   map[string]any
+	extras *Extras
+}
+
+// fill 单元格填充后的值，k 为数据行序号，-1 表示不在重复区域
+func (v *templateValues) fill(text string, single *placeholder, k int) (any, error) {
+	if single != nil {
+		return v.value(single.name, k)
+	}
+	var err error
+	out := placeholderPattern.ReplaceAllStringFunc(text, func(m string) string {
+		name := placeholderPattern.FindStringSubmatch(m)[1]
+		value, e := v.value(name, k)
+		if e != nil && err == nil {
+			err = e
+		}
+		return Text(value)
+	})
+	return out, err
+}
+
+func (v *templateValues) value(name string, k int) (any, error) {
+	switch {
+	case strings.HasPrefix(name, "row."):
+		if k < 0 {
+			return nil, fmt.Errorf("占位符 %s 只能用在重复区域", name)
+		}
+		return v.row(name, k)
+	case strings.HasPrefix(name, "sum."):
+		idx := slices.Index(v.table.Columns, strings.TrimPrefix(name, "sum."))
+		if idx < 0 {
+			return nil, fmt.Errorf("台账中没有列 %s", strings.TrimPrefix(name, "sum."))
+		}
+		sum := 0.0
+		for _, r := range v.table.Rows {
+			if idx < len(r) {
+				sum += number(r[idx])
+			}
+		}
+		return sum, nil
+	}
+	if value, ok := v.vars[name]; ok {
+		return value, nil
+	}
+	return nil, fmt.Errorf("未知的占位符 %s", name)
+}
+
+func (v *templateValues) row(name string, k int) (any, error) {
+	col := strings.TrimPrefix(name, "row.")
+	if col == "#" {
+		return k + 1, nil
+	}
+	idx := slices.Index(v.table.Columns, col)
+	if idx < 0 {
+		return nil, fmt.Errorf("台账中没有列 %s", col)
+	}
+	if idx >= len(v.table.Rows[k]) {
+		return nil, nil
+	}
+	return v.table.Rows[k][idx], nil
+}
+
+// number 数值单元格的值，非数值为 0
+func number(v any) float64 {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case string:
+		n, _ := strconv.ParseFloat(v, 64)
+		return n
+	}
+	return 0
+}
@@ -1,9 +1,14 @@
 package gpu
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"monitor/internal/client"
+	"monitor/internal/service/datasource"
 	"monitor/internal/types"
 	"monitor/util"
+	"time"
 )
 
 type ClusterHandler struct {
@@ -56,3 +61,34 @@ func getMapInfoCluster(result *types.VectorResponse) map[string]int {
 	}
 	return infoMap
 }
+
+// GetClusterNames 从最近 5 分钟的 kpanda_gpu_count 标签中获取集群 ID 与名称，
+// 并补充数据源配置中指定的集群（如没有 kpanda 指标的边缘集群）
+func GetClusterNames(ctx context.Context) []types.NameList {
+	sources := datasource.Default()
+	now := time.Now()
+	nMap := make(map[string]string)
+	for _, c := range sources.ConfiguredClusters() {
+		nMap[c.Cluster] = c.ClusterName
+	}
+	result, err := sources.QueryRange(ctx, "kpanda_gpu_count", client.Range{Start: now.Add(-5 * time.Minute), End: now})
+	if err != nil {
+		log.Println(err)
+		result = &types.VectorResponse{}
+	}
+
+	for i := range result.Matrix {
+		clustername := result.Matrix[i].Metric.ClusterName + result.Matrix[i].Metric.Cluster_Name
+		cluster := result.Matrix[i].Metric.Cluster
+		nMap[cluster] = clustername
+	}
+
+	nameList := make([]types.NameList, 0)
+	for k, v := range nMap {
+		nameList = append(nameList, types.NameList{
+			Cluster:     k,
+			ClusterName: v,
+		})
+	}
+	return nameList
+}
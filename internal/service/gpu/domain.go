@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"monitor/config"
 	"monitor/internal/client"
+	"monitor/internal/service/datasource"
 	"monitor/internal/types"
-	"strconv"
 	"strings"
+	"time"
 )
 
 func NewQueryGrafana(from, to int64, ctx context.Context, baseUrl string) QueryGrafanaInfoRepo {
@@ -25,6 +26,7 @@ func NewQueryGrafana(from, to int64, ctx context.Context, baseUrl string) QueryG
 		Header: headers,
 		Rule:   modelFP,
 		Ctx:    ctx,
+		source: datasource.Default(),
 	}
 }
 
@@ -40,6 +42,10 @@ type QueryGrafana struct {
 	ClusterId string `json:"cluster_id"`
 	NodeId    string `json:"node_id"`
 	ModeStr   string `json:"mode_str"`
+	// 区间查询步长，0 使用默认值
+	Step time.Duration `json:"step"`
+
+	source datasource.Querier
 }
 
 type ClusterInfo struct {
@@ -300,24 +306,20 @@ func (q *QueryGrafana) CalClusterDetailPValueByModel(clusterId string, modeStr s
 	return Pvalue, nil
 }
 
+// Getinfo 查询失败时也返回空结果，调用方可直接遍历
 func (q *QueryGrafana) Getinfo(expr string) (*types.VectorResponse, error) {
-	query := config.NewQueryConfig()
-	queryStr := query.BuildGrafanaQueryRange(expr, strconv.FormatInt(q.From, 10), strconv.FormatInt(q.To, 10))
-	client := client.NewDCEClient(q.Ctx, q.Url, query.InsecureSkipVerify)
-	result, err := client.MakeGetReqRange(queryStr, "/apis/insight.io/v1alpha1/metric/queryrange")
+	result, err := q.Getinforange(expr)
 	if err != nil {
-		fmt.Println(err)
+		return &types.VectorResponse{}, err
 	}
-
-	return result, err
+	return result, nil
 }
 func (q *QueryGrafana) Getinforange(expr string) (*types.VectorResponse, error) {
-	query := config.NewQueryConfig()
-	f := strconv.Itoa(int(q.From))
-	t := strconv.Itoa(int(q.To))
-	queryRange := query.BuildGrafanaQueryRange(expr, f, t)
-	client := client.NewDCEClient(q.Ctx, q.Url, query.InsecureSkipVerify)
-	result, err := client.MakeGetReqRange(queryRange, "/apis/insight.io/v1alpha1/metric/queryrange")
+	start, end := unixTime(q.From), unixTime(q.To)
+	if end.Before(start) {
+		end = start
+	}
+	result, err := q.source.QueryRange(q.Ctx, expr, client.Range{Start: start, End: end, Step: q.Step})
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
@@ -326,6 +328,22 @@ func (q *QueryGrafana) Getinforange(expr string) (*types.VectorResponse, error)
 	return result, err
 }
 
+func (q *QueryGrafana) SetStep(step time.Duration) {
+	q.Step = step
+}
+
+// unixTime 兼容秒级与毫秒级时间戳，0 表示当前时间
+func unixTime(v int64) time.Time {
+	switch {
+	case v <= 0:
+		return time.Now()
+	case v > 1e12:
+		return time.UnixMilli(v)
+	default:
+		return time.Unix(v, 0)
+	}
+}
+
 func (q *QueryGrafana) SetClusterName(names []types.NameList) {
 	q.ClusterName = names
 }
@@ -105,6 +105,41 @@ func (q *QueryExpr) GetTotalAscendPvalue(ctx context.Context, from, to int64) (m
 	return infoMap, nil
 }
 
+// GetTotalPvalueByCluster 按集群统计各型号 GPU、NPU 的节点数、卡数及算力，返回 [集群ID][型号]
+func (q *QueryExpr) GetTotalPvalueByCluster(ctx context.Context, from, to int64) (map[string]map[string]*PvalueDetailResp, error) {
+	client := NewQueryGrafana(from, to, ctx, config.GetGrafanaQueryConfig().ClusterBaseURL)
+	ruleMap := client.GetRule()
+	infoMap := make(map[string]map[string]*PvalueDetailResp)
+	for _, expr := range []string{q.makeExprClusterCoreGPU(), q.makeExprClusterCoreNPU()} {
+		result, err := client.Getinfo(expr)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if result == nil {
+			continue
+		}
+		// 每条序列为一个节点上某型号的卡数
+		for i := range result.Matrix {
+			metric := result.Matrix[i].Metric
+			label := metric.ModelName + metric.Model_Name
+			data := util.ExtractValues(result.Matrix[i].Values)
+			cards, _ := util.CalculateMedian(data)
+			if infoMap[metric.Cluster] == nil {
+				infoMap[metric.Cluster] = make(map[string]*PvalueDetailResp)
+			}
+			if _, exists := infoMap[metric.Cluster][label]; !exists {
+				infoMap[metric.Cluster][label] = &PvalueDetailResp{}
+			}
+			info := infoMap[metric.Cluster][label]
+			info.NodesNum++
+			info.Cards += cards
+			info.Pvalue += float64(cards) * ruleMap[label]
+		}
+	}
+	return infoMap, nil
+}
+
 func (q *QueryExpr) Getmodel_node_view(ctx context.Context, fromstamp, tostamp int64) ([]types.ModelNodeViewDetails, error) {
 	client := NewQueryGrafana(fromstamp, tostamp, ctx, config.GetGrafanaQueryConfig().ClusterBaseURL)
 	expr := q.makeExprchip_info_model_core_utilization()
@@ -124,6 +159,7 @@ func (q *QueryExpr) Getmodel_node_view(ctx context.Context, fromstamp, tostamp i
 		data := util.ExtractValues(result.Matrix[i].Values)
 		mediaData, _ := util.CalculateMedian(data)
 
+		model_view_detail.Cluster = result.Matrix[i].Metric.Cluster
 		model_view_detail.Label_llm_model = modelName
 		model_view_detail.Node = node
 		model_view_detail.Resource = resource
@@ -219,6 +255,14 @@ func (q *QueryExpr) makeExprTotalCoreGPU() string {
 	return expr
 }
 
+func (q *QueryExpr) makeExprClusterCoreGPU() string {
+	return "count by (cluster, node, modelName)(DCGM_FI_DEV_FB_TOTAL)"
+}
+
+func (q *QueryExpr) makeExprClusterCoreNPU() string {
+	return "count by (cluster, node, model_name)(npu_chip_info_hbm_total_memory)"
+}
+
 func (q *QueryExpr) makeExprTotalCoreNPU() string {
 	expr := fmt.Sprintf("count by (model_name)(npu_chip_info_hbm_total_memory)")
 	return expr
@@ -3,11 +3,8 @@ package gpu
 import (
 	"fmt"
 	"log"
-	"monitor/config"
-	"monitor/internal/client"
 	"monitor/internal/types"
 	"monitor/util"
-	"strconv"
 )
 
 type HandlerNode struct {
@@ -33,13 +30,7 @@ func (q *HandlerNode) getNodesName(clusterID string) []NodeInfo {
 
 func (q *HandlerNode) getNames(qStr string) []NodeInfo {
 
-	query := config.NewQueryConfig()
-	start := strconv.FormatInt(q.query.From, 10)
-	end := strconv.FormatInt(q.query.To, 10)
-	queryStr := query.BuildGrafanaQueryRange(qStr, start, end)
-	client := client.NewDCEClient(q.query.Ctx, q.query.Url, true)
-	result, err := client.MakeGetReqRange(queryStr, "/apis/insight.io/v1alpha1/metric/queryrange")
-
+	result, err := q.query.Getinfo(qStr)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -1,6 +1,9 @@
 package gpu
 
-import "monitor/internal/types"
+import (
+	"monitor/internal/types"
+	"time"
+)
 
 type QueryGrafanaInfoRepo interface {
 	GetClustersMemMap(nvidiaMem, ascendMem map[string]int) (map[string]int, error)
@@ -34,6 +37,7 @@ type QueryGrafanaInfoRepo interface {
 	GetNodesName(clusterID string) ([]NodeInfo, error)
 	Getinforange(expr string) (*types.VectorResponse, error)
 	Getinfo(expr string) (*types.VectorResponse, error)
+	SetStep(step time.Duration)
 
 	SetClusterName(names []types.NameList)
 	SetClusterId(clusterId string)
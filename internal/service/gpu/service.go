@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"monitor/config"
-	"monitor/internal/client"
 	"monitor/internal/models"
 	"monitor/internal/types"
 	"monitor/util"
@@ -32,10 +31,7 @@ func GetClustersNames(ctx context.Context) []ClusterInfo {
 		clusterMap[cluster] = mode
 	}
 
-	c := config.GetGrafanaQueryConfig()
-	client := client.NewDCEClient(ctx, c.ClusterBaseURL, c.InsecureSkipVerify)
-
-	cluNames := client.GetClusterName("/apis/insight.io/v1alpha1/metric/queryrange")
+	cluNames := GetClusterNames(ctx)
 	clustersName := make([]ClusterInfo, 0)
 	for i := range cluNames {
 		clustersName = append(clustersName, ClusterInfo{
@@ -49,9 +45,14 @@ func GetClustersNames(ctx context.Context) []ClusterInfo {
 func GetClustersInfo(ctx context.Context, req models.ClusterListRequest, from_timestamp int64, to_timestamp int64) *types.PagedResponse {
 	baseUrl := config.GetGrafanaQueryConfig().ClusterBaseURL
 	queryClient := NewQueryGrafana(from_timestamp, to_timestamp, ctx, baseUrl)
-	c := config.GetGrafanaQueryConfig()
-	dceclient := client.NewDCEClient(ctx, c.ClusterBaseURL, c.InsecureSkipVerify)
-	cluNames := dceclient.GetClusterName("/apis/insight.io/v1alpha1/metric/queryrange")
+	if req.Step != "" {
+		if step, err := time.ParseDuration(req.Step); err == nil {
+			queryClient.SetStep(step)
+		} else {
+			log.Println("忽略无效的 step:", req.Step)
+		}
+	}
+	cluNames := GetClusterNames(ctx)
 	queryClient.SetClusterName(cluNames)
 
 	var wg sync.WaitGroup
@@ -278,9 +279,7 @@ func GetClusterDetailPValueByModel(ctx context.Context, param models.DetailReque
 
 func GetNodesPvalueDetailByModel(ctx context.Context, param models.DetailRequest, from_timestamp, to_timestamp int64, baseUrl string, modeStr string) []models.ModelPvalueResponse {
 	queryClient := NewQueryGrafana(from_timestamp, to_timestamp, ctx, baseUrl)
-	c := config.GetGrafanaQueryConfig()
-	client := client.NewDCEClient(ctx, c.ClusterBaseURL, c.InsecureSkipVerify)
-	cluNames := client.GetClusterName("/apis/insight.io/v1alpha1/metric/queryrange")
+	cluNames := GetClusterNames(ctx)
 	queryClient.SetClusterName(cluNames)
 	pvalueMap, err := queryClient.CalNodesPvalueDetailByModel(param.Cluster, param.Node, modeStr)
 
@@ -301,9 +300,7 @@ func GetNodesPvalueDetailByModel(ctx context.Context, param models.DetailRequest
 
 func GetNodesDetailByModel(ctx context.Context, param models.DetailRequest, from_timestamp, to_timestamp int64, baseUrl string) models.NodeDetailResponse {
 	queryClient := NewQueryGrafana(from_timestamp, to_timestamp, ctx, baseUrl)
-	c := config.GetGrafanaQueryConfig()
-	client := client.NewDCEClient(ctx, c.ClusterBaseURL, c.InsecureSkipVerify)
-	cluNames := client.GetClusterName("/apis/insight.io/v1alpha1/metric/queryrange")
+	cluNames := GetClusterNames(ctx)
 	queryClient.SetClusterName(cluNames)
 
 	res, err := queryClient.GetNodeUsedDetailByNode(param.Cluster, param.Node)
@@ -1,45 +1,61 @@
 package grafana
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"monitor/internal/models"
+	"monitor/internal/upstream"
 	"net/url"
 
 	grafana "github.com/grafana/grafana-api-golang-client"
 )
 
+var (
+	ErrDashboardNotFound = errors.New("grafana 看板不存在")
+	ErrPanelNotFound     = errors.New("grafana 看板中没有指定面板")
+	ErrNoMappings        = errors.New("grafana 面板未配置值映射")
+)
+
 type GrafanaClient struct {
 	client *grafana.Client
 }
 
-func NewGrafanaClient(grafanaUrl, username, password, apikey string) *GrafanaClient {
-
-	// 创建客户端
-	client := &grafana.Client{}
-	var err error
-	if username != "" && password != "" {
-		userInfo := url.UserPassword(username, password)
-		client, err = grafana.New(grafanaUrl, grafana.Config{
-			BasicAuth: userInfo,
-		})
-	}
+// NewGrafanaClient 优先使用 apikey，其次用户名密码，都未配置时匿名访问
+func NewGrafanaClient(grafanaUrl, username, password, apikey string) (*GrafanaClient, error) {
+	cfg := grafana.Config{}
 	if apikey != "" {
-		// fmt.Println("use grafana api key")
-		client, err = grafana.New(grafanaUrl, grafana.Config{
-			APIKey: apikey,
-		})
+		cfg.APIKey = apikey
+	} else if username != "" && password != "" {
+		cfg.BasicAuth = url.UserPassword(username, password)
 	}
+	client, err := grafana.New(grafanaUrl, cfg)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("grafana 地址 %s 无效: %w", grafanaUrl, err)
 	}
-	return &GrafanaClient{client: client}
+	return &GrafanaClient{client: client}, nil
+}
+
+// GetPanelMapping 读取看板中指定面板的值映射（值 -> 场景），经 grafana 上游的限流与熔断
+func (c *GrafanaClient) GetPanelMapping(ctx context.Context, uid string, title string) (map[string]models.Item, error) {
+	var mapping map[string]models.Item
+	err := upstream.Get(upstream.Grafana).Do(ctx, func(context.Context) error {
+		var err error
+		mapping, err = c.getPanelMapping(uid, title)
+		return err
+	})
+	return mapping, err
 }
 
-func (c *GrafanaClient) GetPanelMapping(uid string, title string) (map[string]models.Item, error) {
+func (c *GrafanaClient) getPanelMapping(uid string, title string) (map[string]models.Item, error) {
 	dashboard, err := c.client.DashboardByUID(uid)
 	if err != nil {
-		panic(err)
+		var notFound grafana.ErrNotFound
+		if errors.As(err, &notFound) {
+			return nil, &notFoundError{err: fmt.Errorf("%w: %s", ErrDashboardNotFound, uid)}
+		}
+		return nil, fmt.Errorf("读取 grafana 看板 %s 失败: %w", uid, err)
 	}
 	panelsBytes, err := json.Marshal(dashboard.Model["panels"])
 	if err != nil {
@@ -48,18 +64,25 @@ func (c *GrafanaClient) GetPanelMapping(uid string, title string) (map[string]mo
 	panels := make([]models.Panel, 0)
 	err = json.Unmarshal(panelsBytes, &panels)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("解析 grafana 看板 %s 失败: %w", uid, err)
 	}
 	for _, panel := range panels {
 		if panel.Title != title {
 			continue
 		}
 		if len(panel.FieldConfig.Defaults.Mappings) == 0 {
-			err := errors.New("no mappings")
-			panic(err)
+			return nil, &notFoundError{err: fmt.Errorf("%w: %s", ErrNoMappings, title)}
 		}
 		return panel.FieldConfig.Defaults.Mappings[0].Options, nil
-
 	}
-	return nil, nil
+	return nil, &notFoundError{err: fmt.Errorf("%w: %s", ErrPanelNotFound, title)}
 }
+
+// 看板配置问题，与 Grafana 是否可用无关，不计入熔断
+type notFoundError struct {
+	err error
+}
+
+func (e *notFoundError) Error() string     { return e.err.Error() }
+func (e *notFoundError) Unwrap() error     { return e.err }
+func (e *notFoundError) ClientError() bool { return true }
@@ -0,0 +1,326 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"monitor/config"
+	"monitor/internal/service/dao"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// 任务状态
+const (
+	StatusQueued    = dao.JobStatusQueued
+	StatusRunning   = dao.JobStatusRunning
+	StatusSucceeded = dao.JobStatusSucceeded
+	StatusFailed    = dao.JobStatusFailed
+)
+
+// 生成阶段，Progress 为进入该阶段时的进度
+const (
+	StageQueued    = "queued"
+	StageRendering = "rendering"
+	StageSaving    = "saving"
+	StageDone      = "done"
+)
+
+// queueSize 等待生成的任务上限
+const queueSize = 100
+
+// leaseDuration 任务租约的有效期，执行实例每隔 leaseDuration/4 续约一次，超过有效期未续约的任务视为中断
+const leaseDuration = 2 * time.Minute
+
+// interruptedReason 执行实例停止（重启、下线）后未结束的任务记录的失败原因
+const interruptedReason = "服务重启，任务中断，请重新生成"
+
+var (
+	ErrJobNotFound = dao.ErrJobNotFound
+	ErrQueueFull   = errors.New("too many ledger jobs queued")
+)
+
+// Reporter 报告生成阶段及进度
+type Reporter func(stage string, progress int)
+
+// Func 生成台账并保存，返回保存的文件
+type Func func(ctx context.Context, report Reporter) (*dao.Artifact, error)
+
+type task struct {
+	id  string
+	run Func
+}
+
+// Manager 后台生成台账：任务记录保存在数据库，提交的任务在本实例内存中排队，按配置的并发数生成，
+// 结束后 POST 通知配置的地址；已结束的任务保留一段时间供查询。
+// 多个实例共用任务表，每个实例定时为自己的未结束任务续约；实例停止后其任务无法继续，
+// 租约过期后由任一实例记为失败并通知，已生成的文件仍可在台账文件中查到
+type Manager struct {
+	dao      dao.IJobDao
+	instance string     // 本实例标识，主机名加启动时生成的随机数
+	mu       sync.Mutex // 保证检查队列容量与入队之间不被其他提交插入
+	queue    chan task
+	workers  int
+	keep     time.Duration
+	lease    time.Duration
+	webhook  string
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewManager(jobDao dao.IJobDao, workers int, keep time.Duration, webhook string) *Manager {
+	return &Manager{
+		dao:      jobDao,
+		instance: newInstanceID(),
+		queue:    make(chan task, queueSize),
+		workers:  workers,
+		keep:     keep,
+		lease:    leaseDuration,
+		webhook:  webhook,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		now:      time.Now,
+	}
+}
+
+// newInstanceID 主机名加随机数，同一主机重启后也不相同
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultManager *Manager
+	defaultErr     error
+)
+
+// Default 按配置创建的全局任务管理器，数据库未连接时返回错误
+func Default() (*Manager, error) {
+	defaultOnce.Do(func() {
+		if dao.GetDB() == nil {
+			defaultErr = errors.New("台账后台任务不可用：未连接数据库")
+			return
+		}
+		cfg := config.GetArtifactConfig().Jobs
+		defaultManager = NewManager(dao.NewJobDao(nil), cfg.Workers, cfg.KeepFor, cfg.Webhook)
+	})
+	return defaultManager, defaultErr
+}
+
+// Submit 提交任务，spec 提供任务的台账类型、名称、格式、行数及生成人
+func (m *Manager) Submit(spec dao.LedgerJob, run Func) (*dao.LedgerJob, error) {
+	j := spec
+	j.ID = 0
+	j.JobID = dao.NewUUID()
+	j.Status = StatusQueued
+	j.Stage = StageQueued
+	j.Progress = 0
+	j.Instance = m.instance
+	j.CreateTime = m.now()
+	j.LeaseTime = &j.CreateTime
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.queue) == cap(m.queue) {
+		return nil, ErrQueueFull
+	}
+	if err := m.dao.CreateJob(&j); err != nil {
+		return nil, err
+	}
+	m.queue <- task{id: j.JobID, run: run}
+	return &j, nil
+}
+
+// Get 按ID查询任务
+func (m *Manager) Get(id string) (*dao.LedgerJob, error) {
+	return m.dao.GetJob(id)
+}
+
+// List 分页查询任务，creator 为空时返回全部任务，按提交时间倒序
+func (m *Manager) List(creator string, page, pageSize int) ([]dao.LedgerJob, int64, error) {
+	return m.dao.ListJobs(creator, page, pageSize)
+}
+
+// Start 启动生成任务的协程，定时续约本实例的任务并将租约过期的任务记为失败，
+// 定时清理已结束超过保留时间的任务
+func (m *Manager) Start(ctx context.Context) {
+	m.reap(ctx)
+	for range m.workers {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case t := <-m.queue:
+					m.execute(ctx, t)
+				}
+			}
+		}()
+	}
+	go func() {
+		ticker := time.NewTicker(m.lease / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.dao.RenewJobs(m.instance, m.now()); err != nil {
+					log.Println(err)
+				}
+				m.reap(ctx)
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.expire()
+			}
+		}
+	}()
+}
+
+// reap 将租约过期的任务记为失败并通知，多个实例同时处理时只有更新成功的实例通知
+func (m *Manager) reap(ctx context.Context) {
+	stale, err := m.dao.ListStaleJobs(m.now().Add(-m.lease))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, j := range stale {
+		fields := map[string]any{"status": StatusFailed, "error": interruptedReason, "finish_time": m.now()}
+		updated, err := m.dao.UpdateJob(j.JobID, fields)
+		if err != nil {
+			log.Printf("台账任务 %s: %v", j.JobID, err)
+			continue
+		}
+		if !updated {
+			continue
+		}
+		log.Printf("台账任务 %s 因实例 %s 停止而中断", j.JobID, j.Instance)
+		m.finish(ctx, j.JobID)
+	}
+}
+
+func (m *Manager) execute(ctx context.Context, t task) {
+	// 排队期间本实例未能按时续约，任务已被记为失败
+	if !m.update(t.id, map[string]any{"status": StatusRunning, "start_time": m.now()}) {
+		return
+	}
+	saved, err := m.run(ctx, t)
+	fields := map[string]any{"finish_time": m.now()}
+	if err != nil {
+		log.Printf("后台生成台账任务 %s 失败: %v", t.id, err)
+		fields["status"] = StatusFailed
+		fields["error"] = err.Error()
+	} else {
+		fields["status"] = StatusSucceeded
+		fields["stage"] = StageDone
+		fields["progress"] = 100
+		fields["artifact_id"] = saved.ArtifactID
+		fields["size"] = saved.Size
+		fields["checksum"] = saved.Checksum
+	}
+	if !m.update(t.id, fields) {
+		log.Printf("台账任务 %s 已被记为失败，不再更新生成结果", t.id)
+		return
+	}
+	m.finish(ctx, t.id)
+}
+
+// finish 通知任务结束
+func (m *Manager) finish(ctx context.Context, id string) {
+	if j, err := m.Get(id); err == nil {
+		m.notify(ctx, j)
+	} else {
+		log.Printf("台账任务 %s 通知失败: %v", id, err)
+	}
+}
+
+// run 执行生成，生成过程中 panic 时任务记为失败。进度只增不减，阶段或进度变化时才写入数据库
+func (m *Manager) run(ctx context.Context, t task) (saved *dao.Artifact, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("生成台账异常: %v", r)
+		}
+	}()
+	stage, progress := StageQueued, 0
+	saved, err = t.run(ctx, func(s string, p int) {
+		p = min(max(p, progress), 99)
+		if s == stage && p == progress {
+			return
+		}
+		stage, progress = s, p
+		m.update(t.id, map[string]any{"stage": s, "progress": p})
+	})
+	if err == nil && saved == nil {
+		err = errors.New("生成台账未返回文件")
+	}
+	return saved, err
+}
+
+// update 更新未结束的任务，任务已结束时返回 false；更新出错时按未结束处理，数据库短暂不可用时不中断生成
+func (m *Manager) update(id string, fields map[string]any) bool {
+	updated, err := m.dao.UpdateJob(id, fields)
+	if err != nil {
+		log.Printf("台账任务 %s: %v", id, err)
+		return true
+	}
+	return updated
+}
+
+// notify 任务结束后 POST {"event": "ledger.job.succeeded" 或 "ledger.job.failed", "job": 任务} 到配置的地址
+func (m *Manager) notify(ctx context.Context, j *dao.LedgerJob) {
+	if m.webhook == "" {
+		return
+	}
+	body, err := json.Marshal(map[string]any{
+		"event": "ledger.job." + j.Status,
+		"job":   j,
+	})
+	if err != nil {
+		log.Printf("台账任务 %s 通知失败: %v", j.JobID, err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("台账任务 %s 通知失败: %v", j.JobID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		log.Printf("台账任务 %s 通知失败: %v", j.JobID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("台账任务 %s 通知失败: %s", j.JobID, resp.Status)
+	}
+}
+
+// expire 清理已结束超过保留时间的任务
+func (m *Manager) expire() {
+	if n, err := m.dao.DeleteJobsFinishedBefore(m.now().Add(-m.keep)); err != nil {
+		log.Printf("清理过期台账任务失败: %v", err)
+	} else if n > 0 {
+		log.Printf("已清理 %d 个过期台账任务", n)
+	}
+}
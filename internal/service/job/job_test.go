@@ -0,0 +1,340 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"monitor/internal/service/dao"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memJobDao 内存中的任务表，updates 记录每次更新的字段
+type memJobDao struct {
+	mu      sync.Mutex
+	jobs    map[string]dao.LedgerJob
+	updates []map[string]any
+}
+
+func newMemDao() *memJobDao {
+	return &memJobDao{jobs: map[string]dao.LedgerJob{}}
+}
+
+func (m *memJobDao) CreateJob(j *dao.LedgerJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[j.JobID] = *j
+	return nil
+}
+
+func (m *memJobDao) GetJob(id string) (*dao.LedgerJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, dao.ErrJobNotFound
+	}
+	return &j, nil
+}
+
+func (m *memJobDao) ListJobs(creator string, page, pageSize int) ([]dao.LedgerJob, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []dao.LedgerJob
+	for _, j := range m.jobs {
+		if creator == "" || j.Creator == creator {
+			jobs = append(jobs, j)
+		}
+	}
+	slices.SortFunc(jobs, func(a, b dao.LedgerJob) int { return b.CreateTime.Compare(a.CreateTime) })
+	total := int64(len(jobs))
+	start := min((page-1)*pageSize, len(jobs))
+	return jobs[start:min(start+pageSize, len(jobs))], total, nil
+}
+
+func unfinished(j dao.LedgerJob) bool {
+	return j.Status == dao.JobStatusQueued || j.Status == dao.JobStatusRunning
+}
+
+func (m *memJobDao) UpdateJob(id string, fields map[string]any) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok || !unfinished(j) {
+		return false, nil
+	}
+	m.updates = append(m.updates, fields)
+	for k, v := range fields {
+		switch k {
+		case "status":
+			j.Status = v.(string)
+		case "stage":
+			j.Stage = v.(string)
+		case "progress":
+			j.Progress = v.(int)
+		case "artifact_id":
+			j.ArtifactID = v.(string)
+		case "size":
+			j.Size = v.(int64)
+		case "checksum":
+			j.Checksum = v.(string)
+		case "error":
+			j.Error = v.(string)
+		case "start_time":
+			at := v.(time.Time)
+			j.StartTime = &at
+		case "finish_time":
+			at := v.(time.Time)
+			j.FinishTime = &at
+		}
+	}
+	m.jobs[id] = j
+	return true, nil
+}
+
+func (m *memJobDao) RenewJobs(instance string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, j := range m.jobs {
+		if j.Instance == instance && unfinished(j) {
+			j.LeaseTime = &at
+			m.jobs[id] = j
+		}
+	}
+	return nil
+}
+
+func (m *memJobDao) ListStaleJobs(before time.Time) ([]dao.LedgerJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []dao.LedgerJob
+	for _, j := range m.jobs {
+		if unfinished(j) && (j.LeaseTime == nil || j.LeaseTime.Before(before)) {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs, nil
+}
+
+func (m *memJobDao) DeleteJobsFinishedBefore(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for id, j := range m.jobs {
+		if j.FinishTime != nil && j.FinishTime.Before(before) {
+			delete(m.jobs, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestManagerRunsAndNotifies(t *testing.T) {
+	events := make(chan map[string]any, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer srv.Close()
+
+	m := NewManager(newMemDao(), 1, time.Hour, srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	rendering := make(chan struct{})
+	ok, err := m.Submit(dao.LedgerJob{LedgerType: 4, Name: "明细.xlsx", Rows: 30000, Creator: "alice"},
+		func(ctx context.Context, report Reporter) (*dao.Artifact, error) {
+			report(StageRendering, 10)
+			close(rendering)
+			<-release
+			report(StageSaving, 90)
+			return &dao.Artifact{ArtifactID: "a1", Size: 12, Checksum: "c"}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, _ := m.Submit(dao.LedgerJob{LedgerType: 2, Creator: "bob"}, func(context.Context, Reporter) (*dao.Artifact, error) {
+		return nil, errors.New("boom")
+	})
+	if j, _ := m.Get(ok.JobID); j.Status != StatusQueued || j.Progress != 0 {
+		t.Errorf("before start: %+v", j)
+	}
+
+	m.Start(ctx)
+	<-rendering
+	if j, _ := m.Get(ok.JobID); j.Status != StatusRunning || j.Stage != StageRendering || j.Progress != 10 {
+		t.Errorf("running: %+v", j)
+	}
+	close(release)
+
+	for range 2 {
+		select {
+		case event := <-events:
+			job := event["job"].(map[string]any)
+			switch job["id"] {
+			case ok.JobID:
+				if event["event"] != "ledger.job.succeeded" || job["artifactId"] != "a1" || job["progress"] != float64(100) {
+					t.Errorf("succeeded event = %v", event)
+				}
+			case failed.JobID:
+				if event["event"] != "ledger.job.failed" || job["error"] != "boom" {
+					t.Errorf("failed event = %v", event)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification")
+		}
+	}
+	if jobs, total, _ := m.List("", 1, 10); total != 2 || jobs[0].JobID != failed.JobID {
+		t.Errorf("list = %+v", jobs)
+	}
+	if jobs, total, _ := m.List("alice", 1, 10); total != 1 || jobs[0].JobID != ok.JobID {
+		t.Errorf("alice's jobs = %+v", jobs)
+	}
+
+	// 结束超过保留时间的任务被清理
+	m.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	m.expire()
+	if _, err := m.Get(ok.JobID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("err = %v, want not found", err)
+	}
+}
+
+func TestManagerQueueFull(t *testing.T) {
+	d := newMemDao()
+	m := NewManager(d, 1, time.Hour, "")
+	run := func(context.Context, Reporter) (*dao.Artifact, error) { return &dao.Artifact{}, nil }
+	for range queueSize {
+		if _, err := m.Submit(dao.LedgerJob{}, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.Submit(dao.LedgerJob{}, run); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("err = %v, want queue full", err)
+	}
+	if len(d.jobs) != queueSize {
+		t.Errorf("jobs saved = %d, want %d", len(d.jobs), queueSize)
+	}
+}
+
+func TestManagerProgressAndRestart(t *testing.T) {
+	d := newMemDao()
+	// 租约过期的任务在启动时记为失败，其他实例仍在续约的任务不受影响
+	old := time.Now().Add(-time.Hour)
+	d.CreateJob(&dao.LedgerJob{JobID: "stale", Instance: "old", Status: StatusRunning, CreateTime: old, LeaseTime: &old})
+	live := time.Now()
+	d.CreateJob(&dao.LedgerJob{JobID: "live", Instance: "other", Status: StatusRunning, CreateTime: live, LeaseTime: &live})
+	m := NewManager(d, 1, time.Hour, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Start(ctx)
+	if j, _ := m.Get("stale"); j.Status != StatusFailed || j.Error != interruptedReason || j.FinishTime == nil {
+		t.Errorf("stale job = %+v", j)
+	}
+	if j, _ := m.Get("live"); j.Status != StatusRunning {
+		t.Errorf("live job = %+v", j)
+	}
+
+	// 按行报告的进度只在变化时写入
+	finished := make(chan struct{})
+	submitted, err := m.Submit(dao.LedgerJob{Creator: "alice"}, func(ctx context.Context, report Reporter) (*dao.Artifact, error) {
+		defer close(finished)
+		const rows = 50000
+		for i := 1; i <= rows; i++ {
+			report(StageRendering, 10+80*i/rows)
+		}
+		report(StageSaving, 90)
+		return &dao.Artifact{ArtifactID: "a1"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-finished
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if j, _ := m.Get(submitted.JobID); j.Status == StatusSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job not finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n := len(d.updates); n > 100 {
+		t.Errorf("progress written %d times", n)
+	}
+}
+
+func TestManagerLeaseAcrossInstances(t *testing.T) {
+	events := make(chan map[string]any, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer srv.Close()
+
+	d := newMemDao()
+	a := NewManager(d, 1, time.Hour, srv.URL)
+	b := NewManager(d, 1, time.Hour, srv.URL)
+	ctxA, stopA := context.WithCancel(context.Background())
+	defer stopA()
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+
+	release := make(chan struct{})
+	rendering := make(chan struct{})
+	submitted, err := a.Submit(dao.LedgerJob{Creator: "alice"}, func(ctx context.Context, report Reporter) (*dao.Artifact, error) {
+		report(StageRendering, 10)
+		close(rendering)
+		<-release
+		return &dao.Artifact{ArtifactID: "a1"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Start(ctxA)
+	<-rendering
+
+	// 另一实例启动（例如滚动发布）不影响仍在续约的任务
+	b.Start(ctxB)
+	if j, _ := b.Get(submitted.JobID); j.Status != StatusRunning {
+		t.Fatalf("job after other instance started = %+v", j)
+	}
+
+	// 实例 a 停止续约，租约过期后由实例 b 记为失败并通知
+	stopA()
+	b.now = func() time.Time { return time.Now().Add(b.lease + time.Minute) }
+	b.reap(ctxB)
+	if j, _ := b.Get(submitted.JobID); j.Status != StatusFailed || j.Error != interruptedReason {
+		t.Fatalf("job after lease expired = %+v", j)
+	}
+	select {
+	case event := <-events:
+		if event["event"] != "ledger.job.failed" {
+			t.Errorf("event = %v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification")
+	}
+
+	// 实例 a 之后生成完成也不会把状态改回成功
+	close(release)
+	time.Sleep(100 * time.Millisecond)
+	if j, _ := b.Get(submitted.JobID); j.Status != StatusFailed || j.ArtifactID != "" {
+		t.Errorf("job after late finish = %+v", j)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event %v", event)
+	default:
+	}
+}
@@ -0,0 +1,120 @@
+package ledger
+
+import (
+	"fmt"
+	"io"
+	"monitor/internal/service/excel"
+	"monitor/internal/service/export"
+	"strings"
+)
+
+func init() {
+	RegisterClass(ClassSpec[excel.DataRow]{
+		ID:     HighLevelLedgerClass,
+		Name:   "新算力精确分布表",
+		Title:  "高性能算力及大模型部署情况",
+		Source: "DCE 集群监控（GPU/NPU 节点及模型部署）",
+		Columns: []Column[excel.DataRow]{
+			{"环境", func(r excel.DataRow) any { return r.Env }},
+			{"算力(P)", func(r excel.DataRow) any { return r.ComputeP }},
+			{"型号", func(r excel.DataRow) any { return r.Model }},
+			{"服务器数(台)", func(r excel.DataRow) any { return r.ServerNum }},
+			{"卡数(张)", func(r excel.DataRow) any { return r.CardNum }},
+			{"模型", func(r excel.DataRow) any { return r.ModelUsed }},
+			{"使用算力", func(r excel.DataRow) any { return r.UsedCompute }},
+			{"使用卡数", func(r excel.DataRow) any { return r.UsedCard }},
+			{"备注", func(r excel.DataRow) any { return r.Remarks }},
+		},
+		Totals: []string{"使用算力", "使用卡数"},
+		Build:  (*LedgerData).MakeHighLevelModelDetail,
+		Renderers: map[Format]func(io.Writer, []excel.DataRow, *export.Extras) error{
+			FormatXLSX: excel.NewHighLevel().GenerateLedger,
+		},
+	})
+
+	serviceColumns := []Column[excel.ServiceRecord]{
+		{"环境", func(r excel.ServiceRecord) any { return r.Environment }},
+		{"序号", func(r excel.ServiceRecord) any { return r.SerialNumber }},
+		{"场景", func(r excel.ServiceRecord) any { return r.Scene }},
+		{"开发部门", func(r excel.ServiceRecord) any { return r.Department }},
+		{"负责人", func(r excel.ServiceRecord) any { return r.ResponsiblePerson }},
+		{"调用频度", func(r excel.ServiceRecord) any { return r.Frequency }},
+		{"调用模型", func(r excel.ServiceRecord) any { return r.Model }},
+		{"申请并发(页)", func(r excel.ServiceRecord) any { return r.Concurrency }},
+		{"本期调用量", func(r excel.ServiceRecord) any { return r.CallVolume }},
+		{"输入Token", func(r excel.ServiceRecord) any { return r.PromptTokens }},
+		{"输出Token", func(r excel.ServiceRecord) any { return r.CompletionTokens }},
+		{"Token总量", func(r excel.ServiceRecord) any { return r.TotalTokens }},
+	}
+	serviceSource := "网关调用日志（Elasticsearch）、场景目录"
+	serviceTotals := []string{"本期调用量", "Token总量"}
+	serviceRenderers := map[Format]func(io.Writer, []excel.ServiceRecord, *export.Extras) error{
+		FormatXLSX: excel.NewLargeInvokingexcel().GenerateLedgerExcel,
+	}
+	RegisterClass(ClassSpec[excel.ServiceRecord]{
+		ID:        LargeModelLedgerClass,
+		Name:      "智能平台大模型服务调用情况表",
+		Title:     "大模型调用情况",
+		Source:    serviceSource,
+		Columns:   serviceColumns,
+		Totals:    serviceTotals,
+		Build:     (*LedgerData).MakeLargeInvokingDetail,
+		Renderers: serviceRenderers,
+	})
+	RegisterClass(ClassSpec[excel.SupportRecord]{
+		ID:     LargeModelSupportLedgerClass,
+		Name:   "智能平台大模型支撑场景调用量统计表",
+		Title:  "大模型支撑场景调用量",
+		Source: serviceSource,
+		Columns: []Column[excel.SupportRecord]{
+			{"序号", func(r excel.SupportRecord) any { return r.SerialNumber }},
+			{"模型", func(r excel.SupportRecord) any { return r.Model }},
+			{"支撑场景数", func(r excel.SupportRecord) any { return r.SceneCount }},
+			{"各部门场景数", func(r excel.SupportRecord) any { return deptScenesText(r.Departments) }},
+			{"本期调用总量", func(r excel.SupportRecord) any { return r.TotalCalls }},
+			{"本期成功调用量", func(r excel.SupportRecord) any { return r.SuccessCalls }},
+			{"成功率(%)", func(r excel.SupportRecord) any { return r.SuccessRate }},
+			{"申请并发", func(r excel.SupportRecord) any { return r.Concurrency }},
+		},
+		Totals: []string{"支撑场景数", "本期调用总量", "本期成功调用量", "申请并发"},
+		Build:  (*LedgerData).MakeSupportSceneDetail,
+		Renderers: map[Format]func(io.Writer, []excel.SupportRecord, *export.Extras) error{
+			FormatXLSX: excel.NewSupportInvoking().GenerateSupportLedger,
+		},
+	})
+
+	RegisterClass(ClassSpec[excel.Record]{
+		ID:     SceneDetailLedgerClass,
+		Name:   "智能平台服务调用情况表",
+		Title:  "场景调用模型量明细",
+		Source: "网关调用日志（Elasticsearch）、每日调用汇总、场景目录",
+		Columns: []Column[excel.Record]{
+			{"环境", func(r excel.Record) any { return r.Environment }},
+			{"模型", func(r excel.Record) any { return r.Model }},
+			{"场景", func(r excel.Record) any { return r.Scenario }},
+			{"开发部门", func(r excel.Record) any { return r.Department }},
+			{"中心", func(r excel.Record) any { return r.Center }},
+			{"负责人", func(r excel.Record) any { return r.Manager }},
+			{"申请并发(页)", func(r excel.Record) any { return r.Concurrency }},
+			{"本期成功调用量", func(r excel.Record) any { return r.Success }},
+			{"累计调用量", func(r excel.Record) any { return r.History }},
+			{"输入Token", func(r excel.Record) any { return r.PromptTokens }},
+			{"输出Token", func(r excel.Record) any { return r.CompletionTokens }},
+			{"Token总量", func(r excel.Record) any { return r.TotalTokens }},
+		},
+		Totals: []string{"本期成功调用量", "累计调用量", "Token总量"},
+		Build:  (*LedgerData).MakeplatformDetail,
+		Renderers: map[Format]func(io.Writer, []excel.Record, *export.Extras) error{
+			FormatXLSX: excel.NewServiceLedgerDetail().GenerateServiceLedger,
+		},
+	})
+}
+
+// deptScenesText 各部门场景数的文本形式，例如 人工智能中心 3、数据管理部 1
+func deptScenesText(depts []excel.DeptScenes) string {
+	parts := make([]string, len(depts))
+	for i, d := range depts {
+		parts[i] = fmt.Sprintf("%s %d", d.Department, d.SceneCount)
+	}
+	return strings.Join(parts, "、")
+}
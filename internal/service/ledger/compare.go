@@ -0,0 +1,317 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"monitor/internal/service/excel"
+	"monitor/internal/types"
+	"monitor/util"
+	"sort"
+	"time"
+)
+
+// 对比的维度
+const (
+	CompareByModel = "model"
+	CompareByScene = "scene"
+	CompareByDept  = "dept"
+	CompareByGPU   = "gpu"
+)
+
+// CompareDimensions 全部对比维度，生成台账时按此顺序输出工作表
+var CompareDimensions = []string{CompareByModel, CompareByScene, CompareByDept, CompareByGPU}
+
+// 对比期的取法
+const (
+	ComparePrevious = ""       // 紧邻本期之前、长度相同的周期
+	CompareWeek     = "wow"    // 周同比，前移 7 天
+	CompareMonth    = "mom"    // 月同比，前移一个自然月
+	CompareYear     = "yoy"    // 年同比，前移一年
+	CompareCustom   = "custom" // 自定义对比期
+)
+
+// ComparisonName 周期对比台账的文件名前缀
+const ComparisonName = "智能平台周期对比台账"
+
+// 变化量绝对值排名前几的记录标记为变化最大
+const compareTopMovers = 5
+
+var ErrInvalidPeriod = errors.New("invalid comparison period")
+
+// Period 统计周期，毫秒时间戳
+type Period struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// BasePeriod 按 mode 确定本期 current 的对比期，custom 时使用 custom
+func BasePeriod(mode string, current, custom Period) (Period, error) {
+	if current.From <= 0 || current.To <= current.From {
+		return Period{}, fmt.Errorf("%w: 本期 %d-%d", ErrInvalidPeriod, current.From, current.To)
+	}
+	loc, err := util.LoadLocation("")
+	if err != nil {
+		return Period{}, err
+	}
+	shift := func(years, months, days int) Period {
+		from := shiftDate(time.UnixMilli(current.From).In(loc), years, months, days)
+		to := shiftDate(time.UnixMilli(current.To).In(loc), years, months, days)
+		return Period{From: from.UnixMilli(), To: to.UnixMilli()}
+	}
+	switch mode {
+	case ComparePrevious:
+		return Period{From: 2*current.From - current.To, To: current.From}, nil
+	case CompareWeek:
+		return shift(0, 0, -7), nil
+	case CompareMonth:
+		return shift(0, -1, 0), nil
+	case CompareYear:
+		return shift(-1, 0, 0), nil
+	case CompareCustom:
+		if custom.From <= 0 || custom.To <= custom.From {
+			return Period{}, fmt.Errorf("%w: 对比期 %d-%d", ErrInvalidPeriod, custom.From, custom.To)
+		}
+		return custom, nil
+	}
+	return Period{}, fmt.Errorf("%w: 不支持的对比方式 %s", ErrInvalidPeriod, mode)
+}
+
+// shiftDate 与 AddDate 相同，但跨月时日期超出目标月份天数则取月末，例如 3 月 31 日前移一个月为 2 月 28 日
+func shiftDate(t time.Time, years, months, days int) time.Time {
+	shifted := t.AddDate(years, months, days)
+	if months == 0 && years == 0 {
+		return shifted
+	}
+	target := time.Date(t.Year()+years, t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if shifted.Month() != target.Month() {
+		// 目标月份的最后一天
+		return target.AddDate(0, 1, -1)
+	}
+	return shifted
+}
+
+// compareDef 维度的工作表名及指标
+type compareDef struct {
+	title   string
+	metrics []string
+}
+
+var compareDefs = map[string]compareDef{
+	CompareByModel: {"模型", []string{"调用量", "Token总量"}},
+	CompareByScene: {"场景", []string{"调用量", "Token总量"}},
+	CompareByDept:  {"部门", []string{"调用量", "Token总量"}},
+	CompareByGPU:   {"GPU型号", []string{"使用算力(P)", "使用卡数"}},
+}
+
+// compareSide 一个周期内各维度取值：维度值 -> 指标
+type compareSide map[string]map[string][]float64
+
+// compareNames 维度 -> 维度值 -> 展示名称
+type compareNames map[string]map[string]string
+
+// MakeComparison 生成本期与对比期在各维度上的对比
+func (l *LedgerData) MakeComparison(current, base Period, dimensions []string) ([]excel.CompareSheet, error) {
+	for _, d := range dimensions {
+		if _, ok := compareDefs[d]; !ok {
+			return nil, fmt.Errorf("%w: 不支持的对比维度 %s", ErrInvalidPeriod, d)
+		}
+	}
+	names := compareNames{}
+	collect := func(p Period) (compareSide, error) {
+		side := compareSide{}
+		for _, d := range dimensions {
+			side[d] = map[string][]float64{}
+		}
+		if needsInvoking(dimensions) {
+			if err := l.collectInvoking(p, side, names); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := side[CompareByGPU]; ok {
+			if err := l.collectComputing(p, side[CompareByGPU]); err != nil {
+				return nil, err
+			}
+		}
+		return side, nil
+	}
+	cur, err := collect(current)
+	if err != nil {
+		return nil, err
+	}
+	old, err := collect(base)
+	if err != nil {
+		return nil, err
+	}
+
+	caption := fmt.Sprintf("本期 %s，对比期 %s", formatPeriod(current), formatPeriod(base))
+	sheets := make([]excel.CompareSheet, 0, len(dimensions))
+	for _, d := range dimensions {
+		def := compareDefs[d]
+		sheets = append(sheets, excel.CompareSheet{
+			Title:   def.title,
+			Caption: def.title + "对比（" + caption + "）",
+			Metrics: def.metrics,
+			Rows:    compareRows(cur[d], old[d], names[d], len(def.metrics)),
+		})
+	}
+	return sheets, nil
+}
+
+func needsInvoking(dimensions []string) bool {
+	for _, d := range dimensions {
+		if d != CompareByGPU {
+			return true
+		}
+	}
+	return false
+}
+
+// collectInvoking 统计周期内成功调用量及 token 用量，按模型、场景、部门汇总，场景按部门范围过滤
+func (l *LedgerData) collectInvoking(p Period, side compareSide, names compareNames) error {
+	sceneManager, err := l.sceneLedger.GetSceneInfoMap(Scene)
+	if err != nil {
+		return err
+	}
+	calls, err := l.modelLedger.GetSuccessInvokingBySceneModel(p.From, p.To)
+	if err != nil {
+		return err
+	}
+	tokens, err := l.modelLedger.GetTokenUsageBySceneModel(p.From, p.To)
+	if err != nil {
+		return err
+	}
+
+	add := func(scene, model string, count int64, usage types.TokenUsage) {
+		info := sceneManager[scene]
+		if !l.scope.AllowDept(info.DevDept) {
+			return
+		}
+		dept := info.DevDept
+		if dept == "" {
+			dept = "未知部门"
+		}
+		sceneName := info.ApisixScenarioName
+		if sceneName == "" {
+			sceneName = scene
+		}
+		keys := map[string][2]string{
+			CompareByModel: {model, model},
+			CompareByScene: {scene, sceneName},
+			CompareByDept:  {dept, dept},
+		}
+		for d, key := range keys {
+			values, ok := side[d]
+			if !ok {
+				continue
+			}
+			if values[key[0]] == nil {
+				values[key[0]] = make([]float64, 2)
+			}
+			values[key[0]][0] += float64(count)
+			values[key[0]][1] += float64(usage.TotalTokens)
+			if names[d] == nil {
+				names[d] = map[string]string{}
+			}
+			names[d][key[0]] = key[1]
+		}
+	}
+	for scene, models := range calls {
+		for model, count := range models {
+			add(scene, model, count, tokens[scene][model])
+		}
+	}
+	// 只有 token 记录、没有成功调用的组合
+	for scene, models := range tokens {
+		for model, usage := range models {
+			if _, ok := calls[scene][model]; !ok {
+				add(scene, model, 0, usage)
+			}
+		}
+	}
+	return nil
+}
+
+// collectComputing 按 GPU 型号汇总使用算力和卡数
+func (l *LedgerData) collectComputing(p Period, values map[string][]float64) error {
+	details, err := l.GetModelComputingDetail(p.From, p.To)
+	if err != nil {
+		return err
+	}
+	for _, d := range details {
+		if values[d.ModelName] == nil {
+			values[d.ModelName] = make([]float64, 2)
+		}
+		values[d.ModelName][0] += d.UsedPvalue
+		values[d.ModelName][1] += float64(d.UsedCards)
+	}
+	return nil
+}
+
+// compareRows 合并两个周期的取值，按第一个指标变化量的绝对值降序
+func compareRows(cur, old map[string][]float64, names map[string]string, metrics int) []excel.CompareRow {
+	keys := make(map[string]bool, len(cur)+len(old))
+	for k := range cur {
+		keys[k] = true
+	}
+	for k := range old {
+		keys[k] = true
+	}
+	rows := make([]excel.CompareRow, 0, len(keys))
+	for k := range keys {
+		row := excel.CompareRow{Key: k, Name: k, Values: make([]excel.CompareValue, metrics)}
+		if name, ok := names[k]; ok {
+			row.Name = name
+		}
+		curTotal, oldTotal := 0.0, 0.0
+		for i := 0; i < metrics; i++ {
+			v := excel.CompareValue{Base: valueAt(old[k], i), Current: valueAt(cur[k], i)}
+			v.Delta = v.Current - v.Base
+			if v.Base != 0 {
+				percent := math.Round(v.Delta/v.Base*10000) / 100
+				v.Percent = &percent
+			}
+			row.Values[i] = v
+			curTotal += math.Abs(v.Current)
+			oldTotal += math.Abs(v.Base)
+		}
+		switch delta := row.Values[0].Delta; {
+		case oldTotal == 0 && curTotal != 0:
+			row.Status = excel.CompareNew
+		case curTotal == 0 && oldTotal != 0:
+			row.Status = excel.CompareGone
+		case delta > 0:
+			row.Status = excel.CompareUp
+		case delta < 0:
+			row.Status = excel.CompareDown
+		default:
+			row.Status = excel.CompareFlat
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		di, dj := math.Abs(rows[i].Values[0].Delta), math.Abs(rows[j].Values[0].Delta)
+		if di != dj {
+			return di > dj
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	for i := 0; i < len(rows) && i < compareTopMovers; i++ {
+		if rows[i].Values[0].Delta != 0 {
+			rows[i].TopMover = true
+		}
+	}
+	return rows
+}
+
+func valueAt(values []float64, i int) float64 {
+	if i < len(values) {
+		return values[i]
+	}
+	return 0
+}
+
+func formatPeriod(p Period) string {
+	loc, _ := util.LoadLocation("")
+	return time.UnixMilli(p.From).In(loc).Format("2006-01-02") + " 至 " + time.UnixMilli(p.To).In(loc).Format("2006-01-02")
+}
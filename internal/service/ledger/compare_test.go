@@ -0,0 +1,135 @@
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"monitor/internal/service/excel"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestBasePeriod(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	day := func(m time.Month, d int) int64 { return time.Date(2025, m, d, 0, 0, 0, 0, loc).UnixMilli() }
+	current := Period{From: day(3, 31), To: day(4, 7)}
+
+	cases := []struct {
+		mode string
+		want Period
+	}{
+		{ComparePrevious, Period{From: day(3, 24), To: day(3, 31)}},
+		{CompareWeek, Period{From: day(3, 24), To: day(3, 31)}},
+		// 3 月 31 日前移一个月取 2 月月末
+		{CompareMonth, Period{From: day(2, 28), To: day(3, 7)}},
+		{CompareYear, Period{From: time.Date(2024, 3, 31, 0, 0, 0, 0, loc).UnixMilli(), To: time.Date(2024, 4, 7, 0, 0, 0, 0, loc).UnixMilli()}},
+	}
+	for _, c := range cases {
+		got, err := BasePeriod(c.mode, current, Period{})
+		if err != nil || got != c.want {
+			t.Errorf("mode %q: got %+v, err %v, want %+v", c.mode, got, err, c.want)
+		}
+	}
+
+	custom := Period{From: day(1, 1), To: day(2, 1)}
+	if got, _ := BasePeriod(CompareCustom, current, custom); got != custom {
+		t.Errorf("custom = %+v", got)
+	}
+	for _, mode := range []string{CompareCustom, "qoq"} {
+		if _, err := BasePeriod(mode, current, Period{}); !errors.Is(err, ErrInvalidPeriod) {
+			t.Errorf("mode %q: err = %v", mode, err)
+		}
+	}
+	if _, err := BasePeriod(CompareWeek, Period{From: day(4, 7), To: day(3, 31)}, Period{}); !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("reversed period: err = %v", err)
+	}
+}
+
+func TestCompareRows(t *testing.T) {
+	cur := map[string][]float64{"a": {150, 10}, "b": {50, 5}, "new": {20, 1}, "flat": {7, 7}}
+	old := map[string][]float64{"a": {100, 10}, "b": {80, 5}, "gone": {30, 2}, "flat": {7, 3}}
+	rows := compareRows(cur, old, map[string]string{"a": "模型A"}, 2)
+
+	byKey := map[string]excel.CompareRow{}
+	for _, r := range rows {
+		byKey[r.Key] = r
+	}
+	if rows[0].Key != "a" || rows[0].Name != "模型A" {
+		t.Errorf("largest mover should be first: %+v", rows[0])
+	}
+	a := byKey["a"].Values[0]
+	if a.Delta != 50 || a.Percent == nil || *a.Percent != 50 {
+		t.Errorf("a = %+v", a)
+	}
+	if p := byKey["b"].Values[0].Percent; p == nil || *p != -37.5 {
+		t.Errorf("b percent = %v", p)
+	}
+	if byKey["new"].Status != excel.CompareNew || byKey["new"].Values[0].Percent != nil {
+		t.Errorf("new = %+v", byKey["new"])
+	}
+	if byKey["gone"].Status != excel.CompareGone || byKey["b"].Status != excel.CompareDown || byKey["a"].Status != excel.CompareUp {
+		t.Errorf("statuses = %+v", byKey)
+	}
+	// 第一个指标不变时不算变化最大
+	if byKey["flat"].Status != excel.CompareFlat || byKey["flat"].TopMover {
+		t.Errorf("flat = %+v", byKey["flat"])
+	}
+	if !byKey["gone"].TopMover {
+		t.Error("gone should be a top mover")
+	}
+}
+
+func TestGenerateComparisonHighlights(t *testing.T) {
+	rows := compareRows(map[string][]float64{"a": {10, 1}, "new": {5, 1}}, map[string][]float64{"a": {4, 1}, "gone": {1, 1}}, nil, 2)
+	var buf bytes.Buffer
+	err := excel.NewComparison().GenerateComparison(&buf, []excel.CompareSheet{
+		{Title: "模型", Caption: "模型对比", Metrics: []string{"调用量", "Token总量"}, Rows: rows},
+		{Title: "部门", Caption: "部门对比", Metrics: []string{"调用量", "Token总量"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got := f.GetSheetList(); len(got) != 2 || got[0] != "模型" {
+		t.Fatalf("sheets = %v", got)
+	}
+	header, _ := f.GetRows("模型")
+	if header[1][5] != "调用量变化率" || header[1][9] != "Token总量变化率" {
+		t.Errorf("header = %v", header[1])
+	}
+
+	fill := func(cell string) string {
+		id, _ := f.GetCellStyle("模型", cell)
+		style, _ := f.GetStyle(id)
+		if len(style.Fill.Color) == 0 {
+			return ""
+		}
+		return style.Fill.Color[0]
+	}
+	for r, row := range rows {
+		cell := func(col string) string { return col + string(rune('3'+r)) }
+		switch row.Status {
+		case excel.CompareNew:
+			if fill(cell("A")) != "E2EFDA" {
+				t.Errorf("new row fill = %q", fill(cell("A")))
+			}
+		case excel.CompareGone:
+			if fill(cell("A")) != "D9D9D9" {
+				t.Errorf("gone row fill = %q", fill(cell("A")))
+			}
+		}
+		if row.Key == "a" {
+			if fill(cell("E")) != "FFEB9C" {
+				t.Errorf("top mover delta fill = %q", fill(cell("E")))
+			}
+			if v, _ := f.GetCellValue("模型", cell("F")); v != "150.00%" {
+				t.Errorf("percent = %q", v)
+			}
+		}
+	}
+}
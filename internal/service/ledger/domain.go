@@ -2,7 +2,6 @@ package ledger
 
 import (
 	"context"
-	"fmt"
 	"github.com/jinzhu/copier"
 	"log"
 	"monitor/config"
@@ -21,6 +20,10 @@ const (
 	LargeModelSupportLedgerClass LedgerClass = 3
 	//4、场景调用模型量明细
 	SceneDetailLedgerClass LedgerClass = 4
+	//5、周期汇总台账，以上台账合并为一个工作簿
+	PeriodPackLedgerClass LedgerClass = 5
+	//6、周期对比台账
+	ComparisonLedgerClass LedgerClass = 6
 )
 
 // 返回台账excel给用户下载
@@ -36,8 +39,8 @@ type TaskDomain struct {
 
 type LedgerResult struct {
 	Class LedgerClass
-	Data  []interface{} // 实际数据
-	Err   error         // 错误信息
+	Rows  Rows  // 实际数据
+	Err   error // 错误信息
 }
 
 // 获取台账task列表Get
@@ -59,6 +62,14 @@ func NewTaskDomain(ctx context.Context) *TaskDomain {
 	}
 }
 
+// WithContext 返回绑定到请求 ctx 的副本，台账数据按调用方权限获取
+func (t *TaskDomain) WithContext(ctx context.Context) *TaskDomain {
+	domain := *t
+	domain.Ctx = ctx
+	domain.LedgerData = t.LedgerData.WithContext(ctx)
+	return &domain
+}
+
 func (t *TaskDomain) GenerateTaskItem(params models.TaskMetaRequest) error {
 	var taskMeta dao.TaskMetaData
 	copier.Copy(&taskMeta, &params)
@@ -91,74 +102,19 @@ func (t *TaskDomain) TaskItems(page int, pageSize int) ([]dao.TaskMetaData, int6
 
 // 生成预览数据,返回数据,预览数据仅返回用户使用。
 func (t *TaskDomain) GenerateLedgerData(ledgerclass LedgerClass, from, to int64) LedgerResult {
-	switch ledgerclass {
-	case HighLevelLedgerClass:
-
-		data, err := t.LedgerData.MakeHighLevelModelDetail(from, to)
-		if err != nil {
-			log.Println(err)
-		}
-		var ledgerdata []interface{}
-		for i := range data {
-			ledgerdata = append(ledgerdata, data[i])
-		}
-
-		return LedgerResult{
-			Class: HighLevelLedgerClass,
-			Data:  ledgerdata,
-			Err:   nil,
-		}
-
-	case LargeModelLedgerClass:
-		fmt.Println("Large Model Ledger Class")
-		data, err := t.LedgerData.MakeLargeInvokingDetail(from, to)
-		if err != nil {
-			log.Println(err)
-		}
-		var ledgerdata []interface{}
-		for i := range data {
-			ledgerdata = append(ledgerdata, data[i])
-		}
-
-		return LedgerResult{
-			Class: LargeModelLedgerClass,
-			Data:  ledgerdata,
-			Err:   nil,
-		}
-
-	case LargeModelSupportLedgerClass:
-		fmt.Println("Large Model Support Ledger Class")
-		data, err := t.LedgerData.MakeLargeInvokingDetail(from, to)
-		if err != nil {
-			fmt.Println(err)
-		}
-		var ledgerdata []interface{}
-		for i := range data {
-			ledgerdata = append(ledgerdata, data[i])
-		}
-		return LedgerResult{
-			Class: LargeModelSupportLedgerClass,
-			Data:  ledgerdata,
-			Err:   nil,
-		}
-
-	case SceneDetailLedgerClass:
-		fmt.Println("Scene Detail Ledger Class")
-		data, err := t.LedgerData.MakeplatformDetail(from, to)
-		if err != nil {
-			fmt.Println(err)
-		}
-		var ledgerdata []interface{}
-		for i := range data {
-			ledgerdata = append(ledgerdata, data[i])
-		}
-		return LedgerResult{
-			Class: SceneDetailLedgerClass,
-			Data:  ledgerdata,
-			Err:   nil,
-		}
+	class, err := LookupClass(ledgerclass)
+	if err != nil {
+		return LedgerResult{Class: ledgerclass, Err: err}
+	}
+	rows, err := class.Build(t.LedgerData, from, to)
+	if err != nil {
+		log.Println(err)
+	}
+	return LedgerResult{
+		Class: ledgerclass,
+		Rows:  rows,
+		Err:   err,
 	}
-	return LedgerResult{}
 }
 
 // 生成台账,加入延时任务。获取post用户请求
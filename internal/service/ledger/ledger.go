@@ -2,10 +2,17 @@ package ledger
 
 import (
 	"context"
+	"fmt"
 	"github.com/jinzhu/copier"
 	"log"
+	"math"
+	"monitor/internal/service/environment"
 	"monitor/internal/service/excel"
 	"monitor/internal/service/gpu"
+	"monitor/internal/service/tenant"
+	"monitor/internal/types"
+	"monitor/util"
+	"sort"
 )
 
 //大模型调用情况台账
@@ -15,9 +22,11 @@ import (
 type LedgerData struct {
 	Ctx         context.Context
 	modelLedger *ModelLedger
-	sceneLedger *SceneLedger
-	from        int64
-	to          int64
+	sceneLedger sceneSource
+	// 台账中场景相关数据的部门范围
+	scope tenant.Scope
+	from  int64
+	to    int64
 }
 
 func NewLedgerData(ctx context.Context) *LedgerData {
@@ -27,9 +36,19 @@ func NewLedgerData(ctx context.Context) *LedgerData {
 		Ctx:         ctx,
 		modelLedger: modelLedger,
 		sceneLedger: sceneLedger,
+		scope:       tenant.Scope{Global: true},
 	}
 }
 
+// WithContext 返回绑定到 ctx 的副本，DCE 请求使用 ctx 中调用方的 token，场景数据按调用方部门过滤
+func (l *LedgerData) WithContext(ctx context.Context) *LedgerData {
+	data := *l
+	data.Ctx = ctx
+	data.sceneLedger = NewSceneLedger(ctx)
+	data.scope = tenant.ScopeFromContext(ctx)
+	return &data
+}
+
 type LargeModelServiceResp struct {
 	ModelName        string `json:"modelName"`
 	ApplyConcurrency int64  `json:"applyConcurrency"`
@@ -57,9 +76,28 @@ type InteResp struct {
 	InvokingThisPeriod int64  `json:"invokingThisPeriod"`
 	InvokingHistory    int64  `json:"invokingHistory"`
 	ApplyModel         string `json:"applyModel"`
+	PromptTokens       int64  `json:"promptTokens"`
+	CompletionTokens   int64  `json:"completionTokens"`
+	TotalTokens        int64  `json:"totalTokens"`
+}
+
+// token 用量统计的分组维度
+const (
+	TokenGroupScene = "scene"
+	TokenGroupModel = "model"
+	TokenGroupDept  = "dept"
+)
+
+type TokenUsageResp struct {
+	Key  string `json:"key"`  // 场景token、模型名称或部门
+	Name string `json:"name"` // 场景名称，仅按场景分组时有值
+	types.TokenUsage
+	Tps float64 `json:"tps"`
 }
 
 type ModelLedgerResp struct {
+	Env            string //环境，由集群归属得到
+	Cluster        string //集群ID
 	TotalPvalue    float64
 	ModelName      string //显卡型号
 	NodeNum        int
@@ -71,7 +109,8 @@ type ModelLedgerResp struct {
 	MaxConcurrency int64
 }
 
-// 算力分布情况台账
+// 算力分布情况台账。每条记录为某集群中某个模型使用的算力，
+// 服务器数、卡数及算力为该模型所在环境中同型号显卡的合计
 func (l *LedgerData) GetModelComputingDetail(from, to int64) ([]ModelLedgerResp, error) {
 	queryStr := gpu.NewQueryExpr()
 	details, err := queryStr.Getmodel_node_view(l.Ctx, from, to)
@@ -80,10 +119,38 @@ func (l *LedgerData) GetModelComputingDetail(from, to int64) ([]ModelLedgerResp,
 		return nil, err
 	}
 
-	GPU_Pvalue, err := queryStr.GetTotalNvidiaPvalue(l.Ctx, from, to)
-	NPU_Pvalue, err := queryStr.GetTotalAscendPvalue(l.Ctx, from, to)
+	clusterPvalue, err := queryStr.GetTotalPvalueByCluster(l.Ctx, from, to)
+	if err != nil {
+		log.Println(err)
+	}
 	sceneMap, err := l.sceneLedger.GetSceneInfoMap("model")
 
+	resolver := environment.Default()
+	clusterNames := make(map[string]string)
+	for _, c := range gpu.GetClusterNames(l.Ctx) {
+		clusterNames[c.Cluster] = c.ClusterName
+	}
+	clusterEnv := func(cluster string) string {
+		return resolver.Resolve(cluster, clusterNames[cluster])
+	}
+
+	// [环境][型号]
+	envPvalue := make(map[string]map[string]*gpu.PvalueDetailResp)
+	for cluster, labels := range clusterPvalue {
+		env := clusterEnv(cluster)
+		if envPvalue[env] == nil {
+			envPvalue[env] = make(map[string]*gpu.PvalueDetailResp)
+		}
+		for label, v := range labels {
+			if envPvalue[env][label] == nil {
+				envPvalue[env][label] = &gpu.PvalueDetailResp{}
+			}
+			envPvalue[env][label].NodesNum += v.NodesNum
+			envPvalue[env][label].Cards += v.Cards
+			envPvalue[env][label].Pvalue += v.Pvalue
+		}
+	}
+
 	modelsLedgerResp := make([]ModelLedgerResp, 0)
 	for i := range details {
 		var modelLedgerResp ModelLedgerResp
@@ -92,21 +159,21 @@ func (l *LedgerData) GetModelComputingDetail(from, to int64) ([]ModelLedgerResp,
 		usedCards := detail.Core
 		usedPvalue := detail.Pvalue
 		label := detail.Resource
+		env := clusterEnv(detail.Cluster)
 
-		if v, exist := GPU_Pvalue[label]; exist {
-			modelLedgerResp.Corenum = v.Cards
-			modelLedgerResp.NodeNum = v.NodesNum
-			modelLedgerResp.Pvalue = v.Pvalue
-		} else if v, exist := NPU_Pvalue[label]; exist {
+		if v, exist := envPvalue[env][label]; exist {
 			modelLedgerResp.Corenum = v.Cards
 			modelLedgerResp.NodeNum = v.NodesNum
 			modelLedgerResp.Pvalue = v.Pvalue
+			modelLedgerResp.TotalPvalue = v.Pvalue
 		}
 		var maxConcurr int64
 		if _, exist := sceneMap[modelName]; exist {
 			maxConcurr = sceneMap[modelName].MaxConcurrency
 		}
 
+		modelLedgerResp.Env = env
+		modelLedgerResp.Cluster = detail.Cluster
 		modelLedgerResp.MaxConcurrency = maxConcurr
 		modelLedgerResp.Model = modelName
 		modelLedgerResp.UsedCards = usedCards
@@ -162,6 +229,11 @@ func (l *LedgerData) MakeLedgerIntelligent(from int64, to int64) ([]InteResp, er
 		return nil, err
 	}
 
+	tokenMap, err := l.modelLedger.GetTokenUsageBySceneModel(from, to)
+	if err != nil {
+		log.Println(err)
+	}
+
 	IntelResps := make([]InteResp, 0)
 	for k, v := range sceneManager {
 		var intellResp InteResp
@@ -176,6 +248,10 @@ func (l *LedgerData) MakeLedgerIntelligent(from int64, to int64) ([]InteResp, er
 		if _, exist := countInvoking[token]; exist {
 			intellResp.CountInvoking = countInvoking[token]
 		}
+		usage := tokenMap[token][v.ModelName]
+		intellResp.PromptTokens = usage.PromptTokens
+		intellResp.CompletionTokens = usage.CompletionTokens
+		intellResp.TotalTokens = usage.TotalTokens
 		IntelResps = append(IntelResps, intellResp)
 	}
 	return IntelResps, nil
@@ -202,21 +278,15 @@ func (l *LedgerData) MakeLedgerLargeModelDetail(from int64, to int64) ([]InteRes
 		log.Println(err)
 		return nil, err
 	}
-	//var (
-	//	authValues  []string
-	//	modelValues []string
-	//)
-	//
-	//for scene, modelInfo := range sceneInfo {
-	//	for m := range modelInfo {
-	//		authValues = append(authValues, scene)
-	//		modelValues = append(modelValues, m)
-	//		r := fmt.Sprintf("%s|%s", scene, m)
-	//		fmt.Println(r)
-	//	}
-	//}
-	//
-	//history_sceneInfo, err := l.modelLedger.GetHistoryInvokingBySceneModel(authValues, modelValues)
+	tokenMap, err := l.modelLedger.GetTokenUsageBySceneModel(from, to)
+	if err != nil {
+		log.Println(err)
+	}
+	//累计调用
+	historyInfo, err := l.modelLedger.GetHistoryInvokingBySceneModel()
+	if err != nil {
+		log.Println(err)
+	}
 	lmResps := make([]InteResp, 0)
 	for scene, _ := range sceneManager {
 		var lmResp InteResp
@@ -228,6 +298,7 @@ func (l *LedgerData) MakeLedgerLargeModelDetail(from int64, to int64) ([]InteRes
 			lmResp.ModelName = model
 			lmResp.Token = scene
 			lmResp.ApisixScenarioName = sceneManager[scene].ApisixScenarioName
+			lmResp.DevDept = sceneManager[scene].DevDept
 			lmResp.DevManager = sceneManager[scene].DevManager
 			lmResp.EnvAlias = sceneManager[scene].EnvAlias
 			lmResp.EnvName = sceneManager[scene].EnvName
@@ -236,10 +307,11 @@ func (l *LedgerData) MakeLedgerLargeModelDetail(from int64, to int64) ([]InteRes
 			lmResp.InvokingLastWeek = LastWeek_sceneInfo[scene][model]
 			lmResp.InvokingThisPeriod = modelInfo[model]
 			lmResp.InvokingChange = lmResp.InvokingThisPeriod - lmResp.InvokingLastWeek
-
-			//key := fmt.Sprintf("%s|%s", scene, model)
-			//historycount := history_sceneInfo[key]
-			//lmResp.InvokingHistory = historycount
+			lmResp.PromptTokens = tokenMap[scene][model].PromptTokens
+			lmResp.CompletionTokens = tokenMap[scene][model].CompletionTokens
+			lmResp.TotalTokens = tokenMap[scene][model].TotalTokens
+			lmResp.InvokingHistory = historyInfo[scene][model].Total
+			lmResp.InvokingSuccess = historyInfo[scene][model].Success
 			lmResps = append(lmResps, lmResp)
 		}
 
@@ -256,11 +328,21 @@ func (l *LedgerData) MakeHighLevelModelDetail(from, to int64) ([]excel.DataRow,
 		return nil, err
 	}
 
+	// 同一环境、型号、模型的多个实例合并为一行，按环境、型号排列以便表格合并单元格
+	type rowKey struct{ env, gpu, model string }
+	rows := make(map[rowKey]*excel.DataRow)
 	datas := make([]excel.DataRow, 0)
 	for i := range ComputingModel {
 		detail := ComputingModel[i]
+		key := rowKey{detail.Env, detail.ModelName, detail.Model}
+		if data, ok := rows[key]; ok {
+			data.UsedCompute += detail.UsedPvalue
+			data.UsedCard += detail.UsedCards
+			continue
+		}
 
 		var data excel.DataRow
+		data.Env = detail.Env
 		data.Model = detail.ModelName
 		data.ModelUsed = detail.Model
 		data.CardNum = detail.Corenum
@@ -268,9 +350,23 @@ func (l *LedgerData) MakeHighLevelModelDetail(from, to int64) ([]excel.DataRow,
 		data.ServerNum = detail.NodeNum
 		data.UsedCompute = detail.UsedPvalue
 		data.UsedCard = detail.UsedCards
-
-		datas = append(datas, data)
+		rows[key] = &data
 	}
+	for _, data := range rows {
+		datas = append(datas, *data)
+	}
+	sort.Slice(datas, func(i, j int) bool {
+		if datas[i].Env != datas[j].Env {
+			return environment.Less(datas[i].Env, datas[j].Env)
+		}
+		if datas[i].Model != datas[j].Model {
+			return datas[i].Model < datas[j].Model
+		}
+		if datas[i].UsedCompute != datas[j].UsedCompute {
+			return datas[i].UsedCompute > datas[j].UsedCompute
+		}
+		return datas[i].ModelUsed < datas[j].ModelUsed
+	})
 
 	return datas, nil
 }
@@ -281,9 +377,13 @@ func (l *LedgerData) MakeLargeInvokingDetail(from, to int64) ([]excel.ServiceRec
 		return nil, err
 	}
 
+	resolver := environment.Default()
 	datas := make([]excel.ServiceRecord, 0)
 	for i := range LedgerInfo {
 		detail := LedgerInfo[i]
+		if !l.scope.AllowDept(detail.DevDept) {
+			continue
+		}
 		var data excel.ServiceRecord
 		data.Model = detail.ModelName
 		data.Scene = detail.ApisixScenarioName
@@ -292,13 +392,115 @@ func (l *LedgerData) MakeLargeInvokingDetail(from, to int64) ([]excel.ServiceRec
 		data.CallVolume = int(detail.InvokingThisPeriod)
 		data.Concurrency = int(detail.MaxConcurrency)
 		data.ApplyModel = detail.ApplyModel
-		data.SerialNumber = i
-		data.Environment = detail.EnvName
+		data.Environment = resolver.Resolve(detail.EnvName, detail.EnvAlias)
 		data.Frequency = "实时"
+		data.PromptTokens = detail.PromptTokens
+		data.CompletionTokens = detail.CompletionTokens
+		data.TotalTokens = detail.TotalTokens
 		datas = append(datas, data)
 	}
+	// 按环境、场景排列，序号在排序后编排
+	sort.Slice(datas, func(i, j int) bool {
+		if datas[i].Environment != datas[j].Environment {
+			return environment.Less(datas[i].Environment, datas[j].Environment)
+		}
+		if datas[i].Scene != datas[j].Scene {
+			return datas[i].Scene < datas[j].Scene
+		}
+		return datas[i].Model < datas[j].Model
+	})
+	for i := range datas {
+		datas[i].SerialNumber = i + 1
+	}
 	return datas, nil
 }
+
+// 3、大模型支撑场景调用量：按模型统计支撑的场景数、各部门场景数、调用总量、成功调用量及申请并发。
+// 支撑场景为登记在该模型下的场景及本期实际调用过该模型的场景
+func (l *LedgerData) MakeSupportSceneDetail(from, to int64) ([]excel.SupportRecord, error) {
+	sceneManager, err := l.sceneLedger.GetSceneInfoMap(Scene)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	allInvoking, err := l.modelLedger.GetAllInvokingByModelScene(from, to)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	successInvoking, err := l.modelLedger.GetSuccessInvokingByModelScene(from, to)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	// [model]scene
+	modelScenes := make(map[string]map[string]bool)
+	addScene := func(model, scene string) {
+		if model == "" || !l.scope.AllowDept(sceneManager[scene].DevDept) {
+			return
+		}
+		if modelScenes[model] == nil {
+			modelScenes[model] = make(map[string]bool)
+		}
+		modelScenes[model][scene] = true
+	}
+	for token, info := range sceneManager {
+		if token != "" {
+			addScene(info.ModelName, token)
+		}
+	}
+	for model, scenes := range allInvoking {
+		for scene, count := range scenes {
+			if count > 0 {
+				addScene(model, scene)
+			}
+		}
+	}
+
+	datas := make([]excel.SupportRecord, 0, len(modelScenes))
+	for model, scenes := range modelScenes {
+		data := excel.SupportRecord{Model: model, SceneCount: len(scenes)}
+		deptCount := make(map[string]int)
+		for scene := range scenes {
+			info := sceneManager[scene]
+			dept := info.DevDept
+			if dept == "" {
+				dept = "未知部门"
+			}
+			deptCount[dept]++
+			data.TotalCalls += allInvoking[model][scene]
+			data.SuccessCalls += successInvoking[model][scene]
+			if info.ModelName == model {
+				data.Concurrency += info.MaxConcurrency
+			}
+		}
+		for dept, count := range deptCount {
+			data.Departments = append(data.Departments, excel.DeptScenes{Department: dept, SceneCount: count})
+		}
+		sort.Slice(data.Departments, func(i, j int) bool {
+			if data.Departments[i].SceneCount != data.Departments[j].SceneCount {
+				return data.Departments[i].SceneCount > data.Departments[j].SceneCount
+			}
+			return data.Departments[i].Department < data.Departments[j].Department
+		})
+		if data.TotalCalls > 0 {
+			data.SuccessRate = math.Round(float64(data.SuccessCalls)/float64(data.TotalCalls)*10000) / 100
+		}
+		datas = append(datas, data)
+	}
+	sort.Slice(datas, func(i, j int) bool {
+		if datas[i].TotalCalls != datas[j].TotalCalls {
+			return datas[i].TotalCalls > datas[j].TotalCalls
+		}
+		return datas[i].Model < datas[j].Model
+	})
+	for i := range datas {
+		datas[i].SerialNumber = i + 1
+	}
+	return datas, nil
+}
+
 func (l *LedgerData) MakeplatformDetail(from, to int64) ([]excel.Record, error) {
 	LedgerInfo, err := l.MakeLedgerLargeModelDetail(from, to)
 	if err != nil {
@@ -306,18 +508,122 @@ func (l *LedgerData) MakeplatformDetail(from, to int64) ([]excel.Record, error)
 		return nil, err
 	}
 
+	resolver := environment.Default()
 	datas := make([]excel.Record, 0)
 	for i := range LedgerInfo {
 		detail := LedgerInfo[i]
+		if !l.scope.AllowDept(detail.DevDept) {
+			continue
+		}
 		var data excel.Record
 		data.Model = detail.ModelName
-		data.Environment = detail.EnvName
+		data.Environment = resolver.Resolve(detail.EnvName, detail.EnvAlias)
 		data.Department = detail.DevDept
 		data.Success = int(detail.InvokingThisPeriod)
+		data.History = detail.InvokingHistory
 		data.Manager = detail.DevManager
 		data.Scenario = detail.ApisixScenarioName
+		data.PromptTokens = detail.PromptTokens
+		data.CompletionTokens = detail.CompletionTokens
+		data.TotalTokens = detail.TotalTokens
 		datas = append(datas, data)
 	}
+	// 按环境、模型排列，同一模型的场景连续
+	sort.Slice(datas, func(i, j int) bool {
+		if datas[i].Environment != datas[j].Environment {
+			return environment.Less(datas[i].Environment, datas[j].Environment)
+		}
+		if datas[i].Model != datas[j].Model {
+			return datas[i].Model < datas[j].Model
+		}
+		return datas[i].Scenario < datas[j].Scenario
+	})
 
 	return datas, nil
 }
+
+// token 用量统计，按场景、模型或部门汇总
+func (l *LedgerData) MakeTokenUsage(from, to int64, groupBy string) ([]TokenUsageResp, error) {
+	tokenMap, err := l.modelLedger.GetTokenUsageBySceneModel(from, to)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var sceneManager map[string]types.SceneInfoItem
+	if groupBy == TokenGroupDept || groupBy == TokenGroupScene || !l.scope.Global {
+		sceneManager, err = l.sceneLedger.GetSceneInfoMap(Scene)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+	}
+
+	usageMap := make(map[string]*TokenUsageResp)
+	for scene, modelUsage := range tokenMap {
+		if !l.scope.AllowDept(sceneManager[scene].DevDept) {
+			continue
+		}
+		for model, usage := range modelUsage {
+			var key, name string
+			switch groupBy {
+			case TokenGroupScene:
+				key = scene
+				name = sceneManager[scene].ApisixScenarioName
+			case TokenGroupModel:
+				key = model
+			case TokenGroupDept:
+				key = sceneManager[scene].DevDept
+				if key == "" {
+					key = "未知部门"
+				}
+			default:
+				return nil, fmt.Errorf("不支持的分组维度: %s", groupBy)
+			}
+			if _, exist := usageMap[key]; !exist {
+				usageMap[key] = &TokenUsageResp{Key: key, Name: name}
+			}
+			usageMap[key].Add(usage)
+		}
+	}
+
+	resps := make([]TokenUsageResp, 0, len(usageMap))
+	for _, resp := range usageMap {
+		resp.Tps = util.RatePerSecond(resp.TotalTokens, from, to)
+		resps = append(resps, *resp)
+	}
+	sort.Slice(resps, func(i, j int) bool {
+		return resps[i].TotalTokens > resps[j].TotalTokens
+	})
+	return resps, nil
+}
+
+// 各模型在统计周期内的调用量趋势，按天分桶（超过半年按周），场景按部门范围过滤
+func (l *LedgerData) MakeCallTrend(from, to int64, models []string) ([]types.TrendSeries, error) {
+	if len(models) == 0 {
+		return nil, nil
+	}
+	interval := types.TrendDay
+	if types.TrendInterval(from, to) == types.TrendWeek {
+		interval = types.TrendWeek
+	}
+	loc, err := util.LoadLocation("")
+	if err != nil {
+		return nil, err
+	}
+	params := types.TrendParams{
+		From:     from,
+		To:       to,
+		Interval: interval,
+		Location: loc,
+		Series:   models,
+	}
+	if !l.scope.Global {
+		sceneManager, err := l.sceneLedger.GetSceneInfoMap(Scene)
+		if err != nil {
+			return nil, err
+		}
+		params.AuthCodes = tenant.NewSceneFilter(l.scope, sceneManager).Scenes()
+	}
+	return l.modelLedger.GetInvokingTrendByModel(params)
+}
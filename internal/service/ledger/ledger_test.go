@@ -0,0 +1,62 @@
+package ledger
+
+import (
+	"monitor/internal/service/es"
+	"monitor/internal/service/excel"
+	"monitor/internal/service/tenant"
+	"monitor/internal/types"
+	"testing"
+	"time"
+)
+
+type staticScenes map[string]types.SceneInfoItem
+
+func (s staticScenes) GetSceneInfoMap(KeyModel) (map[string]types.SceneInfoItem, error) {
+	return s, nil
+}
+
+func TestSceneDetailScopedToDept(t *testing.T) {
+	esClient, err := es.NewMockESService("../es/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &LedgerData{
+		modelLedger: &ModelLedger{EsClient: esClient},
+		sceneLedger: staticScenes{
+			"sk-a": {ApisixScenarioName: "场景A", ModelName: "m1", DevDept: "研发部", DevManager: "alice"},
+			"sk-b": {ApisixScenarioName: "场景B", ModelName: "m1", DevDept: "运营部", DevManager: "bob"},
+		},
+		scope: tenant.Scope{Departments: map[string]bool{"研发部": true}},
+	}
+	class, err := LookupClass(SceneDetailLedgerClass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rows, err := class.Build(l, now.Add(-48*time.Hour).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := rows.Data.([]excel.Record)
+	if len(records) == 0 {
+		t.Fatal("rows of the caller's department should be kept")
+	}
+	for _, r := range records {
+		if r.Department != "研发部" || r.Scenario != "场景A" {
+			t.Errorf("record = %+v", r)
+		}
+	}
+
+	l.scope = tenant.Scope{Global: true}
+	rows, err = class.Build(l, now.Add(-48*time.Hour).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		t.Fatal(err)
+	}
+	depts := map[string]bool{}
+	for _, r := range rows.Data.([]excel.Record) {
+		depts[r.Department] = true
+	}
+	if !depts["研发部"] || !depts["运营部"] || depts[""] {
+		t.Errorf("departments = %v", depts)
+	}
+}
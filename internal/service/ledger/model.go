@@ -2,8 +2,11 @@ package ledger
 
 import (
 	"monitor/config"
+	"monitor/internal/service/dao"
 	"monitor/internal/service/es"
+	"monitor/internal/types"
 	"monitor/util"
+	"time"
 )
 
 // 查询 model的本周调用次数
@@ -49,6 +52,27 @@ func (m *ModelLedger) GetLastWeekInvokingBySceneModel() (map[string]map[string]i
 	return m.EsClient.Count(from, to, "", "onAuth", "")
 }
 
-func (m *ModelLedger) GetHistoryInvokingBySceneModel(authValues []string, modelValues []string) (map[string]int64, error) {
-	return m.EsClient.BatchCountFieldOccurrences(authValues, modelValues)
+// [scene]model 累计调用量，优先使用每日汇总表；未连接数据库时直接统计回溯期内的网关日志
+func (m *ModelLedger) GetHistoryInvokingBySceneModel() (map[string]map[string]types.InvokingTotal, error) {
+	now := time.Now()
+	if dao.GetDB() == nil {
+		from := now.AddDate(0, 0, -config.GetDBConfig().RollupBackfillDays).UnixMilli()
+		return countSceneModel(m.EsClient, from, now.UnixMilli())
+	}
+	rollup := &InvokingRollup{
+		esClient:    m.EsClient,
+		invokingDao: dao.NewInvokingDao(nil),
+	}
+	return rollup.Cumulative(now)
+}
+
+// [scene]model token用量
+func (m *ModelLedger) GetTokenUsageBySceneModel(from int64, to int64) (map[string]map[string]types.TokenUsage, error) {
+	return m.EsClient.SumTokens(from, to, "onAuth")
+}
+
+// 按模型拆分的调用量趋势
+func (m *ModelLedger) GetInvokingTrendByModel(params types.TrendParams) ([]types.TrendSeries, error) {
+	params.SeriesBy = types.SeriesByModel
+	return m.EsClient.CountTrend(params)
 }
@@ -0,0 +1,317 @@
+package ledger
+
+import (
+	"fmt"
+	"io"
+	"monitor/internal/service/excel"
+	"monitor/internal/service/export"
+	"monitor/internal/types"
+	"monitor/util"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 周期汇总台账的文件名前缀及固定工作表
+const (
+	PeriodPackName   = "智能平台台账汇总"
+	packCoverSheet   = "封面"
+	packSummarySheet = "汇总"
+	packChartSheet   = "图表"
+	// 调用趋势图最多展示的模型数，按本期调用量取前几名
+	packTrendModels = 8
+)
+
+// PackSheet 汇总台账中的一个台账类别
+type PackSheet struct {
+	Class *Class
+	Rows  Rows
+}
+
+// PeriodPack 一个统计周期内全部台账类别合并的工作簿：封面、汇总、各台账明细及图表
+type PeriodPack struct {
+	From        int64
+	To          int64
+	GeneratedAt time.Time
+	Creator     string
+	Sheets      []PackSheet
+	// 主要模型的调用量趋势
+	Trend []types.TrendSeries
+}
+
+// BuildPeriodPack 生成全部台账类别的数据，任一类别失败则整体失败，避免汇总缺页
+func (t *TaskDomain) BuildPeriodPack(from, to int64) (*PeriodPack, error) {
+	pack := &PeriodPack{From: from, To: to, GeneratedAt: time.Now()}
+	for _, class := range Classes() {
+		rows, err := class.Build(t.LedgerData, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("生成%s失败: %w", class.Title, err)
+		}
+		pack.Sheets = append(pack.Sheets, PackSheet{Class: class, Rows: rows})
+	}
+	trend, err := t.LedgerData.MakeCallTrend(from, to, pack.topModels())
+	if err != nil {
+		return nil, fmt.Errorf("统计调用趋势失败: %w", err)
+	}
+	pack.Trend = trend
+	return pack, nil
+}
+
+// Rows 各台账的记录总数
+func (p *PeriodPack) Rows() int {
+	total := 0
+	for _, s := range p.Sheets {
+		total += s.Rows.Len
+	}
+	return total
+}
+
+// rowsOf 指定类别的数据，类别不在汇总中时返回 nil
+func rowsOf[T any](p *PeriodPack, id LedgerClass) []T {
+	for _, s := range p.Sheets {
+		if s.Class.ID == id {
+			data, _ := s.Rows.Data.([]T)
+			return data
+		}
+	}
+	return nil
+}
+
+// topModels 本期调用量最多的模型
+func (p *PeriodPack) topModels() []string {
+	calls := make(map[string]int)
+	for _, r := range rowsOf[excel.ServiceRecord](p, LargeModelLedgerClass) {
+		if r.Model != "" {
+			calls[r.Model] += r.CallVolume
+		}
+	}
+	models := make([]string, 0, len(calls))
+	for m := range calls {
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		if calls[models[i]] != calls[models[j]] {
+			return calls[models[i]] > calls[models[j]]
+		}
+		return models[i] < models[j]
+	})
+	if len(models) > packTrendModels {
+		models = models[:packTrendModels]
+	}
+	return models
+}
+
+// Render 输出 xlsx 工作簿
+func (p *PeriodPack) Render(w io.Writer) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName("Sheet1", packCoverSheet); err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+	sheets := []string{packSummarySheet}
+	names := make([]string, len(p.Sheets))
+	for i, s := range p.Sheets {
+		names[i] = export.SheetName(s.Class.Title)
+		sheets = append(sheets, names[i])
+	}
+	sheets = append(sheets, packChartSheet)
+	for _, name := range sheets {
+		if _, err := f.NewSheet(name); err != nil {
+			return fmt.Errorf("创建工作表%s失败: %w", name, err)
+		}
+	}
+
+	for i, s := range p.Sheets {
+		if err := export.WriteSheet(f, names[i], s.Class.Table(s.Rows)); err != nil {
+			return fmt.Errorf("写入%s失败: %w", names[i], err)
+		}
+	}
+	if err := p.writeCover(f, names); err != nil {
+		return err
+	}
+	if err := p.writeSummary(f, names); err != nil {
+		return err
+	}
+	if err := p.writeCharts(f); err != nil {
+		return err
+	}
+
+	// 汇总页为公式，打开时重新计算
+	fullCalc := true
+	if err := f.SetCalcProps(&excelize.CalcPropsOptions{FullCalcOnLoad: &fullCalc}); err != nil {
+		return err
+	}
+	f.SetActiveSheet(0)
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("写入台账失败: %w", err)
+	}
+	return nil
+}
+
+func (p *PeriodPack) writeCover(f *excelize.File, names []string) error {
+	loc, err := util.LoadLocation("")
+	if err != nil {
+		return err
+	}
+	creator := p.Creator
+	if creator == "" {
+		creator = "系统"
+	}
+	titleStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true, Size: 16}})
+	boldStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	linkStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Color: "#1265BE", Underline: "single"}})
+
+	sheet := packCoverSheet
+	f.SetCellValue(sheet, "A1", PeriodPackName)
+	f.SetCellStyle(sheet, "A1", "A1", titleStyle)
+	f.SetSheetRow(sheet, "A3", &[]interface{}{"统计周期", formatPeriod(Period{From: p.From, To: p.To})})
+	f.SetSheetRow(sheet, "A4", &[]interface{}{"生成时间", p.GeneratedAt.In(loc).Format("2006-01-02 15:04:05")})
+	f.SetSheetRow(sheet, "A5", &[]interface{}{"生成人", creator})
+	f.SetCellStyle(sheet, "A3", "A5", boldStyle)
+
+	f.SetSheetRow(sheet, "A7", &[]interface{}{"工作表", "内容", "数据来源", "记录数"})
+	f.SetCellStyle(sheet, "A7", "D7", boldStyle)
+	for i, s := range p.Sheets {
+		row := 8 + i
+		cell := fmt.Sprintf("A%d", row)
+		f.SetSheetRow(sheet, cell, &[]interface{}{names[i], s.Class.Name, s.Class.Source, s.Rows.Len})
+		if err := f.SetCellHyperLink(sheet, cell, quoteSheet(names[i])+"!A1", "Location"); err != nil {
+			return err
+		}
+		f.SetCellStyle(sheet, cell, cell, linkStyle)
+	}
+	f.SetColWidth(sheet, "A", "A", 28)
+	f.SetColWidth(sheet, "B", "B", 30)
+	f.SetColWidth(sheet, "C", "C", 50)
+	return nil
+}
+
+// writeSummary 各台账的记录数及合计列，合计以跨工作表公式引用明细页
+func (p *PeriodPack) writeSummary(f *excelize.File, names []string) error {
+	sheet := packSummarySheet
+	boldStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	f.SetCellValue(sheet, "A1", "关键指标汇总")
+	f.SetSheetRow(sheet, "A2", &[]interface{}{"台账", "指标", "数值"})
+	f.SetCellStyle(sheet, "A1", "C2", boldStyle)
+
+	row := 3
+	for i, s := range p.Sheets {
+		f.SetSheetRow(sheet, fmt.Sprintf("A%d", row), &[]interface{}{names[i], "记录数", s.Rows.Len})
+		row++
+		columns := s.Class.Columns()
+		for _, idx := range s.Class.Totals() {
+			f.SetSheetRow(sheet, fmt.Sprintf("A%d", row), &[]interface{}{names[i], columns[idx]})
+			cell := fmt.Sprintf("C%d", row)
+			if s.Rows.Len == 0 {
+				f.SetCellValue(sheet, cell, 0)
+			} else {
+				col, _ := excelize.ColumnNumberToName(idx + 1)
+				formula := fmt.Sprintf("SUM(%s!%s%d:%s%d)", quoteSheet(names[i]),
+					col, export.FirstDataRow, col, export.FirstDataRow+s.Rows.Len-1)
+				if err := f.SetCellFormula(sheet, cell, formula); err != nil {
+					return fmt.Errorf("写入汇总公式失败: %w", err)
+				}
+			}
+			row++
+		}
+	}
+	f.SetColWidth(sheet, "A", "A", 28)
+	f.SetColWidth(sheet, "B", "B", 18)
+	f.SetColWidth(sheet, "C", "C", 18)
+	return nil
+}
+
+// writeCharts 调用量趋势折线图和各模型使用算力柱状图，图表数据写在本页左侧
+func (p *PeriodPack) writeCharts(f *excelize.File) error {
+	sheet := packChartSheet
+	boldStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	ref := quoteSheet(sheet)
+
+	// 调用量趋势：第一列为日期，每个模型一列
+	header := []interface{}{"日期"}
+	for _, s := range p.Trend {
+		header = append(header, s.Name)
+	}
+	f.SetSheetRow(sheet, "A1", &header)
+	f.SetCellStyle(sheet, "A1", "A1", boldStyle)
+	points := 0
+	if len(p.Trend) > 0 {
+		points = len(p.Trend[0].Points)
+	}
+	for i := 0; i < points; i++ {
+		values := []interface{}{p.Trend[0].Points[i].Date}
+		for _, s := range p.Trend {
+			values = append(values, s.Points[i].Count)
+		}
+		f.SetSheetRow(sheet, fmt.Sprintf("A%d", i+2), &values)
+	}
+	chartCol, _ := excelize.ColumnNumberToName(len(header) + 2)
+	if points > 0 {
+		series := make([]excelize.ChartSeries, len(p.Trend))
+		for i := range p.Trend {
+			col, _ := excelize.ColumnNumberToName(i + 2)
+			series[i] = excelize.ChartSeries{
+				Name:       fmt.Sprintf("%s!$%s$1", ref, col),
+				Categories: fmt.Sprintf("%s!$A$2:$A$%d", ref, points+1),
+				Values:     fmt.Sprintf("%s!$%s$2:$%s$%d", ref, col, col, points+1),
+			}
+		}
+		if err := f.AddChart(sheet, chartCol+"1", &excelize.Chart{
+			Type:      excelize.Line,
+			Series:    series,
+			Title:     []excelize.RichTextRun{{Text: "模型调用量趋势"}},
+			Legend:    excelize.ChartLegend{Position: "bottom"},
+			Dimension: excelize.ChartDimension{Width: 720, Height: 320},
+		}); err != nil {
+			return fmt.Errorf("生成调用趋势图失败: %w", err)
+		}
+	}
+
+	// 使用算力：按模型汇总
+	used := make(map[string]float64)
+	cards := make(map[string]int)
+	for _, r := range rowsOf[excel.DataRow](p, HighLevelLedgerClass) {
+		used[r.ModelUsed] += r.UsedCompute
+		cards[r.ModelUsed] += r.UsedCard
+	}
+	models := make([]string, 0, len(used))
+	for m := range used {
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		if used[models[i]] != used[models[j]] {
+			return used[models[i]] > used[models[j]]
+		}
+		return models[i] < models[j]
+	})
+	start := points + 4
+	f.SetSheetRow(sheet, fmt.Sprintf("A%d", start), &[]interface{}{"模型", "使用算力(P)", "使用卡数"})
+	f.SetCellStyle(sheet, fmt.Sprintf("A%d", start), fmt.Sprintf("C%d", start), boldStyle)
+	for i, m := range models {
+		f.SetSheetRow(sheet, fmt.Sprintf("A%d", start+1+i), &[]interface{}{m, used[m], cards[m]})
+	}
+	if len(models) > 0 {
+		if err := f.AddChart(sheet, fmt.Sprintf("%s%d", chartCol, 19), &excelize.Chart{
+			Type: excelize.Col,
+			Series: []excelize.ChartSeries{{
+				Name:       fmt.Sprintf("%s!$B$%d", ref, start),
+				Categories: fmt.Sprintf("%s!$A$%d:$A$%d", ref, start+1, start+len(models)),
+				Values:     fmt.Sprintf("%s!$B$%d:$B$%d", ref, start+1, start+len(models)),
+			}},
+			Title:     []excelize.RichTextRun{{Text: "各模型使用算力(P)"}},
+			Legend:    excelize.ChartLegend{Position: "none"},
+			Dimension: excelize.ChartDimension{Width: 720, Height: 320},
+		}); err != nil {
+			return fmt.Errorf("生成算力图失败: %w", err)
+		}
+	}
+	f.SetColWidth(sheet, "A", "A", 28)
+	return nil
+}
+
+// quoteSheet 公式及图表中引用的工作表名
+func quoteSheet(name string) string {
+	return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+}
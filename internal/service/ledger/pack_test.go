@@ -0,0 +1,115 @@
+package ledger
+
+import (
+	"bytes"
+	"monitor/internal/types"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func samplePack(t *testing.T) *PeriodPack {
+	t.Helper()
+	pack := &PeriodPack{
+		From:        time.Date(2025, 7, 28, 0, 0, 0, 0, time.UTC).UnixMilli(),
+		To:          time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC).UnixMilli(),
+		GeneratedAt: time.Now(),
+		Creator:     "alice",
+		Trend: []types.TrendSeries{
+			{Key: "QwQ-32B", Name: "QwQ-32B", Points: []types.TrendPoint{{Date: "2025-07-28", Count: 3}, {Date: "2025-07-29", Count: 5}}},
+			{Key: "Qwen3-8B", Name: "Qwen3-8B", Points: []types.TrendPoint{{Date: "2025-07-28", Count: 1}, {Date: "2025-07-29", Count: 0}}},
+		},
+	}
+	for _, class := range Classes() {
+		raw := sampleRows[class.ID]
+		if class.ID == HighLevelLedgerClass {
+			raw = `[{"env":"生产","model":"910B","modelUsed":"QwQ-32B","usedCompute":7.5,"usedCard":24},
+				{"env":"生产","model":"V100","modelUsed":"QwQ-32B","usedCompute":2,"usedCard":8},
+				{"env":"生产","model":"V100","modelUsed":"Qwen3-8B","usedCompute":25,"usedCard":168}]`
+		}
+		rows, err := class.Decode([]byte(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pack.Sheets = append(pack.Sheets, PackSheet{Class: class, Rows: rows})
+	}
+	return pack
+}
+
+func TestPeriodPackRender(t *testing.T) {
+	pack := samplePack(t)
+	var buf bytes.Buffer
+	if err := pack.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{"xl/charts/chart1.xml", "xl/charts/chart2.xml"} {
+		if !bytes.Contains(buf.Bytes(), []byte(part)) {
+			t.Errorf("workbook should contain %s", part)
+		}
+	}
+
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := []string{packCoverSheet, packSummarySheet, "高性能算力及大模型部署情况", "大模型调用情况", "大模型支撑场景调用量", "场景调用模型量明细", packChartSheet}
+	if got := f.GetSheetList(); !slices.Equal(got, want) {
+		t.Fatalf("sheets = %v, want %v", got, want)
+	}
+
+	if v, _ := f.GetCellValue(packCoverSheet, "B3"); v != "2025-07-28 至 2025-08-01" {
+		t.Errorf("period = %q", v)
+	}
+	if ok, target, _ := f.GetCellHyperLink(packCoverSheet, "A8"); !ok || target != "'高性能算力及大模型部署情况'!A1" {
+		t.Errorf("cover link = %v %q", ok, target)
+	}
+
+	// 汇总页以公式引用明细页，计算结果与明细一致
+	rows, _ := f.GetRows(packSummarySheet)
+	totals := map[string]string{}
+	for i, r := range rows[2:] {
+		cell := "C" + strconv.Itoa(i+3)
+		if formula, _ := f.GetCellFormula(packSummarySheet, cell); formula != "" {
+			if !strings.Contains(formula, "'!") {
+				t.Errorf("%s formula %q should reference another sheet", cell, formula)
+			}
+			value, err := f.CalcCellValue(packSummarySheet, cell)
+			if err != nil {
+				t.Fatal(err)
+			}
+			totals[r[0]+"/"+r[1]] = value
+		}
+	}
+	if totals["高性能算力及大模型部署情况/使用卡数"] != "200" || totals["高性能算力及大模型部署情况/使用算力"] != "34.5" {
+		t.Errorf("compute totals = %v", totals)
+	}
+	if totals["场景调用模型量明细/累计调用量"] != "1000000000" {
+		t.Errorf("scene totals = %v", totals)
+	}
+
+	// 图表数据：趋势在前，算力按模型汇总并按使用量降序
+	if v, _ := f.GetCellValue(packChartSheet, "B3"); v != "5" {
+		t.Errorf("trend B3 = %q", v)
+	}
+	if v, _ := f.GetCellValue(packChartSheet, "A7"); v != "Qwen3-8B" {
+		t.Errorf("top compute model = %q", v)
+	}
+	if v, _ := f.GetCellValue(packChartSheet, "B8"); v != "9.5" {
+		t.Errorf("QwQ-32B compute = %q", v)
+	}
+}
+
+func TestPeriodPackTopModels(t *testing.T) {
+	pack := samplePack(t)
+	if got := pack.topModels(); !slices.Equal(got, []string{"QwQ-32B"}) {
+		t.Errorf("top models = %v", got)
+	}
+	if pack.Rows() != 6 {
+		t.Errorf("rows = %d", pack.Rows())
+	}
+}
@@ -0,0 +1,307 @@
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"monitor/internal/service/export"
+	"slices"
+	"sort"
+)
+
+// Format 台账输出格式，同时作为文件扩展名
+type Format string
+
+const (
+	FormatXLSX Format = "xlsx"
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+	FormatPDF  Format = "pdf"
+)
+
+var (
+	ErrUnknownClass      = errors.New("unknown ledger class")
+	ErrUnsupportedFormat = errors.New("unsupported ledger format")
+)
+
+// Rows 某一台账类别的数据，Data 为该类别的行切片（例如 []excel.DataRow）
+type Rows struct {
+	Data any
+	Len  int
+	// 统计区间(毫秒)，用于模板中的统计周期；解析提交的数据时为 0，由调用方设置
+	From, To int64
+	cells    func(i int) []any
+}
+
+// Renderer 将台账数据写为某一格式，extras 为写入同一文件的说明行、附加工作表及进度回调，可为 nil
+type Renderer func(w io.Writer, c *Class, rows Rows, extras *export.Extras) error
+
+type formatDef struct {
+	contentType string
+	render      Renderer
+}
+
+var formats = map[Format]formatDef{}
+
+// RegisterFormat 注册通用格式，所有台账类别都可输出，类别可以用专用版式覆盖
+func RegisterFormat(f Format, contentType string, render Renderer) {
+	formats[f] = formatDef{contentType: contentType, render: render}
+}
+
+// ContentType 格式对应的 MIME 类型
+func ContentType(f Format) string {
+	if def, ok := formats[f]; ok {
+		return def.contentType
+	}
+	return "application/octet-stream"
+}
+
+func init() {
+	RegisterFormat(FormatXLSX, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		func(w io.Writer, c *Class, rows Rows, extras *export.Extras) error {
+			return export.WriteXLSX(w, c.Table(rows), extras)
+		})
+	RegisterFormat(FormatCSV, "text/csv; charset=utf-8",
+		func(w io.Writer, c *Class, rows Rows, extras *export.Extras) error {
+			return export.WriteCSV(w, c.table(rows, extras))
+		})
+	RegisterFormat(FormatPDF, "application/pdf",
+		func(w io.Writer, c *Class, rows Rows, extras *export.Extras) error {
+			return export.WritePDF(w, c.table(rows, extras))
+		})
+	RegisterFormat(FormatJSON, "application/json",
+		func(w io.Writer, c *Class, rows Rows, extras *export.Extras) error {
+			if extras != nil && len(extras.Notes) > 0 {
+				return json.NewEncoder(w).Encode(map[string]any{"rows": rows.Data, "notes": extras.Notes})
+			}
+			return json.NewEncoder(w).Encode(rows.Data)
+		})
+}
+
+// Column 台账的一列，T 为行类型
+type Column[T any] struct {
+	Title string
+	Value func(row T) any
+}
+
+// ClassSpec 台账类别的定义，T 为行类型
+type ClassSpec[T any] struct {
+	ID      LedgerClass
+	Name    string // 生成文件名的前缀
+	Title   string
+	Source  string // 数据来源，写入汇总台账封面
+	Columns []Column[T]
+	// 汇总台账中需要合计的列（列标题）
+	Totals []string
+	Build  func(l *LedgerData, from, to int64) ([]T, error)
+	// 类别专用的版式，未提供的格式使用通用输出
+	Renderers map[Format]func(w io.Writer, rows []T, extras *export.Extras) error
+}
+
+// Class 已注册的台账类别
+type Class struct {
+	ID        LedgerClass
+	Name      string
+	Title     string
+	Source    string
+	columns   []string
+	totals    []int
+	build     func(l *LedgerData, from, to int64) (Rows, error)
+	decode    func(data []byte) (Rows, error)
+	renderers map[Format]Renderer
+}
+
+var classes = map[LedgerClass]*Class{}
+
+// RegisterClass 注册台账类别，预览、生成和各格式输出都由定义驱动
+func RegisterClass[T any](spec ClassSpec[T]) *Class {
+	rowsOf := func(data []T) Rows {
+		return Rows{
+			Data: data,
+			Len:  len(data),
+			cells: func(i int) []any {
+				cells := make([]any, len(spec.Columns))
+				for j, col := range spec.Columns {
+					cells[j] = col.Value(data[i])
+				}
+				return cells
+			},
+		}
+	}
+
+	c := &Class{
+		ID:        spec.ID,
+		Name:      spec.Name,
+		Title:     spec.Title,
+		Source:    spec.Source,
+		renderers: make(map[Format]Renderer, len(spec.Renderers)),
+		build: func(l *LedgerData, from, to int64) (Rows, error) {
+			data, err := spec.Build(l, from, to)
+			if err != nil {
+				return Rows{}, err
+			}
+			rows := rowsOf(data)
+			rows.From, rows.To = from, to
+			return rows, nil
+		},
+		decode: func(raw []byte) (Rows, error) {
+			var data []T
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return Rows{}, fmt.Errorf("台账数据格式错误: %w", err)
+			}
+			return rowsOf(data), nil
+		},
+	}
+	for _, col := range spec.Columns {
+		c.columns = append(c.columns, col.Title)
+	}
+	for _, title := range spec.Totals {
+		idx := slices.Index(c.columns, title)
+		if idx < 0 {
+			panic(fmt.Sprintf("台账 %d 的合计列 %s 不存在", spec.ID, title))
+		}
+		c.totals = append(c.totals, idx)
+	}
+	for f, render := range spec.Renderers {
+		render := render
+		c.renderers[f] = func(w io.Writer, _ *Class, rows Rows, extras *export.Extras) error {
+			data, ok := rows.Data.([]T)
+			if !ok {
+				return fmt.Errorf("台账 %d 的数据类型不匹配: %T", c.ID, rows.Data)
+			}
+			return render(w, data, extras)
+		}
+	}
+	classes[spec.ID] = c
+	return c
+}
+
+// LookupClass 按编号查询台账类别
+func LookupClass(id LedgerClass) (*Class, error) {
+	if c, ok := classes[id]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrUnknownClass, id)
+}
+
+// Classes 全部台账类别，按编号排序
+func Classes() []*Class {
+	list := make([]*Class, 0, len(classes))
+	for _, c := range classes {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Columns 表头
+func (c *Class) Columns() []string {
+	return c.columns
+}
+
+// Totals 需要合计的列序号，从 0 开始
+func (c *Class) Totals() []int {
+	return c.totals
+}
+
+// Build 从监控数据生成台账
+func (c *Class) Build(l *LedgerData, from, to int64) (Rows, error) {
+	return c.build(l, from, to)
+}
+
+// Decode 解析调用方提交的台账数据
+func (c *Class) Decode(data []byte) (Rows, error) {
+	return c.decode(data)
+}
+
+// Formats 可输出的格式
+func (c *Class) Formats() []Format {
+	list := make([]Format, 0, len(formats))
+	for f := range formats {
+		list = append(list, f)
+	}
+	for f := range c.renderers {
+		if _, ok := formats[f]; !ok {
+			list = append(list, f)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// Supports 是否可以输出为格式 f
+func (c *Class) Supports(f Format) bool {
+	if _, ok := c.renderers[f]; ok {
+		return true
+	}
+	_, ok := formats[f]
+	return ok
+}
+
+// Render 输出为格式 f，xlsx 优先使用选用的模板，其次为类别的专用版式
+func (c *Class) Render(w io.Writer, f Format, rows Rows) error {
+	return c.RenderExtras(w, f, rows, nil)
+}
+
+// RenderExtras 输出为格式 f 并在同一文件中写入 extras：说明行各格式均可附加，附加工作表仅 xlsx 输出
+func (c *Class) RenderExtras(w io.Writer, f Format, rows Rows, extras *export.Extras) error {
+	render, err := c.layout(f)
+	if err != nil {
+		return err
+	}
+	if render != nil {
+		return render(w, c, rows, extras)
+	}
+	if def, ok := formats[f]; ok {
+		return def.render(w, c, rows, extras)
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedFormat, f)
+}
+
+// layout 格式 f 的模板或专用版式，没有时返回 nil
+func (c *Class) layout(f Format) (Renderer, error) {
+	if f == FormatXLSX {
+		tpl, err := c.template()
+		if err != nil {
+			return nil, err
+		}
+		if tpl != nil {
+			return func(w io.Writer, c *Class, rows Rows, extras *export.Extras) error {
+				return c.renderTemplate(w, tpl, rows, extras)
+			}, nil
+		}
+	}
+	return c.renderers[f], nil
+}
+
+// RenderNotes 输出为格式 f 并在表格后附加说明行，例如审批信息。
+// 模板及专用版式仅 xlsx 可附加说明，JSON 输出为 {"rows": ..., "notes": ...}
+func (c *Class) RenderNotes(w io.Writer, f Format, rows Rows, notes []string) error {
+	render, err := c.layout(f)
+	if err != nil {
+		return err
+	}
+	if render != nil && f != FormatXLSX {
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, f)
+	}
+	return c.RenderExtras(w, f, rows, &export.Extras{Notes: notes})
+}
+
+// Table 转换为通用二维表
+func (c *Class) Table(rows Rows) export.Table {
+	return c.table(rows, nil)
+}
+
+// table 转换为通用二维表，附带 extras 的说明行并按行报告进度
+func (c *Class) table(rows Rows, extras *export.Extras) export.Table {
+	t := export.Table{Title: c.Title, Columns: c.columns, Rows: make([][]any, rows.Len)}
+	for i := 0; i < rows.Len; i++ {
+		t.Rows[i] = rows.cells(i)
+		extras.Report(i+1, rows.Len)
+	}
+	if extras != nil {
+		t.Notes = extras.Notes
+	}
+	return t
+}
@@ -0,0 +1,171 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var sampleRows = map[LedgerClass]string{
+	HighLevelLedgerClass:         `[{"env":"生产","computeP":461.5,"model":"910B","serverNum":175,"cardNum":1400,"modelUsed":"Qwen3-32B","usedCompute":8.7,"usedCard":27}]`,
+	LargeModelLedgerClass:        `[{"environment":"生产","serialNumber":1,"scene":"表单识别","department":"人工智能中心","model":"QwQ-32B","callVolume":4730}]`,
+	LargeModelSupportLedgerClass: `[{"serialNumber":1,"model":"QwQ-32B","sceneCount":3,"departments":[{"department":"人工智能中心","sceneCount":2},{"department":"数据管理部","sceneCount":1}],"totalCalls":5000,"successCalls":4730,"successRate":94.6,"concurrency":168}]`,
+	SceneDetailLedgerClass:       `[{"environment":"生产","model":"Qwen3-8B","scenario":"信用卡审批支持助手","department":"数据管理部","success":80,"history":1000000000}]`,
+}
+
+func TestLedgerClassesRenderAllFormats(t *testing.T) {
+	for _, class := range Classes() {
+		raw, ok := sampleRows[class.ID]
+		if !ok {
+			t.Fatalf("no sample rows for class %d", class.ID)
+		}
+		rows, err := class.Decode([]byte(raw))
+		if err != nil || rows.Len != 1 {
+			t.Fatalf("class %d decode: rows = %d, err = %v", class.ID, rows.Len, err)
+		}
+		for _, format := range class.Formats() {
+			var buf bytes.Buffer
+			if err := class.Render(&buf, format, rows); err != nil {
+				t.Errorf("class %d %s: %v", class.ID, format, err)
+				continue
+			}
+			checkOutput(t, class, format, buf.Bytes())
+		}
+	}
+}
+
+func checkOutput(t *testing.T, class *Class, format Format, out []byte) {
+	t.Helper()
+	switch format {
+	case FormatXLSX:
+		f, err := excelize.OpenReader(bytes.NewReader(out))
+		if err != nil {
+			t.Errorf("class %d xlsx: %v", class.ID, err)
+			return
+		}
+		f.Close()
+	case FormatCSV:
+		text := strings.TrimPrefix(string(out), "\xEF\xBB\xBF")
+		if text == string(out) || !strings.HasPrefix(text, strings.Join(class.Columns(), ",")) {
+			t.Errorf("class %d csv = %q", class.ID, out)
+		}
+		if class.ID == SceneDetailLedgerClass && !strings.Contains(text, "1000000000") {
+			t.Errorf("csv should keep integers as written: %q", text)
+		}
+	case FormatJSON:
+		var data []map[string]any
+		if err := json.Unmarshal(out, &data); err != nil || len(data) != 1 {
+			t.Errorf("class %d json = %s, err = %v", class.ID, out, err)
+		}
+	case FormatPDF:
+		checkPDF(t, out)
+	}
+}
+
+// checkPDF 校验文件头、结尾及交叉引用表中每个对象的偏移
+func checkPDF(t *testing.T, out []byte) {
+	t.Helper()
+	s := string(out)
+	if !strings.HasPrefix(s, "%PDF-1.4") || !strings.HasSuffix(s, "%%EOF\n") {
+		t.Fatalf("invalid pdf envelope")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(s)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(m[1])
+	if !strings.HasPrefix(s[xref:], "xref\n") {
+		t.Fatalf("startxref %d does not point to xref", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(s[xref:], -1)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(e[1])
+		if want := strconv.Itoa(i+1) + " 0 obj"; !strings.HasPrefix(s[off:], want) {
+			t.Errorf("object %d offset %d points to %q", i+1, off, s[off:off+10])
+		}
+	}
+}
+
+func TestLedgerPDFPagination(t *testing.T) {
+	class, _ := LookupClass(SceneDetailLedgerClass)
+	var rows []map[string]any
+	for i := 0; i < 100; i++ {
+		rows = append(rows, map[string]any{"scenario": strings.Repeat("很长的场景名称", 10), "success": i})
+	}
+	raw, _ := json.Marshal(rows)
+	decoded, err := class.Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := class.Render(&buf, FormatPDF, decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkPDF(t, buf.Bytes())
+	if !strings.Contains(buf.String(), "/Count 3") {
+		t.Error("100 rows should span 3 pages")
+	}
+}
+
+func TestLedgerRegistryErrors(t *testing.T) {
+	if _, err := LookupClass(99); !errors.Is(err, ErrUnknownClass) {
+		t.Errorf("err = %v, want unknown class", err)
+	}
+	class, _ := LookupClass(HighLevelLedgerClass)
+	if class.Supports("docx") {
+		t.Error("docx should not be supported")
+	}
+	if err := class.Render(&bytes.Buffer{}, "docx", Rows{}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("err = %v, want unsupported format", err)
+	}
+	if _, err := class.Decode([]byte(`{"not":"a list"}`)); err == nil {
+		t.Error("invalid data should fail to decode")
+	}
+}
+
+func TestSupportLedgerLayout(t *testing.T) {
+	class, _ := LookupClass(LargeModelSupportLedgerClass)
+	rows, err := class.Decode([]byte(sampleRows[LargeModelSupportLedgerClass]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := class.Render(&buf, FormatXLSX, rows); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sheet := f.GetSheetList()[0]
+	// 两个部门各占一行，模型级的列合并
+	merged, _ := f.GetMergeCells(sheet)
+	ranges := map[string]bool{}
+	for _, m := range merged {
+		ranges[m.GetStartAxis()+":"+m.GetEndAxis()] = true
+	}
+	for _, want := range []string{"B3:B4", "F3:F4", "I3:I4", "A5:B5"} {
+		if !ranges[want] {
+			t.Errorf("missing merged range %s in %v", want, ranges)
+		}
+	}
+	cells := map[string]string{"D4": "数据管理部", "E4": "1", "A5": "合计", "G5": "4730", "H5": "94.60%", "I5": "168"}
+	for cell, want := range cells {
+		if got, _ := f.GetCellValue(sheet, cell); got != want {
+			t.Errorf("%s = %q, want %q", cell, got, want)
+		}
+	}
+
+	var csv bytes.Buffer
+	class.Render(&csv, FormatCSV, rows)
+	if !strings.Contains(csv.String(), "人工智能中心 2、数据管理部 1") {
+		t.Errorf("csv = %s", csv.String())
+	}
+}
@@ -0,0 +1,155 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"monitor/config"
+	"monitor/internal/service/dao"
+	"monitor/internal/service/es"
+	"monitor/internal/types"
+	"time"
+)
+
+const rollupDayFormat = "2006-01-02"
+
+// InvokingRollup 将网关日志按天汇总到 invoking_daily，累计调用量 = 历史汇总 + 当天实时统计
+type InvokingRollup struct {
+	esClient     es.EsRepo
+	invokingDao  dao.IInvokingDao
+	backfillDays int
+}
+
+func NewInvokingRollup() *InvokingRollup {
+	return &InvokingRollup{
+		esClient:     es.NewESService(config.GetEsConfig()),
+		invokingDao:  dao.NewInvokingDao(nil),
+		backfillDays: config.GetDBConfig().RollupBackfillDays,
+	}
+}
+
+// Start 启动时补齐缺失日期，之后每天零点过后汇总前一天
+func (r *InvokingRollup) Start(ctx context.Context) {
+	go func() {
+		for {
+			if err := r.Sync(time.Now()); err != nil {
+				log.Printf("每日调用量汇总失败: %v", err)
+			}
+			now := time.Now()
+			next := startOfDay(now).AddDate(0, 0, 1).Add(10 * time.Minute)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(next.Sub(now)):
+			}
+		}
+	}()
+}
+
+// Sync 汇总最新已汇总日期之后到昨天的数据，首次运行回溯 backfillDays 天。
+// 无调用的日期不会落库，下次同步会重新统计这些日期，结果不变。
+func (r *InvokingRollup) Sync(now time.Time) error {
+	today := startOfDay(now)
+	start := today.AddDate(0, 0, -r.backfillDays)
+
+	latest, err := r.invokingDao.LatestDay()
+	if err != nil {
+		return err
+	}
+	if latest != "" {
+		day, err := time.ParseInLocation(rollupDayFormat, latest, time.Local)
+		if err != nil {
+			return fmt.Errorf("无效的汇总日期 %s: %w", latest, err)
+		}
+		start = day.AddDate(0, 0, 1)
+	}
+
+	for day := start; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if err := r.RollupDay(day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollupDay 统计并覆盖写入某一天的调用量
+func (r *InvokingRollup) RollupDay(day time.Time) error {
+	day = startOfDay(day)
+	from := day.UnixMilli()
+	to := day.AddDate(0, 0, 1).UnixMilli() - 1
+
+	counts, err := countSceneModel(r.esClient, from, to)
+	if err != nil {
+		return err
+	}
+
+	dayStr := day.Format(rollupDayFormat)
+	rows := make([]dao.InvokingDaily, 0)
+	for scene, models := range counts {
+		for model, count := range models {
+			rows = append(rows, dao.InvokingDaily{
+				Day:     dayStr,
+				Scene:   scene,
+				Model:   model,
+				Total:   count.Total,
+				Success: count.Success,
+			})
+		}
+	}
+	return r.invokingDao.UpsertDaily(rows)
+}
+
+// Cumulative 场景×模型 累计调用量，[scene][model]
+func (r *InvokingRollup) Cumulative(now time.Time) (map[string]map[string]types.InvokingTotal, error) {
+	today := startOfDay(now)
+	sums, err := r.invokingDao.SumBefore(today.Format(rollupDayFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := countSceneModel(r.esClient, today.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	for _, sum := range sums {
+		if _, ok := result[sum.Scene]; !ok {
+			result[sum.Scene] = make(map[string]types.InvokingTotal)
+		}
+		total := result[sum.Scene][sum.Model]
+		total.Total += sum.Total
+		total.Success += sum.Success
+		result[sum.Scene][sum.Model] = total
+	}
+	return result, nil
+}
+
+// 时间范围内 场景×模型 的调用总量与成功量
+func countSceneModel(esClient es.EsRepo, from, to int64) (map[string]map[string]types.InvokingTotal, error) {
+	result := make(map[string]map[string]types.InvokingTotal)
+	if to <= from {
+		return result, nil
+	}
+	all, err := esClient.Count(from, to, "", "onAuth", "")
+	if err != nil {
+		return nil, err
+	}
+	success, err := esClient.Count(from, to, "success", "onAuth", "")
+	if err != nil {
+		return nil, err
+	}
+	for scene, models := range all {
+		result[scene] = make(map[string]types.InvokingTotal)
+		for model, count := range models {
+			result[scene][model] = types.InvokingTotal{
+				Total:   count,
+				Success: success[scene][model],
+			}
+		}
+	}
+	return result, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
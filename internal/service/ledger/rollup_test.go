@@ -0,0 +1,87 @@
+package ledger
+
+import (
+	"monitor/internal/service/dao"
+	"monitor/internal/service/es"
+	"sort"
+	"testing"
+	"time"
+)
+
+type memInvokingDao struct {
+	rows map[string]dao.InvokingDaily
+}
+
+func (m *memInvokingDao) UpsertDaily(rows []dao.InvokingDaily) error {
+	for _, row := range rows {
+		m.rows[row.Day+"|"+row.Scene+"|"+row.Model] = row
+	}
+	return nil
+}
+
+func (m *memInvokingDao) LatestDay() (string, error) {
+	days := make([]string, 0)
+	for _, row := range m.rows {
+		days = append(days, row.Day)
+	}
+	if len(days) == 0 {
+		return "", nil
+	}
+	sort.Strings(days)
+	return days[len(days)-1], nil
+}
+
+func (m *memInvokingDao) SumBefore(before string) ([]dao.InvokingSum, error) {
+	sums := make(map[string]*dao.InvokingSum)
+	for _, row := range m.rows {
+		if row.Day >= before {
+			continue
+		}
+		key := row.Scene + "|" + row.Model
+		if _, ok := sums[key]; !ok {
+			sums[key] = &dao.InvokingSum{Scene: row.Scene, Model: row.Model}
+		}
+		sums[key].Total += row.Total
+		sums[key].Success += row.Success
+	}
+	result := make([]dao.InvokingSum, 0)
+	for _, sum := range sums {
+		result = append(result, *sum)
+	}
+	return result, nil
+}
+
+func TestInvokingRollupCumulative(t *testing.T) {
+	esClient, err := es.NewMockESService("../es/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &InvokingRollup{
+		esClient:     esClient,
+		invokingDao:  &memInvokingDao{rows: make(map[string]dao.InvokingDaily)},
+		backfillDays: 7,
+	}
+
+	now := time.Now()
+	if err := r.Sync(now); err != nil {
+		t.Fatal(err)
+	}
+	// 再次同步不应重复累加
+	if err := r.Sync(now); err != nil {
+		t.Fatal(err)
+	}
+
+	cumulative, err := r.Cumulative(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cumulative["sk-a"]["m1"]; got.Total != 2 || got.Success != 1 {
+		t.Errorf("sk-a/m1 = %+v, want total 2 success 1", got)
+	}
+	if got := cumulative["sk-a"]["m2"]; got.Total != 1 || got.Success != 1 {
+		t.Errorf("sk-a/m2 = %+v, want total 1 success 1", got)
+	}
+	if _, ok := cumulative["sk-c"]; ok {
+		t.Errorf("doc before backfill window counted: %+v", cumulative["sk-c"])
+	}
+}
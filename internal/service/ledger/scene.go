@@ -2,11 +2,11 @@ package ledger
 
 import (
 	"context"
-	"fmt"
 	"github.com/jinzhu/copier"
 	"log"
 	"monitor/config"
 	"monitor/internal/client"
+	"monitor/internal/service/catalog"
 	"monitor/internal/service/scene"
 	"monitor/internal/types"
 	"strings"
@@ -18,6 +18,11 @@ const (
 	CallModelName KeyModel = "callmodelname"
 )
 
+// sceneSource 场景元数据来源，由 SceneLedger 实现
+type sceneSource interface {
+	GetSceneInfoMap(key KeyModel) (map[string]types.SceneInfoItem, error)
+}
+
 type SceneLedger struct {
 	client *client.DCEClient
 }
@@ -32,23 +37,32 @@ func NewSceneLedger(ctx context.Context) *SceneLedger {
 }
 
 // 传参为"scene" key为token 传参为“model”key为model 传参为“callmodelname”key为模型描述。
+// 优先读取场景登记表（已应用人工修正），登记表尚未可用时直接查询 DCE 与 Grafana。
 func (s *SceneLedger) GetSceneInfoMap(key KeyModel) (map[string]types.SceneInfoItem, error) {
-	url := "/apis/auth.engine.io/v1/workspaces/2/tokens/list"
+	if c := catalog.Default(); c.Ready() {
+		switch key {
+		case Scene:
+			return c.ByToken(), nil
+		case Model:
+			return c.ByModel(), nil
+		case CallModelName:
+			return c.ByCallModelName(), nil
+		}
+	}
 	pageSize := 50
-	infosResp, err := s.client.GetSceneManageInfo(url, pageSize)
+	infosResp, err := s.client.GetSceneManageInfo(client.SceneTokenListURL, pageSize)
 	if err != nil {
 		return nil, err
 	}
-	grafanaConf := config.Grafana
-	iGrafanaService := scene.NewGrafanaService(&grafanaConf)
-	sceneLabel, err := iGrafanaService.GenerateApiSixScenarioKeyMapMock()
-	for k, v := range sceneLabel {
-		fmt.Println("key", k)
-		fmt.Println("value", v)
-	}
-	if err != nil {
-		log.Println(err)
-		return nil, err
+	// 场景标签来自定时刷新的注册表，仅按 token 索引时需要
+	var sceneLabel map[string]string
+	if key == Scene {
+		grafanaConf := config.GetGrafanaConfig()
+		sceneLabel, err = scene.NewGrafanaService(&grafanaConf).GenerateApiSixScenarioKeyMapMock()
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
 	}
 
 	SceneMap := make(map[string]types.SceneInfoItem, 0)
@@ -0,0 +1,132 @@
+package ledger
+
+import (
+	"fmt"
+	"io"
+	"monitor/internal/service/export"
+	"monitor/util"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// TemplateVars 模板中可用的变量，另有 {{row.列标题}}、{{sum.列标题}}，见 export.Template
+var TemplateVars = []string{"title", "name", "period", "from", "to", "generated", "count"}
+
+// TemplateSource 台账类别当前选用的 xlsx 模板，未选用时返回 nil，使用内置版式
+type TemplateSource func(id LedgerClass) (*export.Template, error)
+
+var templateSource TemplateSource
+
+// UseTemplates 设置模板来源，未设置时 xlsx 均使用内置版式
+func UseTemplates(source TemplateSource) {
+	templateSource = source
+}
+
+func (c *Class) template() (*export.Template, error) {
+	if templateSource == nil {
+		return nil, nil
+	}
+	tpl, err := templateSource(c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("读取台账 %d 的模板失败: %w", c.ID, err)
+	}
+	return tpl, nil
+}
+
+// ParseTemplate 解析本类别的模板，占位符中的列标题须为本类别的列
+func (c *Class) ParseTemplate(data []byte) (*export.Template, error) {
+	return export.ParseTemplate(data, c.columns, TemplateVars)
+}
+
+// RenderTemplate 用模板输出 xlsx
+func (c *Class) RenderTemplate(w io.Writer, tpl *export.Template, rows Rows) error {
+	return c.renderTemplate(w, tpl, rows, nil)
+}
+
+func (c *Class) renderTemplate(w io.Writer, tpl *export.Template, rows Rows, extras *export.Extras) error {
+	loc, err := util.LoadLocation("")
+	if err != nil {
+		return err
+	}
+	vars := map[string]any{
+		"title":     c.Title,
+		"name":      c.Name,
+		"period":    "",
+		"from":      "",
+		"to":        "",
+		"generated": time.Now().In(loc).Format(time.DateTime),
+		"count":     rows.Len,
+	}
+	if rows.From > 0 || rows.To > 0 {
+		vars["period"] = formatPeriod(Period{From: rows.From, To: rows.To})
+		vars["from"] = time.UnixMilli(rows.From).In(loc).Format(time.DateOnly)
+		vars["to"] = time.UnixMilli(rows.To).In(loc).Format(time.DateOnly)
+	}
+	return tpl.Execute(w, c.Table(rows), vars, extras)
+}
+
+// WriteStarterTemplate 输出本类别的起始模板：标题、统计周期、表头、重复行及合计行，供在此基础上调整版式
+func (c *Class) WriteStarterTemplate(w io.Writer) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := export.SheetName(c.Title)
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+	last, _ := excelize.ColumnNumberToName(len(c.columns))
+	border := []excelize.Border{
+		{Type: "left", Color: "000000", Style: 1}, {Type: "top", Color: "000000", Style: 1},
+		{Type: "bottom", Color: "000000", Style: 1}, {Type: "right", Color: "000000", Style: 1},
+	}
+	titleStyle, _ := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true, Size: 14},
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"#4472C4"}, Pattern: 1},
+		Font:      &excelize.Font{Bold: true, Color: "#FFFFFF"},
+		Border:    border,
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	dataStyle, _ := f.NewStyle(&excelize.Style{
+		Border:    border,
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	totalStyle, _ := f.NewStyle(&excelize.Style{
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"#D6DCE4"}, Pattern: 1},
+		Font:      &excelize.Font{Bold: true},
+		Border:    border,
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+
+	f.SetCellValue(sheet, "A1", "{{title}}")
+	f.MergeCell(sheet, "A1", last+"1")
+	f.SetCellStyle(sheet, "A1", last+"1", titleStyle)
+	f.SetCellValue(sheet, "A2", "统计周期：{{period}}    生成时间：{{generated}}")
+	f.MergeCell(sheet, "A2", last+"2")
+
+	header := make([]any, len(c.columns))
+	data := make([]any, len(c.columns))
+	total := make([]any, len(c.columns))
+	for i, col := range c.columns {
+		header[i] = col
+		data[i] = "{{row." + col + "}}"
+	}
+	total[0] = "合计"
+	for _, idx := range c.totals {
+		total[idx] = "{{sum." + c.columns[idx] + "}}"
+	}
+	f.SetSheetRow(sheet, "A3", &header)
+	f.SetSheetRow(sheet, "A4", &data)
+	f.SetSheetRow(sheet, "A5", &total)
+	f.SetCellStyle(sheet, "A3", last+"3", headerStyle)
+	f.SetCellStyle(sheet, "A4", last+"4", dataStyle)
+	f.SetCellStyle(sheet, "A5", last+"5", totalStyle)
+	f.SetColWidth(sheet, "A", last, 16)
+
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("写入台账模板失败: %w", err)
+	}
+	return nil
+}
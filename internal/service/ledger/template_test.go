@@ -0,0 +1,259 @@
+package ledger
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"monitor/internal/service/excel"
+	"monitor/internal/service/export"
+	"slices"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func highLevelRows(t *testing.T, c *Class) Rows {
+	t.Helper()
+	data, _ := json.Marshal([]excel.DataRow{
+		{Env: "生产", ComputeP: 461.5, Model: "910B", ModelUsed: "Qwen3-32B", UsedCard: 27},
+		{Env: "生产", ComputeP: 461.5, Model: "910B", ModelUsed: "QwQ-32B", UsedCard: 24},
+		{Env: "生产", ComputeP: 521.5, Model: "v300", ModelUsed: "Qwen3-8B", UsedCard: 168},
+		{Env: "开发", ComputeP: 16, Model: "v300", ModelUsed: "Qwen3-8B", UsedCard: 8},
+	})
+	rows, err := c.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func newTemplate(t *testing.T, cells map[string]string) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	for cell, text := range cells {
+		f.SetCellValue("Sheet1", cell, text)
+	}
+	f.MergeCell("Sheet1", "D3", "E3")
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openXLSX(t *testing.T, data []byte) *excelize.File {
+	t.Helper()
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestRenderTemplate(t *testing.T) {
+	c, _ := LookupClass(HighLevelLedgerClass)
+	data := newTemplate(t, map[string]string{
+		"A1": "{{title}}（{{period}}）",
+		"A2": "环境", "B2": "型号", "C2": "模型", "D2": "卡数",
+		"A3": "{{row.环境|merge}}", "B3": "{{ row.型号 | merge }}", "C3": "{{row.模型}}", "D3": "{{row.使用卡数}} 张",
+		"A4": "合计", "C4": "共 {{count}} 个模型", "D4": "{{sum.使用卡数}}",
+	})
+	tpl, err := c.ParseTemplate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := highLevelRows(t, c)
+	rows.From, rows.To = 1759248000000, 1761840000000
+	var buf bytes.Buffer
+	if err := c.RenderTemplate(&buf, tpl, rows); err != nil {
+		t.Fatal(err)
+	}
+	f := openXLSX(t, buf.Bytes())
+	defer f.Close()
+
+	for cell, want := range map[string]string{
+		"A1": "高性能算力及大模型部署情况（2025-10-01 至 2025-10-31）",
+		"C3": "Qwen3-32B", "C6": "Qwen3-8B", "D4": "24 张",
+		"A7": "合计", "C7": "共 4 个模型", "D7": "227",
+	} {
+		if got, _ := f.GetCellValue("Sheet1", cell); got != want {
+			t.Errorf("%s = %q, want %q", cell, got, want)
+		}
+	}
+	// 合计保留为数字单元格
+	if typ, _ := f.GetCellType("Sheet1", "D7"); typ != excelize.CellTypeNumber && typ != excelize.CellTypeUnset {
+		t.Errorf("D7 type = %v", typ)
+	}
+	merged, _ := f.GetMergeCells("Sheet1")
+	var ranges []string
+	for _, m := range merged {
+		ranges = append(ranges, m.GetStartAxis()+":"+m.GetEndAxis())
+	}
+	// 环境合并生产三行；型号 v300 跨环境不合并；行内横向合并随重复区域复制
+	for _, want := range []string{"A3:A5", "B3:B4", "D3:E3", "D6:E6"} {
+		if !slices.Contains(ranges, want) {
+			t.Errorf("merged cells %v missing %s", ranges, want)
+		}
+	}
+	if slices.Contains(ranges, "B5:B6") {
+		t.Errorf("v300 merged across environments: %v", ranges)
+	}
+}
+
+func TestRenderTemplateCopiesRowFormat(t *testing.T) {
+	c, _ := LookupClass(HighLevelLedgerClass)
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "{{title}}")
+	f.SetCellValue("Sheet1", "A2", "{{row.#}}")
+	f.SetCellValue("Sheet1", "B2", "{{row.模型}}")
+	f.SetCellValue("Sheet1", "C2", "{{row.使用卡数}}")
+	f.SetCellValue("Sheet1", "D2", "张")
+	f.SetCellFormula("Sheet1", "E2", `C2*2&"张"`)
+	f.SetRowHeight("Sheet1", 2, 30)
+	style, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	f.SetCellStyle("Sheet1", "A2", "E2", style)
+	f.SetCellValue("Sheet1", "A3", "合计")
+	f.SetCellFormula("Sheet1", "C3", "SUM(C2:C2)")
+	var tplData bytes.Buffer
+	if err := f.Write(&tplData); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	tpl, err := c.ParseTemplate(tplData.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 行数较多时逐行插入为平方复杂度，一次插入后复制应很快完成
+	const n = 20000
+	data := make([]excel.DataRow, n)
+	for i := range data {
+		data[i] = excel.DataRow{Env: "生产", Model: "910B", ModelUsed: "Qwen3-8B", UsedCard: i % 8}
+	}
+	raw, _ := json.Marshal(data)
+	rows, err := c.Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.RenderTemplate(&buf, tpl, rows); err != nil {
+		t.Fatal(err)
+	}
+	out := openXLSX(t, buf.Bytes())
+	defer out.Close()
+
+	last := n + 1
+	for cell, want := range map[string]string{
+		"A2": "1", fmt.Sprintf("A%d", last): fmt.Sprint(n), fmt.Sprintf("D%d", last): "张",
+		fmt.Sprintf("A%d", last+1): "合计",
+	} {
+		if got, _ := out.GetCellValue("Sheet1", cell); got != want {
+			t.Errorf("%s = %q, want %q", cell, got, want)
+		}
+	}
+	if got, _ := out.GetCellFormula("Sheet1", fmt.Sprintf("E%d", last)); got != fmt.Sprintf(`C%d*2&"张"`, last) {
+		t.Errorf("copied formula = %q", got)
+	}
+	if got, _ := out.GetCellFormula("Sheet1", fmt.Sprintf("C%d", last+1)); got == "" {
+		t.Error("total formula not moved below the rows")
+	}
+	if h, _ := out.GetRowHeight("Sheet1", last); h != 30 {
+		t.Errorf("row height = %v", h)
+	}
+	if s, _ := out.GetCellStyle("Sheet1", fmt.Sprintf("B%d", last)); s != style {
+		t.Errorf("cell style = %d, want %d", s, style)
+	}
+}
+
+func TestParseTemplateUnzipLimit(t *testing.T) {
+	c, _ := LookupClass(HighLevelLedgerClass)
+	data := newTemplate(t, map[string]string{"A3": "{{row.环境}}"})
+	// 在合法模板中追加一个解压后很大的文件
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bomb bytes.Buffer
+	zw := zip.NewWriter(&bomb)
+	for _, file := range zr.File {
+		if err := zw.Copy(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, _ := zw.Create("xl/media/padding.bin")
+	w.Write(make([]byte, 64<<20))
+	zw.Close()
+	if bomb.Len() > 1<<20 {
+		t.Fatalf("compressed size = %d", bomb.Len())
+	}
+	if _, err := c.ParseTemplate(bomb.Bytes()); !errors.Is(err, export.ErrInvalidTemplate) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	c, _ := LookupClass(HighLevelLedgerClass)
+	for name, cells := range map[string]map[string]string{
+		"no placeholder": {"A1": "算力分布"},
+		"unknown column": {"A3": "{{row.机房}}"},
+		"unknown var":    {"A1": "{{author}}"},
+		"two regions":    {"A3": "{{row.环境}}", "A5": "{{row.模型}}"},
+		"merge in text":  {"A3": "环境：{{row.环境|merge}}"},
+		"bad option":     {"A3": "{{row.环境|upper}}"},
+	} {
+		if _, err := c.ParseTemplate(newTemplate(t, cells)); !errors.Is(err, export.ErrInvalidTemplate) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestRenderUsesSelectedTemplate(t *testing.T) {
+	c, _ := LookupClass(SceneDetailLedgerClass)
+	var starter bytes.Buffer
+	if err := c.WriteStarterTemplate(&starter); err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := c.ParseTemplate(starter.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseTemplates(func(id LedgerClass) (*export.Template, error) {
+		if id == c.ID {
+			return tpl, nil
+		}
+		return nil, nil
+	})
+	defer UseTemplates(nil)
+
+	rows, _ := c.Decode([]byte(`[{"environment":"生产","model":"Qwen3-8B","scenario":"罗盘-知识问答","success":80,"history":1000,"totalTokens":5},` +
+		`{"environment":"开发","model":"Qwen3-8B","scenario":"OA系统公文校对","success":20,"history":10,"totalTokens":7}]`))
+	var buf bytes.Buffer
+	if err := c.RenderNotes(&buf, FormatXLSX, rows, []string{"审核人：carol"}); err != nil {
+		t.Fatal(err)
+	}
+	f := openXLSX(t, buf.Bytes())
+	defer f.Close()
+	sheet := f.GetSheetName(f.GetActiveSheetIndex())
+	got, _ := f.GetRows(sheet)
+	if len(got) != 8 || got[0][0] != c.Title || got[2][0] != "环境" || got[4][2] != "OA系统公文校对" || got[5][0] != "合计" || got[7][0] != "审核人：carol" {
+		t.Errorf("rows = %v", got)
+	}
+	if v, _ := f.GetCellValue(sheet, "H6"); v != "100" {
+		t.Errorf("本期成功调用量合计 = %q", v)
+	}
+
+	// 其他类别仍使用专用版式
+	other, _ := LookupClass(HighLevelLedgerClass)
+	buf.Reset()
+	if err := other.Render(&buf, FormatXLSX, highLevelRows(t, other)); err != nil {
+		t.Fatal(err)
+	}
+	g := openXLSX(t, buf.Bytes())
+	defer g.Close()
+	if v, _ := g.GetCellValue("算力分布", "A1"); v != "算力分布情况" {
+		t.Errorf("builtin layout A1 = %q", v)
+	}
+}
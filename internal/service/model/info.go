@@ -3,8 +3,8 @@ package model
 import (
 	"context"
 	"fmt"
-	"monitor/config"
 	"monitor/internal/client"
+	"monitor/internal/service/datasource"
 	"monitor/internal/types"
 	"time"
 )
@@ -24,16 +24,12 @@ func NewModelQueryReq(ctx context.Context, from int64, to int64) *ModelQueryReq
 }
 
 func (m *ModelQueryReq) GetPodInfo(data_name, keyword string) (*types.VectorResponse, error) {
-	query := config.NewQueryConfig()
+	expr := BuildModelExpr(data_name, keyword)
+	if expr == "" {
+		return nil, fmt.Errorf("不支持的查询类型: %s", data_name)
+	}
 	now := time.Now()
-	fiveMinutesAgo := now.Add(-5 * time.Minute)
-	// 生成秒级Unix时间戳（10位字符串格式）
-	nowTimestamp := fmt.Sprintf("%d", now.Unix())
-	fiveMinutesAgoTimestamp := fmt.Sprintf("%d", fiveMinutesAgo.Unix())
-
-	queryStr := BuildModelQueryRange(data_name, keyword, fiveMinutesAgoTimestamp, nowTimestamp)
-	client := client.NewDCEClient(m.ctx, config.GetGrafanaQueryConfig().ClusterBaseURL, query.InsecureSkipVerify)
-	result, err := client.MakeGetReqRange(queryStr, "/apis/insight.io/v1alpha1/metric/queryrange")
+	result, err := datasource.Default().QueryRange(m.ctx, expr, client.Range{Start: now.Add(-5 * time.Minute), End: now})
 	if err != nil {
 		fmt.Println(err)
 	}
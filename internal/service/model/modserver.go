@@ -9,12 +9,15 @@ import (
 	"monitor/internal/common"
 	"monitor/internal/models"
 	"monitor/internal/service/es"
+	"monitor/internal/service/tenant"
 	"monitor/internal/types"
 	"monitor/util"
 	"sort"
 	"strings"
 )
 
+const maxTrendSeries = 10
+
 // 这里负责获取日志部分代码
 type ModelRepo interface {
 	ModelsCountCards(req models.ModelsListRequest) (*types.PagedModelsResponse, error)
@@ -26,12 +29,15 @@ type ModelRepo interface {
 
 type ModelDomain struct {
 	SceneMap map[string]string `json:"scene_map"`
-	ctx      context.Context
+	// 调用方可查看的场景，nil 不限制
+	Filter tenant.SceneFilter `json:"-"`
+	ctx    context.Context
 }
 
-func NewModelRepo(ctx context.Context, SceneMap map[string]string) ModelRepo {
+func NewModelRepo(ctx context.Context, SceneMap map[string]string, filter tenant.SceneFilter) ModelRepo {
 	return &ModelDomain{
 		SceneMap: SceneMap,
+		Filter:   filter,
 		ctx:      ctx,
 	}
 }
@@ -51,7 +57,7 @@ func (s *ModelDomain) ModelsDetailInfo(req models.ModelWithCodeRequest) (*types.
 	resultScenes := make([]types.SceneCountData, 0)
 	for k := range resultScene {
 		SceneName, exist := s.SceneMap[k]
-		if !exist {
+		if !exist || !s.Filter.Allow(k) {
 			continue
 		}
 
@@ -68,16 +74,100 @@ func (s *ModelDomain) ModelsDetailInfo(req models.ModelWithCodeRequest) (*types.
 	return &types.ModelDetailResp{SceneDetails: resultScenes}, nil
 }
 
+// 调用量趋势，最多对比 maxTrendSeries 条序列
 func (s *ModelDomain) ModelsDetailTrend(req models.ModelWithCodeRequest) (*types.ModelDetailTrend, error) {
-	appConfig := config.GetEsConfig()
-	ec := es.NewESService(appConfig)
-	resultTrend, err := ec.CountDailyLogsByFixedAuthModel(req.ModelName, req.AuthCode)
+	from := util.ToInt64(req.From)
+	to := util.ToInt64(req.To)
+
+	if from <= 0 || to <= from {
+		return nil, fmt.Errorf("无效的时间范围: from=%d to=%d", from, to)
+	}
+	loc, err := util.LoadLocation(req.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]string, 0)
+	for _, item := range strings.Split(req.Series, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			series = append(series, item)
+		}
+	}
+	if len(series) > maxTrendSeries {
+		return nil, fmt.Errorf("对比序列最多 %d 条", maxTrendSeries)
+	}
+
+	// 自动粒度分桶过多时逐级放粗；指定的粒度分桶过多时拒绝
+	interval := req.Interval
+	switch interval {
+	case "", "auto":
+		interval = types.TrendInterval(from, to)
+		for interval != types.TrendWeek && types.CheckTrendBuckets(from, to, interval, len(series)) != nil {
+			interval = types.CoarserTrendInterval(interval)
+		}
+	case types.TrendMinute, types.TrendHour, types.TrendDay, types.TrendWeek:
+	default:
+		return nil, fmt.Errorf("不支持的统计粒度: %s", req.Interval)
+	}
+	if err := types.CheckTrendBuckets(from, to, interval, len(series)); err != nil {
+		return nil, err
+	}
+
+	// 部门隔离：指定的场景需在范围内，未指定场景时仅统计范围内的场景
+	var authCodes []string
+	switch {
+	case req.SeriesBy == types.SeriesByScene:
+		for _, item := range series {
+			if err := s.Filter.Check(item); err != nil {
+				return nil, err
+			}
+		}
+	case req.AuthCode != "":
+		if err := s.Filter.Check(req.AuthCode); err != nil {
+			return nil, err
+		}
+	default:
+		authCodes = s.Filter.Scenes()
+	}
+
+	ec := es.NewESService(config.GetEsConfig())
+	resultTrend, err := ec.CountTrend(types.TrendParams{
+		From:      from,
+		To:        to,
+		Interval:  interval,
+		Location:  loc,
+		AuthCode:  req.AuthCode,
+		AuthCodes: authCodes,
+		ModelName: req.ModelName,
+		SeriesBy:  req.SeriesBy,
+		Series:    series,
+	})
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	return &types.ModelDetailTrend{ModelDetailTrend: resultTrend}, nil
+	trend := &types.ModelDetailTrend{
+		ModelDetailTrend: make([]types.DateCount, 0),
+		Interval:         interval,
+		Timezone:         loc.String(),
+		// 查询结果可能来自缓存，复制后再填充名称
+		Series: append(make([]types.TrendSeries, 0, len(resultTrend)), resultTrend...),
+	}
+	for i := range trend.Series {
+		if name, exist := s.SceneMap[trend.Series[i].Key]; exist {
+			trend.Series[i].Name = name
+		}
+	}
+	if len(resultTrend) > 0 {
+		for _, point := range resultTrend[0].Points {
+			trend.ModelDetailTrend = append(trend.ModelDetailTrend, types.DateCount{
+				Date:  point.Date,
+				Count: point.Count,
+			})
+		}
+	}
+	return trend, nil
 }
 
 func (s *ModelDomain) ModelsCountCards(req models.ModelsListRequest) (*types.PagedModelsResponse, error) {
@@ -92,16 +182,35 @@ func (s *ModelDomain) ModelsCountCards(req models.ModelsListRequest) (*types.Pag
 		return nil, err
 	}
 
+	tokenUsage, err := ec.SumTokens(from, to, "onModel")
+	if err != nil {
+		log.Println(err)
+	}
+
 	resultSceneData := make([]models.ModelCard, 0)
 	gserver := NewModelsServer(s.ctx, from, to)
 	for k, v := range resultScence {
-		modelPodInfo := gserver.GetPods(k)
 		var count int64
-		sceneNum := len(v)
-		for _, ts := range v {
+		sceneNum := 0
+		for scene, ts := range v {
+			if !s.Filter.Allow(scene) {
+				continue
+			}
+			sceneNum++
 			count += ts
 
 		}
+		// 部门隔离时不展示没有可见场景调用的模型
+		if sceneNum == 0 && s.Filter != nil {
+			continue
+		}
+		modelPodInfo := gserver.GetPods(k)
+		var usage types.TokenUsage
+		for scene, u := range tokenUsage[k] {
+			if s.Filter.Allow(scene) {
+				usage.Add(u)
+			}
+		}
 		var data models.ModelCard
 		data.ModelName = k
 		data.Scene = sceneNum
@@ -110,6 +219,10 @@ func (s *ModelDomain) ModelsCountCards(req models.ModelsListRequest) (*types.Pag
 		data.Qps = math.Round(diff*100) / 100
 		data.Status = modelPodInfo.status
 		data.Url = modelPodInfo.url
+		data.PromptTokens = usage.PromptTokens
+		data.CompletionTokens = usage.CompletionTokens
+		data.TotalTokens = usage.TotalTokens
+		data.Tps = util.RatePerSecond(usage.TotalTokens, from, to)
 		resultSceneData = append(resultSceneData, data)
 	}
 	totalItems := len(resultSceneData)
@@ -141,6 +254,11 @@ func (s *ModelDomain) ModelCountWithLog(req models.ModelWithCodeRequest) (*types
 	ec := es.NewESService(appConfig)
 	from := util.ToInt64(req.From)
 	to := util.ToInt64(req.To)
+	if req.AuthCode != "" {
+		if err := s.Filter.Check(req.AuthCode); err != nil {
+			return nil, err
+		}
+	}
 
 	resultScence, err := ec.GetDocumentFields(from, to, "failed", req.AuthCode, req.ModelName)
 	if err != nil {
@@ -166,6 +284,9 @@ func (s *ModelDomain) ModelCountWithLog(req models.ModelWithCodeRequest) (*types
 		request := fmt.Sprintf("request: %s", util.ToString(resultScence[i]["request"], ""))
 		http_host := fmt.Sprintf("http_host: %s", util.ToString(resultScence[i]["http_host"], ""))
 		authCode := util.ToString(resultScence[i]["http_authorization"], "")
+		if !s.Filter.Allow(authCode) {
+			continue
+		}
 		scene := s.SceneMap[authCode]
 		Log := []string{_id, req_uri, time, path, request_time, request, http_model, http_host, url, scene}
 		data.Log = Log
@@ -187,6 +308,10 @@ func (s *ModelDomain) ModelRequestTime(req models.ModelWithCodeRequest) (*types.
 	ec := es.NewESService(appConfig)
 	from := util.ToInt64(req.From)
 	to := util.ToInt64(req.To)
+	// 跨场景汇总，部门隔离时不提供
+	if s.Filter != nil {
+		return nil, tenant.ErrForbidden
+	}
 	resultScence, err := ec.GetDocumentFields(from, to, "success", "", req.ModelName)
 	if err != nil {
 		fmt.Println(err)
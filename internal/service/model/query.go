@@ -4,12 +4,8 @@ import (
 	"fmt"
 )
 
-func BuildModelQueryRange(data_name, keyword, start, end string) map[string]string {
-	query := make(map[string]string, 0)
+func BuildModelExpr(data_name, keyword string) string {
 	var expr string
-	if data_name == "" {
-		return query
-	}
 	if data_name == "cpu" {
 		expr = makeCPUExpr(keyword)
 	}
@@ -20,11 +16,7 @@ func BuildModelQueryRange(data_name, keyword, start, end string) map[string]stri
 		expr = makeProbeExpr(keyword)
 	}
 
-	return map[string]string{
-		"query": expr,
-		"start": start,
-		"end":   end,
-	}
+	return expr
 }
 
 func makeProbeExpr(modelName string) string {
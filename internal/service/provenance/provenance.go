@@ -0,0 +1,285 @@
+package provenance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"monitor/config"
+	"monitor/internal/service/dao"
+	"monitor/internal/service/export"
+	"monitor/internal/service/ledger"
+	"monitor/util"
+	"time"
+)
+
+// 核验结果
+const (
+	StatusVerified   = "verified"   // 与预览快照一致
+	StatusModified   = "modified"   // 与预览快照不一致
+	StatusUnverified = "unverified" // 未提供预览快照
+)
+
+var statusText = map[string]string{
+	StatusVerified:   "与预览快照一致",
+	StatusModified:   "提交数据已被修改",
+	StatusUnverified: "未提供预览快照，数据来源未经核验",
+}
+
+// SheetName 台账 xlsx 中隐藏的数据来源工作表
+const SheetName = "数据来源"
+
+var (
+	ErrSnapshotNotFound   = dao.ErrSnapshotNotFound
+	ErrProvenanceNotFound = dao.ErrProvenanceNotFound
+	ErrSnapshotMismatch   = errors.New("snapshot does not match ledger type or period")
+)
+
+// CellChange 提交数据与预览快照不一致的单元格，Row 从 1 开始
+type CellChange struct {
+	Row       int    `json:"row"`
+	Column    string `json:"column"`
+	Snapshot  string `json:"snapshot"`
+	Submitted string `json:"submitted"`
+}
+
+// Report 提交数据与预览快照的核对结果
+type Report struct {
+	SnapshotID       string       `json:"snapshotId"`
+	SnapshotTime     *time.Time   `json:"snapshotTime,omitempty"`
+	SnapshotChecksum string       `json:"snapshotChecksum"`
+	DataChecksum     string       `json:"dataChecksum"`
+	Status           string       `json:"status"`
+	ModifiedCells    int          `json:"modifiedCells"`
+	AddedRows        int          `json:"addedRows"`
+	RemovedRows      int          `json:"removedRows"`
+	Changes          []CellChange `json:"changes"`
+}
+
+// Store 保存台账预览快照，生成台账时核对提交的数据并记录核验结果；快照与台账文件的保留期限相同
+type Store struct {
+	dao       dao.ISnapshotDao
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewStore(snapshotDao dao.ISnapshotDao, retention time.Duration) *Store {
+	return &Store{dao: snapshotDao, retention: retention, now: time.Now}
+}
+
+// Default 使用数据库保存快照，数据库未连接时返回错误
+func Default() (*Store, error) {
+	if dao.GetDB() == nil {
+		return nil, errors.New("台账预览快照不可用：未连接数据库")
+	}
+	days := config.GetArtifactConfig().RetentionDays
+	return NewStore(dao.NewSnapshotDao(nil), time.Duration(days)*24*time.Hour), nil
+}
+
+// Snapshot 保存预览数据，返回快照ID及校验和
+func (s *Store) Snapshot(class *ledger.Class, rows ledger.Rows, from, to int64, creator string) (*dao.LedgerSnapshot, error) {
+	data, err := marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &dao.LedgerSnapshot{
+		SnapshotID: dao.NewUUID(),
+		LedgerType: int(class.ID),
+		PeriodFrom: from,
+		PeriodTo:   to,
+		Data:       string(data),
+		Rows:       rows.Len,
+		Checksum:   checksum(data),
+		Creator:    creator,
+		CreateTime: s.now(),
+	}
+	if err := s.dao.CreateSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Verify 逐行逐列对比提交的数据与预览快照。快照的台账类型或统计周期与提交不一致时返回 ErrSnapshotMismatch
+func (s *Store) Verify(snapshotID string, class *ledger.Class, submitted ledger.Rows, from, to int64) (*Report, error) {
+	snapshot, err := s.dao.GetSnapshot(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.LedgerType != int(class.ID) || snapshot.PeriodFrom != from || snapshot.PeriodTo != to {
+		return nil, ErrSnapshotMismatch
+	}
+	data, err := marshal(submitted)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		SnapshotID:       snapshot.SnapshotID,
+		SnapshotTime:     &snapshot.CreateTime,
+		SnapshotChecksum: snapshot.Checksum,
+		DataChecksum:     checksum(data),
+		Status:           StatusVerified,
+	}
+	if report.DataChecksum == snapshot.Checksum {
+		return report, nil
+	}
+
+	original, err := class.Decode([]byte(snapshot.Data))
+	if err != nil {
+		return nil, err
+	}
+	columns := class.Columns()
+	before := class.Table(original).Strings()
+	after := class.Table(submitted).Strings()
+	for i := 0; i < len(before) && i < len(after); i++ {
+		for j, col := range columns {
+			if before[i][j] != after[i][j] {
+				report.Changes = append(report.Changes, CellChange{Row: i + 1, Column: col, Snapshot: before[i][j], Submitted: after[i][j]})
+			}
+		}
+	}
+	report.ModifiedCells = len(report.Changes)
+	if len(after) > len(before) {
+		report.AddedRows = len(after) - len(before)
+	} else {
+		report.RemovedRows = len(before) - len(after)
+	}
+	// 字段均相同但校验和不同时（例如未输出为列的字段被修改）也视为修改
+	report.Status = StatusModified
+	return report, nil
+}
+
+// Unverified 未提供预览快照时的核验结果
+func Unverified(rows ledger.Rows) (*Report, error) {
+	data, err := marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &Report{DataChecksum: checksum(data), Status: StatusUnverified}, nil
+}
+
+// Record 记录台账文件的核验结果
+func (s *Store) Record(artifactID string, report *Report) error {
+	changes, err := json.Marshal(report.Changes)
+	if err != nil {
+		return err
+	}
+	return s.dao.CreateProvenance(&dao.LedgerProvenance{
+		ArtifactID:       artifactID,
+		SnapshotID:       report.SnapshotID,
+		SnapshotChecksum: report.SnapshotChecksum,
+		DataChecksum:     report.DataChecksum,
+		Status:           report.Status,
+		ModifiedCells:    report.ModifiedCells,
+		AddedRows:        report.AddedRows,
+		RemovedRows:      report.RemovedRows,
+		Changes:          string(changes),
+		CreateTime:       s.now(),
+	})
+}
+
+// Lookup 台账文件的核验结果
+func (s *Store) Lookup(artifactID string) (*Report, error) {
+	p, err := s.dao.GetProvenance(artifactID)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		SnapshotID:       p.SnapshotID,
+		SnapshotChecksum: p.SnapshotChecksum,
+		DataChecksum:     p.DataChecksum,
+		Status:           p.Status,
+		ModifiedCells:    p.ModifiedCells,
+		AddedRows:        p.AddedRows,
+		RemovedRows:      p.RemovedRows,
+	}
+	if p.Changes != "" {
+		if err := json.Unmarshal([]byte(p.Changes), &report.Changes); err != nil {
+			return nil, fmt.Errorf("台账数据来源格式错误: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// Purge 删除超过保留期限的快照
+func (s *Store) Purge() (int64, error) {
+	return s.dao.DeleteSnapshotsBefore(s.now().Add(-s.retention))
+}
+
+// Start 每天清理一次过期快照
+func (s *Store) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			if n, err := s.Purge(); err != nil {
+				log.Printf("清理过期台账预览快照失败: %v", err)
+			} else if n > 0 {
+				log.Printf("已清理 %d 个过期台账预览快照", n)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Render 输出台账，xlsx 在写出前于同一文件中附加隐藏的数据来源工作表。progress 按数据行报告进度，可为 nil
+func Render(w io.Writer, class *ledger.Class, f ledger.Format, rows ledger.Rows, report *Report, progress func(done, total int)) error {
+	extras := &export.Extras{Progress: progress}
+	if f == ledger.FormatXLSX {
+		extras.Sheets = []export.Sheet{{Name: SheetName, Rows: report.Cells(), Hidden: true}}
+	}
+	return class.RenderExtras(w, f, rows, extras)
+}
+
+// Cells 数据来源工作表的内容
+func (r *Report) Cells() [][]any {
+	snapshotTime := ""
+	if r.SnapshotTime != nil {
+		loc, err := util.LoadLocation("")
+		if err != nil {
+			loc = time.Local
+		}
+		snapshotTime = r.SnapshotTime.In(loc).Format(time.DateTime)
+	}
+	cells := [][]any{
+		{"数据来源核验"},
+		{"预览快照ID", r.SnapshotID},
+		{"预览时间", snapshotTime},
+		{"预览快照校验和（SHA-256）", r.SnapshotChecksum},
+		{"提交数据校验和（SHA-256）", r.DataChecksum},
+		{"核验结果", statusText[r.Status]},
+		{"修改的单元格数", r.ModifiedCells},
+		{"新增行数", r.AddedRows},
+		{"删除行数", r.RemovedRows},
+	}
+	if len(r.Changes) > 0 {
+		cells = append(cells, []any{}, []any{"行", "列", "预览快照值", "提交值"})
+		for _, c := range r.Changes {
+			cells = append(cells, []any{c.Row, c.Column, c.Snapshot, c.Submitted})
+		}
+	}
+	return cells
+}
+
+func marshal(rows ledger.Rows) ([]byte, error) {
+	if rows.Data == nil {
+		return []byte("[]"), nil
+	}
+	data, err := json.Marshal(rows.Data)
+	if err != nil {
+		return nil, fmt.Errorf("台账数据格式错误: %w", err)
+	}
+	return data, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,219 @@
+package provenance
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"monitor/internal/service/dao"
+	"monitor/internal/service/excel"
+	"monitor/internal/service/ledger"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type memSnapshotDao struct {
+	snapshots   map[string]dao.LedgerSnapshot
+	provenances map[string]dao.LedgerProvenance
+}
+
+func newMemDao() *memSnapshotDao {
+	return &memSnapshotDao{snapshots: map[string]dao.LedgerSnapshot{}, provenances: map[string]dao.LedgerProvenance{}}
+}
+
+func (m *memSnapshotDao) CreateSnapshot(s *dao.LedgerSnapshot) error {
+	m.snapshots[s.SnapshotID] = *s
+	return nil
+}
+
+func (m *memSnapshotDao) GetSnapshot(id string) (*dao.LedgerSnapshot, error) {
+	s, ok := m.snapshots[id]
+	if !ok {
+		return nil, dao.ErrSnapshotNotFound
+	}
+	return &s, nil
+}
+
+func (m *memSnapshotDao) DeleteSnapshotsBefore(before time.Time) (int64, error) {
+	var n int64
+	for id, s := range m.snapshots {
+		if s.CreateTime.Before(before) {
+			delete(m.snapshots, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memSnapshotDao) CreateProvenance(p *dao.LedgerProvenance) error {
+	m.provenances[p.ArtifactID] = *p
+	return nil
+}
+
+func (m *memSnapshotDao) GetProvenance(id string) (*dao.LedgerProvenance, error) {
+	p, ok := m.provenances[id]
+	if !ok {
+		return nil, dao.ErrProvenanceNotFound
+	}
+	return &p, nil
+}
+
+const (
+	from = 1759248000000
+	to   = 1761840000000
+	raw  = `[{"environment":"生产","model":"Qwen3-8B","scenario":"信用卡审批支持助手","department":"数据管理部","success":80,"history":1000}]`
+)
+
+func decode(t *testing.T, c *ledger.Class, data string) ledger.Rows {
+	t.Helper()
+	rows, err := c.Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestVerify(t *testing.T) {
+	d := newMemDao()
+	s := NewStore(d, 24*time.Hour)
+	c, _ := ledger.LookupClass(ledger.SceneDetailLedgerClass)
+	snapshot, err := s.Snapshot(c, decode(t, c, raw), from, to, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Verify(snapshot.SnapshotID, c, decode(t, c, raw), from, to)
+	if err != nil || report.Status != StatusVerified || report.DataChecksum != snapshot.Checksum {
+		t.Fatalf("unchanged: report = %+v, err = %v", report, err)
+	}
+
+	modified := `[{"environment":"生产","model":"Qwen3-8B","scenario":"信用卡审批支持助手","department":"数据管理部","success":95,"history":1000},` +
+		`{"environment":"生产","model":"Qwen3-8B","scenario":"新增场景","department":"数据管理部","success":1,"history":1}]`
+	report, err = s.Verify(snapshot.SnapshotID, c, decode(t, c, modified), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != StatusModified || report.ModifiedCells != 1 || report.AddedRows != 1 || report.RemovedRows != 0 {
+		t.Fatalf("modified: report = %+v", report)
+	}
+	if got := report.Changes[0]; got.Row != 1 || got.Snapshot != "80" || got.Submitted != "95" || got.Column == "" {
+		t.Errorf("change = %+v", got)
+	}
+
+	if _, err := s.Verify(snapshot.SnapshotID, c, decode(t, c, raw), from, to+1); !errors.Is(err, ErrSnapshotMismatch) {
+		t.Errorf("other period: err = %v", err)
+	}
+	if _, err := s.Verify("missing", c, decode(t, c, raw), from, to); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("missing snapshot: err = %v", err)
+	}
+
+	if err := s.Record("a1", report); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Lookup("a1")
+	if err != nil || got.Status != StatusModified || len(got.Changes) != 1 {
+		t.Errorf("lookup = %+v, err = %v", got, err)
+	}
+
+	s.now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+	if n, _ := s.Purge(); n != 1 {
+		t.Errorf("purged %d snapshots, want 1", n)
+	}
+}
+
+func TestRenderHiddenSheet(t *testing.T) {
+	c, _ := ledger.LookupClass(ledger.SceneDetailLedgerClass)
+	rows := decode(t, c, raw)
+	report, err := Unverified(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Render(&buf, c, ledger.FormatXLSX, rows, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if visible, err := f.GetSheetVisible(SheetName); err != nil || visible {
+		t.Errorf("provenance sheet visible = %v, err = %v", visible, err)
+	}
+	if f.GetSheetName(f.GetActiveSheetIndex()) == SheetName {
+		t.Error("provenance sheet is active")
+	}
+	value, _ := f.GetCellValue(SheetName, "B6")
+	if value != statusText[StatusUnverified] {
+		t.Errorf("status cell = %q", value)
+	}
+}
+
+// 大台账附加数据来源时不应把整个 xlsx 读回内存：数据行流式写出，数据来源工作表写入同一文件
+func TestRenderLargeLedgerMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("large ledger")
+	}
+	c, _ := ledger.LookupClass(ledger.SceneDetailLedgerClass)
+	const n = 50000
+	data := make([]excel.Record, n)
+	for i := range data {
+		data[i] = excel.Record{
+			Environment: "生产", Model: fmt.Sprintf("Qwen3-%dB", i/1000), Scenario: fmt.Sprintf("场景%d", i),
+			Department: "数据管理部", Manager: "吕伟", Success: i, History: int64(i) * 10, TotalTokens: int64(i) * 100,
+		}
+	}
+	encoded, _ := json.Marshal(data)
+	rows := decode(t, c, string(encoded))
+	encoded, data = nil, nil
+	report, err := Unverified(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 降低 GC 阈值，使堆占用接近存活对象
+	defer debug.SetGCPercent(debug.SetGCPercent(10))
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	base := ms.HeapInuse
+	var peak atomic.Uint64
+	done := make(chan struct{})
+	go func() {
+		var ms runtime.MemStats
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+			runtime.ReadMemStats(&ms)
+			if ms.HeapInuse > peak.Load() {
+				peak.Store(ms.HeapInuse)
+			}
+		}
+	}()
+	var size countingWriter
+	err = Render(&size, c, ledger.FormatXLSX, rows, report, nil)
+	close(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grown := int64(peak.Load()) - int64(base)
+	t.Logf("xlsx %d bytes, heap grew %d MB", size, grown>>20)
+	if grown > 40<<20 {
+		t.Errorf("heap grew %d MB while rendering %d rows", grown>>20, n)
+	}
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
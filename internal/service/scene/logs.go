@@ -0,0 +1,120 @@
+package scene
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"monitor/config"
+	"monitor/internal/common"
+	"monitor/internal/models"
+	"monitor/internal/service/es"
+	"monitor/internal/types"
+	"monitor/util"
+	"strings"
+)
+
+// ErrInvalidLogQuery 检索参数或游标不合法
+var ErrInvalidLogQuery = errors.New("invalid log query")
+
+const (
+	defaultLogPageSize = 20
+	maxLogPageSize     = 200
+)
+
+// SearchLogs 请求日志检索，游标为上一页最后一条记录排序值的 base64 编码
+func (s *SceneReq) SearchLogs(req models.LogSearchRequest) (*types.LogSearchResult, error) {
+	params := types.LogSearchParams{
+		From:       util.ToInt64(req.From),
+		To:         util.ToInt64(req.To),
+		AuthCode:   req.AuthCode,
+		ModelName:  req.ModelName,
+		Status:     req.Status,
+		MinLatency: req.MinLatency,
+		MaxLatency: req.MaxLatency,
+		Keyword:    strings.TrimSpace(req.Keyword),
+		SortBy:     req.SortBy,
+		Ascending:  strings.EqualFold(req.Order, "asc"),
+		Size:       req.Size,
+	}
+	if params.SortBy != "latency" {
+		params.SortBy = "time"
+	}
+	if params.Size <= 0 {
+		params.Size = defaultLogPageSize
+	}
+	if params.Size > maxLogPageSize {
+		params.Size = maxLogPageSize
+	}
+	if params.MaxLatency > 0 && params.MinLatency > params.MaxLatency {
+		return nil, fmt.Errorf("%w: min_latency 不能大于 max_latency", ErrInvalidLogQuery)
+	}
+	if params.AuthCode != "" {
+		if err := s.Filter.Check(params.AuthCode); err != nil {
+			return nil, err
+		}
+	} else {
+		params.AuthCodes = s.Filter.Scenes()
+	}
+	if req.Cursor != "" {
+		after, err := DecodeLogCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		params.SearchAfter = after
+	}
+
+	ec := es.NewESService(config.GetEsConfig())
+	result, err := ec.SearchLogs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	kib := config.GetKibanaConfig()
+	for i := range result.Hits {
+		hit := &result.Hits[i]
+		hit.SceneName = s.SceneMap[hit.SceneLabel]
+		url, err := common.GenerateDocURL(kib, hit.Id)
+		if err != nil {
+			log.Println(err)
+		}
+		hit.KibanaUrl = url
+	}
+
+	if result.HasNext && len(result.Hits) > 0 {
+		cursor, err := EncodeLogCursor(result.Hits[len(result.Hits)-1].Sort)
+		if err != nil {
+			return nil, err
+		}
+		result.NextCursor = cursor
+	}
+	return result, nil
+}
+
+func EncodeLogCursor(sort []interface{}) (string, error) {
+	data, err := json.Marshal(sort)
+	if err != nil {
+		return "", fmt.Errorf("生成游标失败: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeLogCursor 解析游标，数字保持 json.Number 避免毫秒时间戳丢失精度
+func DecodeLogCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无效的游标: %v", ErrInvalidLogQuery, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var sort []interface{}
+	if err := decoder.Decode(&sort); err != nil {
+		return nil, fmt.Errorf("%w: 无效的游标: %v", ErrInvalidLogQuery, err)
+	}
+	if len(sort) == 0 {
+		return nil, fmt.Errorf("%w: 无效的游标: 排序值为空", ErrInvalidLogQuery)
+	}
+	return sort, nil
+}
@@ -0,0 +1,69 @@
+package scene
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"monitor/config"
+	"monitor/internal/service/es"
+	"monitor/internal/types"
+	"testing"
+	"time"
+)
+
+func TestLogCursorRoundTrip(t *testing.T) {
+	cursor, err := EncodeLogCursor([]interface{}{int64(1760000000123), "req-9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort, err := DecodeLogCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 毫秒时间戳保持 json.Number，不经 float64 丢失精度
+	if len(sort) != 2 || sort[0] != json.Number("1760000000123") || sort[1] != "req-9" {
+		t.Errorf("sort = %#v", sort)
+	}
+
+	for _, bad := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("{}")), base64.RawURLEncoding.EncodeToString([]byte("[]"))} {
+		if _, err := DecodeLogCursor(bad); !errors.Is(err, ErrInvalidLogQuery) {
+			t.Errorf("%q: err = %v, want invalid query", bad, err)
+		}
+	}
+}
+
+// 按游标逐页检索样例日志，每条只出现一次
+func TestLogCursorPaging(t *testing.T) {
+	ec := es.NewESService(config.ESConfig{Mock: true, MockDataPath: "../es/testdata"})
+	params := types.LogSearchParams{
+		From: time.Now().AddDate(0, 0, -7).UnixMilli(),
+		To:   time.Now().UnixMilli(),
+		Size: 1,
+	}
+	seen := map[string]bool{}
+	for page := 0; page < 10; page++ {
+		res, err := ec.SearchLogs(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, hit := range res.Hits {
+			if seen[hit.Id] {
+				t.Fatalf("hit %s returned twice", hit.Id)
+			}
+			seen[hit.Id] = true
+		}
+		if !res.HasNext {
+			break
+		}
+		cursor, err := EncodeLogCursor(res.Hits[len(res.Hits)-1].Sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if params.SearchAfter, err = DecodeLogCursor(cursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seen) != 4 {
+		t.Errorf("hits = %v, want 4", seen)
+	}
+}
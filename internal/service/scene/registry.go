@@ -0,0 +1,143 @@
+package scene
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"monitor/config"
+	"monitor/internal/models"
+	"monitor/internal/service/grafana"
+	"sync"
+	"time"
+)
+
+// SceneRegistry Grafana 面板值映射（网关 token -> 场景标签）的内存注册表，定时刷新，
+// 刷新失败时继续使用最近一次成功的结果
+type SceneRegistry struct {
+	client   *grafana.GrafanaClient
+	initErr  error // Grafana 配置错误，所有刷新都返回该错误
+	uid      string
+	title    string
+	interval time.Duration
+
+	refreshMu sync.Mutex // 同一时间只有一个刷新请求 Grafana
+	mu        sync.RWMutex
+	mapping   map[string]models.Item
+	status    RegistryStatus
+	startOnce sync.Once
+}
+
+// RegistryStatus 注册表的刷新状态
+type RegistryStatus struct {
+	Scenes        int        `json:"scenes"`
+	RefreshedAt   *time.Time `json:"refreshedAt,omitempty"`   // 最近一次成功刷新的时间
+	LastAttemptAt *time.Time `json:"lastAttemptAt,omitempty"` // 最近一次刷新的时间
+	LastError     string     `json:"lastError,omitempty"`     // 最近一次刷新失败的原因，成功后清空
+}
+
+var registries sync.Map // url|uid|title -> *SceneRegistry
+
+// GetSceneRegistry 返回看板配置对应的注册表，相同配置共享同一个实例
+func GetSceneRegistry(cfg *config.GrafanaConfig) *SceneRegistry {
+	key := cfg.URL + "|" + cfg.ModelRequestDashboardUid + "|" + cfg.ModelRequestDashboardPanelTitle
+	if r, ok := registries.Load(key); ok {
+		return r.(*SceneRegistry)
+	}
+	r, _ := registries.LoadOrStore(key, newSceneRegistry(cfg))
+	return r.(*SceneRegistry)
+}
+
+func newSceneRegistry(cfg *config.GrafanaConfig) *SceneRegistry {
+	client, err := grafana.NewGrafanaClient(cfg.URL, cfg.Username, cfg.Password, cfg.APIKey)
+	interval := cfg.SceneRefreshInterval
+	if interval <= 0 {
+		interval = config.GetGrafanaConfig().SceneRefreshInterval
+	}
+	return &SceneRegistry{
+		client:   client,
+		initErr:  err,
+		uid:      cfg.ModelRequestDashboardUid,
+		title:    cfg.ModelRequestDashboardPanelTitle,
+		interval: interval,
+	}
+}
+
+// Start 立即刷新一次，之后按配置的间隔定时刷新，多次调用只启动一次
+func (r *SceneRegistry) Start(ctx context.Context) {
+	r.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(r.interval)
+			defer ticker.Stop()
+			for {
+				if err := r.Refresh(ctx); err != nil {
+					log.Printf("刷新场景标签失败: %v", err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	})
+}
+
+// Refresh 从 Grafana 重新读取映射，失败时保留原有结果并返回错误
+func (r *SceneRegistry) Refresh(ctx context.Context) error {
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+	return r.refresh(ctx)
+}
+
+func (r *SceneRegistry) refresh(ctx context.Context) error {
+	err := r.initErr
+	var mapping map[string]models.Item
+	if err == nil {
+		mapping, err = r.client.GetPanelMapping(ctx, r.uid, r.title)
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.LastAttemptAt = &now
+	if err != nil {
+		r.status.LastError = err.Error()
+		return err
+	}
+	r.mapping = mapping
+	r.status.Scenes = len(mapping)
+	r.status.RefreshedAt = &now
+	r.status.LastError = ""
+	return nil
+}
+
+// Mapping 当前的映射，调用方不可修改；尚未成功刷新过时同步刷新一次
+func (r *SceneRegistry) Mapping(ctx context.Context) (map[string]models.Item, error) {
+	if mapping, ok := r.loaded(); ok {
+		return mapping, nil
+	}
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+	// 等待锁期间可能已由其他请求刷新成功
+	if mapping, ok := r.loaded(); ok {
+		return mapping, nil
+	}
+	if err := r.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("场景标签不可用: %w", err)
+	}
+	mapping, _ := r.loaded()
+	return mapping, nil
+}
+
+func (r *SceneRegistry) loaded() (map[string]models.Item, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.mapping, r.status.RefreshedAt != nil
+}
+
+// Status 当前刷新状态
+func (r *SceneRegistry) Status() RegistryStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
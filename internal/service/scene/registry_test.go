@@ -0,0 +1,71 @@
+package scene
+
+import (
+	"context"
+	"errors"
+	"monitor/config"
+	"monitor/internal/service/grafana"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testDashboard = `{"dashboard":{"panels":[
+	{"title":"other"},
+	{"title":"场景调用","fieldConfig":{"defaults":{"mappings":[{"options":{"tok-1":{"index":0,"text":"dept#Scene A#owner"}}}]}}}]},"meta":{}}`
+
+func TestSceneRegistryLastGood(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/api/dashboards/uid/dash" || !healthy.Load() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testDashboard))
+	}))
+	defer srv.Close()
+
+	svc := NewGrafanaService(&config.GrafanaConfig{
+		URL: srv.URL, ModelRequestDashboardUid: "dash", ModelRequestDashboardPanelTitle: "场景调用",
+		SceneRefreshInterval: time.Hour,
+	})
+	labels, err := svc.GenerateApiSixScenarioKeyMapMock()
+	if err != nil || labels["dept#scene a#owner"] != "tok-1" {
+		t.Fatalf("labels = %v, err = %v", labels, err)
+	}
+	// 已加载后直接使用内存中的结果
+	svc.GenerateApiSixScenarioKeyMap()
+	if requests.Load() != 1 {
+		t.Errorf("requests = %d, want 1", requests.Load())
+	}
+
+	healthy.Store(false)
+	status, err := svc.RefreshSceneLabels(context.Background())
+	if !errors.Is(err, grafana.ErrDashboardNotFound) || status.LastError == "" || status.Scenes != 1 {
+		t.Errorf("refresh = %+v, err = %v", status, err)
+	}
+	if labels, err := svc.GenerateApiSixScenarioKeyMap(); err != nil || labels["tok-1"] != "Scene A" {
+		t.Errorf("last good labels = %v, err = %v", labels, err)
+	}
+}
+
+func TestSceneRegistryErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"dashboard":{"panels":[{"title":"场景调用"}]},"meta":{}}`))
+	}))
+	defer srv.Close()
+
+	svc := NewGrafanaService(&config.GrafanaConfig{URL: srv.URL, ModelRequestDashboardUid: "dash", ModelRequestDashboardPanelTitle: "场景调用"})
+	if _, err := svc.GenerateApiSixScenarioKeyMap(); !errors.Is(err, grafana.ErrNoMappings) {
+		t.Errorf("err = %v, want no mappings", err)
+	}
+	svc = NewGrafanaService(&config.GrafanaConfig{URL: srv.URL, ModelRequestDashboardUid: "dash", ModelRequestDashboardPanelTitle: "missing"})
+	if _, err := svc.GenerateApiSixScenarioKeyMap(); !errors.Is(err, grafana.ErrPanelNotFound) {
+		t.Errorf("err = %v, want panel not found", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"monitor/internal/common"
 	"monitor/internal/models"
 	"monitor/internal/service/es"
+	"monitor/internal/service/tenant"
 	"monitor/internal/types"
 	"monitor/util"
 	"sort"
@@ -19,15 +20,19 @@ type SceneRepo interface {
 	SceneCountCards(req models.SceneListRequest) (*types.ScenesPagedResponse, error)
 	SceneCountWithModel(req models.SceneWithCodeRequest) (*types.SceneDetailWithModel, error)
 	SceneCountWithLog(req models.SceneWithCodeRequest) (*types.LogDetailResp, error)
+	SearchLogs(req models.LogSearchRequest) (*types.LogSearchResult, error)
 }
 
 type SceneReq struct {
 	SceneMap map[string]string `json:"scene_map"`
+	// 调用方可查看的场景，nil 不限制
+	Filter tenant.SceneFilter `json:"-"`
 }
 
-func NewSceneReq(SceneMap map[string]string) SceneRepo {
+func NewSceneReq(SceneMap map[string]string, filter tenant.SceneFilter) SceneRepo {
 	return &SceneReq{
 		SceneMap: SceneMap,
+		Filter:   filter,
 	}
 }
 
@@ -39,6 +44,9 @@ func (s *SceneReq) ModelRequestTime(req models.SceneWithCodeRequest) (*types.Req
 	to := util.ToInt64(req.To)
 
 	authCode := req.AuthCode
+	if err := s.Filter.Check(authCode); err != nil {
+		return nil, err
+	}
 	resultScence, err := ec.GetDocumentFields(from, to, "success", authCode, req.ModelName)
 	if err != nil {
 		log.Println(err)
@@ -95,8 +103,16 @@ func (s *SceneReq) SceneCountCards(req models.SceneListRequest) (*types.ScenesPa
 		return nil, err
 	}
 
+	tokenUsage, err := ec.SumTokens(from, to, "onAuth")
+	if err != nil {
+		log.Println(err)
+	}
+
 	resultSceneData := make([]types.SceneCountData, 0)
 	for k, v := range resultScence {
+		if !s.Filter.Allow(k) {
+			continue
+		}
 		var count int64
 		SceneName := s.SceneMap[k]
 		modelNum := len(v)
@@ -104,6 +120,10 @@ func (s *SceneReq) SceneCountCards(req models.SceneListRequest) (*types.ScenesPa
 			count += ts
 
 		}
+		var usage types.TokenUsage
+		for _, u := range tokenUsage[k] {
+			usage.Add(u)
+		}
 		var data types.SceneCountData
 		data.SceneName = SceneName
 		data.SceneCount = int(count)
@@ -111,6 +131,10 @@ func (s *SceneReq) SceneCountCards(req models.SceneListRequest) (*types.ScenesPa
 		data.ModelsNum = modelNum
 		diff := float64(count) / timeDifferenceHours
 		data.Qps = math.Round(diff*100) / 100
+		data.PromptTokens = usage.PromptTokens
+		data.CompletionTokens = usage.CompletionTokens
+		data.TotalTokens = usage.TotalTokens
+		data.Tps = util.RatePerSecond(usage.TotalTokens, from, to)
 		resultSceneData = append(resultSceneData, data)
 	}
 	totalItems := len(resultSceneData)
@@ -144,6 +168,9 @@ func (s *SceneReq) SceneCountWithModel(req models.SceneWithCodeRequest) (*types.
 
 	timeDifferenceHours := float64(to-from) / (1000 * 60 * 60)
 	authCode := req.AuthCode
+	if err := s.Filter.Check(authCode); err != nil {
+		return nil, err
+	}
 	resultScence, err := ec.CountByNestedAggs(from, to)
 	Scene, _ := resultScence[authCode]
 	if err != nil {
@@ -151,6 +178,11 @@ func (s *SceneReq) SceneCountWithModel(req models.SceneWithCodeRequest) (*types.
 		return nil, err
 	}
 
+	tokenUsage, err := ec.SumTokens(from, to, "onAuth")
+	if err != nil {
+		log.Println(err)
+	}
+
 	sceneResp := &types.SceneDetailWithModel{}
 	sceneResp.SceneName = s.SceneMap[authCode]
 	sceneResp.SceneLabel = authCode
@@ -163,6 +195,8 @@ func (s *SceneReq) SceneCountWithModel(req models.SceneWithCodeRequest) (*types.
 
 		diff := float64(v) / timeDifferenceHours
 		data.Qps = math.Round(diff*100) / 100
+		data.TotalTokens = tokenUsage[authCode][k].TotalTokens
+		data.Tps = util.RatePerSecond(data.TotalTokens, from, to)
 
 		models = append(models, data)
 	}
@@ -177,6 +211,9 @@ func (s *SceneReq) SceneCountWithLog(req models.SceneWithCodeRequest) (*types.Lo
 	ec := es.NewESService(appConfig)
 	from := util.ToInt64(req.From)
 	to := util.ToInt64(req.To)
+	if err := s.Filter.Check(req.AuthCode); err != nil {
+		return nil, err
+	}
 
 	resultScence, err := ec.GetDocumentFields(from, to, "failed", req.AuthCode, "")
 	if err != nil {
@@ -1,8 +1,8 @@
 package scene
 
 import (
+	"context"
 	"monitor/config"
-	"monitor/internal/service/grafana"
 	"monitor/util"
 	"strings"
 )
@@ -10,50 +10,50 @@ import (
 type IGrafanaService interface {
 	GenerateApiSixScenarioKeyMap() (map[string]string, error)
 	GenerateApiSixScenarioKeyMapMock() (map[string]string, error)
+	// RefreshSceneLabels 立即从 Grafana 刷新场景标签
+	RefreshSceneLabels(ctx context.Context) (RegistryStatus, error)
 }
 
 type GrafanaService struct {
-	GrafanaClient                   *grafana.GrafanaClient
-	ModelRequestDashboardUid        string
-	ModelRequestDashboardPanelTitle string
+	Registry *SceneRegistry
 }
 
 func NewGrafanaService(appConfig *config.GrafanaConfig) IGrafanaService {
 	return &GrafanaService{
-		GrafanaClient:                   grafana.NewGrafanaClient(appConfig.URL, appConfig.Username, appConfig.Password, appConfig.APIKey),
-		ModelRequestDashboardUid:        appConfig.ModelRequestDashboardUid,
-		ModelRequestDashboardPanelTitle: appConfig.ModelRequestDashboardPanelTitle,
+		Registry: GetSceneRegistry(appConfig),
 	}
 }
 
+// GenerateApiSixScenarioKeyMap 网关 token -> 场景名称
 func (s *GrafanaService) GenerateApiSixScenarioKeyMap() (map[string]string, error) {
-	apiSixScenarioKeyMap := make(map[string]string, 0)
-	consumers, err := s.GrafanaClient.GetPanelMapping(s.ModelRequestDashboardUid, s.ModelRequestDashboardPanelTitle)
+	consumers, err := s.Registry.Mapping(context.Background())
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
+	apiSixScenarioKeyMap := make(map[string]string, len(consumers))
 	for key, consumer := range consumers {
 		text := util.ProcessSceneString(consumer.Text)
 		apiSixScenarioKeyMap[key] = text
-		//fmt.Printf("%s--%s\n", consumer.Text, key)
 	}
 	//sceneLabel:scene
 	return apiSixScenarioKeyMap, nil
 }
 
+// GenerateApiSixScenarioKeyMapMock 小写场景标签 -> 网关 token
 func (s *GrafanaService) GenerateApiSixScenarioKeyMapMock() (map[string]string, error) {
-	apiSixScenarioKeyMap := make(map[string]string, 0)
-	consumers, err := s.GrafanaClient.GetPanelMapping(s.ModelRequestDashboardUid, s.ModelRequestDashboardPanelTitle)
+	consumers, err := s.Registry.Mapping(context.Background())
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
+	apiSixScenarioKeyMap := make(map[string]string, len(consumers))
 	for key, consumer := range consumers {
-		//text := util.ProcessSceneString(consumer.Text)
 		text := strings.ToLower(consumer.Text)
 		apiSixScenarioKeyMap[text] = key
-		//fmt.Printf("%s--%s\n", consumer.Text, key)
 	}
-	//log.Println("====================apiSixScenarioKeyMap", apiSixScenarioKeyMap)
-	//sceneLabel:scene
 	return apiSixScenarioKeyMap, nil
 }
+
+func (s *GrafanaService) RefreshSceneLabels(ctx context.Context) (RegistryStatus, error) {
+	err := s.Registry.Refresh(ctx)
+	return s.Registry.Status(), err
+}
@@ -0,0 +1,136 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"monitor/internal/service/dao"
+	"monitor/internal/service/export"
+	"monitor/internal/service/ledger"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Builtin 内置版式的模板ID，即类别专用版式或通用表格
+const Builtin = "builtin"
+
+// MaxSize 模板文件大小上限
+const MaxSize = 5 << 20
+
+var (
+	ErrTemplateNotFound = dao.ErrTemplateNotFound
+	ErrInvalidTemplate  = export.ErrInvalidTemplate
+	ErrWrongClass       = errors.New("template belongs to another ledger class")
+)
+
+// Store 台账模板的上传、版本及选用，生成 xlsx 时通过 Source 提供选用的模板
+type Store struct {
+	dao dao.ITemplateDao
+	now func() time.Time
+	// 已解析的模板，模板上传后内容不变，按模板ID缓存
+	parsed sync.Map
+}
+
+func NewStore(templateDao dao.ITemplateDao) *Store {
+	return &Store{dao: templateDao, now: time.Now}
+}
+
+// Default 使用数据库保存模板，数据库未连接时返回错误
+func Default() (*Store, error) {
+	if dao.GetDB() == nil {
+		return nil, errors.New("台账模板不可用：未连接数据库")
+	}
+	return NewStore(dao.NewTemplateDao(nil)), nil
+}
+
+// Upload 校验并保存模板的新版本，不改变当前选用的模板
+func (s *Store) Upload(class *ledger.Class, name, comment string, data []byte, creator string) (*dao.LedgerTemplate, error) {
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("%w: 文件超过 %d MB", ErrInvalidTemplate, MaxSize>>20)
+	}
+	if _, err := class.ParseTemplate(data); err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = class.Name
+	}
+	sum := sha256.Sum256(data)
+	template := &dao.LedgerTemplate{
+		TemplateID: dao.NewUUID(),
+		LedgerType: int(class.ID),
+		Name:       name,
+		Comment:    strings.TrimSpace(comment),
+		Content:    data,
+		Size:       int64(len(data)),
+		Checksum:   hex.EncodeToString(sum[:]),
+		Creator:    creator,
+		CreateTime: s.now(),
+	}
+	if err := s.dao.CreateTemplate(template); err != nil {
+		return nil, err
+	}
+	template.Content = nil
+	return template, nil
+}
+
+// List 台账类别的全部模板，第一项为内置版式，没有选用上传的模板时内置版式处于选用状态
+func (s *Store) List(class *ledger.Class) ([]dao.LedgerTemplate, error) {
+	templates, err := s.dao.ListTemplates(int(class.ID))
+	if err != nil {
+		return nil, err
+	}
+	builtin := dao.LedgerTemplate{TemplateID: Builtin, LedgerType: int(class.ID), Name: "内置版式", Active: true}
+	for _, t := range templates {
+		if t.Active {
+			builtin.Active = false
+		}
+	}
+	return append([]dao.LedgerTemplate{builtin}, templates...), nil
+}
+
+// Select 选用模板，id 为 Builtin 时恢复内置版式
+func (s *Store) Select(class *ledger.Class, id string) error {
+	if id == Builtin {
+		id = ""
+	}
+	err := s.dao.ActivateTemplate(int(class.ID), id)
+	if errors.Is(err, dao.ErrTemplateNotFound) {
+		// 区分模板不存在与模板属于其他类别
+		if t, e := s.dao.GetTemplate(id); e == nil && t.LedgerType != int(class.ID) {
+			return ErrWrongClass
+		}
+	}
+	return err
+}
+
+// Get 按ID查询模板，含模板文件
+func (s *Store) Get(id string) (*dao.LedgerTemplate, error) {
+	return s.dao.GetTemplate(id)
+}
+
+// Source 台账类别选用的模板，未选用时返回 nil，用于 ledger.UseTemplates
+func (s *Store) Source(id ledger.LedgerClass) (*export.Template, error) {
+	t, err := s.dao.GetActiveTemplate(int(id))
+	if errors.Is(err, dao.ErrTemplateNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tpl, ok := s.parsed.Load(t.TemplateID); ok {
+		return tpl.(*export.Template), nil
+	}
+	class, err := ledger.LookupClass(id)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := class.ParseTemplate(t.Content)
+	if err != nil {
+		return nil, err
+	}
+	s.parsed.Store(t.TemplateID, tpl)
+	return tpl, nil
+}
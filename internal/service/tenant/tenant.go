@@ -0,0 +1,97 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"monitor/config"
+	"monitor/internal/service/auth"
+	"monitor/internal/types"
+	"sort"
+)
+
+// ErrForbidden 请求的场景不在调用方部门范围内
+var ErrForbidden = errors.New("forbidden")
+
+// Scope 调用方可查看的数据范围，Global 为 true 时不做部门限制
+type Scope struct {
+	Global      bool
+	Departments map[string]bool
+}
+
+// ScopeFromContext 根据当前用户确定数据范围：未认证（后台任务）及管理员为全局，
+// 有所属部门的按部门限制，否则按 auth.unscopedAccess 配置决定
+func ScopeFromContext(ctx context.Context) Scope {
+	identity := auth.FromContext(ctx)
+	if identity == nil || identity.Has(auth.RoleAdmin) {
+		return Scope{Global: true}
+	}
+	scope := Scope{Departments: make(map[string]bool, len(identity.Departments))}
+	for _, dept := range identity.Departments {
+		scope.Departments[dept] = true
+	}
+	if len(scope.Departments) == 0 && config.GetAuthConfig().UnscopedAccess == config.UnscopedAccessGlobal {
+		scope.Global = true
+	}
+	return scope
+}
+
+// AllowDept 判断部门是否在范围内
+func (s Scope) AllowDept(dept string) bool {
+	return s.Global || s.Departments[dept]
+}
+
+// DepartmentList 排序后的部门，Global 时返回 nil
+func (s Scope) DepartmentList() []string {
+	if s.Global {
+		return nil
+	}
+	depts := make([]string, 0, len(s.Departments))
+	for dept := range s.Departments {
+		depts = append(depts, dept)
+	}
+	sort.Strings(depts)
+	return depts
+}
+
+// SceneFilter 可查看的场景 token 集合，nil 表示不限制
+type SceneFilter map[string]bool
+
+// NewSceneFilter 按场景元数据（场景token -> 场景信息）中的 DevDept 筛选出范围内的场景
+func NewSceneFilter(scope Scope, scenes map[string]types.SceneInfoItem) SceneFilter {
+	if scope.Global {
+		return nil
+	}
+	filter := make(SceneFilter)
+	for token, info := range scenes {
+		if token != "" && scope.AllowDept(info.DevDept) {
+			filter[token] = true
+		}
+	}
+	return filter
+}
+
+// Allow 判断场景是否可查看
+func (f SceneFilter) Allow(scene string) bool {
+	return f == nil || f[scene]
+}
+
+// Scenes 返回排序后的场景 token，不限制时返回 nil
+func (f SceneFilter) Scenes() []string {
+	if f == nil {
+		return nil
+	}
+	scenes := make([]string, 0, len(f))
+	for scene := range f {
+		scenes = append(scenes, scene)
+	}
+	sort.Strings(scenes)
+	return scenes
+}
+
+// Check 场景不在范围内时返回 ErrForbidden
+func (f SceneFilter) Check(scene string) error {
+	if !f.Allow(scene) {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package tenant
+
+import (
+	"context"
+	"monitor/config"
+	"monitor/internal/service/auth"
+	"monitor/internal/types"
+	"reflect"
+	"testing"
+)
+
+func TestSceneFilter(t *testing.T) {
+	scenes := map[string]types.SceneInfoItem{
+		"sk-a": {DevDept: "研发部"},
+		"sk-b": {DevDept: "运营部"},
+		"sk-c": {DevDept: "研发部"},
+	}
+	withIdentity := func(identity *auth.Identity) context.Context {
+		return context.WithValue(context.Background(), auth.IdentityKey, identity)
+	}
+
+	admin := ScopeFromContext(withIdentity(&auth.Identity{Username: "root", Roles: []string{auth.RoleAdmin}}))
+	if f := NewSceneFilter(admin, scenes); f != nil || !f.Allow("sk-b") {
+		t.Errorf("admin filter = %v, want unrestricted", f)
+	}
+
+	dev := ScopeFromContext(withIdentity(&auth.Identity{
+		Username:    "alice",
+		Roles:       []string{auth.RoleViewer},
+		Departments: []string{"研发部"},
+	}))
+	f := NewSceneFilter(dev, scenes)
+	if got := f.Scenes(); !reflect.DeepEqual(got, []string{"sk-a", "sk-c"}) {
+		t.Errorf("dept scenes = %v", got)
+	}
+	if f.Check("sk-b") != ErrForbidden || f.Check("sk-a") != nil {
+		t.Errorf("unexpected check result for %v", f)
+	}
+
+	saved := config.Auth
+	defer func() { config.Auth = saved }()
+	unscoped := withIdentity(&auth.Identity{Username: "bob", Roles: []string{auth.RoleViewer}})
+	config.Auth.UnscopedAccess = config.UnscopedAccessGlobal
+	if !ScopeFromContext(unscoped).Global {
+		t.Error("unscoped user should be global when unscopedAccess=global")
+	}
+	// 未配置时默认不可查看，隔离不因漏配而失效
+	config.Auth.UnscopedAccess = ""
+	if ScopeFromContext(unscoped).Global {
+		t.Error("unscoped user should not be global by default")
+	}
+	config.Auth.UnscopedAccess = config.UnscopedAccessNone
+	f = NewSceneFilter(ScopeFromContext(unscoped), scenes)
+	if f == nil || len(f.Scenes()) != 0 {
+		t.Errorf("unscoped filter = %v, want empty", f)
+	}
+}
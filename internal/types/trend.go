@@ -0,0 +1,123 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxTrendBuckets 一次趋势查询的分桶数上限（时间分桶数 × 序列数），避免超过 ES search.max_buckets
+const MaxTrendBuckets = 10000
+
+// TrendInterval 根据时间跨度自动选择趋势分桶粒度，保证点数在几十到两百左右
+func TrendInterval(from, to int64) string {
+	span := time.Duration(to-from) * time.Millisecond
+	switch {
+	case span <= 3*time.Hour:
+		return TrendMinute
+	case span <= 7*24*time.Hour:
+		return TrendHour
+	case span <= 180*24*time.Hour:
+		return TrendDay
+	default:
+		return TrendWeek
+	}
+}
+
+// TrendBucketStart 返回 t 在 loc 时区下所属分桶的起始时间，周从周一开始
+func TrendBucketStart(t time.Time, interval string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	y, m, d := t.Date()
+	switch interval {
+	case TrendMinute:
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+	case TrendHour:
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	case TrendWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+}
+
+// NextTrendBucket 下一个分桶的起始时间
+func NextTrendBucket(t time.Time, interval string) time.Time {
+	switch interval {
+	case TrendMinute:
+		return t.Add(time.Minute)
+	case TrendHour:
+		return t.Add(time.Hour)
+	case TrendWeek:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// TrendDateFormat 分桶时间的展示格式
+func TrendDateFormat(interval string) string {
+	switch interval {
+	case TrendMinute:
+		return "2006-01-02 15:04"
+	case TrendHour:
+		return "2006-01-02 15:00"
+	default:
+		return "2006-01-02"
+	}
+}
+
+// trendStep 分桶粒度对应的时长，按自然日、周估算
+func trendStep(interval string) time.Duration {
+	switch interval {
+	case TrendMinute:
+		return time.Minute
+	case TrendHour:
+		return time.Hour
+	case TrendWeek:
+		return 7 * 24 * time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// CoarserTrendInterval 比 interval 粗一级的粒度，周为最粗一级
+func CoarserTrendInterval(interval string) string {
+	switch interval {
+	case TrendMinute:
+		return TrendHour
+	case TrendHour:
+		return TrendDay
+	default:
+		return TrendWeek
+	}
+}
+
+// TrendBuckets 估算 [from, to] 毫秒区间内 series 条序列的分桶总数，未指定序列时按一条计
+func TrendBuckets(from, to int64, interval string, series int) int64 {
+	span := time.Duration(to-from) * time.Millisecond
+	buckets := int64(span/trendStep(interval)) + 1
+	return buckets * int64(max(series, 1))
+}
+
+// CheckTrendBuckets 分桶总数超过 MaxTrendBuckets 时返回错误，提示改用更粗的粒度或缩短时间范围
+func CheckTrendBuckets(from, to int64, interval string, series int) error {
+	if n := TrendBuckets(from, to, interval, series); n > MaxTrendBuckets {
+		return fmt.Errorf("统计粒度 %s 下分桶数 %d 超过上限 %d，请使用更粗的粒度或缩短时间范围", interval, n, MaxTrendBuckets)
+	}
+	return nil
+}
+
+// TrendZoneID 传给 ES 的时区：IANA 时区使用名称，本地时区及缺少时区数据时的固定时区
+// 使用 from 时刻的 UTC 偏移（如 +08:00），ES 只接受合法的 Java ZoneId
+func TrendZoneID(loc *time.Location, from int64) string {
+	name := loc.String()
+	if name == "UTC" {
+		return name
+	}
+	if name != "" && name != "Local" {
+		if _, err := time.LoadLocation(name); err == nil {
+			return name
+		}
+	}
+	return time.UnixMilli(from).In(loc).Format("-07:00")
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrendBucket(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	// 2025-03-05 17:30 UTC 为北京时间 3 月 6 日（周四）01:30
+	ts := time.Date(2025, 3, 5, 17, 30, 0, 0, time.UTC)
+
+	if got := TrendBucketStart(ts, TrendDay, loc).Format(TrendDateFormat(TrendDay)); got != "2025-03-06" {
+		t.Errorf("day bucket = %s", got)
+	}
+	if got := TrendBucketStart(ts, TrendWeek, loc).Format(TrendDateFormat(TrendWeek)); got != "2025-03-03" {
+		t.Errorf("week bucket = %s", got)
+	}
+	if got := TrendBucketStart(ts, TrendHour, loc).Format(TrendDateFormat(TrendHour)); got != "2025-03-06 01:00" {
+		t.Errorf("hour bucket = %s", got)
+	}
+
+	day := int64(24 * time.Hour / time.Millisecond)
+	if got := TrendInterval(0, day/24); got != TrendMinute {
+		t.Errorf("1h interval = %s", got)
+	}
+	if got := TrendInterval(0, 30*day); got != TrendDay {
+		t.Errorf("30d interval = %s", got)
+	}
+	if got := TrendInterval(0, 365*day); got != TrendWeek {
+		t.Errorf("365d interval = %s", got)
+	}
+}
+
+func TestTrendBucketsCap(t *testing.T) {
+	day := int64(24 * time.Hour / time.Millisecond)
+	if n := TrendBuckets(0, 365*day, TrendMinute, 10); n < 5_000_000 {
+		t.Errorf("year of minutes × 10 series = %d buckets", n)
+	}
+	if err := CheckTrendBuckets(0, 365*day, TrendMinute, 10); err == nil {
+		t.Error("year of minute buckets should be rejected")
+	}
+	if err := CheckTrendBuckets(0, 365*day, TrendDay, 10); err != nil {
+		t.Errorf("year of day buckets × 10 series: %v", err)
+	}
+	if err := CheckTrendBuckets(0, 3*day/24, TrendMinute, 0); err != nil {
+		t.Errorf("3h of minutes: %v", err)
+	}
+	if got := CoarserTrendInterval(TrendHour); got != TrendDay {
+		t.Errorf("coarser than hour = %s", got)
+	}
+}
+
+func TestTrendZoneID(t *testing.T) {
+	from := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	// 缺少时区数据时的固定时区名称不是合法的 ZoneId，改用偏移
+	if got := TrendZoneID(time.FixedZone("CST", 8*3600), from); got != "+08:00" {
+		t.Errorf("fixed zone = %s", got)
+	}
+	if got := TrendZoneID(time.FixedZone("", -5*3600-1800), from); got != "-05:30" {
+		t.Errorf("negative offset = %s", got)
+	}
+	if got := TrendZoneID(time.UTC, from); got != "UTC" {
+		t.Errorf("utc = %s", got)
+	}
+	if got := TrendZoneID(time.Local, from); strings.HasPrefix(got, "Local") || len(got) != 6 {
+		t.Errorf("local = %s", got)
+	}
+	if loc, err := time.LoadLocation("Asia/Shanghai"); err == nil {
+		if got := TrendZoneID(loc, from); got != "Asia/Shanghai" {
+			t.Errorf("iana = %s", got)
+		}
+	}
+}
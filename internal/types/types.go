@@ -32,7 +32,7 @@ type SceneDetail struct {
 	Id          string  `json:"_id"`
 	RequestTime float64 `json:"request_time"`
 	Status      int     `json:"status"`
-	time        string  `json:"time"`
+	Time        string  `json:"time"`
 }
 
 type SceneCountData struct {
@@ -41,6 +41,27 @@ type SceneCountData struct {
 	SceneName  string  `json:"scene_name"`
 	SceneLabel string  `json:"scene_label"`
 	Qps        float64 `json:"qps"`
+	// token 用量，网关日志未携带时为 0
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Tps              float64 `json:"tps"` // 每秒 token 数
+}
+
+// TokenUsage 一组调用的 token 用量汇总
+type TokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	Count            int64 `json:"count"` // 参与统计的调用次数
+}
+
+// Add 累加另一组用量
+func (t *TokenUsage) Add(o TokenUsage) {
+	t.PromptTokens += o.PromptTokens
+	t.CompletionTokens += o.CompletionTokens
+	t.TotalTokens += o.TotalTokens
+	t.Count += o.Count
 }
 
 type RequestTimeResp struct {
@@ -68,10 +89,63 @@ type LogDetailResp struct {
 	Models *SceneDetailWithModel `json:"models"`
 }
 
+// InvokingTotal 场景×模型 的累计调用量
+type InvokingTotal struct {
+	Total   int64 `json:"total"`
+	Success int64 `json:"success"`
+}
+
+// LogSearchParams 请求日志检索条件，时间为毫秒时间戳，延迟单位为秒
+type LogSearchParams struct {
+	From     int64
+	To       int64
+	AuthCode string
+	// 非 nil 时仅检索这些场景，用于部门数据隔离
+	AuthCodes  []string
+	ModelName  string
+	Status     string
+	MinLatency float64
+	MaxLatency float64
+	Keyword    string
+	SortBy     string
+	Ascending  bool
+	Size       int
+	// 上一页最后一条记录的排序值，对应 ES search_after
+	SearchAfter []interface{}
+}
+
+type LogHit struct {
+	Id           string  `json:"_id"`
+	Timestamp    string  `json:"timestamp"`
+	Time         string  `json:"time"`
+	Status       string  `json:"status"`
+	RequestTime  float64 `json:"request_time"`
+	UpstreamTime float64 `json:"upstream_time"`
+	ModelName    string  `json:"model_name"`
+	SceneLabel   string  `json:"scene_label"`
+	SceneName    string  `json:"scene_name"`
+	RequestUri   string  `json:"request_uri"`
+	Path         string  `json:"path"`
+	Host         string  `json:"http_host"`
+	Request      string  `json:"request"`
+	KibanaUrl    string  `json:"kibana_url"`
+	// 当前记录的排序值，用于生成下一页游标
+	Sort []interface{} `json:"-"`
+}
+
+type LogSearchResult struct {
+	Total      int64    `json:"total"`
+	Hits       []LogHit `json:"hits"`
+	NextCursor string   `json:"next_cursor"`
+	HasNext    bool     `json:"has_next"`
+}
+
 type ModelResp struct {
-	Count     int     `json:"count"`
-	ModelName string  `json:"model_name"`
-	Qps       float64 `json:"qps"`
+	Count       int     `json:"count"`
+	ModelName   string  `json:"model_name"`
+	Qps         float64 `json:"qps"`
+	TotalTokens int64   `json:"total_tokens"`
+	Tps         float64 `json:"tps"`
 }
 
 type SceneDetailWithModel struct {
@@ -194,7 +268,52 @@ type ModelDetailResp struct {
 }
 
 type ModelDetailTrend struct {
+	// 第一条序列的按日期计数，兼容旧版前端
 	ModelDetailTrend []DateCount
+	Interval         string        `json:"interval"`
+	Timezone         string        `json:"timezone"`
+	Series           []TrendSeries `json:"series"`
+}
+
+// 趋势统计的分桶粒度
+const (
+	TrendMinute = "minute"
+	TrendHour   = "hour"
+	TrendDay    = "day"
+	TrendWeek   = "week"
+)
+
+// 多序列对比时按模型或按场景拆分
+const (
+	SeriesByModel = "model"
+	SeriesByScene = "scene"
+)
+
+// TrendParams 调用量趋势查询条件。SeriesBy 为空时只统计 AuthCode+ModelName 一条序列；
+// 为 model 时固定场景对比 Series 中的模型，为 scene 时固定模型对比 Series 中的场景
+type TrendParams struct {
+	From     int64
+	To       int64
+	Interval string
+	Location *time.Location
+	AuthCode string
+	// 非 nil 时仅统计这些场景，用于部门数据隔离
+	AuthCodes []string
+	ModelName string
+	SeriesBy  string
+	Series    []string
+}
+
+type TrendPoint struct {
+	Time  int64  `json:"time"` // 分桶起始时间，毫秒
+	Date  string `json:"date"` // 按时区格式化后的分桶时间
+	Count int64  `json:"count"`
+}
+
+type TrendSeries struct {
+	Key    string       `json:"key"`  // 模型名称或场景token
+	Name   string       `json:"name"` // 展示名称
+	Points []TrendPoint `json:"points"`
 }
 
 type DateCount struct {
@@ -218,6 +337,7 @@ type SceneInfoItem struct {
 }
 
 type ModelNodeViewDetails struct {
+	Cluster         string  `json:"cluster"`
 	Node            string  `json:"node"`
 	Label_llm_model string  `json:"label_llm_model"`
 	Resource        string  `json:"resource"`
@@ -235,5 +355,8 @@ type PagedResponseTask struct {
 }
 
 type GenerateLedgerResp struct {
+	ID         string `json:"id"`
 	LedgerName string `json:"fileName"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum"`
 }
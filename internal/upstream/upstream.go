@@ -0,0 +1,264 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monitor/config"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// 上游服务名称，指标数据源以配置的名称作为上游名称
+const (
+	DCE     = "dce"
+	ES      = "es"
+	Grafana = "grafana"
+)
+
+var (
+	// ErrUnavailable 上游暂不可用：熔断中、排队超时或请求失败，调用方可改用过期缓存
+	ErrUnavailable = errors.New("上游服务不可用")
+
+	ErrCircuitOpen = errors.New("熔断中")
+	ErrRateLimited = errors.New("超出请求速率限制")
+	ErrOverloaded  = errors.New("并发请求已满")
+)
+
+// Error 上游不可用错误，errors.Is(err, ErrUnavailable) 为 true，Unwrap 返回具体原因
+type Error struct {
+	Upstream string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %v: %v", e.Upstream, ErrUnavailable, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// 由调用方引起的错误（参数错误、未授权等）实现该接口，不计入熔断
+type clientError interface {
+	ClientError() bool
+}
+
+// 熔断状态
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// Status 上游的熔断及负载状态
+type Status struct {
+	Name           string     `json:"name"`
+	State          string     `json:"state"`
+	Failures       int        `json:"failures"` // 连续失败次数
+	InFlight       int        `json:"inFlight"`
+	MaxConcurrency int        `json:"maxConcurrency"`
+	Rejected       int64      `json:"rejected"` // 熔断、限流及并发已满拒绝的请求数
+	LastError      string     `json:"lastError,omitempty"`
+	RetryAt        *time.Time `json:"retryAt,omitempty"` // 熔断中时下一次放行探测请求的时间
+}
+
+// Guard 单个上游的并发限制、令牌桶限流与熔断
+type Guard struct {
+	name     string
+	cfg      config.UpstreamConfig
+	limiter  *rate.Limiter
+	slots    chan struct{}
+	rejected atomic.Int64
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool // 半开状态下已放行探测请求
+	lastErr  string
+	now      func() time.Time
+}
+
+// NewGuard 按配置创建，未配置的项使用默认值
+func NewGuard(name string, cfg config.UpstreamConfig) *Guard {
+	return &Guard{
+		name:    name,
+		cfg:     cfg,
+		limiter: rate.NewLimiter(rate.Limit(cfg.RateLimit), cfg.Burst),
+		slots:   make(chan struct{}, cfg.MaxConcurrency),
+		state:   StateClosed,
+		now:     time.Now,
+	}
+}
+
+var guards sync.Map // name -> *Guard
+
+// Get 返回上游对应的 Guard，配置取自 upstreams.<name>
+func Get(name string) *Guard {
+	if g, ok := guards.Load(name); ok {
+		return g.(*Guard)
+	}
+	g, _ := guards.LoadOrStore(name, NewGuard(name, config.GetUpstreamConfig(name)))
+	return g.(*Guard)
+}
+
+// All dce、es、grafana 及其他已使用的上游状态，按名称排序
+func All() []Status {
+	for _, name := range []string{DCE, ES, Grafana} {
+		Get(name)
+	}
+	statuses := make([]Status, 0)
+	guards.Range(func(_, v interface{}) bool {
+		statuses = append(statuses, v.(*Guard).Status())
+		return true
+	})
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Do 限流、占用并发槽位并检查熔断后执行 fn。熔断中或等待超过 maxWait 时立即返回 *Error；
+// fn 失败时计入熔断并同样包装为 *Error，调用方错误及取消原样返回
+func (g *Guard) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if g.rejecting() {
+		g.rejected.Add(1)
+		return &Error{Upstream: g.name, Err: ErrCircuitOpen}
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, g.cfg.MaxWait)
+	defer cancel()
+	if err := g.limiter.Wait(waitCtx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		g.rejected.Add(1)
+		return &Error{Upstream: g.name, Err: ErrRateLimited}
+	}
+	select {
+	case g.slots <- struct{}{}:
+	case <-waitCtx.Done():
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		g.rejected.Add(1)
+		return &Error{Upstream: g.name, Err: ErrOverloaded}
+	}
+	defer func() { <-g.slots }()
+
+	if err := g.allow(); err != nil {
+		g.rejected.Add(1)
+		return &Error{Upstream: g.name, Err: err}
+	}
+
+	success := false
+	defer func() {
+		// fn panic 时按失败处理，避免半开状态的探测请求一直未结束
+		if !success {
+			g.record(errors.New("panic"))
+		}
+	}()
+	err := fn(ctx)
+	success = true
+	if err == nil {
+		g.record(nil)
+		return nil
+	}
+	var ce clientError
+	if errors.Is(err, context.Canceled) || (errors.As(err, &ce) && ce.ClientError()) {
+		// 不影响熔断状态，但半开状态需要结束探测
+		g.mu.Lock()
+		g.probing = false
+		g.mu.Unlock()
+		return err
+	}
+	g.record(err)
+	return &Error{Upstream: g.name, Err: err}
+}
+
+// 熔断中且未到探测时间，或探测请求尚未结束时，不必排队直接拒绝
+func (g *Guard) rejecting() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch g.state {
+	case StateOpen:
+		return g.now().Before(g.openedAt.Add(g.cfg.OpenTimeout))
+	case StateHalfOpen:
+		return g.probing
+	}
+	return false
+}
+
+func (g *Guard) allow() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch g.state {
+	case StateOpen:
+		if g.now().Before(g.openedAt.Add(g.cfg.OpenTimeout)) {
+			return ErrCircuitOpen
+		}
+		g.state = StateHalfOpen
+		g.probing = true
+	case StateHalfOpen:
+		if g.probing {
+			return ErrCircuitOpen
+		}
+		g.probing = true
+	}
+	return nil
+}
+
+func (g *Guard) record(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.probing = false
+	if err == nil {
+		g.state = StateClosed
+		g.failures = 0
+		return
+	}
+	g.failures++
+	g.lastErr = err.Error()
+	if g.state == StateHalfOpen || g.failures >= g.cfg.FailureThreshold {
+		g.state = StateOpen
+		g.openedAt = g.now()
+	}
+}
+
+// State 当前熔断状态
+func (g *Guard) State() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state
+}
+
+func (g *Guard) Status() Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := Status{
+		Name:           g.name,
+		State:          g.state,
+		Failures:       g.failures,
+		InFlight:       len(g.slots),
+		MaxConcurrency: cap(g.slots),
+		Rejected:       g.rejected.Load(),
+		LastError:      g.lastErr,
+	}
+	if g.state == StateOpen {
+		retryAt := g.openedAt.Add(g.cfg.OpenTimeout)
+		s.RetryAt = &retryAt
+	}
+	return s
+}
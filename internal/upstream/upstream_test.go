@@ -0,0 +1,86 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"monitor/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+type badRequest struct{}
+
+func (badRequest) Error() string     { return "bad request" }
+func (badRequest) ClientError() bool { return true }
+
+func TestGuardBreaker(t *testing.T) {
+	now := time.Now()
+	g := NewGuard("es", config.UpstreamConfig{
+		MaxConcurrency: 2, RateLimit: 1000, Burst: 1000, MaxWait: time.Second,
+		FailureThreshold: 2, OpenTimeout: 30 * time.Second,
+	})
+	g.now = func() time.Time { return now }
+
+	calls := 0
+	fail := func(context.Context) error { calls++; return errors.New("timeout") }
+	ok := func(context.Context) error { calls++; return nil }
+
+	// 调用方错误不计入熔断
+	if err := g.Do(context.Background(), func(context.Context) error { return badRequest{} }); errors.Is(err, ErrUnavailable) {
+		t.Errorf("client error wrapped: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := g.Do(context.Background(), fail); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("failure should be unavailable: %v", err)
+		}
+	}
+	if g.State() != StateOpen {
+		t.Fatalf("state = %s, want open", g.State())
+	}
+	if err := g.Do(context.Background(), ok); !errors.Is(err, ErrCircuitOpen) || calls != 2 {
+		t.Errorf("open breaker should fast-fail: err = %v, calls = %d", err, calls)
+	}
+
+	// 到期后放行一个探测请求，失败则继续熔断
+	now = now.Add(31 * time.Second)
+	g.Do(context.Background(), fail)
+	if g.State() != StateOpen || calls != 3 {
+		t.Errorf("failed probe: state = %s, calls = %d", g.State(), calls)
+	}
+	now = now.Add(31 * time.Second)
+	if err := g.Do(context.Background(), ok); err != nil || g.State() != StateClosed {
+		t.Errorf("probe succeeded: err = %v, state = %s", err, g.State())
+	}
+	if s := g.Status(); s.Rejected != 1 || s.Failures != 0 || s.RetryAt != nil {
+		t.Errorf("status = %+v", s)
+	}
+}
+
+func TestGuardConcurrencyLimit(t *testing.T) {
+	g := NewGuard("dce", config.UpstreamConfig{
+		MaxConcurrency: 1, RateLimit: 1000, Burst: 1000, MaxWait: 20 * time.Millisecond,
+		FailureThreshold: 5, OpenTimeout: time.Second,
+	})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.Do(context.Background(), func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	if err := g.Do(context.Background(), func(context.Context) error { return nil }); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("err = %v, want overloaded", err)
+	}
+	close(release)
+	wg.Wait()
+	if g.Status().InFlight != 0 || g.State() != StateClosed {
+		t.Errorf("status = %+v", g.Status())
+	}
+}
@@ -8,8 +8,17 @@ import (
 	"log"
 	"monitor/config"
 	"monitor/internal/api"
+	"monitor/internal/service/artifact"
+	"monitor/internal/service/auth"
+	"monitor/internal/service/catalog"
+	"monitor/internal/service/datasource"
+	"monitor/internal/service/es"
+	"monitor/internal/service/job"
+	"monitor/internal/service/ledger"
+	"monitor/internal/service/provenance"
 	"monitor/internal/service/scene"
 	"monitor/internal/service/task"
+	"monitor/internal/service/template"
 	"time"
 )
 
@@ -19,13 +28,58 @@ func main() {
 		log.Fatalf("无法加载配置文件: %v", err)
 	}
 
+	//指标数据源配置错误时不启动，避免在首个请求时才失败
+	if err := datasource.Init(); err != nil {
+		log.Fatal(err)
+	}
+
+	//ES 连接、mock 样例及请求日志翻页字段有误时不启动，避免在请求中才失败
+	if err := es.Init(config.GetEsConfig()); err != nil {
+		log.Fatal(err)
+	}
+
 	svc := api.NewServiceContext()
 	engine := gin.Default()
-	grafanaConf := config.Grafana
-	iGrafanaService := scene.NewGrafanaService(&grafanaConf)
+	grafanaConf := config.GetGrafanaConfig()
+	//场景标签定时从 Grafana 刷新
+	scene.GetSceneRegistry(&grafanaConf).Start(context.Background())
+	//场景名称优先读取场景登记表，登记表不可用时回退到 Grafana
+	iGrafanaService := catalog.NewLabelService(scene.NewGrafanaService(&grafanaConf))
 	sc := api.NewScene(iGrafanaService)
 	ms := api.NewModelReq(iGrafanaService)
 	lg := api.NewLedger(context.Background())
+	sys := api.NewSystem()
+	sct := api.NewSceneCatalog()
+	//场景登记表定时从 DCE、Grafana 同步，需在连接数据库之后启动
+	if c := catalog.Default(); c != nil {
+		c.Start(context.Background())
+	}
+	//按保留策略清理过期的台账文件
+	if store, err := artifact.Default(); err != nil {
+		log.Printf("台账文件存储不可用: %v", err)
+	} else {
+		store.Start(context.Background())
+	}
+	//台账 xlsx 按选用的模板输出，未选用时使用内置版式
+	if templates, err := template.Default(); err != nil {
+		log.Printf("台账模板不可用，使用内置版式: %v", err)
+	} else {
+		ledger.UseTemplates(templates.Source)
+	}
+	//按台账文件的保留期限清理预览快照
+	if snapshots, err := provenance.Default(); err != nil {
+		log.Printf("台账预览快照不可用: %v", err)
+	} else {
+		snapshots.Start(context.Background())
+	}
+	//后台生成台账的任务，数据量大时生成后通知
+	if jobs, err := job.Default(); err != nil {
+		log.Printf("台账后台任务不可用: %v", err)
+	} else {
+		jobs.Start(context.Background())
+	}
+	//每日调用量汇总，用于台账累计调用量
+	ledger.NewInvokingRollup().Start(context.Background())
 	// 配置CORS中间件
 
 	//启动任务队列
@@ -82,7 +136,7 @@ func main() {
 	}))
 	{
 		monitor := engine.Group("/apis/gpu.monitor.io/monitor/list")
-		monitor.Use(api.MakeToken())
+		monitor.Use(api.MakeToken(), api.RequireRole(auth.RoleViewer))
 		monitor.GET("/clusterinfo", svc.ListCluster)
 		monitor.GET("/clustername", svc.ListClusterName)
 		monitor.GET("/nodesinfo", svc.ListNodes)
@@ -90,25 +144,68 @@ func main() {
 		monitor.GET("/nodedetail", svc.NodeDetail)
 
 		scene := engine.Group("/apis/gpu.monitor.io/scene")
-		scene.Use(api.MakeToken())
+		scene.Use(api.MakeToken(), api.RequireRole(auth.RoleViewer))
 		scene.GET("/list", sc.CountScenes)
 		scene.GET("/models", sc.CountModels)
 		scene.GET("/details", sc.CountModelDetail)
+		scene.GET("/logs", sc.SearchLogs) //请求日志检索
 
 		model := engine.Group("/apis/gpu.monitor.io/model")
-		model.Use(api.MakeToken())
+		model.Use(api.MakeToken(), api.RequireRole(auth.RoleViewer))
 		model.GET("/list", ms.ModelCards)         //外部模型列表
 		model.GET("/logs", ms.ModelLogs)          //模型对应场景详情中的Logs
 		model.GET("/timerecord", ms.ModelReqTime) //模型对应场景调用次数趋势
 		model.GET("/details", ms.ModelDetail)     //模型对应场景
 
 		ledger := engine.Group("/apis/gpu.monitor.io/ledger")
-		ledger.Use(api.MakeToken())
-		ledger.GET("/tasklist", lg.LedgerTasksList)   //任务列表
-		ledger.GET("/Preview", lg.LedgerAllInfo)      //台账预览
-		ledger.GET("/download", lg.DownloadLedger)    //下载台账
-		ledger.POST("/saveledger", lg.GenerateLedger) //生成任务，生成台账
-		ledger.POST("/savetask", lg.GenerateTask)     //生成任务，生成台账
+		ledger.Use(api.MakeToken(), api.RequireRole(auth.RoleViewer))
+		ledger.GET("/tasklist", lg.LedgerTasksList)            //任务列表
+		ledger.GET("/Preview", lg.LedgerAllInfo)               //台账预览
+		ledger.GET("/tokens", lg.TokenUsage)                   //token用量统计
+		ledger.GET("/artifacts", lg.ListArtifacts)             //已生成的台账文件
+		ledger.GET("/classes", lg.LedgerClasses)               //台账类别及可输出的格式
+		ledger.GET("/compare", lg.CompareLedger)               //周期对比
+		ledger.GET("/drafts", lg.ListDrafts)                   //待审批台账草稿
+		ledger.GET("/drafts/:id", lg.GetDraft)                 //草稿数据及操作记录
+		ledger.GET("/provenance", lg.LedgerProvenance)         //台账文件的数据来源核验结果
+		ledger.GET("/templates", lg.ListTemplates)             //台账模板版本
+		ledger.GET("/templates/starter", lg.StarterTemplate)   //下载起始模板
+		ledger.GET("/templates/:id/file", lg.DownloadTemplate) //下载模板文件
+
+		// 台账生成、下载及任务维护需要台账操作员
+		ledgerOp := ledger.Group("", api.RequireRole(auth.RoleLedgerOperator))
+		ledgerOp.GET("/download", lg.DownloadLedger)            //下载台账
+		ledgerOp.HEAD("/download", lg.DownloadLedger)           //查询台账文件大小，用于分段下载
+		ledgerOp.POST("/saveledger", lg.GenerateLedger)         //生成任务，生成台账
+		ledgerOp.POST("/savetask", lg.GenerateTask)             //生成任务，生成台账
+		ledgerOp.POST("/pack", lg.GeneratePeriodPack)           //生成周期汇总台账
+		ledgerOp.POST("/compare", lg.GenerateComparison)        //生成周期对比台账
+		ledgerOp.POST("/drafts", lg.CreateDraft)                //由监控数据生成台账草稿
+		ledgerOp.POST("/drafts/:id/adjust", lg.AdjustDraft)     //人工调整，须填写原因
+		ledgerOp.POST("/drafts/:id/annotate", lg.AnnotateDraft) //批注
+		ledgerOp.POST("/drafts/:id/finalize", lg.FinalizeDraft) //审批通过后定稿
+		ledgerOp.POST("/templates", lg.UploadTemplate)          //上传台账模板
+		ledgerOp.POST("/templates/select", lg.SelectTemplate)   //选用模板或恢复内置版式
+		ledgerOp.GET("/jobs", lg.ListJobs)                      //后台生成台账的任务，非管理员仅本人提交的
+		ledgerOp.GET("/jobs/:id", lg.GetJob)                    //任务状态及进度
+
+		// 台账审批需要台账审批人，生成人不能审批自己的草稿
+		ledgerApprove := ledger.Group("", api.RequireRole(auth.RoleLedgerApprover))
+		ledgerApprove.POST("/drafts/:id/approve", lg.ApproveDraft) //审核通过
+		ledgerApprove.POST("/drafts/:id/reject", lg.RejectDraft)   //驳回
+
+		// 健康检查供探针及监控使用，不需要认证
+		engine.GET("/apis/gpu.monitor.io/health", sys.Health)
+
+		system := engine.Group("/apis/gpu.monitor.io/system")
+		system.Use(api.MakeToken(), api.RequireRole(auth.RoleAdmin))
+		system.GET("/cache/stats", sys.CacheStats)                        //查询缓存命中统计
+		system.POST("/scenes/refresh", sc.RefreshSceneLabels)             //立即刷新场景标签
+		system.GET("/scenes", sct.ListScenes)                             //场景登记表
+		system.POST("/scenes/sync", sct.SyncScenes)                       //立即同步场景登记表
+		system.GET("/scenes/:id/history", sct.SceneHistory)               //场景变更历史
+		system.PUT("/scenes/:id/overrides", sct.SetOverride)              //人工修正场景字段
+		system.DELETE("/scenes/:id/overrides/:field", sct.DeleteOverride) //撤销人工修正
 	}
 	addr := fmt.Sprintf(":%d", config.GetServerConfig().Port)
 
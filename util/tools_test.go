@@ -70,3 +70,12 @@ func TestGetMinit(t *testing.T) {
 		fmt.Println(":sdfs")
 	}
 }
+
+func TestRatePerSecond(t *testing.T) {
+	if got := RatePerSecond(3000, 0, 2000); got != 1500 {
+		t.Errorf("RatePerSecond = %v, want 1500", got)
+	}
+	if got := RatePerSecond(100, 1000, 1000); got != 0 {
+		t.Errorf("RatePerSecond on empty range = %v, want 0", got)
+	}
+}
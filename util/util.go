@@ -59,6 +59,15 @@ func RoundFloat64(val float64) float64 {
 	return math.Round(val*100) / 100
 }
 
+// RatePerSecond 毫秒时间范围内的每秒速率，保留两位小数
+func RatePerSecond(total int64, from, to int64) float64 {
+	seconds := float64(to-from) / 1000
+	if seconds <= 0 {
+		return 0
+	}
+	return RoundFloat64(float64(total) / seconds)
+}
+
 func CalculateP50P90P95(data []float64) (p50, p90, p95 float64, err error) {
 	percentilesMap, err := Percentiles(data, 50, 90, 95)
 	if err != nil {
@@ -397,3 +406,19 @@ func DayTomill(days int) int64 {
 	milliseconds := int64(days) * 86400 * 1000
 	return milliseconds
 }
+
+// LoadLocation 加载时区，运行环境缺少时区数据时 Asia/Shanghai 退化为固定 UTC+8；
+// 固定时区不是合法的 IANA 名称，传给 ES 等外部系统时使用 types.TrendZoneID
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		name = "Asia/Shanghai"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		if name == "Asia/Shanghai" {
+			return time.FixedZone("CST", 8*3600), nil
+		}
+		return nil, fmt.Errorf("无效的时区 %s: %w", name, err)
+	}
+	return loc, nil
+}